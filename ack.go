@@ -0,0 +1,306 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxAckQueue is how many events an AckSubscription holds in memory for
+// delivery. Further persisted events wait on disk only, and are read back
+// as the queue drains.
+const maxAckQueue = 1024
+
+// AckEvent is a StreamEvent delivered by an AckSubscription. It stays
+// pending, and is delivered again after a restart, until Ack is called.
+type AckEvent struct {
+	StreamEvent
+	Redelivered bool // loaded from disk after a restart
+
+	seq uint64 // 0 for events that are not persisted
+	sub *AckSubscription
+}
+
+// Ack marks the event as processed and advances the subscription's cursor
+// past it. Acking an event twice is harmless.
+func (e AckEvent) Ack() error {
+	if e.seq == 0 || e.sub == nil {
+		return nil
+	}
+	return e.sub.ack(e.seq)
+}
+
+// AckSubscription gives at-least-once delivery of StreamEvents: every
+// event is written to its directory before it is delivered and removed only
+// when acknowledged, so events a consumer had not finished with when the
+// process stopped are delivered again on the next start. Events are
+// delivered in order; several may be in flight, and the cursor (the oldest
+// unacknowledged event) advances as they are acked.
+//
+// audio_ready and video_ready events are delivered but not persisted,
+// since the capture reader they carry cannot outlive the process.
+type AckSubscription struct {
+	dir string
+	out chan AckEvent
+
+	mu      sync.Mutex
+	pending map[uint64]bool
+	seq     uint64 // last assigned sequence number
+
+	backlog []uint64 // persisted events found at open, delivered first
+}
+
+// NewAckSubscription opens the subscription state stored in dir, creating
+// it if needed. Events left unacknowledged by a previous process are
+// delivered before any new event. Each consumer needs its own dir.
+func NewAckSubscription(dir string) (*AckSubscription, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("ack subscription: create dir: %w", err)
+	}
+	s := &AckSubscription{
+		dir:     dir,
+		out:     make(chan AckEvent, streamEventBufSize),
+		pending: make(map[uint64]bool),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load finds the unacknowledged events of a previous run. They are read
+// when their turn for delivery comes. Partial writes the run left behind
+// are removed.
+func (s *AckSubscription) load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("ack subscription: read dir: %w", err)
+	}
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".tmp") {
+			if err := os.Remove(filepath.Join(s.dir, e.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("ack subscription: remove partial write: %w", err)
+			}
+			continue
+		}
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if e.IsDir() || !ok {
+			continue
+		}
+		seq, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		s.backlog = append(s.backlog, seq)
+		s.pending[seq] = true
+		s.seq = max(s.seq, seq)
+	}
+	sort.Slice(s.backlog, func(i, j int) bool { return s.backlog[i] < s.backlog[j] })
+	return nil
+}
+
+// Events returns the channel events are delivered on. It is closed when
+// the source passed to Run is closed and drained, or Run's ctx is done.
+func (s *AckSubscription) Events() <-chan AckEvent {
+	return s.out
+}
+
+// Pending returns the number of persisted events not yet acknowledged.
+func (s *AckSubscription) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
+
+// Run persists every event from events and delivers it on Events until
+// events is closed or ctx is done. Persisting never waits for the consumer;
+// events queue up on disk until they can be delivered, with at most 1024
+// held in memory. Call Run once. Captures of audio_ready and video_ready
+// events not yet delivered when ctx is done are released.
+func (s *AckSubscription) Run(ctx context.Context, events <-chan StreamEvent) {
+	defer close(s.out)
+	var queue []AckEvent // in memory, delivered first
+	var spill []spilled  // behind queue, in order
+	for _, seq := range s.backlog {
+		spill = append(spill, spilled{seq: seq, redelivered: true})
+	}
+	s.backlog = nil
+
+	for events != nil || len(queue) > 0 || len(spill) > 0 {
+		for len(queue) < maxAckQueue && len(spill) > 0 {
+			if aev, ok := s.unspill(spill[0]); ok {
+				queue = append(queue, aev)
+			}
+			spill = spill[1:]
+		}
+		var out chan<- AckEvent
+		var head AckEvent
+		if len(queue) > 0 {
+			out, head = s.out, queue[0]
+		}
+		select {
+		case <-ctx.Done():
+			for _, aev := range queue {
+				releaseStreams(aev.StreamEvent)
+			}
+			for _, e := range spill {
+				if e.ev != nil {
+					releaseStreams(e.ev.StreamEvent)
+				}
+			}
+			return
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			aev, err := s.persist(ev)
+			if err != nil {
+				// Still deliver it; only the restart guarantee is lost.
+				slog.Error("ack subscription: failed to persist event",
+					"type", ev.Type, "room_id", ev.RoomID, "error", err)
+			}
+			switch {
+			case len(queue) < maxAckQueue && len(spill) == 0:
+				queue = append(queue, aev)
+			case aev.seq != 0:
+				spill = append(spill, spilled{seq: aev.seq})
+			default:
+				spill = append(spill, spilled{seq: aev.seq, ev: &aev})
+			}
+		case out <- head:
+			queue = queue[1:]
+		}
+	}
+}
+
+// spilled is an event queued behind the in-memory queue: a persisted one
+// by its sequence number only, or one that is not persisted in full.
+type spilled struct {
+	seq         uint64
+	ev          *AckEvent // nil if persisted
+	redelivered bool      // left by a previous run
+}
+
+// unspill returns the event of e, reading it back from disk if it was
+// persisted. It reports false for an event that can no longer be read.
+func (s *AckSubscription) unspill(e spilled) (AckEvent, bool) {
+	if e.ev != nil {
+		return *e.ev, true
+	}
+	ev, err := s.read(e.seq)
+	if err != nil {
+		slog.Error("ack subscription: failed to read queued event", "seq", e.seq, "error", err)
+		return AckEvent{}, false
+	}
+	ev.Redelivered = e.redelivered
+	return ev, true
+}
+
+// read loads the persisted event seq.
+func (s *AckSubscription) read(seq uint64) (AckEvent, error) {
+	data, err := os.ReadFile(s.eventPath(seq))
+	if err != nil {
+		return AckEvent{}, fmt.Errorf("ack subscription: read event: %w", err)
+	}
+	var ev StreamEvent
+	if err := json.Unmarshal(data, &ev); err != nil {
+		return AckEvent{}, fmt.Errorf("ack subscription: parse event %d: %w", seq, err)
+	}
+	return AckEvent{StreamEvent: ev, seq: seq, sub: s}, nil
+}
+
+// persist writes ev to disk and assigns its sequence number.
+func (s *AckSubscription) persist(ev StreamEvent) (AckEvent, error) {
+	aev := AckEvent{StreamEvent: ev, sub: s}
+	if ev.Type == EventAudioReady || ev.Type == EventVideoReady {
+		return aev, nil
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return aev, fmt.Errorf("ack subscription: encode event: %w", err)
+	}
+
+	s.mu.Lock()
+	s.seq++
+	seq := s.seq
+	s.mu.Unlock()
+
+	path := s.eventPath(seq)
+	tmp := path + ".tmp"
+	if err := writeFileSync(tmp, data); err != nil {
+		return aev, fmt.Errorf("ack subscription: write event: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return aev, fmt.Errorf("ack subscription: write event: %w", err)
+	}
+
+	s.mu.Lock()
+	s.pending[seq] = true
+	s.mu.Unlock()
+	aev.seq = seq
+	return aev, nil
+}
+
+// ack removes an acknowledged event from disk.
+func (s *AckSubscription) ack(seq uint64) error {
+	s.mu.Lock()
+	if !s.pending[seq] {
+		s.mu.Unlock()
+		return nil
+	}
+	delete(s.pending, seq)
+	s.mu.Unlock()
+
+	if err := os.Remove(s.eventPath(seq)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("ack subscription: remove event: %w", err)
+	}
+	return nil
+}
+
+// writeFileSync writes data to a new file at path and flushes it to disk,
+// so a rename of the file cannot expose a torn write after a crash.
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if syncErr := f.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (s *AckSubscription) eventPath(seq uint64) string {
+	// Zero-padded so directory listings sort in delivery order.
+	return filepath.Join(s.dir, fmt.Sprintf("%020d.json", seq))
+}
+
+// SubscribeAcked is like Subscribe, but delivers events with at-least-once
+// semantics through an AckSubscription stored in dir: each event must be
+// acknowledged with Ack, and unacknowledged events are delivered again
+// when the subscription is reopened after a restart.
+func (c *StreamClient) SubscribeAcked(ctx context.Context, roomIDs []int64, dir string) (<-chan AckEvent, error) {
+	sub, err := NewAckSubscription(dir)
+	if err != nil {
+		return nil, err
+	}
+	events, err := c.Subscribe(ctx, roomIDs)
+	if err != nil {
+		return nil, err
+	}
+	go sub.Run(ctx, events)
+	return sub.Events(), nil
+}
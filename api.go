@@ -3,7 +3,9 @@ package stream
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 )
 
@@ -11,9 +13,9 @@ const (
 	userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
 	referer   = "https://live.bilibili.com/"
 
-	roomInitURL  = "https://api.live.bilibili.com/room/v1/Room/room_init?id=%d"
-	roomInfoURL  = "https://api.live.bilibili.com/room/v1/Room/get_info?room_id=%d"
-	playURL      = "https://api.live.bilibili.com/room/v1/Room/playUrl?cid=%d&quality=4&platform=web"
+	roomInitURL = "https://api.live.bilibili.com/room/v1/Room/room_init?id=%d"
+	roomInfoURL = "https://api.live.bilibili.com/room/v1/Room/get_info?room_id=%d"
+	playURL     = "https://api.live.bilibili.com/room/v1/Room/playUrl?cid=%d&qn=%d&platform=web"
 )
 
 // apiResponse is the common envelope for Bilibili API responses.
@@ -21,36 +23,124 @@ type apiResponse struct {
 	Code    int             `json:"code"`
 	Message string          `json:"message"`
 	Data    json.RawMessage `json:"data"`
+
+	endpoint string // request URL path, for schema drift reports
+}
+
+// APIError is returned when Bilibili responds with a non-zero code in the
+// API envelope.
+type APIError struct {
+	Code    int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("api error %d: %s", e.Code, e.Message)
 }
 
-// doGet performs an authenticated GET request and decodes the API envelope.
+// doGet performs an authenticated GET request with the APIClient attached
+// to ctx, or the default client, and decodes the API envelope. cookie, if
+// not empty, replaces the client's cookie.
 func doGet(ctx context.Context, url string, cookie string) (*apiResponse, error) {
+	return apiClientFrom(ctx).get(ctx, url, cookie)
+}
+
+// getAuthenticated performs a GET request without retries. RequestOptions
+// attached to ctx override the cookie and user agent and may route the
+// request through a proxy. If the cookie is rejected as logged out,
+// RefreshCredentials from ctx is asked for a new one and the request is
+// retried once; otherwise ErrCredentialsExpired is returned. Device cookies
+// are added (see WithAPIBuvid), and endpoints that require it are
+// WBI-signed.
+func (c *APIClient) getAuthenticated(ctx context.Context, url string, cookie string) (*apiResponse, error) {
+	opts, _ := RequestOptionsFromContext(ctx)
+	if opts.Cookie != "" {
+		cookie = opts.Cookie
+	}
+	if opts.UserAgent == "" {
+		opts.UserAgent = c.cfg.userAgent
+	}
+	if c.cfg.extraCookies != "" && cookie == c.cfg.cookie {
+		// A Cookie header attached to ctx replaces the client's.
+		opts = RequestOptions{Headers: map[string]string{"Cookie": c.cfg.extraCookies}}.merge(opts)
+	}
+	opts = c.withFingerprint(ctx, opts)
+	url, signed := c.signWBI(ctx, url, opts)
+
+	apiResp, err := c.getOnce(ctx, url, cookie, opts)
+	if signed && isRiskControl(err) {
+		c.wbi.invalidate() // the keys may have rotated
+	}
+	if opts.onResult != nil {
+		opts.onResult(cookie, err)
+	}
+	var apiErr *APIError
+	if cookie == "" || !errors.As(err, &apiErr) || apiErr.Code != codeNotLoggedIn {
+		return apiResp, err
+	}
+	if opts.RefreshCredentials == nil {
+		return nil, opts.expired(cookie, fmt.Errorf("%w: %w", ErrCredentialsExpired, err))
+	}
+
+	slog.Warn("api: cookie rejected, refreshing credentials", "url", url)
+	fresh, refreshErr := opts.RefreshCredentials(ctx, cookie)
+	if refreshErr != nil {
+		return nil, opts.expired(cookie, fmt.Errorf("%w: refresh: %w", ErrCredentialsExpired, refreshErr))
+	}
+	apiResp, err = c.getOnce(ctx, url, fresh, opts)
+	if opts.onResult != nil {
+		opts.onResult(fresh, err)
+	}
+	if errors.As(err, &apiErr) && apiErr.Code == codeNotLoggedIn {
+		return nil, opts.expired(fresh, fmt.Errorf("%w: refreshed cookie rejected: %w", ErrCredentialsExpired, err))
+	}
+	return apiResp, err
+}
+
+// getOnce performs a single GET request with the given cookie. An
+// *APIError is returned along with the decoded envelope, since some
+// endpoints fill data regardless (nav reports the WBI keys logged out).
+func (c *APIClient) getOnce(ctx context.Context, url string, cookie string, opts RequestOptions) (*apiResponse, error) {
+	client, err := httpClientFor(opts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy: %w", err)
+	}
+	if c.cfg.httpClient != nil && opts.Proxy == "" && opts.Resolver == nil {
+		client = c.cfg.httpClient
+	}
+
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
-	req.Header.Set("User-Agent", userAgent)
-	req.Header.Set("Referer", referer)
-	if cookie != "" {
-		req.Header.Set("Cookie", "SESSDATA="+cookie)
+	headers, err := requestHeaders(opts, cookie)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	if opts.TraceID != "" {
+		slog.Debug("api: request", "url", url, "trace_id", opts.TraceID)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("http get: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("http status %d", resp.StatusCode)
+		return nil, &httpStatusError{code: resp.StatusCode}
 	}
 
 	var apiResp apiResponse
 	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
 		return nil, fmt.Errorf("decode response: %w", err)
 	}
+	apiResp.endpoint = req.URL.Path
 	if apiResp.Code != 0 {
-		return nil, fmt.Errorf("api error %d: %s", apiResp.Code, apiResp.Message)
+		return &apiResp, &APIError{Code: apiResp.Code, Message: apiResp.Message}
 	}
 	return &apiResp, nil
 }
@@ -66,7 +156,7 @@ func ResolveRoomID(ctx context.Context, shortID int64) (int64, error) {
 	var data struct {
 		RoomID int64 `json:"room_id"`
 	}
-	if err := json.Unmarshal(apiResp.Data, &data); err != nil {
+	if err := decodeData(apiResp, &data); err != nil {
 		return 0, fmt.Errorf("parse room_init: %w", err)
 	}
 	return data.RoomID, nil
@@ -86,10 +176,19 @@ func GetRoomInfo(ctx context.Context, roomID int64) (*RoomInfo, error) {
 		LiveStatus int    `json:"live_status"`
 		Title      string `json:"title"`
 		LiveTime   string `json:"live_time"`
+		Online     int64  `json:"online"`
+		Tags       string `json:"tags"`
+		UserCover  string `json:"user_cover"`
+
+		AreaID         int    `json:"area_id"`
+		AreaName       string `json:"area_name"`
+		ParentAreaID   int    `json:"parent_area_id"`
+		ParentAreaName string `json:"parent_area_name"`
 	}
-	if err := json.Unmarshal(apiResp.Data, &data); err != nil {
+	if err := decodeData(apiResp, &data); err != nil {
 		return nil, fmt.Errorf("parse room info: %w", err)
 	}
+	idCache.store(data.UID, data.RoomID)
 
 	return &RoomInfo{
 		RoomID:     data.RoomID,
@@ -98,27 +197,38 @@ func GetRoomInfo(ctx context.Context, roomID int64) (*RoomInfo, error) {
 		LiveStatus: data.LiveStatus,
 		Title:      data.Title,
 		LiveTime:   data.LiveTime,
+		Online:     data.Online,
+		Tags:       parseTags(data.Tags),
+		Cover:      data.UserCover,
+
+		AreaID:         data.AreaID,
+		AreaName:       data.AreaName,
+		ParentAreaID:   data.ParentAreaID,
+		ParentAreaName: data.ParentAreaName,
 	}, nil
 }
 
 // GetStreamURL fetches the FLV stream URL for a live room.
 // Returns an error if the room is not currently live.
 func GetStreamURL(ctx context.Context, roomID int64) (string, error) {
-	apiResp, err := doGet(ctx, fmt.Sprintf(playURL, roomID), "")
+	urls, err := GetStreamURLs(ctx, roomID)
 	if err != nil {
-		return "", fmt.Errorf("get stream url: %w", err)
+		return "", err
 	}
+	return urls[0], nil
+}
 
-	var data struct {
-		Durl []struct {
-			URL string `json:"url"`
-		} `json:"durl"`
-	}
-	if err := json.Unmarshal(apiResp.Data, &data); err != nil {
-		return "", fmt.Errorf("parse play url: %w", err)
-	}
-	if len(data.Durl) == 0 {
-		return "", fmt.Errorf("no stream urls returned (room may be offline)")
+// GetStreamURLs fetches all candidate FLV stream URLs for a live room at
+// the best quality available (see GetPlayURLs). Candidates are typically
+// served by different CDN hosts, in Bilibili's order of preference.
+// Returns an error if the room is not currently live.
+//
+// Member-only (大航海专属) streams require the cookie of a qualifying account
+// (see WithRequestOptions); otherwise a *GuardRequiredError is returned.
+func GetStreamURLs(ctx context.Context, roomID int64) ([]string, error) {
+	play, err := GetPlayURLs(ctx, roomID, QualityOriginal)
+	if err != nil {
+		return nil, err
 	}
-	return data.Durl[0].URL, nil
+	return play.URLs, nil
 }
@@ -0,0 +1,257 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Retry defaults for RetryPolicy.
+const (
+	defaultAPIRetryBackoff    = time.Second
+	defaultAPIRetryMaxBackoff = 30 * time.Second
+)
+
+// Limiter paces API requests. Wait blocks until a request may be made, or
+// returns ctx's error once ctx is done.
+type Limiter interface {
+	Wait(ctx context.Context) error
+}
+
+// RetryPolicy controls how an APIClient retries requests that failed for
+// transient reasons: network errors and HTTP 429 and 5xx responses. API
+// errors and risk control rejections (HTTP 412) are not retried, as
+// repeating them only prolongs a ban.
+type RetryPolicy struct {
+	MaxAttempts int           // attempts including the first; 0 or 1 disables retries
+	Backoff     time.Duration // delay before the first retry, doubling after each; default 1s
+	MaxBackoff  time.Duration // upper bound of the delay; default 30s
+}
+
+// delay returns the wait before retry number attempt (1-based).
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d, limit := p.Backoff, p.MaxBackoff
+	if d <= 0 {
+		d = defaultAPIRetryBackoff
+	}
+	if limit <= 0 {
+		limit = defaultAPIRetryMaxBackoff
+	}
+	for i := 1; i < attempt && d < limit; i++ {
+		d *= 2
+	}
+	return min(d, limit)
+}
+
+// apiClientConfig holds internal configuration for APIClient.
+type apiClientConfig struct {
+	cookie       string
+	extraCookies string // cookies besides SESSDATA (WithAPICredentials)
+	userAgent    string
+	httpClient   *http.Client
+	limiter      Limiter
+	ownLimiter   bool // limiter was made by WithRateLimit
+	retry        RetryPolicy
+	buvid        BuvidMode
+	clock        Clock
+}
+
+// APIClientOption configures an APIClient.
+type APIClientOption func(*apiClientConfig)
+
+// WithAPICookie sets the SESSDATA cookie sent with the client's requests.
+// A cookie in RequestOptions attached to the request context takes
+// priority.
+func WithAPICookie(sessdata string) APIClientOption {
+	return func(c *apiClientConfig) {
+		c.cookie = sessdata
+	}
+}
+
+// WithAPICredentials sends the full cookie set of a login with the
+// client's requests; see Credentials. A cookie in RequestOptions attached
+// to the request context takes priority, and the other cookies are then
+// not sent.
+func WithAPICredentials(creds Credentials) APIClientOption {
+	return func(c *apiClientConfig) {
+		c.cookie = creds.SESSDATA
+		c.extraCookies = creds.otherCookies()
+	}
+}
+
+// WithAPIUserAgent sets the User-Agent of the client's requests, unless
+// RequestOptions attached to the request context set one.
+func WithAPIUserAgent(ua string) APIClientOption {
+	return func(c *apiClientConfig) {
+		c.userAgent = ua
+	}
+}
+
+// WithAPIHTTPClient sends the client's requests with hc, e.g. one with a
+// test transport. Requests routed through a proxy or Resolver from
+// RequestOptions use the library's transports instead. Default is
+// http.DefaultClient.
+func WithAPIHTTPClient(hc *http.Client) APIClientOption {
+	return func(c *apiClientConfig) {
+		c.httpClient = hc
+	}
+}
+
+// WithAPILimiter paces the client's requests with l, including retries.
+func WithAPILimiter(l Limiter) APIClientOption {
+	return func(c *apiClientConfig) {
+		c.limiter, c.ownLimiter = l, false
+	}
+}
+
+// WithAPIRetry retries the client's transiently failed requests as
+// described by p. Requests are not retried by default.
+func WithAPIRetry(p RetryPolicy) APIClientOption {
+	return func(c *apiClientConfig) {
+		c.retry = p
+	}
+}
+
+// WithAPIClock sets the clock timing the client's retry backoff, WBI key
+// expiry and the limiter of WithRateLimit. Default is SystemClock().
+func WithAPIClock(clock Clock) APIClientOption {
+	return func(c *apiClientConfig) {
+		c.clock = clock
+	}
+}
+
+// APIClient makes Bilibili API requests with its own cookie, user agent,
+// HTTP client, rate limiter and retry policy, so that several accounts or
+// test doubles can be used in one process.
+//
+// The package-level API functions (GetRoomInfo, GetPlayURLs,
+// GetRoomPlayInfo and so on) are thin wrappers: they use the APIClient
+// attached to their context with Context, else the default client
+// (DefaultAPIClient). The methods below are shorthands that attach c
+// first. Monitor and StreamClient use an APIClient given with
+// WithAPIClient or WithClientAPIClient.
+//
+// An APIClient is safe for concurrent use.
+type APIClient struct {
+	cfg   apiClientConfig
+	wbi   wbiCache
+	buvid buvidCache
+}
+
+// NewAPIClient creates an APIClient with the given options. Without
+// options it behaves like the default client.
+func NewAPIClient(opts ...APIClientOption) *APIClient {
+	var cfg apiClientConfig
+	for _, o := range opts {
+		o(&cfg)
+	}
+	if cfg.clock == nil {
+		cfg.clock = SystemClock()
+	}
+	if rl, ok := cfg.limiter.(*RateLimiter); ok && cfg.ownLimiter {
+		rl.clock = cfg.clock
+	}
+	return &APIClient{cfg: cfg}
+}
+
+var defaultAPIClient atomic.Pointer[APIClient]
+
+func init() {
+	defaultAPIClient.Store(NewAPIClient())
+}
+
+// DefaultAPIClient returns the client used by API requests whose context
+// carries none.
+func DefaultAPIClient() *APIClient {
+	return defaultAPIClient.Load()
+}
+
+// SetDefaultAPIClient replaces the default client, e.g. to rate limit all
+// of the process's API traffic. A nil c restores an unconfigured client.
+func SetDefaultAPIClient(c *APIClient) {
+	if c == nil {
+		c = NewAPIClient()
+	}
+	defaultAPIClient.Store(c)
+}
+
+type apiClientKey struct{}
+
+// Context returns a copy of ctx carrying c, so that API requests made with
+// it, including those of package-level functions, go through c.
+func (c *APIClient) Context(ctx context.Context) context.Context {
+	return context.WithValue(ctx, apiClientKey{}, c)
+}
+
+// apiClientFrom returns the APIClient attached to ctx, or the default.
+func apiClientFrom(ctx context.Context) *APIClient {
+	if c, ok := ctx.Value(apiClientKey{}).(*APIClient); ok {
+		return c
+	}
+	return DefaultAPIClient()
+}
+
+// ResolveRoomID is ResolveRoomID using c.
+func (c *APIClient) ResolveRoomID(ctx context.Context, shortID int64) (int64, error) {
+	return ResolveRoomID(c.Context(ctx), shortID)
+}
+
+// GetRoomInfo is GetRoomInfo using c.
+func (c *APIClient) GetRoomInfo(ctx context.Context, roomID int64) (*RoomInfo, error) {
+	return GetRoomInfo(c.Context(ctx), roomID)
+}
+
+// GetStreamURL is GetStreamURL using c.
+func (c *APIClient) GetStreamURL(ctx context.Context, roomID int64) (string, error) {
+	return GetStreamURL(c.Context(ctx), roomID)
+}
+
+// GetStreamURLs is GetStreamURLs using c.
+func (c *APIClient) GetStreamURLs(ctx context.Context, roomID int64) ([]string, error) {
+	return GetStreamURLs(c.Context(ctx), roomID)
+}
+
+// GetPlayURLs is GetPlayURLs using c.
+func (c *APIClient) GetPlayURLs(ctx context.Context, roomID int64, qn int) (*PlayURLs, error) {
+	return GetPlayURLs(c.Context(ctx), roomID, qn)
+}
+
+// get performs a GET request with the client's settings, paced by its
+// limiter and the process's (SetRateLimit), retrying transient failures
+// according to its RetryPolicy. cookie, if not empty, replaces the
+// client's cookie.
+func (c *APIClient) get(ctx context.Context, url, cookie string) (*apiResponse, error) {
+	if cookie == "" {
+		cookie = c.cfg.cookie
+	}
+	for attempt := 1; ; attempt++ {
+		apiResp, err := c.paced(ctx, func() (*apiResponse, error) {
+			return c.getAuthenticated(ctx, url, cookie)
+		})
+		if err == nil || attempt >= c.cfg.retry.MaxAttempts || !isTransientAPIError(err) || !retrying(ctx) || ctx.Err() != nil {
+			return apiResp, err
+		}
+		delay := c.cfg.retry.delay(attempt)
+		slog.Debug("api: request failed, retrying", "url", url, "attempt", attempt, "delay", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-c.cfg.clock.After(delay):
+		}
+	}
+}
+
+// isTransientAPIError reports whether a failed request may succeed when
+// repeated: network errors and HTTP 429 and 5xx responses.
+func isTransientAPIError(err error) bool {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code == http.StatusTooManyRequests || statusErr.code >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
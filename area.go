@@ -0,0 +1,51 @@
+package stream
+
+import "strings"
+
+// virtualParentArea is the parent area of virtual streamers (VTubers).
+const virtualParentArea = "虚拟主播"
+
+// AreaHints are routing hints derived from a room's live area (分区), e.g.
+// for sending rooms to the right speech-to-text model.
+type AreaHints struct {
+	Area       string `json:"area"`        // sub-area name, e.g. "虚拟日常"
+	ParentArea string `json:"parent_area"` // parent area name, e.g. "虚拟主播"
+	Virtual    bool   `json:"virtual"`     // the parent area is 虚拟主播
+	Language   string `json:"language"`    // BCP 47 language tag inferred from the area names, or ""
+}
+
+// areaLanguages maps keywords in area names to language tags. Areas
+// without a keyword give no language hint rather than assuming Chinese.
+var areaLanguages = []struct {
+	keyword string
+	lang    string
+}{
+	{"英语", "en"},
+	{"英文", "en"},
+	{"日语", "ja"},
+	{"日本", "ja"},
+	{"韩语", "ko"},
+	{"韩国", "ko"},
+	{"粤语", "yue"},
+	{"俄语", "ru"},
+	{"法语", "fr"},
+	{"德语", "de"},
+	{"西班牙语", "es"},
+}
+
+// NewAreaHints derives hints from a room's sub-area and parent area names,
+// as returned in RoomInfo.
+func NewAreaHints(area, parentArea string) AreaHints {
+	h := AreaHints{
+		Area:       area,
+		ParentArea: parentArea,
+		Virtual:    parentArea == virtualParentArea,
+	}
+	for _, al := range areaLanguages {
+		if strings.Contains(area, al.keyword) || strings.Contains(parentArea, al.keyword) {
+			h.Language = al.lang
+			break
+		}
+	}
+	return h
+}
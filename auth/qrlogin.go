@@ -0,0 +1,309 @@
+// Package auth implements Bilibili's QR code login, so headless programs
+// such as recorder daemons can obtain stream.Credentials without copying
+// cookies out of a browser.
+//
+// The flow: GenerateQR returns a URL to show as a QR code; the user scans
+// it with the Bilibili app and confirms; WaitLogin (or repeated Poll calls)
+// then returns the account's cookies.
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	stream "github.com/MatchaCake/bilibili_stream_lib"
+)
+
+const (
+	qrGenerateURL = "https://passport.bilibili.com/x/passport-login/web/qrcode/generate"
+	qrPollURL     = "https://passport.bilibili.com/x/passport-login/web/qrcode/poll?qrcode_key=%s"
+
+	defaultUserAgent    = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	defaultReferer      = "https://passport.bilibili.com/login"
+	defaultPollInterval = 2 * time.Second
+)
+
+// Poll codes of the qrcode/poll endpoint.
+const (
+	codeConfirmed  = 0
+	codeExpired    = 86038
+	codeScanned    = 86090
+	codeNotScanned = 86101
+)
+
+// ErrQRExpired is returned when a QR code was not confirmed in time (about
+// three minutes). Generate a new one.
+var ErrQRExpired = errors.New("auth: QR code expired")
+
+// Status is the state of a QR login.
+type Status int
+
+const (
+	StatusWaiting   Status = iota // not scanned yet
+	StatusScanned                 // scanned, waiting for confirmation in the app
+	StatusConfirmed               // confirmed; the login's cookies are available
+	StatusExpired                 // the QR code expired
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusWaiting:
+		return "waiting"
+	case StatusScanned:
+		return "scanned"
+	case StatusConfirmed:
+		return "confirmed"
+	case StatusExpired:
+		return "expired"
+	}
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+// QRCode is a pending QR login.
+type QRCode struct {
+	URL string // encode this as the QR code shown to the user
+	Key string // qrcode_key, identifies the login when polling
+}
+
+// Result is the outcome of a poll.
+type Result struct {
+	Status Status
+
+	// Credentials and RefreshToken are set when Status is
+	// StatusConfirmed. RefreshToken renews the cookies once they expire;
+	// store it along with them.
+	Credentials  stream.Credentials
+	RefreshToken string
+}
+
+// config holds internal configuration for Client.
+type config struct {
+	httpClient   *http.Client
+	userAgent    string
+	pollInterval time.Duration
+}
+
+// Option configures a Client.
+type Option func(*config)
+
+// WithHTTPClient sets the HTTP client used for login requests. Default is
+// http.DefaultClient.
+func WithHTTPClient(c *http.Client) Option {
+	return func(cfg *config) {
+		cfg.httpClient = c
+	}
+}
+
+// WithUserAgent sets the User-Agent of login requests. Default is a
+// desktop browser's.
+func WithUserAgent(ua string) Option {
+	return func(cfg *config) {
+		cfg.userAgent = ua
+	}
+}
+
+// WithPollInterval sets how often WaitLogin polls. Default is 2 seconds.
+func WithPollInterval(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.pollInterval = d
+	}
+}
+
+// Client performs QR code logins.
+type Client struct {
+	cfg config
+}
+
+// NewClient creates a Client with the given options.
+func NewClient(opts ...Option) *Client {
+	cfg := config{
+		httpClient:   http.DefaultClient,
+		userAgent:    defaultUserAgent,
+		pollInterval: defaultPollInterval,
+	}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	if cfg.pollInterval <= 0 {
+		cfg.pollInterval = defaultPollInterval
+	}
+	return &Client{cfg: cfg}
+}
+
+// GenerateQR starts a login and returns its QR code.
+func (c *Client) GenerateQR(ctx context.Context) (*QRCode, error) {
+	var data struct {
+		URL       string `json:"url"`
+		QRCodeKey string `json:"qrcode_key"`
+	}
+	if _, err := c.get(ctx, qrGenerateURL, &data); err != nil {
+		return nil, fmt.Errorf("generate QR code: %w", err)
+	}
+	if data.URL == "" || data.QRCodeKey == "" {
+		return nil, errors.New("generate QR code: empty url or qrcode_key")
+	}
+	return &QRCode{URL: data.URL, Key: data.QRCodeKey}, nil
+}
+
+// Poll checks the state of the login identified by key once.
+func (c *Client) Poll(ctx context.Context, key string) (*Result, error) {
+	var data struct {
+		URL          string `json:"url"`
+		RefreshToken string `json:"refresh_token"`
+		Code         int    `json:"code"`
+		Message      string `json:"message"`
+	}
+	resp, err := c.get(ctx, fmt.Sprintf(qrPollURL, url.QueryEscape(key)), &data)
+	if err != nil {
+		return nil, fmt.Errorf("poll QR login: %w", err)
+	}
+	switch data.Code {
+	case codeNotScanned:
+		return &Result{Status: StatusWaiting}, nil
+	case codeScanned:
+		return &Result{Status: StatusScanned}, nil
+	case codeExpired:
+		return &Result{Status: StatusExpired}, nil
+	case codeConfirmed:
+	default:
+		return nil, fmt.Errorf("poll QR login: code %d: %s", data.Code, data.Message)
+	}
+
+	creds := stream.CredentialsFromCookies(resp.Cookies())
+	if creds.SESSDATA == "" {
+		// The cookies are also passed as query parameters of the
+		// cross-domain redirect URL.
+		creds = credentialsFromURL(data.URL)
+	}
+	if creds.SESSDATA == "" {
+		return nil, errors.New("poll QR login: confirmed but no SESSDATA returned")
+	}
+	return &Result{Status: StatusConfirmed, Credentials: creds, RefreshToken: data.RefreshToken}, nil
+}
+
+// WaitLogin polls the login of qr until it is confirmed and returns its
+// result. onStatus, if not nil, is called whenever the status changes.
+// Returns ErrQRExpired if the QR code expires first.
+func (c *Client) WaitLogin(ctx context.Context, qr *QRCode, onStatus func(Status)) (*Result, error) {
+	last := Status(-1)
+	ticker := time.NewTicker(c.cfg.pollInterval)
+	defer ticker.Stop()
+	for {
+		res, err := c.Poll(ctx, qr.Key)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			slog.Warn("auth: QR login poll failed", "error", err)
+		} else {
+			if res.Status != last && onStatus != nil {
+				onStatus(res.Status)
+			}
+			last = res.Status
+			switch res.Status {
+			case StatusConfirmed:
+				return res, nil
+			case StatusExpired:
+				return nil, ErrQRExpired
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// get performs a GET request without cookies and decodes the data of the
+// API envelope into v.
+func (c *Client) get(ctx context.Context, u string, v any) (*http.Response, error) {
+	return c.do(ctx, http.MethodGet, u, nil, "", v)
+}
+
+// do performs a request, sending form as the body of a POST and cookie as
+// the Cookie header if not empty, and decodes the data of the API envelope
+// into v.
+func (c *Client) do(ctx context.Context, method, u string, form url.Values, cookie string, v any) (*http.Response, error) {
+	resp, err := c.send(ctx, method, u, form, cookie)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var env struct {
+		Code    int             `json:"code"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	if env.Code != 0 {
+		return nil, fmt.Errorf("api error %d: %s", env.Code, env.Message)
+	}
+	if err := json.Unmarshal(env.Data, v); err != nil {
+		return nil, fmt.Errorf("decode data: %w", err)
+	}
+	return resp, nil
+}
+
+// send performs a request and returns the response if its status is 200.
+func (c *Client) send(ctx context.Context, method, u string, form url.Values, cookie string) (*http.Response, error) {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("User-Agent", c.cfg.userAgent)
+	req.Header.Set("Referer", defaultReferer)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if cookie != "" {
+		req.Header.Set("Cookie", cookie)
+	}
+
+	resp, err := c.cfg.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http %s: %w", strings.ToLower(method), err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("http status %d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// credentialsFromURL reads the login cookies from the query of the
+// redirect URL returned on confirmation.
+func credentialsFromURL(raw string) stream.Credentials {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return stream.Credentials{}
+	}
+	var cookies []*http.Cookie
+	q := u.Query()
+	for _, name := range []string{"SESSDATA", "bili_jct", "DedeUserID", "DedeUserID__ckMd5"} {
+		if v := q.Get(name); v != "" {
+			cookies = append(cookies, &http.Cookie{Name: name, Value: v})
+		}
+	}
+	creds := stream.CredentialsFromCookies(cookies)
+	if exp, err := strconv.ParseInt(q.Get("Expires"), 10, 64); err == nil && exp > 0 {
+		creds.Expires = time.Unix(exp, 0)
+	}
+	return creds
+}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	stream "github.com/MatchaCake/bilibili_stream_lib"
+)
+
+const (
+	cookieInfoURL    = "https://passport.bilibili.com/x/passport-login/web/cookie/info?csrf=%s"
+	correspondURL    = "https://www.bilibili.com/correspond/1/%s"
+	cookieRefreshURL = "https://passport.bilibili.com/x/passport-login/web/cookie/refresh"
+	confirmURL       = "https://passport.bilibili.com/x/passport-login/web/confirm/refresh"
+)
+
+// correspondKey is the public key Bilibili's web client encrypts the
+// correspond path with.
+const correspondKey = `-----BEGIN PUBLIC KEY-----
+MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQDLgd2OAkcGVtoE3ThUREbio0Eg
+Uc/prcajMKXvkCKFCWhJYJcLkcM2DKKcSeFpD/j6Boy538YXnR6VhcuUJOhH2x71
+nzPjfdTcqMz7djHum0qSZA0AyCBDABUqCrfNgCiJ00Ra7GmRj+YCK1NJEuewlb40
+JNrRuoEUXpabUzGB8QIDAQAB
+-----END PUBLIC KEY-----`
+
+// refreshCSRFPattern finds the refresh_csrf in the correspond page.
+var refreshCSRFPattern = regexp.MustCompile(`<div id="1-name">([^<]+)</div>`)
+
+// NeedsRefresh asks Bilibili whether creds should be refreshed. It
+// requires creds to still be logged in.
+func (c *Client) NeedsRefresh(ctx context.Context, creds stream.Credentials) (bool, error) {
+	info, err := c.cookieInfo(ctx, creds)
+	if err != nil {
+		return false, fmt.Errorf("check cookie refresh: %w", err)
+	}
+	return info.Refresh, nil
+}
+
+type cookieInfo struct {
+	Refresh   bool  `json:"refresh"`
+	Timestamp int64 `json:"timestamp"` // ms
+}
+
+func (c *Client) cookieInfo(ctx context.Context, creds stream.Credentials) (*cookieInfo, error) {
+	var info cookieInfo
+	u := fmt.Sprintf(cookieInfoURL, url.QueryEscape(creds.BiliJct))
+	if _, err := c.do(ctx, http.MethodGet, u, nil, creds.CookieHeader(), &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Refresh renews creds with refreshToken, the refresh token of their
+// login, and returns the new credentials and refresh token. The old
+// refresh token stops working. Its signature matches stream.TokenRefresher:
+//
+//	stream.NewCredentialManager(creds, stream.WithRefreshToken(token, auth.NewClient().Refresh))
+func (c *Client) Refresh(ctx context.Context, creds stream.Credentials, refreshToken string) (stream.Credentials, string, error) {
+	if creds.BiliJct == "" || refreshToken == "" {
+		return stream.Credentials{}, "", errors.New("refresh: bili_jct and refresh token are required")
+	}
+	ts := time.Now().UnixMilli()
+	if info, err := c.cookieInfo(ctx, creds); err == nil && info.Timestamp > 0 {
+		ts = info.Timestamp
+	}
+	path, err := correspondPath(ts)
+	if err != nil {
+		return stream.Credentials{}, "", fmt.Errorf("refresh: %w", err)
+	}
+	refreshCSRF, err := c.refreshCSRF(ctx, creds, path)
+	if err != nil {
+		return stream.Credentials{}, "", fmt.Errorf("refresh: %w", err)
+	}
+
+	var data struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	form := url.Values{
+		"csrf":          {creds.BiliJct},
+		"refresh_csrf":  {refreshCSRF},
+		"source":        {"main_web"},
+		"refresh_token": {refreshToken},
+	}
+	resp, err := c.do(ctx, http.MethodPost, cookieRefreshURL, form, creds.CookieHeader(), &data)
+	if err != nil {
+		return stream.Credentials{}, "", fmt.Errorf("refresh: %w", err)
+	}
+	fresh := mergeCredentials(creds, stream.CredentialsFromCookies(resp.Cookies()))
+	if fresh.SESSDATA == creds.SESSDATA || data.RefreshToken == "" {
+		return stream.Credentials{}, "", errors.New("refresh: no new cookies returned")
+	}
+
+	// Invalidate the old refresh token; the new credentials work either way.
+	confirm := url.Values{"csrf": {fresh.BiliJct}, "refresh_token": {refreshToken}}
+	var ignored struct{}
+	if _, err := c.do(ctx, http.MethodPost, confirmURL, confirm, fresh.CookieHeader(), &ignored); err != nil {
+		slog.Warn("auth: failed to confirm credential refresh", "error", err)
+	}
+	return fresh, data.RefreshToken, nil
+}
+
+// refreshCSRF fetches the refresh_csrf for a refresh from the correspond
+// page.
+func (c *Client) refreshCSRF(ctx context.Context, creds stream.Credentials, path string) (string, error) {
+	resp, err := c.send(ctx, http.MethodGet, fmt.Sprintf(correspondURL, path), nil, creds.CookieHeader())
+	if err != nil {
+		return "", fmt.Errorf("get refresh_csrf: %w", err)
+	}
+	defer resp.Body.Close()
+	page, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("get refresh_csrf: %w", err)
+	}
+	m := refreshCSRFPattern.FindSubmatch(page)
+	if m == nil {
+		return "", errors.New("get refresh_csrf: not found in correspond page")
+	}
+	return string(m[1]), nil
+}
+
+// correspondPath encrypts "refresh_<ts>" with correspondKey (RSA-OAEP,
+// SHA-256) and returns it hex-encoded.
+func correspondPath(ts int64) (string, error) {
+	block, _ := pem.Decode([]byte(correspondKey))
+	if block == nil {
+		return "", errors.New("invalid correspond key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("parse correspond key: %w", err)
+	}
+	pub, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return "", errors.New("correspond key is not RSA")
+	}
+	out, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, []byte(fmt.Sprintf("refresh_%d", ts)), nil)
+	if err != nil {
+		return "", fmt.Errorf("encrypt correspond path: %w", err)
+	}
+	return hex.EncodeToString(out), nil
+}
+
+// mergeCredentials returns old with every cookie set in fresh replaced.
+func mergeCredentials(old, fresh stream.Credentials) stream.Credentials {
+	set := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+		}
+	}
+	set(&old.SESSDATA, fresh.SESSDATA)
+	set(&old.BiliJct, fresh.BiliJct)
+	set(&old.Buvid3, fresh.Buvid3)
+	set(&old.Buvid4, fresh.Buvid4)
+	set(&old.DedeUserID, fresh.DedeUserID)
+	set(&old.DedeUserIDMD5, fresh.DedeUserIDMD5)
+	if len(fresh.Extra) > 0 {
+		extra := make(map[string]string, len(old.Extra)+len(fresh.Extra))
+		for k, v := range old.Extra {
+			extra[k] = v
+		}
+		for k, v := range fresh.Extra {
+			extra[k] = v
+		}
+		old.Extra = extra
+	}
+	if fresh.SESSDATA != "" {
+		old.Expires = fresh.Expires
+	}
+	return old
+}
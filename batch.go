@@ -0,0 +1,147 @@
+package stream
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// GetRoomStatusByUIDs fetches the rooms of many streamers, keyed by UID,
+// with one request per 50 streamers. Streamers without a live room are
+// missing from the result. The RoomInfo fields are filled from the batch
+// endpoint's equivalents, with LiveTime formatted from its start time like
+// GetRoomInfo's.
+func GetRoomStatusByUIDs(ctx context.Context, uids []int64) (map[int64]*RoomInfo, error) {
+	infos := make(map[int64]*RoomInfo)
+	for len(uids) > 0 {
+		batch := uids[:min(len(uids), maxUIDsPerRequest)]
+		uids = uids[len(batch):]
+		rooms, err := fetchStatusByUIDs(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range rooms {
+			infos[d.UID] = d.roomInfo()
+		}
+	}
+	return infos, nil
+}
+
+// roomInfo converts s to a RoomInfo.
+func (s uidStatus) roomInfo() *RoomInfo {
+	liveTime := "0000-00-00 00:00:00"
+	if s.LiveTime > 0 {
+		liveTime = time.Unix(s.LiveTime, 0).In(chinaTime).Format(time.DateTime)
+	}
+	return &RoomInfo{
+		RoomID:     s.RoomID,
+		ShortID:    s.ShortID,
+		UID:        s.UID,
+		LiveStatus: s.LiveStatus,
+		Title:      s.Title,
+		LiveTime:   liveTime,
+		Online:     s.Online,
+		Tags:       parseTags(s.Tags),
+		Cover:      s.Cover,
+
+		AreaID:         s.AreaID,
+		AreaName:       s.AreaName,
+		ParentAreaID:   s.ParentAreaID,
+		ParentAreaName: s.ParentAreaName,
+	}
+}
+
+// WithBatchPolling checks the live status of all watched rooms with one
+// request per 50 streamers each interval (get_status_info_by_uids)
+// instead of a request per room, for monitors watching hundreds of rooms.
+// A room is polled on its own until its streamer's UID is known from the
+// first check, and again whenever the batch request fails or does not
+// report it, so per-room polling remains the fallback.
+func WithBatchPolling(enabled bool) MonitorOption {
+	return func(c *monitorConfig) {
+		c.batchPolling = enabled
+	}
+}
+
+// batchCovers reports whether a recent batch poll reported roomID, so its
+// own poll can be skipped.
+func (m *Monitor) batchCovers(roomID int64) bool {
+	if !m.cfg.batchPolling {
+		return false
+	}
+	m.mu.Lock()
+	at, ok := m.batched[roomID]
+	m.mu.Unlock()
+	return ok && m.cfg.clock.Now().Sub(at) < 2*m.cfg.interval
+}
+
+// pollBatch checks all rooms with known UIDs every interval until ctx is
+// done.
+func (m *Monitor) pollBatch(ctx context.Context) {
+	ticker := m.cfg.clock.NewTicker(m.cfg.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+		m.checkBatch(ctx)
+	}
+}
+
+// checkBatch checks the watched, unpaused rooms with known UIDs and
+// without an active push connection in batches.
+func (m *Monitor) checkBatch(ctx context.Context) {
+	m.mu.Lock()
+	rooms := make(map[int64][]int64) // uid -> roomIDs
+	if !m.paused {
+		for id := range m.rooms {
+			if uid := m.uids[id]; uid != 0 && !m.pausedIDs[id] {
+				rooms[uid] = append(rooms[uid], id)
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	var uids []int64
+	for uid, ids := range rooms {
+		for _, id := range ids {
+			if !m.pushActive(id) {
+				uids = append(uids, uid)
+				break
+			}
+		}
+	}
+	reqCtx := m.requestContext(ctx)
+	for len(uids) > 0 {
+		n := min(len(uids), maxUIDsPerRequest)
+		chunk := uids[:n]
+		uids = uids[n:]
+
+		infos, err := GetRoomStatusByUIDs(reqCtx, chunk)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Warn("monitor: batch status poll failed, polling rooms individually", "rooms", len(chunk), "error", err)
+			}
+			continue
+		}
+		now := m.cfg.clock.Now()
+		for _, uid := range chunk {
+			info := infos[uid]
+			for _, id := range rooms[uid] {
+				m.mu.Lock()
+				_, watched := m.rooms[id]
+				if info != nil && watched {
+					m.batched[id] = now
+				} else {
+					delete(m.batched, id)
+				}
+				m.mu.Unlock()
+				if info != nil && watched && !m.IsPaused(id) {
+					m.applyRoomInfo(id, info)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+const defaultBridgeQueueSize = 256
+
+// MarshalJSON encodes the event for logs and pipelines. Errors are encoded
+// as their message; audio and video streams are reduced to their format
+// descriptors.
+func (ev StreamEvent) MarshalJSON() ([]byte, error) {
+	type audioJSON struct {
+		SampleRate    int    `json:"sample_rate"`
+		Channels      int    `json:"channels"`
+		Encoding      string `json:"encoding"`
+		BytesPerFrame int    `json:"bytes_per_frame"`
+	}
+	type videoJSON struct {
+		Container  string `json:"container"`
+		VideoCodec string `json:"video_codec"`
+		AudioCodec string `json:"audio_codec"`
+	}
+	type crashJSON struct {
+		ExitCode int           `json:"exit_code"`
+		Signal   string        `json:"signal,omitempty"`
+		Stderr   string        `json:"stderr,omitempty"`
+		Uptime   time.Duration `json:"uptime"`
+		Error    string        `json:"error,omitempty"`
+	}
+	out := struct {
+		RoomID       int64               `json:"room_id"`
+		UID          int64               `json:"uid,omitempty"`
+		Name         string              `json:"name,omitempty"`
+		Type         string              `json:"type"`
+		Title        string              `json:"title,omitempty"`
+		Reason       string              `json:"reason,omitempty"`
+		Error        string              `json:"error,omitempty"`
+		Audio        *audioJSON          `json:"audio,omitempty"`
+		Video        *videoJSON          `json:"video,omitempty"`
+		Session      *SessionSummary     `json:"session,omitempty"`
+		Streamer     *StreamerInfo       `json:"streamer,omitempty"`
+		Crash        *crashJSON          `json:"crash,omitempty"`
+		Rank         *RankSnapshot       `json:"rank,omitempty"`
+		Underrun     *CaptureUnderrun    `json:"underrun,omitempty"`
+		Quality      *QualityFallback    `json:"quality,omitempty"`
+		Danmaku      *Danmaku            `json:"danmaku,omitempty"`
+		Chat         *ChatEvent          `json:"chat,omitempty"`
+		Admin        *AdminAction        `json:"admin,omitempty"`
+		Announcement *AnnouncementChange `json:"announcement,omitempty"`
+		Tags         *TagsChange         `json:"tags,omitempty"`
+		RoomInfo     *RoomInfoChange     `json:"room_info,omitempty"`
+		Speaker      *SpeakerChange      `json:"speaker,omitempty"`
+		Latency      *GoLiveLatency      `json:"latency,omitempty"`
+		Resume       *AudioResume        `json:"resume,omitempty"`
+		Gap          *AudioGap           `json:"gap,omitempty"`
+		Preemption   *CapturePreemption  `json:"preemption,omitempty"`
+		Group        string              `json:"group,omitempty"`
+		GroupSession string              `json:"group_session,omitempty"`
+		Area         *AreaHints          `json:"area,omitempty"`
+		LanguageHint string              `json:"language_hint,omitempty"`
+		SessionID    string              `json:"session_id,omitempty"`
+		Muted        bool                `json:"muted,omitempty"`
+	}{
+		RoomID:       ev.RoomID,
+		UID:          ev.UID,
+		Name:         ev.Name,
+		Type:         ev.Type,
+		Title:        ev.Title,
+		Reason:       ev.Reason,
+		Session:      ev.Session,
+		Streamer:     ev.Streamer,
+		Rank:         ev.Rank,
+		Underrun:     ev.Underrun,
+		Quality:      ev.Quality,
+		Danmaku:      ev.Danmaku,
+		Chat:         ev.Chat,
+		Admin:        ev.Admin,
+		Announcement: ev.Announcement,
+		Tags:         ev.Tags,
+		RoomInfo:     ev.RoomInfo,
+		Speaker:      ev.Speaker,
+		Latency:      ev.Latency,
+		Resume:       ev.Resume,
+		Gap:          ev.Gap,
+		Preemption:   ev.Preemption,
+		Group:        ev.Group,
+		GroupSession: ev.GroupSession,
+		LanguageHint: ev.LanguageHint,
+		SessionID:    ev.SessionID,
+		Muted:        ev.Muted,
+	}
+	if ev.Error != nil {
+		out.Error = ev.Error.Error()
+	}
+	if ev.Area != (AreaHints{}) {
+		out.Area = &ev.Area
+	}
+	if a := ev.Audio; a != nil {
+		out.Audio = &audioJSON{a.SampleRate, a.Channels, a.Encoding, a.BytesPerFrame}
+	}
+	if v := ev.Video; v != nil {
+		out.Video = &videoJSON{v.Container, v.VideoCodec, v.AudioCodec}
+	}
+	if c := ev.Crash; c != nil {
+		out.Crash = &crashJSON{ExitCode: c.ExitCode, Signal: c.Signal, Stderr: c.Stderr, Uptime: c.Uptime}
+		if c.Err != nil {
+			out.Crash.Error = c.Err.Error()
+		}
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes the form written by MarshalJSON. Error and
+// Crash.Err come back as plain errors carrying the original message, and
+// Audio and Video are not restored: a capture reader cannot be serialized.
+func (ev *StreamEvent) UnmarshalJSON(data []byte) error {
+	var in struct {
+		RoomID   int64           `json:"room_id"`
+		UID      int64           `json:"uid"`
+		Name     string          `json:"name"`
+		Type     string          `json:"type"`
+		Title    string          `json:"title"`
+		Reason   string          `json:"reason"`
+		Error    string          `json:"error"`
+		Session  *SessionSummary `json:"session"`
+		Streamer *StreamerInfo   `json:"streamer"`
+		Crash    *struct {
+			ExitCode int           `json:"exit_code"`
+			Signal   string        `json:"signal"`
+			Stderr   string        `json:"stderr"`
+			Uptime   time.Duration `json:"uptime"`
+			Error    string        `json:"error"`
+		} `json:"crash"`
+		Rank         *RankSnapshot       `json:"rank"`
+		Underrun     *CaptureUnderrun    `json:"underrun"`
+		Quality      *QualityFallback    `json:"quality"`
+		Danmaku      *Danmaku            `json:"danmaku"`
+		Chat         *ChatEvent          `json:"chat"`
+		Admin        *AdminAction        `json:"admin"`
+		Announcement *AnnouncementChange `json:"announcement"`
+		Tags         *TagsChange         `json:"tags"`
+		RoomInfo     *RoomInfoChange     `json:"room_info"`
+		Speaker      *SpeakerChange      `json:"speaker"`
+		Latency      *GoLiveLatency      `json:"latency"`
+		Resume       *AudioResume        `json:"resume"`
+		Gap          *AudioGap           `json:"gap"`
+		Preemption   *CapturePreemption  `json:"preemption"`
+		Group        string              `json:"group"`
+		GroupSession string              `json:"group_session"`
+		Area         *AreaHints          `json:"area"`
+		LanguageHint string              `json:"language_hint"`
+		SessionID    string              `json:"session_id"`
+		Muted        bool                `json:"muted"`
+	}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	*ev = StreamEvent{
+		RoomID:       in.RoomID,
+		UID:          in.UID,
+		Name:         in.Name,
+		Type:         in.Type,
+		Title:        in.Title,
+		Reason:       in.Reason,
+		Session:      in.Session,
+		Streamer:     in.Streamer,
+		Rank:         in.Rank,
+		Underrun:     in.Underrun,
+		Quality:      in.Quality,
+		Danmaku:      in.Danmaku,
+		Chat:         in.Chat,
+		Admin:        in.Admin,
+		Announcement: in.Announcement,
+		Tags:         in.Tags,
+		RoomInfo:     in.RoomInfo,
+		Speaker:      in.Speaker,
+		Latency:      in.Latency,
+		Resume:       in.Resume,
+		Gap:          in.Gap,
+		Preemption:   in.Preemption,
+		Group:        in.Group,
+		GroupSession: in.GroupSession,
+		LanguageHint: in.LanguageHint,
+		SessionID:    in.SessionID,
+		Muted:        in.Muted,
+	}
+	if in.Error != "" {
+		ev.Error = errors.New(in.Error)
+	}
+	if in.Area != nil {
+		ev.Area = *in.Area
+	}
+	if c := in.Crash; c != nil {
+		ev.Crash = &CaptureCrash{ExitCode: c.ExitCode, Signal: c.Signal, Stderr: c.Stderr, Uptime: c.Uptime}
+		if c.Error != "" {
+			ev.Crash.Err = errors.New(c.Error)
+		}
+	}
+	return nil
+}
+
+// bridgeConfig holds internal configuration for BridgeEvents.
+type bridgeConfig struct {
+	queueSize int
+}
+
+// BridgeOption configures BridgeEvents.
+type BridgeOption func(*bridgeConfig)
+
+// WithBridgeQueueSize sets how many events may wait for a slow writer
+// before new events are dropped. Default is 256.
+func WithBridgeQueueSize(n int) BridgeOption {
+	return func(c *bridgeConfig) {
+		c.queueSize = n
+	}
+}
+
+// BridgeStats counts the events handled by an EventBridge.
+type BridgeStats struct {
+	Written uint64 // events written to the writer
+	Dropped uint64 // events dropped because the queue was full
+}
+
+// EventBridge writes StreamEvents to an io.Writer as newline-delimited JSON.
+// See BridgeEvents.
+type EventBridge struct {
+	written atomic.Uint64
+	dropped atomic.Uint64
+
+	done chan struct{}
+	err  error // set before done is closed
+}
+
+// BridgeEvents writes every event from events to w as one JSON object per
+// line, so events can be piped to files or sockets in one call. Events are
+// buffered in a bounded queue: a slow writer never blocks the channel, and
+// events that do not fit are dropped and counted in Stats. The bridge runs
+// until events is closed or ctx is done, then drains the queue. A write
+// error stops the bridge; it is returned by Wait.
+//
+// The bridge consumes the events: the captures of "audio_ready" and
+// "video_ready" events cannot cross it, so they are stopped and closed
+// once the event is written or dropped.
+func BridgeEvents(ctx context.Context, events <-chan StreamEvent, w io.Writer, opts ...BridgeOption) *EventBridge {
+	cfg := bridgeConfig{queueSize: defaultBridgeQueueSize}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	if cfg.queueSize < 1 {
+		cfg.queueSize = 1
+	}
+
+	b := &EventBridge{done: make(chan struct{})}
+	queue := make(chan StreamEvent, cfg.queueSize)
+	stop := make(chan struct{}) // closed when the writer fails
+
+	go func() {
+		defer close(queue)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+				select {
+				case queue <- ev:
+				default:
+					releaseStreams(ev)
+					if b.dropped.Add(1) == 1 {
+						slog.Warn("bridge: queue full, dropping events", "type", ev.Type, "room_id", ev.RoomID)
+					}
+				}
+			}
+		}
+	}()
+
+	go func() {
+		defer close(b.done)
+		enc := json.NewEncoder(w)
+		for ev := range queue {
+			err := enc.Encode(ev)
+			releaseStreams(ev)
+			if err != nil {
+				b.err = fmt.Errorf("bridge: write event: %w", err)
+				close(stop)
+				for ev := range queue {
+					// Drain so the reader can exit.
+					releaseStreams(ev)
+				}
+				return
+			}
+			b.written.Add(1)
+		}
+	}()
+	return b
+}
+
+// Stats returns the number of events written and dropped so far.
+func (b *EventBridge) Stats() BridgeStats {
+	return BridgeStats{Written: b.written.Load(), Dropped: b.dropped.Load()}
+}
+
+// Wait blocks until the bridge has stopped and returns the write error
+// that stopped it, if any.
+func (b *EventBridge) Wait() error {
+	<-b.done
+	return b.err
+}
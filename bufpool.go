@@ -0,0 +1,58 @@
+package stream
+
+import "sync"
+
+// audioBufSize is the capacity of pooled audio buffers: 32 KiB is about
+// one second of 16kHz mono s16le PCM.
+const audioBufSize = 32 << 10
+
+// audioBufPool recycles AudioBuffers across reads and captures.
+var audioBufPool = sync.Pool{
+	New: func() any {
+		return &AudioBuffer{buf: make([]byte, audioBufSize)}
+	},
+}
+
+// AudioBuffer is a pooled chunk of audio returned by AudioStream.ReadBuf.
+// Data is only valid until Release is called.
+type AudioBuffer struct {
+	Data []byte
+	buf  []byte // full-capacity backing array
+}
+
+// Release returns the buffer to the pool. Data must not be used afterwards.
+func (b *AudioBuffer) Release() {
+	b.Data = nil
+	if b.buf == nil {
+		return // oversized chunk from copyAudioBuf
+	}
+	audioBufPool.Put(b)
+}
+
+// copyAudioBuf returns a pooled buffer holding a copy of p, for relays that
+// hand audio off to another goroutine. Chunks larger than the pooled
+// capacity get a buffer of their own, which Release then drops.
+func copyAudioBuf(p []byte) *AudioBuffer {
+	if len(p) > audioBufSize {
+		return &AudioBuffer{Data: append([]byte(nil), p...)}
+	}
+	b := audioBufPool.Get().(*AudioBuffer)
+	b.Data = b.buf[:copy(b.buf, p)]
+	return b
+}
+
+// ReadBuf reads the next chunk of audio into a pooled buffer, avoiding a
+// per-read allocation for consumers that hand chunks off to other
+// goroutines. The caller must call Release on the returned buffer once done
+// with it. On error the returned buffer is nil.
+func (a *AudioStream) ReadBuf() (*AudioBuffer, error) {
+	b := audioBufPool.Get().(*AudioBuffer)
+	n, err := a.Reader.Read(b.buf)
+	if n == 0 && err != nil {
+		audioBufPool.Put(b)
+		return nil, err
+	}
+	b.Data = b.buf[:n]
+	// Data was read; a read error is reported on the next call.
+	return b, nil
+}
@@ -0,0 +1,156 @@
+package stream
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	spiURL = "https://api.bilibili.com/x/frontend/finger/spi"
+	origin = "https://live.bilibili.com"
+)
+
+// BuvidMode selects how an APIClient obtains the buvid3/buvid4 device
+// cookies it sends with requests that carry none. Without them, anonymous
+// requests are increasingly rejected by risk control (-352).
+type BuvidMode int
+
+const (
+	// BuvidOff sends no device cookies besides those configured. It is
+	// the default.
+	BuvidOff BuvidMode = iota
+	// BuvidLocal generates a buvid3 locally, without a request.
+	BuvidLocal
+	// BuvidFetch fetches buvid3 and buvid4 from Bilibili once per client,
+	// and generates a buvid3 locally if that fails.
+	BuvidFetch
+)
+
+// WithAPIBuvid sets how the client obtains the device cookies (buvid3,
+// buvid4, b_nut, _uuid) sent with requests whose cookies include no
+// buvid3; see BuvidMode. Requests also get an Origin header matching the
+// Referer. Default is BuvidOff.
+func WithAPIBuvid(mode BuvidMode) APIClientOption {
+	return func(c *apiClientConfig) {
+		c.buvid = mode
+	}
+}
+
+// buvidCache holds an APIClient's device cookies.
+type buvidCache struct {
+	mu      sync.Mutex
+	cookies string
+}
+
+// withFingerprint returns opts with the client's device cookies and
+// Origin header added, unless the request's cookies already include a
+// buvid3 or buvids are off.
+func (c *APIClient) withFingerprint(ctx context.Context, opts RequestOptions) RequestOptions {
+	if c.cfg.buvid == BuvidOff || strings.Contains(headerValue(opts.Headers, "Cookie"), "buvid3=") {
+		return opts
+	}
+	cookies := c.deviceCookies(ctx, opts)
+	headers := make(map[string]string, len(opts.Headers)+2)
+	for k, v := range opts.Headers {
+		headers[k] = v
+	}
+	if existing := headerValue(headers, "Cookie"); existing != "" {
+		cookies = existing + "; " + cookies
+	}
+	setHeader(headers, "Cookie", cookies)
+	if headerValue(headers, "Origin") == "" {
+		headers["Origin"] = origin
+	}
+	opts.Headers = headers
+	return opts
+}
+
+// deviceCookies returns the client's device cookies, acquiring them on
+// first use.
+func (c *APIClient) deviceCookies(ctx context.Context, opts RequestOptions) string {
+	b := &c.buvid
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cookies != "" {
+		return b.cookies
+	}
+	now := time.Now()
+	buvid3, buvid4 := "", ""
+	if c.cfg.buvid == BuvidFetch {
+		var err error
+		if buvid3, buvid4, err = c.fetchBuvid(ctx, opts); err != nil {
+			slog.Warn("api: failed to fetch buvid, generating one", "error", err)
+		}
+	}
+	if buvid3 == "" {
+		buvid3 = generateBuvid(now)
+	}
+	cookies := []string{
+		"buvid3=" + buvid3,
+		fmt.Sprintf("b_nut=%d", now.Unix()),
+		"_uuid=" + generateBuvid(now),
+	}
+	if buvid4 != "" {
+		cookies = append(cookies, "buvid4="+buvid4)
+	}
+	b.cookies = strings.Join(cookies, "; ")
+	return b.cookies
+}
+
+// fetchBuvid asks Bilibili for a buvid3 and buvid4.
+func (c *APIClient) fetchBuvid(ctx context.Context, opts RequestOptions) (string, string, error) {
+	apiResp, err := c.paced(ctx, func() (*apiResponse, error) {
+		return c.getOnce(ctx, spiURL, "", opts)
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("get buvid: %w", err)
+	}
+	var data struct {
+		B3 string `json:"b_3"`
+		B4 string `json:"b_4"`
+	}
+	if err := decodeData(apiResp, &data); err != nil {
+		return "", "", fmt.Errorf("parse buvid: %w", err)
+	}
+	if data.B3 == "" {
+		return "", "", errors.New("get buvid: empty b_3")
+	}
+	return data.B3, data.B4, nil
+}
+
+// generateBuvid returns a buvid3 in the web client's format: an uppercase
+// UUID followed by five digits of the time in milliseconds and "infoc".
+func generateBuvid(now time.Time) string {
+	var u [16]byte
+	rand.Read(u[:])
+	u[6] = u[6]&0x0f | 0x40 // version 4
+	u[8] = u[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%X-%X-%X-%X-%X%05dinfoc", u[0:4], u[4:6], u[6:8], u[8:10], u[10:], now.UnixMilli()%100000)
+}
+
+// headerValue returns the value of header name in h, matching the name
+// case-insensitively.
+func headerValue(h map[string]string, name string) string {
+	for k, v := range h {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+// setHeader sets header name in h, replacing any spelling of it.
+func setHeader(h map[string]string, name, value string) {
+	for k := range h {
+		if strings.EqualFold(k, name) {
+			delete(h, k)
+		}
+	}
+	h[name] = value
+}
@@ -1,100 +1,794 @@
 package stream
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
+// Errors classifying CDN failures reported by ffmpeg. They are returned
+// (wrapped) by the capture reader's Close when ffmpeg exits on its own.
+var (
+	ErrStreamForbidden = errors.New("stream CDN returned 403 Forbidden")
+	ErrStreamNotFound  = errors.New("stream CDN returned 404 Not Found")
+)
+
+// ErrCaptureStalled is returned by the capture reader when ffmpeg produced
+// no data within CaptureConfig.FirstByteTimeout or StallTimeout.
+var ErrCaptureStalled = errors.New("capture stalled")
+
 // CaptureAudio starts an ffmpeg process that reads from streamURL and outputs
-// raw PCM audio to the returned ReadCloser. The caller must close the reader
+// raw PCM audio (or AAC in ADTS frames with FormatADTS) to the returned
+// ReadCloser. The caller must close the reader
 // or cancel the context to stop ffmpeg and release resources.
 //
-// ffmpeg must be installed and available in the system PATH.
+// RequestOptions attached to ctx set the user agent, cookie and HTTP proxy
+// ffmpeg uses to fetch the stream. With a Resolver or CaptureConfig.StreamPTS,
+// the stream is instead downloaded by the library and piped to ffmpeg; a 403 or 404 response is
+// then returned immediately as ErrStreamForbidden or ErrStreamNotFound.
+//
+// The reader also has SetReadDeadline and ReadContext methods (see
+// AudioStream), so a consumer can time out a Read on a stuck ffmpeg.
+//
+// ffmpeg must be installed and available in the system PATH, unless
+// CaptureConfig.FFmpeg names another binary.
 func CaptureAudio(ctx context.Context, streamURL string, cfg *CaptureConfig) (io.ReadCloser, error) {
 	if cfg == nil {
 		d := DefaultCaptureConfig()
 		cfg = &d
 	}
 
-	args := []string{
-		"-hide_banner",
-		"-loglevel", "error",
-		// Low-latency input: minimize buffering for live streams.
-		"-fflags", "nobuffer",
-		"-flags", "low_delay",
-		"-analyzeduration", "500000", // 0.5s (default 5s)
-		"-probesize", "500000",       // 500KB (default 5MB)
-		// Input: HTTP stream with required headers.
-		"-user_agent", userAgent,
-		"-headers", "Referer: " + referer + "\r\n",
-		"-i", streamURL,
-		// Output: raw PCM audio to stdout.
-		"-vn",
-		"-acodec", fmt.Sprintf("pcm_%s", cfg.Format),
-		"-ar", strconv.Itoa(cfg.SampleRate),
-		"-ac", strconv.Itoa(cfg.Channels),
-		"-f", cfg.Format,
-		"pipe:1",
+	opts, _ := RequestOptionsFromContext(ctx)
+	cfg, err := uniqueOutputs(cfg)
+	if err != nil {
+		return nil, err
+	}
+	args, err := buildFFmpegArgs(streamURL, cfg, opts)
+	if err != nil {
+		return nil, err
 	}
+	r, err := startFFmpeg(ctx, streamURL, cfg, opts, args)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
 
-	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+// startFFmpeg runs ffmpeg with args for CaptureAudio and CaptureVideo and
+// returns its output reader.
+func startFFmpeg(ctx context.Context, streamURL string, cfg *CaptureConfig, opts RequestOptions, args []string) (*ffmpegReader, error) {
+	log := cfg.logger()
+	clock := cfg.clock
+	if clock == nil {
+		clock = SystemClock()
+	}
+	if cfg.ProbeTimeout > 0 && !pipesInput(cfg, opts) {
+		if err := ProbeStreamURL(ctx, streamURL, cfg.ProbeTimeout); err != nil {
+			return nil, err
+		}
+	}
+	// The watchdog stops a stalled ffmpeg by cancelling its context.
+	ctx, cancel := context.WithCancel(ctx)
+	input, err := streamInput(ctx, streamURL, opts, cfg)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	var pts *flvPTS
+	if input != nil && cfg.StreamPTS {
+		pts = newFLVPTS(input)
+		input = pts
+	}
+	cmd := exec.CommandContext(ctx, ffmpegBinary(cfg.FFmpeg), args...)
+	if input != nil {
+		cmd.Stdin = input
+		// Don't let a stalled download keep Wait blocked after ffmpeg exits.
+		cmd.WaitDelay = inputWaitDelay
+	}
+	cleanup, err := cfg.Isolation.apply(cmd)
+	if err != nil {
+		closeInput(input)
+		cancel()
+		return nil, fmt.Errorf("ffmpeg isolation: %w", err)
+	}
 
-	var stderrBuf bytes.Buffer
-	cmd.Stderr = &stderrBuf
+	stderr := &ffmpegStderr{}
+	if cfg.LogStderr {
+		stderr.log = log
+	}
+	cmd.Stderr = stderr
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
+		closeInput(input)
+		cleanup()
+		cancel()
 		return nil, fmt.Errorf("ffmpeg stdout pipe: %w", err)
 	}
 
 	if err := cmd.Start(); err != nil {
 		stdout.Close()
+		closeInput(input)
+		cleanup()
+		cancel()
 		return nil, fmt.Errorf("ffmpeg start: %w", err)
 	}
 
-	slog.Info("capture: ffmpeg started", "stream_url_prefix", truncateURL(streamURL))
+	if opts.TraceID != "" {
+		log = log.With("trace_id", opts.TraceID)
+	}
+	log.Info("capture: ffmpeg started", "stream_url_prefix", truncateURL(streamURL))
 
 	return &ffmpegReader{
 		ReadCloser: stdout,
 		cmd:        cmd,
 		ctx:        ctx,
-		stderr:     &stderrBuf,
+		stderr:     stderr,
+		log:        log,
+		cancel:     cancel,
+		cleanup:    cleanup,
+		clock:      clock,
+		started:    clock.Now(),
+		onCrash:    cfg.onCrash,
+		input:      input,
+		pts:        pts,
+
+		firstByteTimeout: cfg.FirstByteTimeout,
+		stallTimeout:     cfg.StallTimeout,
+		onStall:          cfg.onStall,
+
+		underrun:          newUnderrunWatch(cfg),
+		restartOnUnderrun: cfg.RestartOnUnderrun,
+		onUnderrun:        cfg.onUnderrun,
 	}, nil
 }
 
+// BuildFFmpegArgs returns the exact ffmpeg argument list (excluding the
+// binary name) that CaptureAudio runs for streamURL and cfg. A nil cfg
+// uses DefaultCaptureConfig. RequestOptions from a capture context are not
+// reflected. It fails if cfg.ChannelMap is invalid or cannot be applied,
+// as CaptureAudio would.
+func BuildFFmpegArgs(streamURL string, cfg *CaptureConfig) ([]string, error) {
+	return buildFFmpegArgs(streamURL, cfg, RequestOptions{})
+}
+
+// buildFFmpegArgs builds the capture argv, applying request overrides.
+// It fails if opts carries headers that cannot be passed to ffmpeg safely
+// or if cfg.ChannelMap cannot be applied.
+func buildFFmpegArgs(streamURL string, cfg *CaptureConfig, opts RequestOptions) ([]string, error) {
+	if cfg == nil {
+		d := DefaultCaptureConfig()
+		cfg = &d
+	}
+	args, err := ffmpegInputArgs(streamURL, cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := channelFilter(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Format == FormatADTS {
+		// Output: the stream's AAC audio, copied without transcoding.
+		args = append(args,
+			"-vn",
+			"-acodec", "copy",
+			"-f", "adts",
+			"pipe:1",
+		)
+	} else {
+		// Output: raw PCM audio to stdout.
+		args = append(args, "-vn")
+		if filter != "" {
+			args = append(args, "-af", filter)
+		}
+		args = append(args,
+			"-acodec", fmt.Sprintf("pcm_%s", cfg.Format),
+			"-ar", strconv.Itoa(cfg.SampleRate),
+			"-ac", strconv.Itoa(cfg.Channels),
+			"-f", cfg.Format,
+			"pipe:1",
+		)
+	}
+
+	// Additional outputs from the same input. Existing files are never
+	// overwritten; see uniqueOutputs.
+	if len(cfg.Outputs) > 0 {
+		args = append([]string{"-n"}, args...)
+	}
+	for _, out := range cfg.Outputs {
+		codec := out.Codec
+		if codec == "" {
+			codec = "copy"
+		}
+		if out.AudioOnly {
+			args = append(args, "-vn")
+		}
+		args = append(args, "-c", codec)
+		if out.Format != "" {
+			args = append(args, "-f", out.Format)
+		}
+		args = append(args, out.Args...)
+		args = append(args, out.Path)
+	}
+	return args, nil
+}
+
+// uniqueOutputs returns cfg with every file output in cfg.Outputs moved to
+// a path that does not exist yet: Path itself, or Path with _2, _3, ...
+// before the extension, like Recorder segments. Restarted captures thus
+// write new files instead of truncating what earlier attempts recorded.
+// The name is reserved with O_EXCL and released just before ffmpeg runs;
+// should another process take it in between, ffmpeg's -n makes the capture
+// fail rather than overwrite it. URL outputs (rtmp://, srt://, pipe:) are
+// left as they are.
+func uniqueOutputs(cfg *CaptureConfig) (*CaptureConfig, error) {
+	if len(cfg.Outputs) == 0 {
+		return cfg, nil
+	}
+	c := *cfg
+	c.Outputs = append([]OutputSpec(nil), cfg.Outputs...)
+	for i, out := range c.Outputs {
+		if !isFileOutput(out.Path) {
+			continue
+		}
+		path := out.Path
+		if c.Isolation != nil && c.Isolation.Dir != "" && !filepath.IsAbs(path) {
+			path = filepath.Join(c.Isolation.Dir, path)
+		}
+		p, f, err := createUnique(path)
+		if err != nil {
+			return nil, fmt.Errorf("capture output: %w", err)
+		}
+		f.Close()
+		os.Remove(p)
+		if p != path {
+			c.logger().Info("capture: output exists, writing to a new file", "path", out.Path, "new_path", p)
+			c.Outputs[i].Path = p
+		}
+	}
+	return &c, nil
+}
+
+// isFileOutput reports whether an output path names a local file rather
+// than a URL such as rtmp://host/app or pipe:1.
+func isFileOutput(path string) bool {
+	u, err := url.Parse(path)
+	return err != nil || len(u.Scheme) <= 1 // "C:\..." has a one-letter scheme
+}
+
+// channelFilter returns the -af filter for cfg.ChannelMap, or "" for
+// ffmpeg's default downmix. The source is first brought to stereo so that
+// mono and surround streams map like stereo ones; -ac then sets the output
+// channel count. ADTS output copies the audio unfiltered, so any channel
+// map is an error there.
+func channelFilter(cfg *CaptureConfig) (string, error) {
+	const stereo = "aformat=channel_layouts=stereo"
+	if cfg.ChannelMap != "" && cfg.Format == FormatADTS {
+		return "", fmt.Errorf("channel map %q cannot be applied to %s output, which is copied without decoding", cfg.ChannelMap, FormatADTS)
+	}
+	switch cfg.ChannelMap {
+	case "":
+		return "", nil
+	case ChannelLeft:
+		return stereo + ",pan=mono|c0=c0", nil
+	case ChannelRight:
+		return stereo + ",pan=mono|c0=c1", nil
+	case ChannelMono:
+		return stereo + ",pan=mono|c0=0.5*c0+0.5*c1", nil
+	case ChannelStereo:
+		if cfg.Channels != 2 {
+			return "", fmt.Errorf("channel map %q needs Channels 2, got %d", cfg.ChannelMap, cfg.Channels)
+		}
+		return stereo, nil
+	}
+	return "", fmt.Errorf("unknown channel map %q", cfg.ChannelMap)
+}
+
+// ffmpegInputArgs returns the global and input part of the capture argv,
+// shared by audio and video captures.
+func ffmpegInputArgs(streamURL string, cfg *CaptureConfig, opts RequestOptions) ([]string, error) {
+	headerMap, err := requestHeaders(opts, opts.Cookie)
+	if err != nil {
+		return nil, err
+	}
+	// ffmpeg sends its own User-Agent unless -user_agent replaces it.
+	ua := headerMap["User-Agent"]
+	delete(headerMap, "User-Agent")
+	headers, err := FFmpegHeaders(headerMap)
+	if err != nil {
+		return nil, err
+	}
+	loglevel := cfg.LogLevel
+	if loglevel == "" {
+		loglevel = "error"
+	}
+	if cfg.LogStderr {
+		// Prefix each line with its level so it can be mapped to slog levels.
+		loglevel = "level+" + loglevel
+	}
+
+	args := []string{
+		"-hide_banner",
+		"-loglevel", loglevel,
+		// Low-latency input: minimize buffering for live streams.
+		"-fflags", "nobuffer",
+		"-flags", "low_delay",
+		"-analyzeduration", "500000", // 0.5s (default 5s)
+		"-probesize", "500000", // 500KB (default 5MB)
+	}
+	if pipesInput(cfg, opts) {
+		// Input: the stream downloaded by streamInput, on stdin.
+		args = append(args, "-i", "pipe:0")
+	} else {
+		// Input: HTTP stream with required headers.
+		args = append(args,
+			"-user_agent", ua,
+			"-headers", headers,
+		)
+		if opts.Proxy != "" {
+			args = append(args, "-http_proxy", opts.Proxy)
+		}
+		args = append(args, "-i", streamURL)
+	}
+	return args, nil
+}
+
+// DryRunCapture validates cfg against streamURL by running the same ffmpeg
+// command as CaptureAudio limited to one second of output, discarding the
+// audio. Additional Outputs are not written. The returned error includes
+// ffmpeg's stderr on failure.
+func DryRunCapture(ctx context.Context, streamURL string, cfg *CaptureConfig) error {
+	if cfg == nil {
+		d := DefaultCaptureConfig()
+		cfg = &d
+	}
+	pcmOnly := *cfg
+	pcmOnly.Outputs = nil
+
+	opts, _ := RequestOptionsFromContext(ctx)
+	args, err := buildFFmpegArgs(streamURL, &pcmOnly, opts)
+	if err != nil {
+		return fmt.Errorf("ffmpeg dry run: %w", err)
+	}
+	input, err := streamInput(ctx, streamURL, opts, &pcmOnly)
+	if err != nil {
+		return fmt.Errorf("ffmpeg dry run: %w", err)
+	}
+	defer closeInput(input)
+	// Insert the duration limit before the output target.
+	output := args[len(args)-1]
+	args = append(args[:len(args)-1], "-t", "1", output)
+
+	cmd := exec.CommandContext(ctx, ffmpegBinary(cfg.FFmpeg), args...)
+	if input != nil {
+		cmd.Stdin = input
+		cmd.WaitDelay = inputWaitDelay
+	}
+	cleanup, err := cfg.Isolation.apply(cmd)
+	if err != nil {
+		return fmt.Errorf("ffmpeg dry run: isolation: %w", err)
+	}
+	defer cleanup()
+	var stderrBuf bytes.Buffer
+	cmd.Stdout = io.Discard
+	cmd.Stderr = &stderrBuf
+
+	if err := cmd.Run(); err != nil {
+		if stderrBuf.Len() > 0 {
+			return fmt.Errorf("ffmpeg dry run: %w: %s", err, bytes.TrimSpace(stderrBuf.Bytes()))
+		}
+		return fmt.Errorf("ffmpeg dry run: %w", err)
+	}
+	return nil
+}
+
 // ffmpegReader wraps the stdout pipe and ensures the ffmpeg process is
 // cleaned up when Close is called.
 type ffmpegReader struct {
 	io.ReadCloser
-	cmd    *exec.Cmd
-	ctx    context.Context
-	stderr *bytes.Buffer
+	cmd     *exec.Cmd
+	ctx     context.Context
+	cancel  context.CancelFunc
+	cleanup func() // releases CaptureIsolation resources after exit
+	stderr  *ffmpegStderr
+	log     *slog.Logger
+	clock   Clock
+	started time.Time
+	onCrash func(CaptureCrash)
+	input   io.Closer // stream download fed to stdin, if any
+	pts     *flvPTS   // CaptureConfig.StreamPTS; nil otherwise
+
+	waitOnce sync.Once
+	waitErr  error
+
+	firstByteTimeout time.Duration
+	stallTimeout     time.Duration
+	onStall          func(error)
+	gotData          bool // a Read has returned data; only touched by Read
+	stallErr         atomic.Pointer[error]
+
+	underrun          *underrunWatch // nil if disabled
+	restartOnUnderrun bool
+	onUnderrun        func(CaptureUnderrun)
+}
+
+// Read reads ffmpeg's output. When the output ends, the process is reaped
+// right away so a crash is reported even before the reader is closed.
+func (f *ffmpegReader) Read(p []byte) (int, error) {
+	if errp := f.stallErr.Load(); errp != nil {
+		return 0, *errp
+	}
+	timer := f.watch()
+	n, err := f.ReadCloser.Read(p)
+	if timer != nil {
+		timer.Stop()
+	}
+	if errp := f.stallErr.Load(); errp != nil {
+		return n, *errp
+	}
+	if n > 0 {
+		f.gotData = true
+	}
+	if err == io.EOF {
+		f.wait()
+	}
+	if f.underrun != nil && err == nil {
+		if u, ok := f.underrun.observe(f.clock.Now(), n); ok {
+			if uerr := f.underrunDetected(u); uerr != nil {
+				return n, uerr
+			}
+		}
+	}
+	return n, err
+}
+
+// underrunDetected reports an underrun and, with RestartOnUnderrun, stops
+// ffmpeg and returns the error the reader fails with from now on.
+func (f *ffmpegReader) underrunDetected(u CaptureUnderrun) error {
+	u.Restarted = f.restartOnUnderrun
+	f.log.Warn("capture: ffmpeg delivering too little audio",
+		"bytes_per_sec", int64(u.Actual), "expected", int64(u.Expected), "window", u.Window, "restart", u.Restarted)
+	var err error
+	if u.Restarted {
+		err = u.Err()
+		if !f.stallErr.CompareAndSwap(nil, &err) {
+			return *f.stallErr.Load()
+		}
+		f.cancel()
+	}
+	if f.onUnderrun != nil {
+		f.onUnderrun(u)
+	}
+	return err
+}
+
+// watch arms the stall watchdog for one Read, returning nil if no timeout
+// applies. Until the first byte the deadline is FirstByteTimeout after
+// ffmpeg started; afterwards each Read may wait StallTimeout.
+func (f *ffmpegReader) watch() clockTimer {
+	var limit, wait time.Duration
+	if !f.gotData {
+		if f.firstByteTimeout <= 0 {
+			return nil
+		}
+		limit = f.firstByteTimeout
+		wait = f.started.Add(limit).Sub(f.clock.Now())
+	} else {
+		if f.stallTimeout <= 0 {
+			return nil
+		}
+		limit, wait = f.stallTimeout, f.stallTimeout
+	}
+	afterFirstByte := f.gotData
+	return afterFunc(f.clock, max(wait, 0), func() {
+		f.stall(limit, afterFirstByte)
+	})
+}
+
+// stall stops ffmpeg after it produced no data for limit. Only stalls of a
+// running stream are reported to onStall; a missing first byte surfaces as
+// a failed capture start instead.
+func (f *ffmpegReader) stall(limit time.Duration, afterFirstByte bool) {
+	err := fmt.Errorf("%w: no data for %s", ErrCaptureStalled, limit)
+	if !f.stallErr.CompareAndSwap(nil, &err) {
+		return
+	}
+	f.log.Warn("capture: no data from ffmpeg, stopping", "timeout", limit, "first_byte", !afterFirstByte)
+	f.cancel()
+	// Unblock the pending Read even if a child of ffmpeg holds the pipe.
+	f.ReadCloser.Close()
+	if afterFirstByte && f.onStall != nil {
+		f.onStall(err)
+	}
+}
+
+// SetReadDeadline sets the deadline of ffmpeg's output pipe; see
+// AudioStream.SetReadDeadline.
+func (f *ffmpegReader) SetReadDeadline(t time.Time) error {
+	return setReadDeadline(f.ReadCloser, t)
+}
+
+// ReadContext is like Read but returns ctx's error once ctx is done; see
+// AudioStream.ReadContext.
+func (f *ffmpegReader) ReadContext(ctx context.Context, p []byte) (int, error) {
+	return readContext(ctx, f, p)
 }
 
 func (f *ffmpegReader) Close() error {
+	defer f.cancel()
 	// Close the stdout pipe first.
 	pipeErr := f.ReadCloser.Close()
 
 	// Wait for the process to exit (may already be dead from context cancel).
-	waitErr := f.cmd.Wait()
-
-	// Log stderr if ffmpeg exited with error (not from context cancel).
-	if waitErr != nil && f.ctx.Err() == nil && f.stderr.Len() > 0 {
-		slog.Error("capture: ffmpeg exited with error", "stderr", f.stderr.String())
-	}
+	waitErr := f.wait()
+	closeInput(f.input)
 
-	if pipeErr != nil {
+	// The pipe is already closed if Read reaped the process at EOF.
+	if pipeErr != nil && !errors.Is(pipeErr, os.ErrClosed) {
 		return pipeErr
 	}
 	if waitErr != nil && f.ctx.Err() != nil {
 		return nil
 	}
-	return waitErr
+	if waitErr != nil {
+		return classifyFFmpegError(waitErr, f.stderr.String())
+	}
+	return nil
+}
+
+// wait reaps the ffmpeg process once and reports a crash: a failed exit
+// that was not caused by cancelling the capture.
+func (f *ffmpegReader) wait() error {
+	f.waitOnce.Do(func() {
+		f.waitErr = f.cmd.Wait()
+		f.cleanup()
+		if f.waitErr == nil || f.ctx.Err() != nil {
+			return
+		}
+		if f.stderr.Len() > 0 {
+			f.log.Error("capture: ffmpeg exited with error", "stderr", f.stderr.String())
+		}
+		if f.onCrash != nil {
+			f.onCrash(newCaptureCrash(f.waitErr, f.stderr.String(), f.clock.Now().Sub(f.started)))
+		}
+	})
+	return f.waitErr
+}
+
+// newCaptureCrash describes a failed ffmpeg exit.
+func newCaptureCrash(err error, stderr string, uptime time.Duration) CaptureCrash {
+	crash := CaptureCrash{
+		ExitCode: -1,
+		Uptime:   uptime,
+		Err:      classifyFFmpegError(err, stderr),
+	}
+	if len(stderr) > maxCrashStderr {
+		stderr = stderr[len(stderr)-maxCrashStderr:]
+	}
+	crash.Stderr = strings.TrimSpace(stderr)
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		crash.ExitCode = exitErr.ExitCode()
+		if ws, ok := exitErr.Sys().(interface {
+			Signaled() bool
+			Signal() syscall.Signal
+		}); ok && ws.Signaled() {
+			crash.Signal = ws.Signal().String()
+		}
+	}
+	return crash
+}
+
+// inputWaitDelay bounds how long Wait waits for the stdin copy after
+// ffmpeg exits.
+const inputWaitDelay = 5 * time.Second
+
+// pipesInput reports whether the library downloads the stream for ffmpeg:
+// when opts need a network setup ffmpeg cannot reproduce (a custom
+// Resolver), or the stream's timestamps are read (CaptureConfig.StreamPTS).
+func pipesInput(cfg *CaptureConfig, opts RequestOptions) bool {
+	return opts.Resolver != nil || cfg.StreamPTS
+}
+
+// streamInput downloads streamURL in Go if pipesInput, returning the
+// response body to feed to ffmpeg's stdin. It returns nil if ffmpeg should
+// fetch the URL itself.
+func streamInput(ctx context.Context, streamURL string, opts RequestOptions, cfg *CaptureConfig) (io.ReadCloser, error) {
+	if !pipesInput(cfg, opts) {
+		return nil, nil
+	}
+	return openStream(ctx, streamURL, opts)
+}
+
+// openStream downloads streamURL with the request options, mapping a 403
+// or 404 response to ErrStreamForbidden or ErrStreamNotFound.
+func openStream(ctx context.Context, streamURL string, opts RequestOptions) (io.ReadCloser, error) {
+	client, err := httpClientFor(opts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, streamURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create stream request: %w", err)
+	}
+	headers, err := requestHeaders(opts, opts.Cookie)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("open stream: %w", err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusForbidden:
+		resp.Body.Close()
+		return nil, fmt.Errorf("open stream: %w", ErrStreamForbidden)
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("open stream: %w", ErrStreamNotFound)
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("open stream: http status %d", resp.StatusCode)
+	}
+}
+
+func closeInput(input io.Closer) {
+	if input != nil {
+		input.Close()
+	}
+}
+
+// classifyFFmpegError wraps err with a sentinel error when ffmpeg's stderr
+// shows a recognizable CDN failure.
+func classifyFFmpegError(err error, stderr string) error {
+	switch {
+	case strings.Contains(stderr, "403 Forbidden"):
+		return fmt.Errorf("%w: %v", ErrStreamForbidden, err)
+	case strings.Contains(stderr, "404 Not Found"):
+		return fmt.Errorf("%w: %v", ErrStreamNotFound, err)
+	}
+	return err
+}
+
+// isCDNError reports whether err is a CDN rejection that is likely to be
+// resolved by switching to another stream host.
+func isCDNError(err error) bool {
+	return errors.Is(err, ErrStreamForbidden) || errors.Is(err, ErrStreamNotFound)
+}
+
+// awaitFirstByte blocks until r produces data. If the stream ends first,
+// r is closed and the (classified) ffmpeg exit error is returned.
+func awaitFirstByte(r io.ReadCloser) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	if _, err := br.Peek(1); err != nil {
+		if closeErr := r.Close(); closeErr != nil {
+			return nil, closeErr
+		}
+		return nil, fmt.Errorf("capture produced no data: %w", err)
+	}
+	return &bufferedReadCloser{Reader: br, Closer: r}, nil
+}
+
+// bufferedReadCloser reads through a bufio.Reader and closes the
+// underlying capture.
+type bufferedReadCloser struct {
+	*bufio.Reader
+	io.Closer
+}
+
+func (b *bufferedReadCloser) SetReadDeadline(t time.Time) error {
+	return setReadDeadline(b.Closer, t)
+}
+
+// streamHost returns the host of a stream URL, or "" if it cannot be parsed.
+func streamHost(streamURL string) string {
+	u, err := url.Parse(streamURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+const (
+	// maxStderrTail is how much of ffmpeg's stderr is kept for error reports.
+	maxStderrTail = 64 << 10
+
+	// maxCrashStderr is how much of the stderr tail a CaptureCrash carries.
+	maxCrashStderr = 4 << 10
+)
+
+// ffmpegStderr collects the tail of ffmpeg's stderr for error reporting and,
+// if log is set, logs each line as it is written.
+type ffmpegStderr struct {
+	mu   sync.Mutex
+	tail []byte
+	line []byte // incomplete last line
+	log  *slog.Logger
+}
+
+func (w *ffmpegStderr) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.tail = append(w.tail, p...)
+	if len(w.tail) > maxStderrTail {
+		w.tail = w.tail[len(w.tail)-maxStderrTail:]
+	}
+
+	if w.log != nil {
+		w.line = append(w.line, p...)
+		for {
+			i := bytes.IndexByte(w.line, '\n')
+			if i < 0 {
+				break
+			}
+			logFFmpegLine(w.log, string(bytes.TrimRight(w.line[:i], "\r")))
+			w.line = w.line[i+1:]
+		}
+	}
+	return len(p), nil
+}
+
+// Len returns the number of retained stderr bytes.
+func (w *ffmpegStderr) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.tail)
+}
+
+// String returns the retained tail of stderr.
+func (w *ffmpegStderr) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return string(w.tail)
+}
+
+// logFFmpegLine logs one "[level] message" line from ffmpeg at the matching
+// slog level.
+func logFFmpegLine(log *slog.Logger, line string) {
+	if line == "" {
+		return
+	}
+	level := slog.LevelInfo
+	if rest, ok := strings.CutPrefix(line, "["); ok {
+		if tag, msg, ok := strings.Cut(rest, "] "); ok {
+			switch tag {
+			case "panic", "fatal", "error":
+				level = slog.LevelError
+			case "warning":
+				level = slog.LevelWarn
+			case "debug", "trace", "verbose":
+				level = slog.LevelDebug
+			}
+			line = msg
+		}
+	}
+	log.Log(context.Background(), level, "ffmpeg: "+line)
 }
 
 // truncateURL returns the first 80 characters of a URL for logging.
@@ -0,0 +1,733 @@
+package stream
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const danmuInfoURL = "https://api.live.bilibili.com/xlive/web-room/v1/index/getDanmuInfo?id=%d&type=0"
+
+// defaultChatHost accepts anonymous connections when getDanmuInfo is
+// unavailable, e.g. rejected by risk control.
+const defaultChatHost = "broadcastlv.chat.bilibili.com"
+
+// Chat packet header (big endian): total length (4), header length (2),
+// protocol version (2), operation (4), sequence (4).
+const chatHeaderLen = 16
+
+// chatAuthTimeout bounds the wait for the server's auth reply.
+const chatAuthTimeout = 10 * time.Second
+
+// Chat packet operations.
+const (
+	chatOpHeartbeat      = 2
+	chatOpHeartbeatReply = 3
+	chatOpMessage        = 5
+	chatOpAuth           = 7
+	chatOpAuthReply      = 8
+)
+
+// Chat packet protocol versions.
+const (
+	chatProtoJSON   = 0
+	chatProtoInt    = 1
+	chatProtoZlib   = 2
+	chatProtoBrotli = 3
+)
+
+// Commands of ChatEvent.Cmd with a typed payload.
+const (
+	ChatDanmaku    = "DANMU_MSG"           // ChatEvent.Danmaku
+	ChatGift       = "SEND_GIFT"           // ChatEvent.Gift
+	ChatSuperChat  = "SUPER_CHAT_MESSAGE"  // ChatEvent.SuperChat
+	ChatGuardBuy   = "GUARD_BUY"           // ChatEvent.Guard
+	ChatPopularity = "POPULARITY"          // ChatEvent.Popularity, from heartbeat replies
+	ChatInteract   = "INTERACT_WORD"       // ChatEvent.Interaction
+	ChatWatched    = "WATCHED_CHANGE"      // ChatEvent.Watched
+	ChatLikes      = "LIKE_INFO_V3_UPDATE" // ChatEvent.Likes
+)
+
+// Kinds of Interaction (INTERACT_WORD msg_type).
+const (
+	InteractEnter         = 1 // entered the room
+	InteractFollow        = 2 // followed the streamer
+	InteractShare         = 3 // shared the room
+	InteractSpecialFollow = 4 // special follow (特别关注)
+	InteractMutualFollow  = 5 // followed back, now mutual
+)
+
+// ErrChatAuth is returned by DanmakuClient.Connect when the danmaku server
+// rejects the connection's credentials.
+var ErrChatAuth = errors.New("danmaku server rejected authentication")
+
+// ChatEvent is a message broadcast in a live room's chat: a danmaku, gift,
+// super chat or any other command. Commands without a typed field are
+// available in Raw.
+type ChatEvent struct {
+	RoomID int64           `json:"room_id"`
+	Cmd    string          `json:"cmd"`  // e.g. ChatDanmaku, "INTERACT_WORD"; suffixes like ":4:0:2:2:2:0" are removed
+	Time   time.Time       `json:"time"` // when received
+	Raw    json.RawMessage `json:"raw,omitempty"`
+
+	Danmaku    *Danmaku       `json:"danmaku,omitempty"`
+	Gift       *Gift          `json:"gift,omitempty"`
+	SuperChat  *SuperChat     `json:"super_chat,omitempty"`
+	Guard      *GuardPurchase `json:"guard,omitempty"`
+	Popularity int64          `json:"popularity,omitempty"`
+
+	Interaction *Interaction `json:"interaction,omitempty"`
+	Watched     int64        `json:"watched,omitempty"` // viewers of the session so far (看过)
+	Likes       int64        `json:"likes,omitempty"`   // likes of the session so far
+
+	Admin *AdminAction `json:"admin,omitempty"` // ChatCutOff, ChatWarning, ChatRoomLock
+}
+
+// typed reports whether ev carries a typed payload.
+func (ev ChatEvent) typed() bool {
+	return ev.Danmaku != nil || ev.Gift != nil || ev.SuperChat != nil || ev.Guard != nil ||
+		ev.Interaction != nil || ev.Admin != nil || ev.Cmd == ChatPopularity || ev.Cmd == ChatWatched || ev.Cmd == ChatLikes
+}
+
+// Interaction is a viewer entering the room, following the streamer or
+// sharing the room (INTERACT_WORD).
+type Interaction struct {
+	UID      int64     `json:"uid"`
+	Nickname string    `json:"nickname"`
+	Kind     int       `json:"kind"` // InteractEnter, InteractFollow, ...
+	Time     time.Time `json:"time"`
+}
+
+// Emoticon is a sticker sent as a danmaku (表情包弹幕).
+type Emoticon struct {
+	ID     string `json:"id"` // emoticon_unique, e.g. "official_147"
+	URL    string `json:"url"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+// Gift is a gift sent to the streamer (SEND_GIFT).
+type Gift struct {
+	UID      int64     `json:"uid"`
+	Nickname string    `json:"nickname"`
+	Name     string    `json:"name"`
+	Count    int       `json:"count"`
+	CoinType string    `json:"coin_type"`  // "gold" (paid, 1000 = 1 CNY) or "silver" (free)
+	Coins    int64     `json:"total_coin"` // value of all Count gifts
+	Time     time.Time `json:"time"`
+}
+
+// SuperChat is a paid, pinned message (醒目留言).
+type SuperChat struct {
+	UID      int64         `json:"uid"`
+	Nickname string        `json:"nickname"`
+	Text     string        `json:"text"`
+	Price    int           `json:"price"`    // CNY
+	Duration time.Duration `json:"duration"` // how long it stays pinned
+	Time     time.Time     `json:"time"`
+}
+
+// GuardPurchase is a membership (大航海) bought in the room.
+type GuardPurchase struct {
+	UID      int64     `json:"uid"`
+	Nickname string    `json:"nickname"`
+	Level    int       `json:"level"`  // 1 总督, 2 提督, 3 舰长
+	Months   int       `json:"months"` // usually 1
+	Price    int64     `json:"price"`  // gold coins, 1000 = 1 CNY
+	Time     time.Time `json:"time"`
+}
+
+// danmakuConfig holds internal configuration for DanmakuClient.
+type danmakuConfig struct {
+	uid       int64
+	heartbeat time.Duration
+	buffer    int
+	clock     Clock
+
+	onConn func(up bool) // told when a connection is established or lost; Monitor push mode
+}
+
+// DanmakuOption configures a DanmakuClient.
+type DanmakuOption func(*danmakuConfig)
+
+// WithDanmakuUID sets the uid of the account whose cookie is attached to
+// the context (RequestOptions.Cookie). Bilibili only reveals full
+// nicknames and sender uids to logged-in connections.
+func WithDanmakuUID(uid int64) DanmakuOption {
+	return func(c *danmakuConfig) {
+		c.uid = uid
+	}
+}
+
+// WithDanmakuClock sets the clock timing heartbeats and reconnect backoff.
+// Default is SystemClock(); StreamClient passes its own (WithClock).
+func WithDanmakuClock(clock Clock) DanmakuOption {
+	return func(c *danmakuConfig) {
+		c.clock = clock
+	}
+}
+
+// WithDanmakuHeartbeat sets how often the connection is kept alive.
+// Default is 30 seconds; the server drops connections silent for 70.
+func WithDanmakuHeartbeat(d time.Duration) DanmakuOption {
+	return func(c *danmakuConfig) {
+		c.heartbeat = d
+	}
+}
+
+// WithDanmakuBuffer sets the capacity of the event channel. Events are
+// dropped, with a warning, while it is full. Default is 256.
+func WithDanmakuBuffer(n int) DanmakuOption {
+	return func(c *danmakuConfig) {
+		c.buffer = n
+	}
+}
+
+// DanmakuClient receives live rooms' chat from Bilibili's danmaku
+// broadcast servers over WebSocket.
+type DanmakuClient struct {
+	cfg danmakuConfig
+}
+
+// NewDanmakuClient creates a DanmakuClient with the given options.
+func NewDanmakuClient(opts ...DanmakuOption) *DanmakuClient {
+	cfg := danmakuConfig{
+		heartbeat: 30 * time.Second,
+		buffer:    256,
+		clock:     SystemClock(),
+	}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	return &DanmakuClient{cfg: cfg}
+}
+
+// Connect joins the chat of roomID and returns its events. The first
+// connection is made before Connect returns; if it fails, so does Connect.
+// Dropped connections are re-established with backoff until ctx is
+// canceled, which closes the channel. RequestOptions attached to ctx are
+// used as for API requests.
+//
+// Messages are requested zlib-compressed, since brotli, the browser's
+// default, has no decoder in the standard library.
+func (d *DanmakuClient) Connect(ctx context.Context, roomID int64) (<-chan ChatEvent, error) {
+	conn, err := d.dial(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan ChatEvent, d.cfg.buffer)
+	go d.run(ctx, roomID, conn, ch)
+	return ch, nil
+}
+
+// run reads conn until it drops, then reconnects, until ctx is done.
+func (d *DanmakuClient) run(ctx context.Context, roomID int64, conn *wsConn, ch chan<- ChatEvent) {
+	defer close(ch)
+	log := slog.With("room_id", roomID)
+	backoff := time.Second
+	for {
+		started := d.cfg.clock.Now()
+		d.connState(true)
+		err := d.serve(ctx, roomID, conn, ch)
+		d.connState(false)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warn("chat: connection lost", "error", err)
+		if d.cfg.clock.Now().Sub(started) > time.Minute {
+			backoff = time.Second
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-d.cfg.clock.After(backoff):
+			}
+			backoff = min(backoff*2, time.Minute)
+			if conn, err = d.dial(ctx, roomID); err == nil {
+				break
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			log.Warn("chat: reconnect failed", "error", err)
+		}
+	}
+}
+
+func (d *DanmakuClient) connState(up bool) {
+	if d.cfg.onConn != nil {
+		d.cfg.onConn(up)
+	}
+}
+
+// dial connects and authenticates to one of the room's chat servers.
+func (d *DanmakuClient) dial(ctx context.Context, roomID int64) (*wsConn, error) {
+	token, hosts, err := getDanmuInfo(ctx, roomID)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("chat: %w", err)
+		}
+		slog.Warn("chat: danmu info unavailable, connecting anonymously", "room_id", roomID, "error", err)
+		hosts = []string{defaultChatHost + ":443"}
+	}
+	opts, _ := RequestOptionsFromContext(ctx)
+
+	var lastErr error
+	for _, host := range hosts {
+		conn, err := dialWebSocket(ctx, "wss://"+host+"/sub", opts)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		authCtx, cancel := context.WithTimeout(ctx, chatAuthTimeout)
+		stop := context.AfterFunc(authCtx, func() { conn.Close() })
+		err = d.auth(conn, roomID, token)
+		if !stop() && err == nil {
+			err = fmt.Errorf("auth: %w", authCtx.Err())
+		}
+		cancel()
+		if err != nil {
+			conn.Close()
+			if errors.Is(err, ErrChatAuth) {
+				return nil, fmt.Errorf("chat: %w", err)
+			}
+			lastErr = err
+			continue
+		}
+		return conn, nil
+	}
+	return nil, fmt.Errorf("chat: connect: %w", lastErr)
+}
+
+// auth sends the join packet and waits for the server's verdict.
+func (d *DanmakuClient) auth(conn *wsConn, roomID int64, token string) error {
+	body, err := json.Marshal(map[string]any{
+		"uid":      d.cfg.uid,
+		"roomid":   roomID,
+		"protover": chatProtoZlib,
+		"platform": "web",
+		"type":     2,
+		"key":      token,
+	})
+	if err != nil {
+		return err
+	}
+	if err := conn.writeMessage(chatPacket(chatOpAuth, body)); err != nil {
+		return fmt.Errorf("send auth: %w", err)
+	}
+	msg, err := conn.readMessage()
+	if err != nil {
+		return fmt.Errorf("read auth reply: %w", err)
+	}
+	for _, p := range splitChatPackets(msg) {
+		if p.op != chatOpAuthReply {
+			continue
+		}
+		var reply struct {
+			Code int `json:"code"`
+		}
+		if err := json.Unmarshal(p.body, &reply); err != nil {
+			return fmt.Errorf("parse auth reply: %w", err)
+		}
+		if reply.Code != 0 {
+			return fmt.Errorf("%w: code %d", ErrChatAuth, reply.Code)
+		}
+		return nil
+	}
+	return errors.New("no auth reply")
+}
+
+// serve sends heartbeats and delivers events until conn fails or ctx is
+// done. It closes conn.
+func (d *DanmakuClient) serve(ctx context.Context, roomID int64, conn *wsConn, ch chan<- ChatEvent) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	defer conn.Close()
+
+	go func() {
+		ticker := d.cfg.clock.NewTicker(d.cfg.heartbeat)
+		defer ticker.Stop()
+		for {
+			if err := conn.writeMessage(chatPacket(chatOpHeartbeat, nil)); err != nil {
+				cancel()
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+			}
+		}
+	}()
+
+	var warnBrotli sync.Once
+	for {
+		msg, err := conn.readMessage()
+		if err != nil {
+			return err
+		}
+		packets, err := decodeChatPackets(msg)
+		if errors.Is(err, errChatBrotli) {
+			warnBrotli.Do(func() {
+				slog.Warn("chat: skipping brotli-compressed messages", "room_id", roomID)
+			})
+		}
+		for _, p := range packets {
+			ev, ok := parseChatPacket(roomID, p)
+			if !ok {
+				continue
+			}
+			select {
+			case ch <- ev:
+			default:
+				slog.Warn("chat: subscriber channel full, dropping event", "room_id", roomID, "cmd", ev.Cmd)
+			}
+		}
+	}
+}
+
+// getDanmuInfo returns the token and "host:port" addresses of the room's
+// chat servers.
+func getDanmuInfo(ctx context.Context, roomID int64) (string, []string, error) {
+	apiResp, err := doGet(ctx, fmt.Sprintf(danmuInfoURL, roomID), "")
+	if err != nil {
+		return "", nil, fmt.Errorf("get danmu info: %w", err)
+	}
+	var data struct {
+		Token    string `json:"token"`
+		HostList []struct {
+			Host    string `json:"host"`
+			WSSPort int    `json:"wss_port"`
+		} `json:"host_list"`
+	}
+	if err := decodeData(apiResp, &data); err != nil {
+		return "", nil, fmt.Errorf("parse danmu info: %w", err)
+	}
+	var hosts []string
+	for _, h := range data.HostList {
+		if h.Host != "" && h.WSSPort > 0 {
+			hosts = append(hosts, h.Host+":"+strconv.Itoa(h.WSSPort))
+		}
+	}
+	if len(hosts) == 0 {
+		hosts = []string{defaultChatHost + ":443"}
+	}
+	return data.Token, hosts, nil
+}
+
+type chatPacketData struct {
+	proto uint16
+	op    uint32
+	body  []byte
+}
+
+// chatPacket frames body as a client packet.
+func chatPacket(op uint32, body []byte) []byte {
+	p := make([]byte, chatHeaderLen, chatHeaderLen+len(body))
+	binary.BigEndian.PutUint32(p[0:], uint32(chatHeaderLen+len(body)))
+	binary.BigEndian.PutUint16(p[4:], chatHeaderLen)
+	binary.BigEndian.PutUint16(p[6:], chatProtoInt)
+	binary.BigEndian.PutUint32(p[8:], op)
+	binary.BigEndian.PutUint32(p[12:], 1)
+	return append(p, body...)
+}
+
+// splitChatPackets splits a WebSocket message into its packets, ignoring
+// a malformed tail.
+func splitChatPackets(msg []byte) []chatPacketData {
+	var packets []chatPacketData
+	for len(msg) >= chatHeaderLen {
+		total := int(binary.BigEndian.Uint32(msg[0:]))
+		hdr := int(binary.BigEndian.Uint16(msg[4:]))
+		if total < hdr || hdr < chatHeaderLen || total > len(msg) {
+			break
+		}
+		packets = append(packets, chatPacketData{
+			proto: binary.BigEndian.Uint16(msg[6:]),
+			op:    binary.BigEndian.Uint32(msg[8:]),
+			body:  msg[hdr:total],
+		})
+		msg = msg[total:]
+	}
+	return packets
+}
+
+var errChatBrotli = errors.New("brotli-compressed packet")
+
+// decodeChatPackets splits msg and unpacks compressed message packets.
+// Packets it cannot decompress are skipped and reported in err.
+func decodeChatPackets(msg []byte) ([]chatPacketData, error) {
+	var out []chatPacketData
+	var err error
+	for _, p := range splitChatPackets(msg) {
+		if p.op != chatOpMessage {
+			out = append(out, p)
+			continue
+		}
+		switch p.proto {
+		case chatProtoZlib:
+			zr, zerr := zlib.NewReader(bytes.NewReader(p.body))
+			if zerr != nil {
+				err = zerr
+				continue
+			}
+			inner, zerr := io.ReadAll(io.LimitReader(zr, wsMaxMessage))
+			zr.Close()
+			if zerr != nil {
+				err = zerr
+				continue
+			}
+			out = append(out, splitChatPackets(inner)...)
+		case chatProtoBrotli:
+			err = errChatBrotli
+		default:
+			out = append(out, p)
+		}
+	}
+	return out, err
+}
+
+// parseChatPacket turns a decoded packet into an event.
+func parseChatPacket(roomID int64, p chatPacketData) (ChatEvent, bool) {
+	now := time.Now()
+	switch p.op {
+	case chatOpHeartbeatReply:
+		if len(p.body) < 4 {
+			return ChatEvent{}, false
+		}
+		return ChatEvent{
+			RoomID:     roomID,
+			Cmd:        ChatPopularity,
+			Time:       now,
+			Popularity: int64(binary.BigEndian.Uint32(p.body)),
+		}, true
+	case chatOpMessage:
+	default:
+		return ChatEvent{}, false
+	}
+
+	var msg struct {
+		Cmd  string          `json:"cmd"`
+		Info json.RawMessage `json:"info"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(p.body, &msg); err != nil {
+		return ChatEvent{}, false
+	}
+	cmd, _, _ := strings.Cut(msg.Cmd, ":")
+	ev := ChatEvent{RoomID: roomID, Cmd: cmd, Time: now, Raw: json.RawMessage(p.body)}
+	switch cmd {
+	case ChatDanmaku:
+		ev.Danmaku = parseDanmuMsg(roomID, msg.Info)
+	case ChatGift:
+		var g struct {
+			UID       int64  `json:"uid"`
+			Uname     string `json:"uname"`
+			GiftName  string `json:"giftName"`
+			Num       int    `json:"num"`
+			CoinType  string `json:"coin_type"`
+			TotalCoin int64  `json:"total_coin"`
+			Timestamp int64  `json:"timestamp"`
+		}
+		if json.Unmarshal(msg.Data, &g) == nil {
+			ev.Gift = &Gift{
+				UID: g.UID, Nickname: g.Uname, Name: g.GiftName, Count: g.Num,
+				CoinType: g.CoinType, Coins: g.TotalCoin, Time: unixOr(g.Timestamp, now),
+			}
+		}
+	case ChatSuperChat:
+		var sc struct {
+			UID       int64  `json:"uid"`
+			Message   string `json:"message"`
+			Price     int    `json:"price"`
+			Time      int64  `json:"time"`
+			StartTime int64  `json:"start_time"`
+			UserInfo  struct {
+				Uname string `json:"uname"`
+			} `json:"user_info"`
+		}
+		if json.Unmarshal(msg.Data, &sc) == nil {
+			ev.SuperChat = &SuperChat{
+				UID: sc.UID, Nickname: sc.UserInfo.Uname, Text: sc.Message, Price: sc.Price,
+				Duration: time.Duration(sc.Time) * time.Second, Time: unixOr(sc.StartTime, now),
+			}
+		}
+	case ChatGuardBuy:
+		var g struct {
+			UID        int64  `json:"uid"`
+			Username   string `json:"username"`
+			GuardLevel int    `json:"guard_level"`
+			Num        int    `json:"num"`
+			Price      int64  `json:"price"`
+			StartTime  int64  `json:"start_time"`
+		}
+		if json.Unmarshal(msg.Data, &g) == nil {
+			ev.Guard = &GuardPurchase{
+				UID: g.UID, Nickname: g.Username, Level: g.GuardLevel, Months: g.Num,
+				Price: g.Price, Time: unixOr(g.StartTime, now),
+			}
+		}
+	case ChatInteract:
+		var iw struct {
+			UID       int64  `json:"uid"`
+			Uname     string `json:"uname"`
+			MsgType   int    `json:"msg_type"`
+			Timestamp int64  `json:"timestamp"`
+		}
+		if json.Unmarshal(msg.Data, &iw) == nil {
+			ev.Interaction = &Interaction{
+				UID: iw.UID, Nickname: iw.Uname, Kind: iw.MsgType, Time: unixOr(iw.Timestamp, now),
+			}
+		}
+	case ChatWatched:
+		var w struct {
+			Num int64 `json:"num"`
+		}
+		if json.Unmarshal(msg.Data, &w) == nil {
+			ev.Watched = w.Num
+		}
+	case ChatLikes:
+		var l struct {
+			ClickCount int64 `json:"click_count"`
+		}
+		if json.Unmarshal(msg.Data, &l) == nil {
+			ev.Likes = l.ClickCount
+		}
+	case ChatCutOff, ChatCutOffV2, ChatWarning, ChatRoomLock:
+		ev.Admin = parseAdminAction(cmd, p.body, now)
+	}
+	return ev, true
+}
+
+// parseDanmuMsg reads the positional info array of DANMU_MSG:
+// info[0][4] is the send time in ms, info[0][12] is 1 for an emoticon
+// described by info[0][13], info[1] the text and info[2] the sender as
+// [uid, nickname, admin, ...].
+func parseDanmuMsg(roomID int64, raw json.RawMessage) *Danmaku {
+	var info []json.RawMessage
+	if json.Unmarshal(raw, &info) != nil || len(info) < 3 {
+		return nil
+	}
+	dm := &Danmaku{RoomID: roomID, Time: time.Now()}
+	if json.Unmarshal(info[1], &dm.Text) != nil {
+		return nil
+	}
+	var meta []json.RawMessage
+	if json.Unmarshal(info[0], &meta) == nil && len(meta) > 4 {
+		var ms int64
+		if json.Unmarshal(meta[4], &ms) == nil && ms > 0 {
+			dm.Time = time.UnixMilli(ms)
+		}
+	}
+	if len(meta) > 13 {
+		var dmType int
+		var emo struct {
+			Unique string `json:"emoticon_unique"`
+			URL    string `json:"url"`
+			Width  int    `json:"width"`
+			Height int    `json:"height"`
+		}
+		if json.Unmarshal(meta[12], &dmType) == nil && dmType == 1 &&
+			json.Unmarshal(meta[13], &emo) == nil && emo.URL != "" {
+			dm.Emoticon = &Emoticon{ID: emo.Unique, URL: emo.URL, Width: emo.Width, Height: emo.Height}
+		}
+	}
+	var user []json.RawMessage
+	if json.Unmarshal(info[2], &user) == nil && len(user) > 2 {
+		json.Unmarshal(user[0], &dm.UID)
+		json.Unmarshal(user[1], &dm.Nickname)
+		var admin int
+		json.Unmarshal(user[2], &admin)
+		dm.Admin = admin == 1
+	}
+	return dm
+}
+
+// unixOr converts a Unix time in seconds, or returns def if it is unset.
+func unixOr(sec int64, def time.Time) time.Time {
+	if sec <= 0 {
+		return def
+	}
+	return time.Unix(sec, 0)
+}
+
+// startChat relays the chat of a live room as EventDanmaku, and the
+// commands selected with WithChatCommands as EventChat, until it goes
+// offline, if WithLiveDanmaku is set. Failures to join are retried with backoff while the room is
+// live; dropped connections are re-established by the DanmakuClient.
+func (c *StreamClient) startChat(ctx context.Context, roomID int64, title string) {
+	if c.chat == nil {
+		return
+	}
+	chatCtx, cancel := context.WithCancel(c.monitor.roomContext(ctx, roomID))
+	c.capturesMu.Lock()
+	if prev, ok := c.chatCancel[roomID]; ok {
+		prev()
+	}
+	c.chatCancel[roomID] = cancel
+	c.capturesMu.Unlock()
+
+	go func() {
+		for attempt := 0; chatCtx.Err() == nil; {
+			events, err := c.chat.Connect(chatCtx, roomID)
+			if err != nil {
+				if chatCtx.Err() != nil {
+					return
+				}
+				c.monitor.roomLogger(roomID).Warn("client: failed to join chat, retrying",
+					"attempt", attempt+1, "error", err)
+				if !c.retryWait(chatCtx, attempt) {
+					return
+				}
+				attempt++
+				continue
+			}
+			attempt = 0
+			c.relayChat(roomID, title, events)
+		}
+	}()
+}
+
+// relayChat publishes the events of a chat connection until it ends.
+func (c *StreamClient) relayChat(roomID int64, title string, events <-chan ChatEvent) {
+	for ev := range events {
+		if ev.Admin != nil {
+			c.adminAction(roomID, title, ev.Admin)
+			continue
+		}
+		if ev.Danmaku == nil {
+			if !c.cfg.chatCmds[ev.Cmd] {
+				continue
+			}
+			if ev.typed() {
+				ev.Raw = nil // carried by the typed payload
+			}
+			c.publishStreamEvent(StreamEvent{
+				RoomID: roomID,
+				Type:   EventChat,
+				Title:  title,
+				Chat:   &ev,
+			})
+			continue
+		}
+		c.publishStreamEvent(StreamEvent{
+			RoomID:  roomID,
+			Type:    EventDanmaku,
+			Title:   title,
+			Danmaku: c.placeDanmaku(roomID, ev.Danmaku),
+		})
+	}
+}
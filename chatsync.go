@@ -0,0 +1,152 @@
+package stream
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// ChatSync maps chat message times onto the timeline of one PCM capture
+// (AudioStream.Reader), so chat overlays on a recording line up with what
+// is being said.
+//
+// It estimates the wall-clock time at which the capture's first byte was
+// live — the anchor — from the times the consumer reads the audio: the
+// anchor is the earliest read time minus the audio position read by then,
+// which discounts time the consumer spent before reading. Messages are then
+// placed at their send time minus the anchor. This assumes viewers hear
+// the stream with about the latency of the capture; their remaining
+// offset, including how long they take to react, can be measured with
+// Calibrate.
+//
+// A ChatSync is safe for concurrent use.
+type ChatSync struct {
+	bytesPerSec int64
+
+	mu          sync.Mutex
+	pos         int64 // bytes read from the capture
+	anchor      time.Time
+	hasAnchor   bool
+	corrections []time.Duration // Calibrate samples, sorted
+}
+
+// newChatSync returns a ChatSync for a raw PCM capture, or nil if the
+// capture has no constant byte rate (ADTS).
+func newChatSync(a *AudioStream) *ChatSync {
+	if a.BytesPerFrame <= 0 || a.SampleRate <= 0 {
+		return nil
+	}
+	return &ChatSync{bytesPerSec: int64(a.BytesPerFrame * a.SampleRate)}
+}
+
+// observe records that n more bytes were read at now.
+func (s *ChatSync) observe(now time.Time, n int) {
+	if s == nil || n <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pos += int64(n)
+	at := now.Add(-s.position())
+	if !s.hasAnchor || at.Before(s.anchor) {
+		s.anchor, s.hasAnchor = at, true
+	}
+}
+
+// reanchor restarts the anchor estimate after a discontinuity in the
+// capture, such as a resume after which the audio continues later than
+// its position suggests.
+func (s *ChatSync) reanchor() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hasAnchor = false
+}
+
+// position returns the audio time read so far. s.mu must be held.
+func (s *ChatSync) position() time.Duration {
+	return time.Duration(s.pos * int64(time.Second) / s.bytesPerSec)
+}
+
+// Anchor returns the estimated wall-clock time of the capture's first
+// byte. ok is false until audio has been read.
+func (s *ChatSync) Anchor() (anchor time.Time, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.anchor, s.hasAnchor
+}
+
+// Offset returns the position in the capture at which a chat message sent
+// at t belongs, including the Calibrate correction. It is negative for
+// messages sent before the capture started. ok is false until audio has
+// been read.
+func (s *ChatSync) Offset(t time.Time) (offset time.Duration, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.hasAnchor {
+		return 0, false
+	}
+	return t.Sub(s.anchor) + s.correction(), true
+}
+
+// Calibrate refines the estimate with a known marker: a chat message sent
+// at chatTime that belongs at audioOffset in the capture, e.g. the first
+// of the "1"s the streamer asked for at audioOffset. The correction used
+// is the median over all markers, so a stray marker does little harm.
+// It returns false if no audio has been read yet.
+func (s *ChatSync) Calibrate(chatTime time.Time, audioOffset time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.hasAnchor {
+		return false
+	}
+	c := audioOffset - chatTime.Sub(s.anchor)
+	i, _ := slices.BinarySearch(s.corrections, c)
+	s.corrections = slices.Insert(s.corrections, i, c)
+	return true
+}
+
+// Correction returns the current Calibrate correction, added to every
+// Offset; zero without markers.
+func (s *ChatSync) Correction() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.correction()
+}
+
+// correction returns the median marker correction. s.mu must be held.
+func (s *ChatSync) correction() time.Duration {
+	n := len(s.corrections)
+	switch {
+	case n == 0:
+		return 0
+	case n%2 == 1:
+		return s.corrections[n/2]
+	}
+	return (s.corrections[n/2-1] + s.corrections[n/2]) / 2
+}
+
+// chatSync returns the ChatSync of the room's current capture, if any.
+func (c *StreamClient) chatSync(roomID int64) *ChatSync {
+	c.capturesMu.Lock()
+	defer c.capturesMu.Unlock()
+	return c.syncs[roomID]
+}
+
+// placeDanmaku returns dm with its offset in the room's current capture
+// set, if the capture has a ChatSync.
+func (c *StreamClient) placeDanmaku(roomID int64, dm *Danmaku) *Danmaku {
+	s := c.chatSync(roomID)
+	if s == nil {
+		return dm
+	}
+	off, ok := s.Offset(dm.Time)
+	if !ok {
+		return dm
+	}
+	out := *dm
+	out.AudioOffset, out.HasAudioOffset = off, true
+	return &out
+}
@@ -2,9 +2,12 @@ package stream
 
 import (
 	"context"
-	"log/slog"
+	"errors"
+	"fmt"
+	"io"
 	"math"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,6 +16,22 @@ const (
 	baseRetryDelay     = 2 * time.Second
 	maxRetryDelay      = 2 * time.Minute
 	maxCaptureRetries  = 5
+	maxURLRetries      = 8
+	maxURLRotations    = 3
+)
+
+var (
+	// ErrNotSubscribed is returned by operations that need an active Subscribe.
+	ErrNotSubscribed = errors.New("stream client: not subscribed")
+
+	// ErrStreamURLFailed wraps errors fetching a stream URL in EventError.
+	// These count against the stream URL retry budget (WithRetryBudgets).
+	ErrStreamURLFailed = errors.New("stream url fetch failed")
+
+	// ErrCaptureStartFailed wraps errors starting ffmpeg or waiting for its
+	// first audio in EventError. These count against the capture retry
+	// budget (WithRetryBudgets).
+	ErrCaptureStartFailed = errors.New("capture start failed")
 )
 
 // StreamClient is a high-level client that combines Monitor, stream URL
@@ -22,24 +41,54 @@ const (
 // and starts audio capture (if autoCapture is enabled), emitting StreamEvent
 // on the subscribed channel.
 type StreamClient struct {
-	cfg     clientConfig
-	monitor *Monitor
+	cfg       clientConfig
+	monitor   *Monitor
+	streamers *streamerCache
 
 	subsMu sync.RWMutex
-	subs   []chan StreamEvent
+	subs   []*subscriber
 	closed bool // true after subscriber channels have been closed
 
 	// Track active captures so we can cancel them on room offline.
 	capturesMu sync.Mutex
-	captures   map[int64]context.CancelFunc
+	captures   map[int64]*captureSlot
+	waiting    map[int64]bool         // live rooms without a capture slot (WithMaxConcurrentCaptures) -> captureSlot.manual
+	sessions   map[int64]*liveSession // roomID -> current live session
+	ctx        context.Context        // Subscribe context, used to restart captures on Resume
+
+	groups map[int64]*collabGroup // roomID -> collab group; read-only after construction
+
+	ranks      *RankSampler                 // nil unless WithRankSampling
+	news       *newsWatcher                 // nil unless WithAnnouncementPolling
+	chat       *DanmakuClient               // nil unless WithLiveDanmaku
+	rankCancel map[int64]context.CancelFunc // guarded by capturesMu
+	chatCancel map[int64]context.CancelFunc // guarded by capturesMu
+	cutOffs    map[int64]*AdminAction       // cut-off announced in chat, for the next "offline"; guarded by capturesMu
+
+	recordings  map[int64]*recording         // WithAutoRecord; guarded by capturesMu
+	videoCancel map[int64]context.CancelFunc // current video capture; guarded by capturesMu
+	syncs       map[int64]*ChatSync          // current capture's ChatSync; guarded by capturesMu
+
+	jobs    []*ScheduledJob    // registered with Schedule; guarded by capturesMu
+	standby map[int64]*standby // rooms in warm standby; guarded by capturesMu
+
+	snap      atomic.Pointer[ClientSnapshot] // latest Snapshot
+	snapDirty chan struct{}                  // wakes the snapshot refresher
+
+	prefJobsMu sync.Mutex
+	prefJobs   map[int64][]*ScheduledJob // jobs from RoomPrefs.Schedules
 }
 
 // NewStreamClient creates a StreamClient with the given options.
 func NewStreamClient(opts ...ClientOption) *StreamClient {
 	cfg := clientConfig{
-		interval:    defaultMonitorInterval,
-		audioCfg:    DefaultCaptureConfig(),
-		autoCapture: true,
+		interval:       defaultMonitorInterval,
+		audioCfg:       DefaultCaptureConfig(),
+		quality:        QualityOriginal,
+		autoCapture:    true,
+		clock:          SystemClock(),
+		urlRetries:     maxURLRetries,
+		captureRetries: maxCaptureRetries,
 	}
 	for _, o := range opts {
 		o(&cfg)
@@ -47,26 +96,123 @@ func NewStreamClient(opts ...ClientOption) *StreamClient {
 
 	monitorOpts := []MonitorOption{
 		WithMonitorInterval(cfg.interval),
+		WithMonitorClock(cfg.clock),
 	}
 	if cfg.cookie != "" {
 		monitorOpts = append(monitorOpts, WithCookie(cfg.cookie))
 	}
+	if cfg.credentials != nil {
+		monitorOpts = append(monitorOpts, WithCredentials(*cfg.credentials))
+	}
+	if cfg.credManager != nil {
+		monitorOpts = append(monitorOpts, WithCredentialManager(cfg.credManager))
+	}
+	if len(cfg.cookies) > 0 {
+		monitorOpts = append(monitorOpts, WithCookies(cfg.cookies...))
+	}
+	if cfg.feedInterval > 0 {
+		monitorOpts = append(monitorOpts, WithFeedDetection(cfg.feedInterval))
+	}
+	if cfg.resolver != nil {
+		monitorOpts = append(monitorOpts, WithResolver(cfg.resolver))
+	}
+	if cfg.refresh != nil {
+		monitorOpts = append(monitorOpts, WithCredentialRefresh(cfg.refresh))
+	}
+	if cfg.pollBudget > 0 {
+		monitorOpts = append(monitorOpts, WithPollBudget(cfg.pollBudget))
+	}
+	if cfg.pollWorkers > 0 {
+		monitorOpts = append(monitorOpts, WithPollWorkers(cfg.pollWorkers))
+	}
+	if cfg.batchPolling {
+		monitorOpts = append(monitorOpts, WithBatchPolling(true))
+	}
+	if cfg.monitorMode != PollMode {
+		monitorOpts = append(monitorOpts, WithMonitorMode(cfg.monitorMode))
+	}
+	if cfg.apiClient != nil {
+		monitorOpts = append(monitorOpts, WithAPIClient(cfg.apiClient))
+	}
+	if cfg.coalesce > 0 {
+		monitorOpts = append(monitorOpts, WithSourceCoalescing(cfg.coalesce))
+	}
+	if cfg.onTransition != nil {
+		monitorOpts = append(monitorOpts, WithStateCallback(cfg.onTransition))
+	}
+	var c *StreamClient
+	monitorOpts = append(monitorOpts, WithLifecycleCallback(func(lc RoomLifecycle) {
+		c.publishStreamEvent(StreamEvent{RoomID: lc.RoomID, Type: lc.Type, Reason: lc.Reason, Error: lc.Err})
+	}))
+	monitorOpts = append(monitorOpts, WithAuthExpiredCallback(func(a AuthExpiry) {
+		c.publishStreamEvent(StreamEvent{RoomID: a.RoomID, Type: EventAuthExpired, Error: a.Err})
+	}))
+	if cfg.infoEvents {
+		monitorOpts = append(monitorOpts, WithRoomInfoChanges(func(ch RoomInfoChange) {
+			if ch.Changed(RoomInfoTitle) {
+				c.recordTitle(ch.RoomID, ch.At, ch.New.Title)
+			}
+			c.publishStreamEvent(StreamEvent{
+				RoomID:   ch.RoomID,
+				Type:     EventRoomInfoChanged,
+				Title:    ch.New.Title,
+				RoomInfo: &ch,
+			})
+		}, cfg.infoFields...))
+	}
+
+	groups := make(map[int64]*collabGroup)
+	for _, g := range cfg.groups {
+		for _, id := range g.rooms {
+			groups[id] = g
+		}
+	}
 
-	return &StreamClient{
-		cfg:      cfg,
-		monitor:  NewMonitor(monitorOpts...),
-		captures: make(map[int64]context.CancelFunc),
+	c = &StreamClient{
+		cfg:        cfg,
+		monitor:    NewMonitor(monitorOpts...),
+		streamers:  newStreamerCache(cfg.clock),
+		captures:   make(map[int64]*captureSlot),
+		waiting:    make(map[int64]bool),
+		sessions:   make(map[int64]*liveSession),
+		groups:     groups,
+		rankCancel: make(map[int64]context.CancelFunc),
+		chatCancel: make(map[int64]context.CancelFunc),
+		cutOffs:    make(map[int64]*AdminAction),
+
+		recordings:  make(map[int64]*recording),
+		videoCancel: make(map[int64]context.CancelFunc),
+		syncs:       make(map[int64]*ChatSync),
+		snapDirty:   make(chan struct{}, 1),
+		prefJobs:    make(map[int64][]*ScheduledJob),
+		standby:     make(map[int64]*standby),
+	}
+	if cfg.rankInterval > 0 {
+		c.ranks = NewRankSampler(cfg.rankInterval)
+		c.ranks.clock = cfg.clock
+	}
+	if cfg.newsInterval > 0 {
+		c.news = newNewsWatcher(cfg.newsInterval)
+	}
+	if cfg.chatOpts != nil {
+		opts := append([]DanmakuOption{WithDanmakuClock(cfg.clock)}, cfg.chatOpts...)
+		c.chat = NewDanmakuClient(opts...)
 	}
+	if cfg.prefs != nil {
+		c.loadPrefs()
+	}
+	return c
 }
 
 // Subscribe begins monitoring the given rooms and returns a channel that
 // receives StreamEvent for live/offline transitions, audio readiness, and errors.
-// The channel is closed when ctx is cancelled.
+// Chat events are queued apart from the others (see subscriber). The
+// channel is closed when ctx is cancelled.
 func (c *StreamClient) Subscribe(ctx context.Context, roomIDs []int64) (<-chan StreamEvent, error) {
-	ch := make(chan StreamEvent, streamEventBufSize)
+	sub := newSubscriber()
 
 	c.subsMu.Lock()
-	c.subs = append(c.subs, ch)
+	c.subs = append(c.subs, sub)
 	c.subsMu.Unlock()
 
 	roomEvents, err := c.monitor.Watch(ctx, roomIDs)
@@ -74,35 +220,49 @@ func (c *StreamClient) Subscribe(ctx context.Context, roomIDs []int64) (<-chan S
 		return nil, err
 	}
 
+	c.capturesMu.Lock()
+	c.ctx = ctx
+	c.capturesMu.Unlock()
+
 	// Dispatch goroutine: converts RoomEvents into StreamEvents.
 	go c.dispatch(ctx, roomEvents)
+	go c.refreshSnapshots(ctx)
+	go c.checkFFmpeg(ctx)
+	if c.news != nil {
+		go c.watchNews(ctx)
+	}
+	if c.cfg.dvr != nil {
+		go c.cfg.dvr.Run(ctx)
+	}
+	c.startJobs(ctx)
 
 	// Cleanup goroutine: close subscriber channels when done.
 	go func() {
 		<-ctx.Done()
 		// Cancel all active captures.
 		c.capturesMu.Lock()
-		for roomID, cancel := range c.captures {
-			cancel()
+		for roomID, slot := range c.captures {
+			slot.cancel()
 			delete(c.captures, roomID)
 		}
+		clear(c.cutOffs)
 		c.capturesMu.Unlock()
 
 		c.subsMu.Lock()
 		c.closed = true
 		for _, sub := range c.subs {
-			close(sub)
+			sub.close()
 		}
 		c.subs = nil
 		c.subsMu.Unlock()
 	}()
 
-	return ch, nil
+	return sub.out, nil
 }
 
 // AddRoom adds a room to the client. Safe to call after Subscribe().
-func (c *StreamClient) AddRoom(roomID int64) {
-	c.monitor.AddRoom(roomID)
+func (c *StreamClient) AddRoom(roomID int64, opts ...RoomOption) {
+	c.monitor.AddRoom(roomID, opts...)
 }
 
 // RemoveRoom stops monitoring a room and cancels any active capture.
@@ -110,11 +270,155 @@ func (c *StreamClient) RemoveRoom(roomID int64) {
 	c.monitor.RemoveRoom(roomID)
 
 	c.capturesMu.Lock()
-	if cancel, ok := c.captures[roomID]; ok {
-		cancel()
-		delete(c.captures, roomID)
+	c.cancelCaptureLocked(roomID)
+	delete(c.waiting, roomID)
+	session := c.sessions[roomID]
+	delete(c.sessions, roomID)
+	c.stopLiveTasksLocked(roomID)
+	c.capturesMu.Unlock()
+	c.endSessionWorkDir(roomID, session)
+	c.fillCaptureSlots()
+}
+
+// Pause suspends polling and stops all active captures. Room configuration
+// and live sessions are kept; Resume restarts capture for rooms that are
+// still live.
+func (c *StreamClient) Pause() {
+	c.monitor.Pause()
+
+	c.capturesMu.Lock()
+	for roomID := range c.captures {
+		c.cancelCaptureLocked(roomID)
+	}
+	c.capturesMu.Unlock()
+}
+
+// Resume re-enables polling after Pause and restarts capture for rooms
+// whose last known status is live, unless they are paused individually.
+func (c *StreamClient) Resume() {
+	c.monitor.Resume()
+	for _, roomID := range c.monitor.liveRooms() {
+		c.resumeCapture(roomID)
+	}
+	c.fillCaptureSlots() // StartCapture rooms kept waiting while paused
+}
+
+// PauseRoom suspends polling and stops any active capture for one room.
+func (c *StreamClient) PauseRoom(roomID int64) {
+	c.monitor.PauseRoom(roomID)
+
+	c.capturesMu.Lock()
+	c.cancelCaptureLocked(roomID)
+	c.capturesMu.Unlock()
+	c.fillCaptureSlots()
+}
+
+// ResumeRoom re-enables polling for a room paused with PauseRoom and
+// restarts its capture if the room is still live.
+func (c *StreamClient) ResumeRoom(roomID int64) {
+	c.monitor.ResumeRoom(roomID)
+	if c.monitor.isLive(roomID) {
+		c.resumeCapture(roomID)
+	}
+	c.fillCaptureSlots()
+}
+
+// streamerInfo returns the (cached) profile of the streamer of a room that
+// went live, or nil if it cannot be fetched.
+func (c *StreamClient) streamerInfo(ctx context.Context, ev RoomEvent) *StreamerInfo {
+	if ev.UID == 0 {
+		return nil
+	}
+	info, err := c.streamers.get(ctx, ev.UID)
+	if err != nil {
+		if ctx.Err() == nil {
+			roomLogger(ev.RoomID, ev.Name).Warn("client: failed to get streamer info",
+				"uid", ev.UID, "error", err)
+		}
+		return nil
+	}
+	return info
+}
+
+// StartCapture starts audio capture for a room on demand, independent of
+// auto-capture and the detected live status. An active capture for the room
+// is replaced. Returns ErrNotSubscribed if Subscribe has not been called.
+func (c *StreamClient) StartCapture(roomID int64) error {
+	return c.startCaptureNow(roomID, true)
+}
+
+// startCaptureNow starts or replaces roomID's capture in its current live
+// session.
+func (c *StreamClient) startCaptureNow(roomID int64, manual bool) error {
+	c.capturesMu.Lock()
+	ctx := c.ctx
+	session, ok := c.sessions[roomID]
+	if !ok {
+		session = newLiveSession(c.cfg.clock.Now())
+		c.sessions[roomID] = session
+	}
+	c.capturesMu.Unlock()
+
+	if ctx == nil || ctx.Err() != nil {
+		return ErrNotSubscribed
+	}
+	go c.startCapture(ctx, roomID, session.title, session, manual)
+	return nil
+}
+
+// Diagnostics returns a snapshot of the client's credential allocation.
+// See Monitor.Diagnostics.
+func (c *StreamClient) Diagnostics() Diagnostics {
+	return c.monitor.Diagnostics()
+}
+
+// StopCapture stops the active capture for a room, if any. Monitoring of
+// the room continues.
+func (c *StreamClient) StopCapture(roomID int64) {
+	c.capturesMu.Lock()
+	c.cancelCaptureLocked(roomID)
+	delete(c.waiting, roomID)
+	c.capturesMu.Unlock()
+	c.snapshotChanged()
+	c.fillCaptureSlots()
+}
+
+// resumeCapture restarts capture for a live room after a pause, continuing
+// its existing live session.
+func (c *StreamClient) resumeCapture(roomID int64) {
+	if !c.autoCaptureFor(roomID) || c.monitor.IsPaused(roomID) {
+		return
+	}
+
+	c.capturesMu.Lock()
+	ctx := c.ctx
+	_, capturing := c.captures[roomID]
+	session, ok := c.sessions[roomID]
+	if !ok {
+		session = newLiveSession(c.cfg.clock.Now())
+		c.sessions[roomID] = session
 	}
 	c.capturesMu.Unlock()
+
+	if ctx == nil || ctx.Err() != nil || capturing {
+		return
+	}
+	go c.startCapture(ctx, roomID, session.title, session, false)
+}
+
+// cancelCaptureLocked stops the active capture for a room, if any. A room
+// started with StartCapture keeps waiting for a slot; only StopCapture and
+// RemoveRoom give that up. c.capturesMu must be held.
+func (c *StreamClient) cancelCaptureLocked(roomID int64) {
+	if slot, ok := c.captures[roomID]; ok {
+		slot.cancel()
+		delete(c.captures, roomID)
+	}
+	delete(c.videoCancel, roomID) // stopped with the capture
+	delete(c.syncs, roomID)
+	if !c.waiting[roomID] {
+		delete(c.waiting, roomID)
+	}
 }
 
 // dispatch reads RoomEvents from the monitor and handles them.
@@ -135,96 +439,387 @@ func (c *StreamClient) dispatch(ctx context.Context, roomEvents <-chan RoomEvent
 // handleRoomEvent processes a single RoomEvent.
 func (c *StreamClient) handleRoomEvent(ctx context.Context, ev RoomEvent) {
 	if ev.Live {
+		session := newLiveSession(c.cfg.clock.Now())
+		session.title = ev.Title
+		session.latency = ev.Latency
+		c.capturesMu.Lock()
+		c.sessions[ev.RoomID] = session
+		delete(c.cutOffs, ev.RoomID) // announced late in the previous session
+		c.capturesMu.Unlock()
+		deferCapture := c.joinGroup(ctx, ev.RoomID)
+
 		c.publishStreamEvent(StreamEvent{
-			RoomID: ev.RoomID,
-			Type:   EventLive,
-			Title:  ev.Title,
+			RoomID:    ev.RoomID,
+			Type:      EventLive,
+			Title:     ev.Title,
+			Streamer:  c.streamerInfo(ctx, ev),
+			SessionID: ev.SessionID,
+			Latency:   ev.Latency,
 		})
 
-		if c.cfg.autoCapture {
-			go c.startCapture(ctx, ev.RoomID, ev.Title)
+		if c.autoCaptureFor(ev.RoomID) && !deferCapture {
+			go c.startCapture(ctx, ev.RoomID, ev.Title, session, false)
+		} else {
+			c.fillCaptureSlots() // a StartCapture room may be waiting
+		}
+		c.startRankSampling(ctx, ev.RoomID)
+		c.startChat(ctx, ev.RoomID, ev.Title)
+		c.startRecording(ctx, ev)
+		if c.cfg.danmakuBackfill > 0 {
+			go c.backfillDanmaku(ctx, ev.RoomID, ev.Title)
 		}
 	} else {
 		// Cancel any active capture for this room.
 		c.capturesMu.Lock()
-		if cancel, ok := c.captures[ev.RoomID]; ok {
-			cancel()
-			delete(c.captures, ev.RoomID)
-		}
+		cutOff := c.cutOffs[ev.RoomID]
+		c.cancelCaptureLocked(ev.RoomID)
+		c.stopLiveTasksLocked(ev.RoomID)
+		session := c.sessions[ev.RoomID]
+		delete(c.sessions, ev.RoomID)
 		c.capturesMu.Unlock()
 
+		var summary *SessionSummary
+		if session != nil {
+			summary = session.summary(c.cfg.audioCfg, c.cfg.clock.Now())
+		}
+
 		c.publishStreamEvent(StreamEvent{
-			RoomID: ev.RoomID,
-			Type:   EventOffline,
-			Title:  ev.Title,
+			RoomID:    ev.RoomID,
+			Type:      EventOffline,
+			Title:     ev.Title,
+			Session:   summary,
+			SessionID: ev.SessionID,
+			Admin:     cutOff,
 		})
+		c.leaveGroup(ev.RoomID)
+		c.endSessionWorkDir(ev.RoomID, session)
+		c.fillCaptureSlots()
 	}
 }
 
-// startCapture fetches the stream URL and starts ffmpeg audio capture,
-// retrying on failure with exponential backoff.
-func (c *StreamClient) startCapture(ctx context.Context, roomID int64, title string) {
-	captureCtx, cancel := context.WithCancel(ctx)
+// stopLiveTasksLocked stops the room's rank sampling, chat connection and
+// recording, and forgets a cut-off announced in its chat.
+// Caller must hold capturesMu.
+func (c *StreamClient) stopLiveTasksLocked(roomID int64) {
+	delete(c.cutOffs, roomID)
+	if cancel, ok := c.rankCancel[roomID]; ok {
+		cancel()
+		delete(c.rankCancel, roomID)
+	}
+	if cancel, ok := c.chatCancel[roomID]; ok {
+		cancel()
+		delete(c.chatCancel, roomID)
+	}
+	if rec, ok := c.recordings[roomID]; ok {
+		rec.cancel()
+		delete(c.recordings, roomID)
+	}
+}
 
+// startRankSampling emits EventRank for a live room until it goes offline,
+// if rank sampling is enabled.
+func (c *StreamClient) startRankSampling(ctx context.Context, roomID int64) {
+	if c.ranks == nil {
+		return
+	}
+	rankCtx, cancel := context.WithCancel(c.monitor.roomContext(ctx, roomID))
 	c.capturesMu.Lock()
-	if prevCancel, ok := c.captures[roomID]; ok {
-		prevCancel()
+	if prev, ok := c.rankCancel[roomID]; ok {
+		prev()
 	}
-	c.captures[roomID] = cancel
+	c.rankCancel[roomID] = cancel
 	c.capturesMu.Unlock()
 
-	for attempt := 0; attempt < maxCaptureRetries; attempt++ {
-		if captureCtx.Err() != nil {
+	go c.ranks.Run(rankCtx, roomID, func(snap *RankSnapshot, err error) {
+		if err != nil {
+			c.monitor.roomLogger(roomID).Warn("client: rank sample failed", "error", err)
 			return
 		}
+		c.publishStreamEvent(StreamEvent{RoomID: roomID, Type: EventRank, Rank: snap})
+	})
+}
 
-		streamURL, err := GetStreamURL(captureCtx, roomID)
-		if err != nil {
-			slog.Warn("client: failed to get stream URL",
-				"room_id", roomID, "attempt", attempt+1, "error", err)
+// startCapture fetches the stream URL and starts ffmpeg audio capture,
+// retrying on failure with exponential backoff. Bytes read from the
+// returned audio stream and retries are recorded on session.
+//
+// A capture is considered started once ffmpeg produces its first byte. If the
+// CDN rejects the URL (403/404), a fresh URL on a different host is fetched
+// and tried immediately, without consuming a backoff attempt. A capture
+// whose ffmpeg ends while the room is live, including one that stalls
+// (CaptureConfig.StallTimeout) or underruns with
+// CaptureConfig.RestartOnUnderrun, is resumed in place (see resumable).
+//
+// The capture holds its WithMaxConcurrentCaptures slot until it is
+// cancelled, its retries are exhausted or its audio ends for good; manual
+// marks a capture started with StartCapture.
+func (c *StreamClient) startCapture(ctx context.Context, roomID int64, title string, session *liveSession, manual bool) {
+	captureCtx, cancel := context.WithCancel(c.monitor.roomContext(ctx, roomID))
+	slot := &captureSlot{cancel: cancel, manual: manual}
+	if !c.claimCaptureSlot(roomID, title, slot) {
+		cancel()
+		return
+	}
+	c.runCapture(captureCtx, roomID, title, session, slot)
+}
+
+// runCapture runs the capture of roomID in captureCtx, holding slot, which
+// must already be in c.captures, until it ends.
+func (c *StreamClient) runCapture(captureCtx context.Context, roomID int64, title string, session *liveSession, slot *captureSlot) {
+	cancel := slot.cancel
+	go func() {
+		<-captureCtx.Done()
+		c.releaseCaptureSlot(roomID, slot)
+	}()
+
+	// Attach the room to capture logs, including ffmpeg stderr lines.
+	audioCfg := c.cfg.audioCfg
+	if audioCfg.Logger == nil {
+		audioCfg.Logger = c.monitor.roomLogger(roomID)
+	}
+	if relays := c.monitor.relayOutputs(roomID); len(relays) > 0 {
+		audioCfg.Outputs = append(append([]OutputSpec(nil), audioCfg.Outputs...), relays...)
+	}
+	audioCfg.clock = c.cfg.clock
+	audioCfg.onCrash = func(crash CaptureCrash) {
+		c.publishStreamEvent(StreamEvent{
+			RoomID: roomID,
+			Type:   EventCaptureCrashed,
+			Title:  title,
+			Crash:  &crash,
+		})
+	}
+	// A stalled or underrunning ffmpeg fails the reader, which the
+	// resumingReader restarts in place (see resumable).
+	audioCfg.onStall = func(err error) {
+		c.publishStreamEvent(StreamEvent{
+			RoomID: roomID,
+			Type:   EventError,
+			Error:  err,
+			Title:  title,
+		})
+	}
+	audioCfg.onUnderrun = func(u CaptureUnderrun) {
+		c.publishStreamEvent(StreamEvent{
+			RoomID:   roomID,
+			Type:     EventCaptureUnderrun,
+			Title:    title,
+			Underrun: &u,
+		})
+	}
+
+	reader, streamURL, ok := c.openCapture(captureCtx, roomID, title, session, &audioCfg, false)
+	if !ok {
+		cancel()
+		return
+	}
+
+	c.monitor.roomLogger(roomID).Info("client: audio capture started")
+	if c.cfg.heartbeat {
+		go c.runHeartbeat(captureCtx, roomID)
+	}
+	audio := &AudioStream{RoomID: roomID, Cancel: cancel, WorkDir: c.sessionWorkDir(roomID, session)}
+	audio.setFormat(reader, audioCfg)
+	audio.StreamPTS, audio.HasStreamPTS = StreamPTS(reader)
+	reader = c.resumable(captureCtx, audio, reader, title, session, &audioCfg)
+	if c.cfg.dvr != nil {
+		reader = c.cfg.dvr.Tee(roomID, reader)
+	}
+	reader = c.startDiarizer(captureCtx, audio, reader, title)
+	audio.ChatSync = newChatSync(audio)
+	audio.Reader = &countingReader{ReadCloser: reader, session: session, sync: audio.ChatSync, clock: c.cfg.clock, ended: cancel}
+	if audio.ChatSync != nil {
+		c.capturesMu.Lock()
+		if captureCtx.Err() == nil {
+			c.syncs[roomID] = audio.ChatSync
+		}
+		c.capturesMu.Unlock()
+	}
+	var latency *GoLiveLatency
+	if session.latency != nil && session.audioSeen.CompareAndSwap(false, true) {
+		latency = session.latency.withFirstAudio(c.cfg.clock.Now())
+	}
+	c.publishStreamEvent(StreamEvent{
+		RoomID:  roomID,
+		Type:    EventAudioReady,
+		Audio:   audio,
+		Title:   title,
+		Latency: latency,
+	})
+	c.startVideo(captureCtx, roomID, streamURL, title)
+}
+
+// openCapture fetches a stream URL and starts ffmpeg until audio flows,
+// with the retry budget of startCapture, and returns the reader and the
+// URL it reads. The first attempt counts as a restart of the session's
+// capture if resuming is set. ok is false if the capture was stopped or
+// retries were exhausted.
+func (c *StreamClient) openCapture(captureCtx context.Context, roomID int64, title string, session *liveSession, audioCfg *CaptureConfig, resuming bool) (reader io.ReadCloser, streamURL string, ok bool) {
+	badHosts := make(map[string]bool)
+	rotations, tries := 0, 0
+	urlFails, captureFails := 0, 0
+	for urlFails < c.cfg.urlRetries && captureFails < c.cfg.captureRetries {
+		if captureCtx.Err() != nil {
+			return nil, "", false
+		}
+		if tries > 0 || resuming {
+			session.restarts.Add(1)
+		}
+		tries++
+
+		streamURL, play, err := pickStreamURL(captureCtx, roomID, c.roomQuality(roomID), badHosts)
+		if errors.Is(err, ErrGuardRequired) {
+			// Retrying cannot help until a qualifying cookie is configured.
+			c.monitor.roomLogger(roomID).Warn("client: stream is member-only", "error", err)
 			c.publishStreamEvent(StreamEvent{
 				RoomID: roomID,
 				Type:   EventError,
 				Error:  err,
 				Title:  title,
 			})
-			if !c.retryWait(captureCtx, attempt) {
-				return
+			return nil, "", false
+		}
+		if err != nil {
+			c.monitor.roomLogger(roomID).Warn("client: failed to get stream URL",
+				"attempt", urlFails+1, "error", err)
+			c.publishStreamEvent(StreamEvent{
+				RoomID: roomID,
+				Type:   EventError,
+				Error:  fmt.Errorf("%w: %w", ErrStreamURLFailed, err),
+				Title:  title,
+			})
+			urlFails++
+			if urlFails >= c.cfg.urlRetries {
+				break
+			}
+			if !c.retryWait(captureCtx, urlFails-1) {
+				return nil, "", false
 			}
 			continue
 		}
+		c.reportQuality(roomID, title, session, play)
 
-		reader, err := CaptureAudio(captureCtx, streamURL, &c.cfg.audioCfg)
+		reader, err := CaptureAudio(captureCtx, streamURL, audioCfg)
+		if err == nil {
+			reader, err = awaitFirstByte(reader)
+		}
 		if err != nil {
-			slog.Warn("client: failed to start capture",
-				"room_id", roomID, "attempt", attempt+1, "error", err)
+			if captureCtx.Err() != nil {
+				return nil, "", false
+			}
+			if isCDNError(err) && rotations < maxURLRotations {
+				rotations++
+				host := streamHost(streamURL)
+				badHosts[host] = true
+				c.monitor.roomLogger(roomID).Warn("client: CDN rejected stream, rotating host",
+					"host", host, "error", err)
+				continue // host rotation does not consume a retry attempt
+			}
+			c.monitor.roomLogger(roomID).Warn("client: failed to start capture",
+				"attempt", captureFails+1, "error", err)
 			c.publishStreamEvent(StreamEvent{
 				RoomID: roomID,
 				Type:   EventError,
-				Error:  err,
+				Error:  fmt.Errorf("%w: %w", ErrCaptureStartFailed, err),
 				Title:  title,
 			})
-			if !c.retryWait(captureCtx, attempt) {
-				return
+			captureFails++
+			if captureFails >= c.cfg.captureRetries {
+				break
+			}
+			if !c.retryWait(captureCtx, captureFails-1) {
+				return nil, "", false
 			}
 			continue
 		}
+		return reader, streamURL, true
+	}
 
-		slog.Info("client: audio capture started", "room_id", roomID)
-		c.publishStreamEvent(StreamEvent{
-			RoomID: roomID,
-			Type:   EventAudioReady,
-			Audio: &AudioStream{
-				RoomID: roomID,
-				Reader: reader,
-				Cancel: cancel,
-			},
-			Title: title,
-		})
+	if urlFails >= c.cfg.urlRetries {
+		c.monitor.roomLogger(roomID).Error("client: exhausted stream URL retries", "attempts", urlFails)
+	} else {
+		c.monitor.roomLogger(roomID).Error("client: exhausted capture retries", "attempts", captureFails)
+	}
+	return nil, "", false
+}
+
+// sessionWorkDir returns the session's WithWorkDir directory, creating it
+// on the session's first capture. Returns "" without a WorkDir or if the
+// directory cannot be created.
+func (c *StreamClient) sessionWorkDir(roomID int64, session *liveSession) string {
+	if c.cfg.workDir == nil {
+		return ""
+	}
+	session.workMu.Lock()
+	defer session.workMu.Unlock()
+	if session.workDir == "" {
+		dir, err := c.cfg.workDir.NewSession(roomID)
+		if err != nil {
+			c.monitor.roomLogger(roomID).Warn("client: failed to create session dir", "error", err)
+			return ""
+		}
+		session.workDir = dir
+	}
+	return session.workDir
+}
+
+// endSessionWorkDir removes the session's WithWorkDir directory, if any.
+func (c *StreamClient) endSessionWorkDir(roomID int64, session *liveSession) {
+	if session == nil {
 		return
 	}
+	session.workMu.Lock()
+	dir := session.workDir
+	session.workDir = ""
+	session.workMu.Unlock()
+	if dir == "" {
+		return
+	}
+	if err := c.cfg.workDir.EndSession(dir); err != nil {
+		c.monitor.roomLogger(roomID).Warn("client: failed to remove session dir", "error", err)
+	}
+}
+
+// pickStreamURL fetches fresh stream URLs for a room at quality qn and
+// returns the first one whose CDN host has not failed. If every host has
+// failed, the preferred URL is returned and the normal retry schedule
+// applies.
+func pickStreamURL(ctx context.Context, roomID int64, qn int, badHosts map[string]bool) (string, *PlayURLs, error) {
+	play, err := GetPlayURLs(ctx, roomID, qn)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, u := range play.URLs {
+		if !badHosts[streamHost(u)] {
+			return u, play, nil
+		}
+	}
+	return play.URLs[0], play, nil
+}
 
-	slog.Error("client: exhausted capture retries", "room_id", roomID)
+// reportQuality emits EventQualityFallback when a capture gets a different
+// quality than requested, once per session and served quality, so restarts
+// at the same fallback quality do not repeat it.
+func (c *StreamClient) reportQuality(roomID int64, title string, session *liveSession, play *PlayURLs) {
+	if !play.Fallback() {
+		session.quality.Store(0)
+		return
+	}
+	if session.quality.Swap(int32(play.Quality)) == int32(play.Quality) {
+		return
+	}
+	c.monitor.roomLogger(roomID).Info("client: requested quality unavailable, falling back",
+		"requested", QualityName(play.Requested), "actual", QualityName(play.Quality))
+	c.publishStreamEvent(StreamEvent{
+		RoomID: roomID,
+		Type:   EventQualityFallback,
+		Title:  title,
+		Quality: &QualityFallback{
+			Requested: play.Requested,
+			Actual:    play.Quality,
+			Accepted:  play.Accepted,
+		},
+	})
 }
 
 // retryWait waits with exponential backoff. Returns false if the context
@@ -238,24 +833,47 @@ func (c *StreamClient) retryWait(ctx context.Context, attempt int) bool {
 	select {
 	case <-ctx.Done():
 		return false
-	case <-time.After(delay):
+	case <-c.cfg.clock.After(delay):
 		return true
 	}
 }
 
 // publishStreamEvent fans out a StreamEvent to all subscriber channels.
+// Subscribers whose queue is full miss the event; if none took it, its
+// capture is released so the ffmpeg process and capture slot do not leak.
 func (c *StreamClient) publishStreamEvent(ev StreamEvent) {
+	defer c.snapshotChanged()
+	if ev.Name == "" {
+		ev.Name = c.monitor.RoomName(ev.RoomID)
+	}
+	if ev.Group == "" {
+		ev.Group, ev.GroupSession = c.groupSession(ev.RoomID)
+	}
+	if ev.SessionID == "" {
+		ev.SessionID = c.monitor.SessionID(ev.RoomID)
+	}
+	if ev.UID == 0 {
+		ev.UID, _ = LookupUID(ev.RoomID)
+	}
+	ev.Muted = ev.Muted || c.monitor.IsMuted(ev.RoomID)
+	ev.Area, ev.LanguageHint = c.monitor.roomHints(ev.RoomID)
+
 	c.subsMu.RLock()
 	defer c.subsMu.RUnlock()
 	if c.closed {
+		releaseStreams(ev)
 		return
 	}
-	for _, ch := range c.subs {
-		select {
-		case ch <- ev:
-		default:
-			slog.Warn("client: subscriber channel full, dropping event",
-				"room_id", ev.RoomID, "type", ev.Type)
+	taken := false
+	for _, sub := range c.subs {
+		if sub.offer(ev) {
+			taken = true
+			continue
 		}
+		roomLogger(ev.RoomID, ev.Name).Warn("client: subscriber channel full, dropping event",
+			"type", ev.Type)
+	}
+	if !taken {
+		releaseStreams(ev)
 	}
 }
@@ -6,8 +6,47 @@ import "time"
 type clientConfig struct {
 	interval    time.Duration
 	cookie      string
+	cookies     []string
+	credentials *Credentials
+	credManager *CredentialManager
 	audioCfg    CaptureConfig
+	quality     int
+	prefs       *PrefStore
 	autoCapture bool
+	maxCaptures int // 0 is unlimited
+	gapFill     time.Duration
+	dvr         *DVR
+
+	feedInterval time.Duration
+	onTransition func(StateTransition)
+	heartbeat    bool
+	clock        Clock
+	pollBudget   int
+	pollWorkers  int
+	batchPolling bool
+	monitorMode  MonitorMode
+	coalesce     time.Duration
+	apiClient    *APIClient
+	groups       []*collabGroup
+
+	urlRetries     int
+	captureRetries int
+
+	refresh CredentialRefresher
+
+	rankInterval    time.Duration
+	newsInterval    time.Duration
+	infoEvents      bool     // WithRoomInfoEvents
+	infoFields      []string // fields compared for WithRoomInfoEvents; nil for all
+	danmakuBackfill time.Duration
+	diarizer        Diarizer
+	videoCfg        *VideoConfig
+	recordOpts      []RecorderOption // non-nil enables WithAutoRecord
+	concatQueue     *JobQueue        // WithAutoConcat
+	chatOpts        []DanmakuOption  // non-nil enables WithLiveDanmaku
+	chatCmds        map[string]bool  // WithChatCommands
+	resolver        Resolver
+	workDir         *WorkDir
 }
 
 // ClientOption configures a StreamClient.
@@ -21,6 +60,31 @@ func WithInterval(d time.Duration) ClientOption {
 	}
 }
 
+// WithClientCookies spreads the client's API requests over several
+// SESSDATA cookies. See WithCookies.
+func WithClientCookies(sessdata ...string) ClientOption {
+	return func(c *clientConfig) {
+		c.cookies = sessdata
+	}
+}
+
+// WithClientCredentials authenticates the client's API requests with the
+// full cookie set of a login. See WithCredentials.
+func WithClientCredentials(creds Credentials) ClientOption {
+	return func(c *clientConfig) {
+		c.credentials = &creds
+	}
+}
+
+// WithClientCredentialManager authenticates the client's requests with
+// the credentials of cm, which validates and refreshes them. See
+// WithCredentialManager.
+func WithClientCredentialManager(cm *CredentialManager) ClientOption {
+	return func(c *clientConfig) {
+		c.credManager = cm
+	}
+}
+
 // WithClientCookie sets the SESSDATA cookie for authenticated API requests.
 func WithClientCookie(sessdata string) ClientOption {
 	return func(c *clientConfig) {
@@ -35,6 +99,25 @@ func WithAudioConfig(cfg CaptureConfig) ClientOption {
 	}
 }
 
+// WithQuality sets the stream quality captures ask for, e.g. QualityHD to
+// save bandwidth when only the audio is used. Default is QualityOriginal.
+// If it is not available to the client's credentials, the best available
+// quality is captured and EventQualityFallback is emitted.
+func WithQuality(qn int) ClientOption {
+	return func(c *clientConfig) {
+		c.quality = qn
+	}
+}
+
+// WithPrefStore keeps per-room overrides (RoomPrefs) in s, so changes made
+// at runtime with SetRoomPrefs survive restarts. Stored schedules are
+// registered when the client is created.
+func WithPrefStore(s *PrefStore) ClientOption {
+	return func(c *clientConfig) {
+		c.prefs = s
+	}
+}
+
 // WithAutoCapture controls whether audio capture starts automatically when
 // a room goes live. Default is true.
 func WithAutoCapture(enabled bool) ClientOption {
@@ -42,3 +125,287 @@ func WithAutoCapture(enabled bool) ClientOption {
 		c.autoCapture = enabled
 	}
 }
+
+// WithMaxConcurrentCaptures limits the client to n audio captures at a
+// time. When a room goes live with every slot taken, the capture of a
+// lower-priority room (WithCapturePriority) is stopped to make room and
+// reported with EventCapturePreempted; its reader ends, so the consumer
+// finalizes the segment as on any end of a capture. If no capture has a
+// lower priority, the new room gets EventCaptureSkipped. Rooms that lost
+// or never got a slot, including captures started with StartCapture, are
+// captured, highest priority first, when a slot frees up while they are
+// still live. A slot frees up when its capture is stopped, cancelled with
+// AudioStream.Cancel or closed, gives up retrying, or its audio ends.
+// Default is 0: unlimited.
+func WithMaxConcurrentCaptures(n int) ClientOption {
+	return func(c *clientConfig) {
+		c.maxCaptures = n
+	}
+}
+
+// WithAudioGapFill fills the gap of a resumed capture (EventAudioGap) with
+// up to max of silence, so the audio timeline of AudioStream.Reader keeps
+// up with the wall clock and STT timestamps stay aligned. Gaps longer than
+// max are filled partially. Only raw PCM can be filled; ADTS captures
+// still report the gap. Default is 0: no silence is inserted.
+func WithAudioGapFill(max time.Duration) ClientOption {
+	return func(c *clientConfig) {
+		c.gapFill = max
+	}
+}
+
+// WithDVR records every audio capture into d, so past audio can be
+// retrieved with d.ReadRange while the consumer reads the live stream.
+// Subscribe runs d's pruning (DVR.Run) until its context is done.
+func WithDVR(d *DVR) ClientOption {
+	return func(c *clientConfig) {
+		c.dvr = d
+	}
+}
+
+// WithClientFeedDetection enables dynamic feed backup detection on the
+// client's monitor. See WithFeedDetection.
+func WithClientFeedDetection(d time.Duration) ClientOption {
+	return func(c *clientConfig) {
+		c.feedInterval = d
+	}
+}
+
+// WithClientPollBudget caps the client's room info polling at perMinute
+// requests per minute. See WithPollBudget.
+func WithClientPollBudget(perMinute int) ClientOption {
+	return func(c *clientConfig) {
+		c.pollBudget = perMinute
+	}
+}
+
+// WithClientMonitorMode selects how the client's monitor detects live
+// transitions. See WithMonitorMode.
+func WithClientMonitorMode(mode MonitorMode) ClientOption {
+	return func(c *clientConfig) {
+		c.monitorMode = mode
+	}
+}
+
+// WithClientSourceCoalescing coalesces the reports of the client monitor's
+// detection sources. See WithSourceCoalescing.
+func WithClientSourceCoalescing(window time.Duration) ClientOption {
+	return func(c *clientConfig) {
+		c.coalesce = window
+	}
+}
+
+// WithClientAPIClient makes the client's API requests with c. See
+// WithAPIClient.
+func WithClientAPIClient(c *APIClient) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.apiClient = c
+	}
+}
+
+// WithClientPollWorkers polls the client's rooms from n shared workers.
+// See WithPollWorkers.
+func WithClientPollWorkers(n int) ClientOption {
+	return func(c *clientConfig) {
+		c.pollWorkers = n
+	}
+}
+
+// WithClientBatchPolling checks the client's rooms with batch status
+// requests. See WithBatchPolling.
+func WithClientBatchPolling(enabled bool) ClientOption {
+	return func(c *clientConfig) {
+		c.batchPolling = enabled
+	}
+}
+
+// WithClientCredentialRefresh registers a callback that supplies a new
+// SESSDATA when the client's cookie expires. See WithCredentialRefresh.
+func WithClientCredentialRefresh(fn CredentialRefresher) ClientOption {
+	return func(c *clientConfig) {
+		c.refresh = fn
+	}
+}
+
+// WithClientResolver resolves host names for the client's API requests
+// and captures with r. See WithResolver.
+func WithClientResolver(r Resolver) ClientOption {
+	return func(c *clientConfig) {
+		c.resolver = r
+	}
+}
+
+// WithWorkDir gives every live session a scratch directory under w,
+// reported as AudioStream.WorkDir and removed when the room goes offline
+// or is removed.
+func WithWorkDir(w *WorkDir) ClientOption {
+	return func(c *clientConfig) {
+		c.workDir = w
+	}
+}
+
+// WithRankSampling emits an EventRank with a RankSnapshot every d while a
+// room is live. Each sample costs three API requests. Disabled by default.
+func WithRankSampling(d time.Duration) ClientOption {
+	return func(c *clientConfig) {
+		c.rankInterval = d
+	}
+}
+
+// WithAnnouncementPolling checks every watched room's announcement
+// (RoomNews) every d, costing one request per room, and emits
+// EventAnnouncementChanged when it changes. Tag changes picked up by the
+// regular room info polling are reported as EventTagsChanged on the same
+// schedule. Values seen first after start are not reported. Disabled by
+// default.
+func WithAnnouncementPolling(d time.Duration) ClientOption {
+	return func(c *clientConfig) {
+		c.newsInterval = d
+	}
+}
+
+// WithRoomInfoEvents emits EventRoomInfoChanged when the monitor's room
+// info polling finds the title, area, cover or online count of a room
+// changed, limited to the given RoomInfo* fields if any are passed. It
+// costs no extra requests. See WithRoomInfoChanges.
+func WithRoomInfoEvents(fields ...string) ClientOption {
+	return func(c *clientConfig) {
+		c.infoEvents = true
+		c.infoFields = fields
+	}
+}
+
+// WithLiveDanmaku connects to the chat of every room while it is live
+// (DanmakuClient) and emits each chat message as EventDanmaku. Other
+// commands are only emitted if selected with WithChatCommands.
+func WithLiveDanmaku(opts ...DanmakuOption) ClientOption {
+	return func(c *clientConfig) {
+		c.chatOpts = append([]DanmakuOption{}, opts...)
+	}
+}
+
+// WithChatCommands emits the listed chat commands, e.g. ChatGift or
+// ChatSuperChat, as EventChat while WithLiveDanmaku is set. By default
+// none are, as busy rooms send many INTERACT_WORD and counter updates.
+func WithChatCommands(cmds ...string) ClientOption {
+	return func(c *clientConfig) {
+		c.chatCmds = make(map[string]bool, len(cmds))
+		for _, cmd := range cmds {
+			c.chatCmds[cmd] = true
+		}
+	}
+}
+
+// WithDanmakuBackfill emits the chat messages of the last window before a
+// room was detected live as EventDanmaku events marked Backfilled, so a
+// client started in the middle of a broadcast does not miss its recent
+// chat. Only messages sent since the broadcast started are included, and
+// Bilibili keeps only the last few, so a window of a few minutes is
+// typical. Disabled by default.
+func WithDanmakuBackfill(window time.Duration) ClientOption {
+	return func(c *clientConfig) {
+		c.danmakuBackfill = window
+	}
+}
+
+// WithDiarizer runs d over every PCM capture and emits the speaker
+// changes it finds as EventSpeakerChange, e.g. to split multi-host streams
+// into per-speaker segments before transcription. d sees the audio as the
+// consumer reads it; if it cannot keep up, the audio it misses is replaced
+// by silence so offsets stay aligned. ADTS captures are not diarized.
+func WithDiarizer(d Diarizer) ClientOption {
+	return func(c *clientConfig) {
+		c.diarizer = d
+	}
+}
+
+// WithVideoConfig captures each live room's video with cfg next to its
+// audio and emits the stream as EventVideoReady, e.g. for recorders or
+// thumbnail extractors. The video capture uses the audio capture's stream
+// URL and stops and restarts with it; each restart emits a new
+// EventVideoReady. The consumer must read or cancel every VideoStream.
+// A video capture that fails to start emits EventError without affecting
+// the audio.
+func WithVideoConfig(cfg VideoConfig) ClientOption {
+	return func(c *clientConfig) {
+		c.videoCfg = &cfg
+	}
+}
+
+// WithAutoRecord records every live room's stream to disk with a
+// Recorder configured by opts, independent of audio capture, until the
+// room goes offline. When the CDN drops the connection, recording resumes
+// in a new file with the next segment number. Failures are reported as
+// EventError and retried within the capture retry budget
+// (WithRetryBudgets).
+func WithAutoRecord(enabled bool, opts ...RecorderOption) ClientOption {
+	return func(c *clientConfig) {
+		c.recordOpts = nil
+		if enabled {
+			c.recordOpts = append([]RecorderOption{}, opts...)
+		}
+	}
+}
+
+// WithAutoConcat keeps a SessionManifest for each session recorded with
+// WithAutoRecord, named after its session ID (e.g. 21452505-1700000000.json)
+// in the recording directory, and enqueues a JobConcat job for it on q
+// once the room goes offline. Register ConcatHandler on q and run it; the
+// joined file is written next to the manifest with a .mkv extension. The
+// manifest replaces one given with WithRecordManifest.
+func WithAutoConcat(q *JobQueue) ClientOption {
+	return func(c *clientConfig) {
+		c.concatQueue = q
+	}
+}
+
+// WithRetryBudgets sets independent retry budgets for starting a capture:
+// urlRetries failed stream URL fetches (default 8) and captureRetries failed
+// ffmpeg starts (default 5), so a flaky play URL endpoint does not use up
+// the attempts meant for capture problems. Each budget has its own backoff
+// schedule. CDN host rotations count against neither.
+func WithRetryBudgets(urlRetries, captureRetries int) ClientOption {
+	return func(c *clientConfig) {
+		c.urlRetries = urlRetries
+		c.captureRetries = captureRetries
+	}
+}
+
+// WithCollabGroup defines a collab group: when any of roomIDs goes live,
+// the other members are checked at once and, after waiting up to wait for
+// stragglers, capture starts for every live member simultaneously. Members
+// going live later in the same collab start capturing immediately. Events
+// of members carry the group name and a shared GroupSession ID until all
+// members are offline. The rooms must also be watched (Subscribe/AddRoom);
+// a room belongs to at most one group.
+func WithCollabGroup(name string, wait time.Duration, roomIDs ...int64) ClientOption {
+	return func(c *clientConfig) {
+		c.groups = append(c.groups, &collabGroup{name: name, rooms: roomIDs, wait: wait})
+	}
+}
+
+// WithClientStateCallback registers a room state transition callback on the
+// client's monitor. See WithStateCallback.
+func WithClientStateCallback(fn func(StateTransition)) ClientOption {
+	return func(c *clientConfig) {
+		c.onTransition = fn
+	}
+}
+
+// WithHeartbeat enables live watch heartbeats while a room is being
+// captured, so the account configured with WithClientCookie (or per-room
+// request options) shows as watching. Some member-only streams require it to
+// keep the play URL valid for long sessions. Default is false.
+func WithHeartbeat(enabled bool) ClientOption {
+	return func(c *clientConfig) {
+		c.heartbeat = enabled
+	}
+}
+
+// WithClock sets the time source for monitoring, capture retry backoff,
+// heartbeats and session timing. Default is SystemClock().
+func WithClock(c Clock) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.clock = c
+	}
+}
@@ -0,0 +1,144 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Caption is one timed line of text for BurnCaptions, relative to the
+// start of the video.
+type Caption struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string
+}
+
+// WriteSRT writes captions in SubRip (.srt) format.
+func WriteSRT(w io.Writer, captions []Caption) error {
+	for i, c := range captions {
+		if c.End < c.Start {
+			return fmt.Errorf("srt: caption %d ends before it starts", i+1)
+		}
+		text := strings.TrimSpace(strings.ReplaceAll(c.Text, "\r\n", "\n"))
+		// A blank line would end the cue early.
+		for strings.Contains(text, "\n\n") {
+			text = strings.ReplaceAll(text, "\n\n", "\n")
+		}
+		if _, err := fmt.Fprintf(w, "%d\n%s --> %s\n%s\n\n", i+1, srtTime(c.Start), srtTime(c.End), text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// srtTime formats d as HH:MM:SS,mmm.
+func srtTime(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// BurnCaptions renders captions into the picture of the video in, writing
+// the result to out, so the clip plays with subtitles anywhere. The video is
+// re-encoded (libx264 unless cfg.Args selects another video codec with
+// -c:v); audio is copied. cfg may set Progress, Logger and further output
+// Args as for Transcode; its Codec, InputFormat and AudioOnly are ignored.
+// Needs an ffmpeg built with libass.
+func BurnCaptions(ctx context.Context, in, out string, captions []Caption, cfg *TranscodeConfig) error {
+	f, err := os.CreateTemp("", "captions-*.srt")
+	if err != nil {
+		return fmt.Errorf("burn captions: %w", err)
+	}
+	defer os.Remove(f.Name())
+	err = WriteSRT(f, captions)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("burn captions: write subtitles: %w", err)
+	}
+
+	c := TranscodeConfig{}
+	if cfg != nil {
+		c = *cfg
+	}
+	c.InputFormat, c.AudioOnly, c.Codec = "", false, "copy"
+	args := []string{"-vf", "subtitles=" + escapeFilterArg(f.Name())}
+	if !hasArg(c.Args, "-c:v") {
+		args = append(args, "-c:v", "libx264")
+	}
+	c.Args = append(args, c.Args...)
+	if err := Transcode(ctx, in, out, &c); err != nil {
+		return fmt.Errorf("burn captions: %w", err)
+	}
+	return nil
+}
+
+// Thumbnail writes the frame of the video in at offset at to the image out.
+// The image format follows out's extension (.jpg, .png or .webp). A
+// positive width scales the image to that width, keeping the aspect ratio.
+func Thumbnail(ctx context.Context, in, out string, at time.Duration, width int) error {
+	var codec string
+	switch strings.ToLower(filepath.Ext(out)) {
+	case ".jpg", ".jpeg":
+		codec = "mjpeg"
+	case ".png":
+		codec = "png"
+	case ".webp":
+		codec = "libwebp"
+	default:
+		return errors.New("thumbnail: output must be .jpg, .png or .webp")
+	}
+	args := []string{"-ss", strconv.FormatFloat(at.Seconds(), 'f', 3, 64), "-frames:v", "1", "-an"}
+	if width > 0 {
+		args = append(args, "-vf", "scale="+strconv.Itoa(width)+":-2")
+	}
+	if codec == "mjpeg" {
+		args = append(args, "-q:v", "2")
+	}
+	err := Transcode(ctx, in, out, &TranscodeConfig{
+		Codec:  codec,
+		Format: "image2",
+		Args:   args,
+	})
+	if err != nil {
+		return fmt.Errorf("thumbnail: %w", err)
+	}
+	return nil
+}
+
+// escapeFilterArg escapes s for use as an option value inside an ffmpeg
+// filtergraph: once for the option value and once for the graph.
+func escapeFilterArg(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`\':`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	s, b = b.String(), strings.Builder{}
+	for _, r := range s {
+		if strings.ContainsRune(`\'[],;`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// hasArg reports whether args contains the option name.
+func hasArg(args []string, name string) bool {
+	for _, a := range args {
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
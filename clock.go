@@ -0,0 +1,108 @@
+package stream
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock abstracts time for Monitor and StreamClient, so interval and backoff
+// behavior can be tested deterministically. The streamtest package provides
+// a fake implementation.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker is the subset of time.Ticker used by the library.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// SystemClock returns the Clock backed by the time package. It is the
+// default for every component that accepts a Clock.
+func SystemClock() Clock {
+	return systemClock{}
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (systemClock) NewTicker(d time.Duration) Ticker       { return systemTicker{time.NewTicker(d)} }
+
+type systemTicker struct{ t *time.Ticker }
+
+func (t systemTicker) C() <-chan time.Time { return t.t.C }
+func (t systemTicker) Stop()               { t.t.Stop() }
+
+// newTimer returns a channel that receives once d has passed on c, and a
+// func that releases it early. With the system clock it is a time.Timer.
+func newTimer(c Clock, d time.Duration) (<-chan time.Time, func()) {
+	if _, ok := c.(systemClock); ok {
+		t := time.NewTimer(d)
+		return t.C, func() { t.Stop() }
+	}
+	return c.After(d), func() {}
+}
+
+// clockTimer is the subset of time.Timer used by afterFunc's callers.
+type clockTimer interface {
+	Reset(d time.Duration) bool
+	Stop() bool
+}
+
+// afterFunc calls f in its own goroutine once d has passed on c, like
+// time.AfterFunc. With other clocks than the system clock, each arming
+// waits in a goroutine until its time has passed.
+func afterFunc(c Clock, d time.Duration, f func()) clockTimer {
+	if _, ok := c.(systemClock); ok {
+		return time.AfterFunc(d, f)
+	}
+	t := &funcTimer{clock: c, f: f}
+	t.Reset(d)
+	return t
+}
+
+// funcTimer is afterFunc's timer for clocks other than the system clock.
+type funcTimer struct {
+	clock Clock
+	f     func()
+
+	mu     sync.Mutex
+	gen    int // bumped by Reset and Stop, cancelling the pending call
+	active bool
+}
+
+func (t *funcTimer) Reset(d time.Duration) bool {
+	t.mu.Lock()
+	was := t.active
+	t.gen++
+	gen := t.gen
+	t.active = true
+	t.mu.Unlock()
+	fire := t.clock.After(d)
+	go func() {
+		<-fire
+		t.mu.Lock()
+		ok := t.active && t.gen == gen
+		if ok {
+			t.active = false
+		}
+		t.mu.Unlock()
+		if ok {
+			t.f()
+		}
+	}()
+	return was
+}
+
+func (t *funcTimer) Stop() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	was := t.active
+	t.gen++
+	t.active = false
+	return was
+}
@@ -2,6 +2,9 @@
 // 1. API layer (standalone functions)
 // 2. Monitor (live/offline event channel)
 // 3. StreamClient (auto-capture with pub/sub events)
+//
+// Run "example doctor" to diagnose the environment instead. Set
+// BILI_SESSDATA to also check that cookie.
 package main
 
 import (
@@ -19,9 +22,14 @@ import (
 func main() {
 	if len(os.Args) < 2 {
 		fmt.Fprintf(os.Stderr, "Usage: %s <room_id> [room_id...]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s doctor\n", os.Args[0])
 		os.Exit(1)
 	}
 
+	if os.Args[1] == "doctor" {
+		os.Exit(runDoctor())
+	}
+
 	var roomIDs []int64
 	for _, arg := range os.Args[1:] {
 		id, err := strconv.ParseInt(arg, 10, 64)
@@ -110,3 +118,25 @@ func main() {
 		}
 	}
 }
+
+// runDoctor prints a diagnostic report and returns the process exit code.
+func runDoctor() int {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	report := stream.Doctor(ctx, stream.WithDoctorCookie(os.Getenv("BILI_SESSDATA")))
+	for _, c := range report.Checks {
+		status := "ok"
+		switch {
+		case c.Skipped:
+			status = "skip"
+		case !c.OK:
+			status = "FAIL"
+		}
+		fmt.Printf("%-12s %-4s  %s\n", c.Name, status, c.Detail)
+	}
+	if !report.OK() {
+		return 1
+	}
+	return 0
+}
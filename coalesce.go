@@ -0,0 +1,84 @@
+package stream
+
+import (
+	"slices"
+	"time"
+)
+
+// pendingEvent is a RoomEvent held for the coalescing window
+// (WithSourceCoalescing) while other sources confirm it. Its fields are
+// guarded by Monitor.mu.
+type pendingEvent struct {
+	ev         RoomEvent // Sources is kept up to date by confirmLocked
+	ready      bool      // ev has been filled in by emitEvent
+	superseded bool      // a later transition replaced it before it was ready
+}
+
+// coalescing reports whether a report at now falls within the coalescing
+// window of the room's last live/not-live change.
+func (m *Monitor) coalescing(prev roomStateEntry, now time.Time) bool {
+	return m.cfg.coalesce > 0 && prev.changedBy != "" && now.Sub(prev.changedAt) < m.cfg.coalesce
+}
+
+// confirmLocked records source as agreeing with the room's held event.
+// m.mu must be held.
+func (m *Monitor) confirmLocked(roomID int64, source string) {
+	p := m.pending[roomID]
+	if p != nil && !slices.Contains(p.ev.Sources, source) {
+		p.ev.Sources = append(p.ev.Sources, source)
+	}
+}
+
+// holdLocked starts holding the event of a live/not-live change reported by
+// source, if coalescing is enabled. It returns the new pending event, or
+// nil without coalescing, and a previously held event of the room that is
+// ready and must now be published so the room's events keep their order.
+// m.mu must be held.
+func (m *Monitor) holdLocked(roomID int64, source string) (p, flush *pendingEvent) {
+	if m.cfg.coalesce <= 0 {
+		return nil, nil
+	}
+	p = &pendingEvent{ev: RoomEvent{Sources: []string{source}}}
+	if prior := m.pending[roomID]; prior != nil {
+		if prior.ready {
+			flush = prior
+		} else {
+			prior.superseded = true
+		}
+	}
+	m.pending[roomID] = p
+	return p, flush
+}
+
+// emitEvent publishes ev, or, when it is held by p, publishes it once the
+// coalescing window has passed with the sources that confirmed it in the
+// meantime.
+func (m *Monitor) emitEvent(p *pendingEvent, ev RoomEvent) {
+	if p == nil {
+		ev.Sources = []string{ev.Source}
+		m.publishEvent(ev)
+		return
+	}
+	m.mu.Lock()
+	ev.Sources = p.ev.Sources
+	p.ev, p.ready = ev, true
+	superseded := p.superseded
+	m.mu.Unlock()
+	if superseded {
+		m.publishEvent(ev)
+		return
+	}
+
+	go func() {
+		<-m.cfg.clock.After(m.cfg.coalesce)
+		m.mu.Lock()
+		if m.pending[ev.RoomID] != p {
+			m.mu.Unlock()
+			return
+		}
+		delete(m.pending, ev.RoomID)
+		out := p.ev
+		m.mu.Unlock()
+		m.publishEvent(out)
+	}()
+}
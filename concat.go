@@ -0,0 +1,227 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// JobConcat is the job kind for ConcatHandler.
+const JobConcat = "concat"
+
+// ConcatConfig configures ConcatSession.
+type ConcatConfig struct {
+	Args []string // extra output options placed before the output path, e.g. "-movflags", "+faststart"
+
+	FFmpeg   string       // ffmpeg binary, a path or a name in PATH; default "ffmpeg"
+	LogLevel string       // ffmpeg -loglevel; default "error"
+	Logger   *slog.Logger // logger for concat messages; default slog.Default()
+}
+
+// Chapter is a chapter of a concatenated session.
+type Chapter struct {
+	Start time.Duration // offset into the output
+	End   time.Duration
+	Title string
+}
+
+// ConcatSession losslessly joins the segments of the session whose
+// manifest is at manifestPath into out, in segment order, with a chapter
+// at every segment boundary and every title change recorded with
+// SessionManifest.AddTitle (see SessionChapters). Streams are copied, not
+// re-encoded. The container follows out's extension; chapters need one
+// that supports them, such as .mkv or .mp4, and are dropped by .flv.
+//
+// out is overwritten if it exists, and removed if ffmpeg fails or ctx is
+// cancelled. A missing segment fails the concat before ffmpeg runs. A nil
+// cfg uses the defaults.
+func ConcatSession(ctx context.Context, manifestPath, out string, cfg *ConcatConfig) error {
+	if cfg == nil {
+		cfg = &ConcatConfig{}
+	}
+	log := cfg.Logger
+	if log == nil {
+		log = slog.Default()
+	}
+	m, err := ReadManifest(manifestPath)
+	if err != nil {
+		return fmt.Errorf("concat: %w", err)
+	}
+	if len(m.Segments) == 0 {
+		return errors.New("concat: manifest lists no segments")
+	}
+	segments := sortedSegments(m)
+	dir := filepath.Dir(manifestPath)
+	var list strings.Builder
+	for _, seg := range segments {
+		path, err := filepath.Abs(filepath.Join(dir, seg.Name))
+		if err != nil {
+			return fmt.Errorf("concat: %w", err)
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("concat: segment %d: %w", seg.Index, err)
+		}
+		fmt.Fprintf(&list, "file '%s'\n", strings.ReplaceAll(path, "'", `'\''`))
+	}
+
+	tmpDir, err := os.MkdirTemp(filepath.Dir(out), ".concat-")
+	if err != nil {
+		return fmt.Errorf("concat: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	listPath := filepath.Join(tmpDir, "list.txt")
+	metaPath := filepath.Join(tmpDir, "metadata.txt")
+	if err := os.WriteFile(listPath, []byte(list.String()), 0o644); err != nil {
+		return fmt.Errorf("concat: write list: %w", err)
+	}
+	chapters := SessionChapters(m)
+	if err := os.WriteFile(metaPath, []byte(ffmetadata(chapters)), 0o644); err != nil {
+		return fmt.Errorf("concat: write chapters: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, ffmpegBinary(cfg.FFmpeg), buildConcatArgs(listPath, metaPath, out, cfg)...)
+	stderr := &ffmpegStderr{}
+	cmd.Stderr = stderr
+	start := time.Now()
+	if err := cmd.Run(); err != nil {
+		if rmErr := os.Remove(out); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) {
+			log.Warn("concat: failed to remove partial output", "path", out, "error", rmErr)
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("concat: %w", ctx.Err())
+		}
+		if tail := strings.TrimSpace(stderr.String()); tail != "" {
+			return fmt.Errorf("concat: %w: %s", err, tail)
+		}
+		return fmt.Errorf("concat: %w", err)
+	}
+	log.Info("concat: done", "manifest", manifestPath, "output", out,
+		"segments", len(segments), "chapters", len(chapters), "elapsed", time.Since(start))
+	return nil
+}
+
+// buildConcatArgs builds the ffmpeg argv for ConcatSession: the concat
+// demuxer reading list, with chapters and metadata taken from meta.
+func buildConcatArgs(list, meta, out string, cfg *ConcatConfig) []string {
+	loglevel := cfg.LogLevel
+	if loglevel == "" {
+		loglevel = "error"
+	}
+	args := []string{
+		"-hide_banner",
+		"-loglevel", loglevel,
+		"-nostdin",
+		"-y",
+		"-f", "concat", "-safe", "0", "-i", list,
+		"-i", meta,
+		"-map", "0",
+		"-map_metadata", "1",
+		"-map_chapters", "1",
+		"-c", "copy",
+	}
+	args = append(args, cfg.Args...)
+	return append(args, out)
+}
+
+// ConcatHandler returns a JobHandler, registered under JobConcat, that runs
+// ConcatSession for the manifest at job.Path. The output is
+// job.Params["output"], or the manifest's path with a .mkv extension:
+//
+//	q.Handle(stream.JobConcat, stream.ConcatHandler(nil))
+//	q.Enqueue(stream.Job{Kind: stream.JobConcat, RoomID: roomID, Path: manifest.Path()})
+func ConcatHandler(cfg *ConcatConfig) JobHandler {
+	return func(ctx context.Context, job Job) error {
+		out := job.Params["output"]
+		if out == "" {
+			out = strings.TrimSuffix(job.Path, filepath.Ext(job.Path)) + ".mkv"
+		}
+		return ConcatSession(ctx, job.Path, out, cfg)
+	}
+}
+
+// SessionChapters returns the chapters ConcatSession writes for m: one at
+// the start of every segment, titled with the stream title at that time
+// (or "Part N" if unknown), and one at every title change within a
+// segment. Segment lengths are their media durations, or their wall-clock
+// span if unknown.
+func SessionChapters(m *SessionManifest) []Chapter {
+	titles := append([]ManifestTitle(nil), m.Titles...)
+	sort.SliceStable(titles, func(i, j int) bool { return titles[i].At.Before(titles[j].At) })
+	titleAt := func(t time.Time, fallback string) string {
+		title := fallback
+		for _, c := range titles {
+			if c.At.After(t) {
+				break
+			}
+			title = c.Title
+		}
+		return title
+	}
+
+	var chapters []Chapter
+	var offset time.Duration
+	for _, seg := range sortedSegments(m) {
+		length := seg.Duration
+		if length <= 0 {
+			length = seg.End.Sub(seg.Start)
+		}
+		title := titleAt(seg.Start, seg.Title)
+		if title == "" {
+			title = fmt.Sprintf("Part %d", seg.Index)
+		}
+		chapters = append(chapters, Chapter{Start: offset, Title: title})
+		for _, c := range titles {
+			if at := c.At.Sub(seg.Start); at > 0 && at < length {
+				chapters = append(chapters, Chapter{Start: offset + at, Title: c.Title})
+			}
+		}
+		offset += max(length, 0)
+	}
+	for i := range chapters {
+		if i+1 < len(chapters) {
+			chapters[i].End = chapters[i+1].Start
+		} else {
+			chapters[i].End = offset
+		}
+	}
+	return chapters
+}
+
+// sortedSegments returns m's segments in index order.
+func sortedSegments(m *SessionManifest) []ManifestSegment {
+	segments := append([]ManifestSegment(nil), m.Segments...)
+	sort.SliceStable(segments, func(i, j int) bool { return segments[i].Index < segments[j].Index })
+	return segments
+}
+
+// ffmetadata renders chapters as an ffmpeg metadata file.
+func ffmetadata(chapters []Chapter) string {
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	for _, c := range chapters {
+		fmt.Fprintf(&b, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			c.Start.Milliseconds(), c.End.Milliseconds(), escapeFFmetadata(c.Title))
+	}
+	return b.String()
+}
+
+// escapeFFmetadata escapes the characters special in ffmpeg metadata
+// files.
+func escapeFFmetadata(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '=', ';', '#', '\\', '\n':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,233 @@
+package stream
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Bilibili login cookie names.
+const (
+	cookieSESSDATA   = "SESSDATA"
+	cookieBiliJct    = "bili_jct"
+	cookieBuvid3     = "buvid3"
+	cookieBuvid4     = "buvid4"
+	cookieDedeUserID = "DedeUserID"
+	cookieDedeUIDMD5 = "DedeUserID__ckMd5"
+)
+
+// ErrNoCookies is returned when a cookie string or file holds no
+// bilibili.com cookies.
+var ErrNoCookies = errors.New("no bilibili cookies found")
+
+// Credentials is the full cookie set of a Bilibili login. SESSDATA alone
+// authenticates most read APIs, but some endpoints also check bili_jct
+// (the CSRF token), the buvid device IDs or DedeUserID.
+type Credentials struct {
+	SESSDATA      string
+	BiliJct       string // bili_jct, also sent as the csrf parameter of write APIs
+	Buvid3        string
+	Buvid4        string
+	DedeUserID    string // UID of the account
+	DedeUserIDMD5 string // DedeUserID__ckMd5
+
+	// Extra holds any other cookies, sent as they are.
+	Extra map[string]string
+
+	// Expires is when SESSDATA expires, if the source said so
+	// (cookies.txt, Set-Cookie); zero if unknown.
+	Expires time.Time
+}
+
+// IsZero reports whether c holds no cookies.
+func (c Credentials) IsZero() bool {
+	return c.SESSDATA == "" && len(c.otherCookies()) == 0
+}
+
+// UID returns DedeUserID as a number, or 0 if it is missing or invalid.
+func (c Credentials) UID() int64 {
+	uid, _ := strconv.ParseInt(c.DedeUserID, 10, 64)
+	return uid
+}
+
+// CookieHeader returns every cookie of c as a Cookie header value,
+// SESSDATA first.
+func (c Credentials) CookieHeader() string {
+	var parts []string
+	if c.SESSDATA != "" {
+		parts = append(parts, cookieSESSDATA+"="+c.SESSDATA)
+	}
+	if other := c.otherCookies(); other != "" {
+		parts = append(parts, other)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// otherCookies returns the cookies besides SESSDATA as a Cookie header
+// value, in a stable order.
+func (c Credentials) otherCookies() string {
+	var parts []string
+	add := func(name, value string) {
+		if value != "" {
+			parts = append(parts, name+"="+value)
+		}
+	}
+	add(cookieBiliJct, c.BiliJct)
+	add(cookieBuvid3, c.Buvid3)
+	add(cookieBuvid4, c.Buvid4)
+	add(cookieDedeUserID, c.DedeUserID)
+	add(cookieDedeUIDMD5, c.DedeUserIDMD5)
+	names := make([]string, 0, len(c.Extra))
+	for name := range c.Extra {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		add(name, c.Extra[name])
+	}
+	return strings.Join(parts, "; ")
+}
+
+// RequestOptions returns options that send c with a call: SESSDATA as
+// Cookie and the other cookies as a "Cookie" entry of Headers. Attach them
+// with WithRequestOptions.
+func (c Credentials) RequestOptions() RequestOptions {
+	opts := RequestOptions{Cookie: c.SESSDATA}
+	if other := c.otherCookies(); other != "" {
+		opts.Headers = map[string]string{"Cookie": other}
+	}
+	return opts
+}
+
+// set stores one cookie in c.
+func (c *Credentials) set(name, value string) {
+	switch name {
+	case cookieSESSDATA:
+		c.SESSDATA = value
+	case cookieBiliJct:
+		c.BiliJct = value
+	case cookieBuvid3:
+		c.Buvid3 = value
+	case cookieBuvid4:
+		c.Buvid4 = value
+	case cookieDedeUserID:
+		c.DedeUserID = value
+	case cookieDedeUIDMD5:
+		c.DedeUserIDMD5 = value
+	default:
+		if c.Extra == nil {
+			c.Extra = make(map[string]string)
+		}
+		c.Extra[name] = value
+	}
+}
+
+// ParseCookieString parses a Cookie header value as copied from a
+// browser's developer tools or document.cookie, e.g.
+// "SESSDATA=...; bili_jct=...; buvid3=...". A leading "Cookie:" is
+// ignored.
+func ParseCookieString(s string) (Credentials, error) {
+	s = strings.TrimSpace(s)
+	if len(s) >= 7 && strings.EqualFold(s[:7], "cookie:") {
+		s = s[7:]
+	}
+	var c Credentials
+	for _, part := range strings.Split(s, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return Credentials{}, fmt.Errorf("parse cookies: invalid cookie %q", part)
+		}
+		c.set(name, strings.TrimSpace(value))
+	}
+	if c.IsZero() {
+		return Credentials{}, ErrNoCookies
+	}
+	return c, nil
+}
+
+// ParseCookiesTxt parses a Netscape cookies.txt file, as written by
+// browser extensions, curl and yt-dlp, and returns its bilibili.com
+// cookies. Expired cookies are skipped.
+func ParseCookiesTxt(r io.Reader) (Credentials, error) {
+	var c Credentials
+	now := time.Now()
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimRight(sc.Text(), "\r")
+		// HttpOnly cookies are written as comments by some exporters.
+		text = strings.TrimPrefix(text, "#HttpOnly_")
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, "\t")
+		if len(fields) != 7 {
+			return Credentials{}, fmt.Errorf("parse cookies.txt: line %d: want 7 tab-separated fields, got %d", line, len(fields))
+		}
+		domain := strings.TrimPrefix(fields[0], ".")
+		if domain != "bilibili.com" && !strings.HasSuffix(domain, ".bilibili.com") {
+			continue
+		}
+		expiry, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return Credentials{}, fmt.Errorf("parse cookies.txt: line %d: invalid expiry %q", line, fields[4])
+		}
+		var expires time.Time
+		if expiry > 0 {
+			expires = time.Unix(expiry, 0)
+			if expires.Before(now) {
+				continue
+			}
+		}
+		c.set(fields[5], fields[6])
+		if fields[5] == cookieSESSDATA {
+			c.Expires = expires
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return Credentials{}, fmt.Errorf("parse cookies.txt: %w", err)
+	}
+	if c.IsZero() {
+		return Credentials{}, ErrNoCookies
+	}
+	return c, nil
+}
+
+// CredentialsFromCookies returns the credentials held by cookies, e.g. the
+// Set-Cookie headers of a login response (http.Response.Cookies) or a
+// cookie jar's bilibili.com cookies. Expires is taken from SESSDATA.
+func CredentialsFromCookies(cookies []*http.Cookie) Credentials {
+	var c Credentials
+	for _, ck := range cookies {
+		if ck.Name == "" {
+			continue
+		}
+		c.set(ck.Name, ck.Value)
+		if ck.Name == cookieSESSDATA {
+			c.Expires = ck.Expires
+		}
+	}
+	return c
+}
+
+// LoadCookiesTxt reads the Netscape cookies.txt file at path; see
+// ParseCookiesTxt.
+func LoadCookiesTxt(path string) (Credentials, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("load cookies.txt: %w", err)
+	}
+	defer f.Close()
+	return ParseCookiesTxt(f)
+}
@@ -0,0 +1,290 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// EventAuthExpired reports that Bilibili rejected the configured
+// credentials as logged out and no refresh could replace them
+// (StreamEvent.Error wraps ErrCredentialsExpired). RoomID is the room whose
+// request found out, or 0 for the startup check of a CredentialManager.
+// It is emitted once per rejected cookie.
+const EventAuthExpired = "auth_expired"
+
+// ErrNoRefreshToken is returned by CredentialManager.Refresh when no
+// refresh token or TokenRefresher is configured.
+var ErrNoRefreshToken = errors.New("no refresh token configured")
+
+// AuthExpiry is passed to WithAuthExpiredCallback.
+type AuthExpiry struct {
+	RoomID int64 // 0 if not found by a room's request
+	Err    error // wraps ErrCredentialsExpired
+	At     time.Time
+}
+
+// WithAuthExpiredCallback registers fn to be called when the monitor's
+// credentials are rejected as logged out and could not be refreshed; see
+// EventAuthExpired. It is called once per rejected cookie, synchronously,
+// and must not block.
+func WithAuthExpiredCallback(fn func(AuthExpiry)) MonitorOption {
+	return func(c *monitorConfig) {
+		c.onAuthExpired = fn
+	}
+}
+
+// LoginInfo is the login state of a cookie.
+type LoginInfo struct {
+	LoggedIn bool
+	UID      int64
+	Uname    string
+}
+
+// GetLoginInfo reports whether the cookie of the RequestOptions in ctx is
+// logged in, and as whom. A rejected cookie returns an error wrapping
+// ErrCredentialsExpired.
+func GetLoginInfo(ctx context.Context) (*LoginInfo, error) {
+	apiResp, err := doGet(ctx, navURL, "")
+	if err != nil {
+		return nil, fmt.Errorf("get login info: %w", err)
+	}
+	var data struct {
+		IsLogin bool   `json:"isLogin"`
+		Mid     int64  `json:"mid"`
+		Uname   string `json:"uname"`
+	}
+	if err := decodeData(apiResp, &data); err != nil {
+		return nil, fmt.Errorf("parse login info: %w", err)
+	}
+	return &LoginInfo{LoggedIn: data.IsLogin, UID: data.Mid, Uname: data.Uname}, nil
+}
+
+// TokenRefresher renews credentials with the refresh token of their login,
+// returning the new credentials and the new refresh token.
+// auth.Client.Refresh implements it.
+type TokenRefresher func(ctx context.Context, creds Credentials, refreshToken string) (Credentials, string, error)
+
+// credentialManagerConfig holds internal configuration for
+// CredentialManager.
+type credentialManagerConfig struct {
+	refreshToken string
+	refresher    TokenRefresher
+	onRefresh    func(creds Credentials, refreshToken string)
+}
+
+// CredentialManagerOption configures a CredentialManager.
+type CredentialManagerOption func(*credentialManagerConfig)
+
+// WithRefreshToken lets the manager renew expired credentials with token,
+// the refresh_token of the login (auth.Result.RefreshToken), using fn.
+func WithRefreshToken(token string, fn TokenRefresher) CredentialManagerOption {
+	return func(c *credentialManagerConfig) {
+		c.refreshToken = token
+		c.refresher = fn
+	}
+}
+
+// WithCredentialsSaver registers fn to be called with the new credentials
+// and refresh token after each refresh, to persist them; the old refresh
+// token no longer works.
+func WithCredentialsSaver(fn func(creds Credentials, refreshToken string)) CredentialManagerOption {
+	return func(c *credentialManagerConfig) {
+		c.onRefresh = fn
+	}
+}
+
+// CredentialManager owns the credentials of a monitor or client
+// (WithCredentialManager): it checks them on startup, replaces them using
+// the login's refresh token when Bilibili rejects them, and reports them
+// expired when that is not possible. It is safe for concurrent use.
+type CredentialManager struct {
+	cfg credentialManagerConfig
+
+	refreshMu sync.Mutex // serializes refreshes
+
+	mu       sync.Mutex
+	creds    Credentials
+	token    string
+	replaced string // SESSDATA replaced by the last refresh
+	expired  bool   // creds were rejected and could not be refreshed
+}
+
+// NewCredentialManager creates a CredentialManager for creds.
+func NewCredentialManager(creds Credentials, opts ...CredentialManagerOption) *CredentialManager {
+	var cfg credentialManagerConfig
+	for _, o := range opts {
+		o(&cfg)
+	}
+	return &CredentialManager{cfg: cfg, creds: creds, token: cfg.refreshToken}
+}
+
+// Credentials returns the current credentials.
+func (cm *CredentialManager) Credentials() Credentials {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.creds
+}
+
+// RefreshToken returns the current refresh token.
+func (cm *CredentialManager) RefreshToken() string {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.token
+}
+
+// Expired reports whether the current credentials were rejected and could
+// not be refreshed.
+func (cm *CredentialManager) Expired() bool {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.expired
+}
+
+// Validate checks that the current credentials are logged in, refreshing
+// them first if they are not and a refresh token is configured. Returns an
+// error wrapping ErrCredentialsExpired if they remain rejected.
+func (cm *CredentialManager) Validate(ctx context.Context) (*LoginInfo, error) {
+	info, err := cm.loginInfo(ctx)
+	if err == nil && info.LoggedIn {
+		return info, nil
+	}
+	if err != nil && !errors.Is(err, ErrCredentialsExpired) {
+		return nil, err
+	}
+	if refreshErr := cm.Refresh(ctx); refreshErr != nil {
+		cm.setExpired()
+		return nil, fmt.Errorf("%w: not logged in, refresh: %w", ErrCredentialsExpired, refreshErr)
+	}
+	if info, err = cm.loginInfo(ctx); err != nil {
+		return nil, err
+	}
+	if !info.LoggedIn {
+		cm.setExpired()
+		return nil, fmt.Errorf("%w: refreshed credentials not logged in", ErrCredentialsExpired)
+	}
+	return info, nil
+}
+
+// loginInfo checks the login state of the current credentials.
+func (cm *CredentialManager) loginInfo(ctx context.Context) (*LoginInfo, error) {
+	return GetLoginInfo(WithRequestOptions(ctx, cm.Credentials().RequestOptions()))
+}
+
+// Refresh renews the credentials with the refresh token now.
+func (cm *CredentialManager) Refresh(ctx context.Context) error {
+	cm.refreshMu.Lock()
+	defer cm.refreshMu.Unlock()
+	return cm.refreshLocked(ctx)
+}
+
+// refreshLocked renews the credentials. cm.refreshMu must be held.
+func (cm *CredentialManager) refreshLocked(ctx context.Context) error {
+	if cm.cfg.refresher == nil {
+		return ErrNoRefreshToken
+	}
+	cm.mu.Lock()
+	creds, token := cm.creds, cm.token
+	cm.mu.Unlock()
+	if token == "" {
+		return ErrNoRefreshToken
+	}
+
+	fresh, freshToken, err := cm.cfg.refresher(ctx, creds, token)
+	if err != nil {
+		return fmt.Errorf("refresh credentials: %w", err)
+	}
+	if fresh.SESSDATA == "" {
+		return errors.New("refresh credentials: no SESSDATA returned")
+	}
+	cm.mu.Lock()
+	cm.creds, cm.token = fresh, freshToken
+	cm.replaced = creds.SESSDATA
+	cm.expired = false
+	cm.mu.Unlock()
+	slog.Info("credentials: refreshed with refresh token")
+	if cm.cfg.onRefresh != nil {
+		cm.cfg.onRefresh(fresh, freshToken)
+	}
+	return nil
+}
+
+// refreshCookie is the RefreshCredentials callback for requests using the
+// manager's credentials. A request that hit credentials another request
+// already refreshed gets the new SESSDATA without a second refresh.
+func (cm *CredentialManager) refreshCookie(ctx context.Context, expired string) (string, error) {
+	cm.refreshMu.Lock()
+	defer cm.refreshMu.Unlock()
+
+	cm.mu.Lock()
+	current, replaced := cm.creds.SESSDATA, cm.replaced
+	cm.mu.Unlock()
+	if expired == replaced && current != expired {
+		return current, nil
+	}
+	if err := cm.refreshLocked(ctx); err != nil {
+		return "", err
+	}
+	return cm.Credentials().SESSDATA, nil
+}
+
+func (cm *CredentialManager) setExpired() {
+	cm.mu.Lock()
+	cm.expired = true
+	cm.mu.Unlock()
+}
+
+// WithCredentialManager authenticates the monitor's requests with the
+// credentials of cm and lets cm refresh them when they expire. The
+// credentials are validated when Watch starts; see EventAuthExpired.
+// Replaces WithCookie, WithCredentials and WithCredentialRefresh;
+// WithCookies and per-room cookies keep precedence for their rooms.
+func WithCredentialManager(cm *CredentialManager) MonitorOption {
+	return func(c *monitorConfig) {
+		c.credManager = cm
+	}
+}
+
+// validateCredentials checks the credential manager's credentials when
+// monitoring starts.
+func (m *Monitor) validateCredentials(ctx context.Context) {
+	cm := m.cfg.credManager
+	if m.cfg.apiClient != nil {
+		ctx = m.cfg.apiClient.Context(ctx)
+	}
+	info, err := cm.Validate(ctx)
+	switch {
+	case err == nil:
+		slog.Info("monitor: credentials valid", "uid", info.UID, "uname", info.Uname)
+	case errors.Is(err, ErrCredentialsExpired):
+		m.authExpired(0, cm.Credentials().SESSDATA, err)
+	case ctx.Err() == nil:
+		slog.Warn("monitor: failed to validate credentials", "error", err)
+	}
+}
+
+// authExpired reports that cookie was rejected and could not be
+// refreshed, once per cookie.
+func (m *Monitor) authExpired(roomID int64, cookie string, err error) {
+	if cm := m.cfg.credManager; cm != nil && cm.Credentials().SESSDATA == cookie {
+		cm.setExpired()
+	}
+	m.mu.Lock()
+	first := !m.expiredCookies[cookie]
+	m.expiredCookies[cookie] = true
+	m.mu.Unlock()
+	if !first {
+		return
+	}
+	log := slog.Default()
+	if roomID != 0 {
+		log = m.roomLogger(roomID)
+	}
+	log.Error("monitor: credentials expired", "error", err)
+	if m.cfg.onAuthExpired != nil {
+		m.cfg.onAuthExpired(AuthExpiry{RoomID: roomID, Err: err, At: m.cfg.clock.Now()})
+	}
+}
@@ -0,0 +1,253 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultCredentialPark is how long a credential that hit risk control is
+// kept out of rotation.
+const defaultCredentialPark = 10 * time.Minute
+
+// Bilibili's risk control (风控) responses.
+const (
+	codeRiskControl = -352 // 风控校验失败
+	codeIntercepted = -412 // 请求被拦截
+)
+
+// httpStatusError is a non-200 HTTP response from the API.
+type httpStatusError struct {
+	code int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("http status %d", e.code)
+}
+
+// isRiskControl reports whether err is a risk control rejection, which
+// Bilibili ties to the credential (and IP) that made the request.
+func isRiskControl(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == codeRiskControl || apiErr.Code == codeIntercepted
+	}
+	var statusErr *httpStatusError
+	return errors.As(err, &statusErr) && statusErr.code == 412
+}
+
+// CredentialStats is one credential's share of a Monitor's API traffic.
+type CredentialStats struct {
+	Index       int       // position in WithCookies
+	Requests    int64     // API requests made with the credential
+	Errors      int64     // requests that failed
+	ErrorRate   float64   // Errors / Requests
+	RiskHits    int64     // risk control rejections
+	ParkedUntil time.Time // zero unless parked after risk control
+	Rooms       []int64   // rooms currently polled with the credential
+}
+
+// Diagnostics is a snapshot of a Monitor's internal allocation state.
+type Diagnostics struct {
+	Credentials []CredentialStats // empty unless WithCookies is used
+}
+
+// credential is one SESSDATA of a credentialPool.
+type credential struct {
+	cookie      string
+	requests    int64
+	errors      int64
+	riskHits    int64
+	parkedUntil time.Time
+	rooms       map[int64]bool
+}
+
+// credentialPool spreads rooms over several credentials, so no single
+// account carries all polling traffic. Each room sticks to its credential
+// until that credential is parked after hitting risk control; its rooms
+// then move to the least loaded credential that is still usable.
+type credentialPool struct {
+	clock Clock
+	park  time.Duration
+
+	mu       sync.Mutex
+	creds    []*credential
+	byRoom   map[int64]*credential
+	replaced map[string]string // expired cookie -> refreshed one
+}
+
+func newCredentialPool(cookies []string, clock Clock) *credentialPool {
+	p := &credentialPool{
+		clock:    clock,
+		park:     defaultCredentialPark,
+		byRoom:   make(map[int64]*credential),
+		replaced: make(map[string]string),
+	}
+	for _, c := range cookies {
+		p.creds = append(p.creds, &credential{cookie: c, rooms: make(map[int64]bool)})
+	}
+	return p
+}
+
+// cookie returns the credential to use for roomID, assigning or moving the
+// room if needed.
+func (p *credentialPool) cookie(roomID int64) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.clock.Now()
+	cur := p.byRoom[roomID]
+	if cur != nil && !now.Before(cur.parkedUntil) {
+		return cur.cookie
+	}
+
+	best := p.best(now)
+	if cur != nil {
+		// Moving only helps if another credential is usable.
+		if best == cur || now.Before(best.parkedUntil) {
+			return cur.cookie
+		}
+		delete(cur.rooms, roomID)
+		slog.Info("monitor: moving room to another credential", "room_id", roomID)
+	}
+	best.rooms[roomID] = true
+	p.byRoom[roomID] = best
+	return best.cookie
+}
+
+// borrow returns the credential to use for a request on behalf of no
+// single room, such as a batch poll, without assigning it a room.
+func (p *credentialPool) borrow() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.best(p.clock.Now()).cookie
+}
+
+// best returns the credential that should take the next room. p.mu must
+// be held.
+func (p *credentialPool) best(now time.Time) *credential {
+	var best *credential
+	for _, c := range p.creds {
+		if best == nil || betterCredential(c, best, now) {
+			best = c
+		}
+	}
+	return best
+}
+
+// betterCredential reports whether a should take new rooms before b:
+// usable credentials first, then fewer rooms, then lower error rate. Among
+// parked ones, the one unparked soonest.
+func betterCredential(a, b *credential, now time.Time) bool {
+	aParked, bParked := now.Before(a.parkedUntil), now.Before(b.parkedUntil)
+	switch {
+	case aParked != bParked:
+		return !aParked
+	case aParked:
+		return a.parkedUntil.Before(b.parkedUntil)
+	case len(a.rooms) != len(b.rooms):
+		return len(a.rooms) < len(b.rooms)
+	}
+	return errorRate(a) < errorRate(b)
+}
+
+func errorRate(c *credential) float64 {
+	if c.requests == 0 {
+		return 0
+	}
+	return float64(c.errors) / float64(c.requests)
+}
+
+// record counts a request made with cookie and parks the credential if it
+// hit risk control.
+func (p *credentialPool) record(cookie string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, c := range p.creds {
+		if c.cookie != cookie {
+			continue
+		}
+		c.requests++
+		if err == nil {
+			return
+		}
+		c.errors++
+		if isRiskControl(err) {
+			c.riskHits++
+			c.parkedUntil = p.clock.Now().Add(p.park)
+			slog.Warn("monitor: credential hit risk control, parking it",
+				"credential", i, "until", c.parkedUntil, "error", err)
+		}
+		return
+	}
+}
+
+// replace swaps a refreshed cookie in for an expired one. It returns the
+// replacement if expired was already refreshed, and whether expired
+// belongs to the pool at all.
+func (p *credentialPool) replace(expired string, refresh func() (string, error)) (string, bool, error) {
+	p.mu.Lock()
+	if fresh, ok := p.replaced[expired]; ok {
+		p.mu.Unlock()
+		return fresh, true, nil
+	}
+	var target *credential
+	for _, c := range p.creds {
+		if c.cookie == expired {
+			target = c
+		}
+	}
+	p.mu.Unlock()
+	if target == nil {
+		return "", false, nil
+	}
+
+	fresh, err := refresh()
+	if err != nil {
+		return "", true, err
+	}
+	p.mu.Lock()
+	target.cookie = fresh
+	p.replaced[expired] = fresh
+	p.mu.Unlock()
+	return fresh, true, nil
+}
+
+// release forgets a removed room.
+func (p *credentialPool) release(roomID int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c := p.byRoom[roomID]; c != nil {
+		delete(c.rooms, roomID)
+		delete(p.byRoom, roomID)
+	}
+}
+
+// stats returns the per-credential counters.
+func (p *credentialPool) stats() []CredentialStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.clock.Now()
+	out := make([]CredentialStats, 0, len(p.creds))
+	for i, c := range p.creds {
+		s := CredentialStats{
+			Index:     i,
+			Requests:  c.requests,
+			Errors:    c.errors,
+			ErrorRate: errorRate(c),
+			RiskHits:  c.riskHits,
+		}
+		if now.Before(c.parkedUntil) {
+			s.ParkedUntil = c.parkedUntil
+		}
+		for id := range c.rooms {
+			s.Rooms = append(s.Rooms, id)
+		}
+		sort.Slice(s.Rooms, func(a, b int) bool { return s.Rooms[a] < s.Rooms[b] })
+		out = append(out, s)
+	}
+	return out
+}
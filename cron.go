@@ -0,0 +1,360 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schedule computes the firing times of a scheduled action.
+type Schedule interface {
+	// Next returns the first firing time after t, or the zero time if
+	// there is none.
+	Next(t time.Time) time.Time
+}
+
+// ParseSchedule parses a standard five-field cron expression ("minute hour
+// day-of-month month day-of-week", with *, lists, ranges and /steps; Sunday
+// is 0 or 7), one of @hourly, @daily (@midnight), @weekly and @monthly, or
+// "@every <duration>" such as "@every 15m". Cron times are evaluated in the
+// location of the clock's times, local time by default.
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if d, ok := strings.CutPrefix(spec, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil {
+			return nil, fmt.Errorf("schedule: %w", err)
+		}
+		if every < time.Second {
+			return nil, fmt.Errorf("schedule: @every interval %s is below 1s", every)
+		}
+		return everySchedule(every), nil
+	}
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule: %q: want 5 fields, got %d", spec, len(fields))
+	}
+	var s cronSchedule
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("schedule: minute: %w", err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("schedule: hour: %w", err)
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("schedule: day of month: %w", err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("schedule: month: %w", err)
+	}
+	if s.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("schedule: day of week: %w", err)
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1 // 7 is Sunday too
+	}
+	s.domAny = fields[2] == "*"
+	s.dowAny = fields[4] == "*"
+	return &s, nil
+}
+
+type everySchedule time.Duration
+
+func (e everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// cronSchedule holds one bit per allowed value of each field.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+// parseCronField parses a comma-separated list of *, n, a-b, */s, a-b/s
+// and n/s (n to max) into a bit set.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			step = n
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(a); err != nil {
+				return 0, fmt.Errorf("invalid value in %q", part)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(b); err != nil {
+					return 0, fmt.Errorf("invalid value in %q", part)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+	limit := t.AddDate(5, 0, 0) // e.g. "0 0 30 2 *" never fires
+	for t.Before(limit) {
+		y, mo, d := t.Date()
+		switch {
+		case s.month&(1<<mo) == 0:
+			t = time.Date(y, mo+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(y, mo, d+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<t.Hour()) == 0:
+			t = time.Date(y, mo, d, t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<t.Minute()) == 0:
+			t = time.Date(y, mo, d, t.Hour(), t.Minute()+1, 0, 0, loc)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches applies cron's rule that a day matches either restricted
+// day field when both are restricted.
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<t.Day()) != 0
+	dow := s.dow&(1<<t.Weekday()) != 0
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+// Action is an operational routine run by StreamClient.Schedule for a set
+// of rooms.
+type Action func(ctx context.Context, c *StreamClient, roomIDs []int64) error
+
+// ActionCheckStatus polls the rooms' live status now, outside their regular
+// polling interval. Paused rooms are skipped.
+func ActionCheckStatus(ctx context.Context, c *StreamClient, roomIDs []int64) error {
+	for _, id := range roomIDs {
+		c.monitor.checkRoom(ctx, id)
+	}
+	return nil
+}
+
+// ActionRotateCapture restarts the rooms' active captures, so consumers
+// receive a fresh audio_ready event and can start a new recording segment
+// at a fixed time. Rooms that are not capturing are skipped.
+func ActionRotateCapture(ctx context.Context, c *StreamClient, roomIDs []int64) error {
+	var errs []error
+	for _, id := range roomIDs {
+		c.capturesMu.Lock()
+		slot, capturing := c.captures[id]
+		c.capturesMu.Unlock()
+		if !capturing {
+			continue
+		}
+		if err := c.startCaptureNow(id, slot.manual); err != nil {
+			errs = append(errs, fmt.Errorf("room %d: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ActionRefreshCredentials renews the cookies used for the rooms ahead of
+// expiry with the refresher that serves each room: the client's
+// WithClientCredentialRefresh callback, or its CredentialManager's
+// TokenRefresher. Each distinct cookie is refreshed once. Rooms without a
+// refresher fail with an error.
+func ActionRefreshCredentials(ctx context.Context, c *StreamClient, roomIDs []int64) error {
+	seen := make(map[string]bool)
+	var errs []error
+	for _, id := range roomIDs {
+		opts, _ := RequestOptionsFromContext(c.monitor.roomContext(ctx, id))
+		if opts.Cookie == "" || seen[opts.Cookie] {
+			continue
+		}
+		if opts.RefreshCredentials == nil {
+			errs = append(errs, fmt.Errorf("room %d: no credential refresher configured", id))
+			continue
+		}
+		seen[opts.Cookie] = true
+		fresh, err := opts.RefreshCredentials(ctx, opts.Cookie)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("room %d: %w", id, err))
+			continue
+		}
+		seen[fresh] = true
+	}
+	return errors.Join(errs...)
+}
+
+// ScheduledJob is an action registered with StreamClient.Schedule.
+type ScheduledJob struct {
+	client   *StreamClient
+	spec     string
+	schedule Schedule
+	action   Action
+	rooms    []int64 // nil for all watched rooms
+
+	stopOnce sync.Once
+	stop     chan struct{}
+
+	mu      sync.Mutex
+	running bool
+	next    time.Time
+}
+
+// Schedule runs action on the cron schedule spec (see ParseSchedule) for
+// the given rooms, or for every room watched at the time it fires if none
+// are given, e.g.
+//
+//	c.Schedule("0 4 * * *", stream.ActionRefreshCredentials)
+//	c.Schedule("@every 1h", stream.ActionRotateCapture, 21452505)
+//
+// Jobs run while the client is subscribed: those registered before
+// Subscribe start with it, and all end with the Subscribe context. A job
+// does not overlap itself; firings missed while its action was running are
+// skipped. Errors returned by the action are logged.
+func (c *StreamClient) Schedule(spec string, action Action, rooms ...int64) (*ScheduledJob, error) {
+	sched, err := ParseSchedule(spec)
+	if err != nil {
+		return nil, err
+	}
+	j := &ScheduledJob{
+		client:   c,
+		spec:     spec,
+		schedule: sched,
+		action:   action,
+		rooms:    append([]int64(nil), rooms...),
+		stop:     make(chan struct{}),
+	}
+	if len(rooms) == 0 {
+		j.rooms = nil
+	}
+
+	c.capturesMu.Lock()
+	c.jobs = append(c.jobs, j)
+	ctx := c.ctx
+	c.capturesMu.Unlock()
+	if ctx != nil {
+		go j.run(ctx)
+	}
+	return j, nil
+}
+
+// Stop unregisters the job. An action already running is not interrupted.
+func (j *ScheduledJob) Stop() {
+	j.stopOnce.Do(func() {
+		close(j.stop)
+		c := j.client
+		c.capturesMu.Lock()
+		for i, other := range c.jobs {
+			if other == j {
+				c.jobs = append(c.jobs[:i], c.jobs[i+1:]...)
+				break
+			}
+		}
+		c.capturesMu.Unlock()
+	})
+}
+
+// Next returns the job's next firing time, or the zero time if it is not
+// running.
+func (j *ScheduledJob) Next() time.Time {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.next
+}
+
+// startJobs starts the jobs registered before Subscribe.
+func (c *StreamClient) startJobs(ctx context.Context) {
+	c.capturesMu.Lock()
+	jobs := append([]*ScheduledJob(nil), c.jobs...)
+	c.capturesMu.Unlock()
+	for _, j := range jobs {
+		go j.run(ctx)
+	}
+}
+
+func (j *ScheduledJob) run(ctx context.Context) {
+	j.mu.Lock()
+	if j.running {
+		j.mu.Unlock()
+		return
+	}
+	j.running = true
+	j.mu.Unlock()
+	defer func() {
+		j.mu.Lock()
+		j.running, j.next = false, time.Time{}
+		j.mu.Unlock()
+	}()
+
+	clock := j.client.cfg.clock
+	for {
+		now := clock.Now()
+		next := j.schedule.Next(now)
+		if next.IsZero() {
+			return
+		}
+		j.setNext(next)
+		select {
+		case <-ctx.Done():
+			return
+		case <-j.stop:
+			return
+		case <-clock.After(next.Sub(now)):
+		}
+
+		rooms := j.rooms
+		if rooms == nil {
+			rooms = j.client.monitor.watchedRooms()
+		}
+		if err := j.action(ctx, j.client, rooms); err != nil && ctx.Err() == nil {
+			slog.Warn("schedule: action failed", "spec", j.spec, "error", err)
+		}
+	}
+}
+
+func (j *ScheduledJob) setNext(t time.Time) {
+	j.mu.Lock()
+	j.next = t
+	j.mu.Unlock()
+}
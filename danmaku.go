@@ -0,0 +1,129 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const danmakuHistoryURL = "https://api.live.bilibili.com/xlive/web-room/v1/dM/gethistory?roomid=%d"
+
+// chinaTime is the zone of timestamps the live API reports as text.
+var chinaTime = time.FixedZone("CST", 8*60*60)
+
+// Danmaku is a chat message (弹幕) sent in a live room.
+type Danmaku struct {
+	RoomID   int64     `json:"room_id"`
+	UID      int64     `json:"uid"`
+	Nickname string    `json:"nickname"`
+	Text     string    `json:"text"`
+	Time     time.Time `json:"time"`
+	Admin    bool      `json:"admin,omitempty"` // sent by a room admin
+
+	// Emoticon is set for a sticker danmaku; Text then holds its name.
+	Emoticon *Emoticon `json:"emoticon,omitempty"`
+
+	// Backfilled marks messages fetched from the room's history after
+	// they were sent (GetDanmakuHistory), rather than received live.
+	Backfilled bool `json:"backfilled,omitempty"`
+
+	// AudioOffset is where the message belongs in the room's current
+	// capture (AudioStream.Reader), from its ChatSync; valid if
+	// HasAudioOffset. StreamClient sets it on EventDanmaku while a PCM
+	// capture runs.
+	AudioOffset    time.Duration `json:"audio_offset,omitempty"`
+	HasAudioOffset bool          `json:"has_audio_offset,omitempty"`
+}
+
+// GetDanmakuHistory returns the most recent chat messages of a room, about
+// the last ten regular and ten admin messages, oldest first and marked as
+// Backfilled. It lets a consumer that starts after a broadcast began
+// recover the chat it missed.
+func GetDanmakuHistory(ctx context.Context, roomID int64) ([]Danmaku, error) {
+	apiResp, err := doGet(ctx, fmt.Sprintf(danmakuHistoryURL, roomID), "")
+	if err != nil {
+		return nil, fmt.Errorf("get danmaku history: %w", err)
+	}
+
+	type message struct {
+		Text      string `json:"text"`
+		UID       int64  `json:"uid"`
+		Nickname  string `json:"nickname"`
+		Timeline  string `json:"timeline"` // "2006-01-02 15:04:05", China time
+		CheckInfo struct {
+			TS int64 `json:"ts"`
+		} `json:"check_info"`
+	}
+	var data struct {
+		Admin []message `json:"admin"`
+		Room  []message `json:"room"`
+	}
+	if err := decodeData(apiResp, &data); err != nil {
+		return nil, fmt.Errorf("parse danmaku history: %w", err)
+	}
+
+	msgs := make([]Danmaku, 0, len(data.Admin)+len(data.Room))
+	add := func(list []message, admin bool) {
+		for _, m := range list {
+			t := time.Unix(m.CheckInfo.TS, 0)
+			if m.CheckInfo.TS == 0 {
+				t, _ = time.ParseInLocation(time.DateTime, m.Timeline, chinaTime)
+			}
+			msgs = append(msgs, Danmaku{
+				RoomID:     roomID,
+				UID:        m.UID,
+				Nickname:   m.Nickname,
+				Text:       m.Text,
+				Time:       t,
+				Admin:      admin,
+				Backfilled: true,
+			})
+		}
+	}
+	add(data.Room, false)
+	add(data.Admin, true)
+	sort.SliceStable(msgs, func(i, j int) bool { return msgs[i].Time.Before(msgs[j].Time) })
+	return msgs, nil
+}
+
+// liveStartTime parses RoomInfo.LiveTime; ok is false if the room is not
+// live or the value is not a time.
+func liveStartTime(info *RoomInfo) (time.Time, bool) {
+	t, err := time.ParseInLocation(time.DateTime, info.LiveTime, chinaTime)
+	if err != nil || t.Year() < 2000 { // offline rooms report "0000-00-00 00:00:00"
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// backfillDanmaku publishes the room's chat history of the current
+// broadcast from the last window as EventDanmaku events, marked as
+// Backfilled (WithDanmakuBackfill).
+func (c *StreamClient) backfillDanmaku(ctx context.Context, roomID int64, title string) {
+	ctx = c.monitor.roomContext(ctx, roomID)
+	cutoff := c.cfg.clock.Now().Add(-c.cfg.danmakuBackfill)
+	if info, err := GetRoomInfo(ctx, roomID); err == nil {
+		if start, ok := liveStartTime(info); ok && start.After(cutoff) {
+			cutoff = start
+		}
+	}
+	msgs, err := GetDanmakuHistory(ctx, roomID)
+	if err != nil {
+		if ctx.Err() == nil {
+			c.monitor.roomLogger(roomID).Warn("client: failed to backfill danmaku", "error", err)
+		}
+		return
+	}
+	for _, msg := range msgs {
+		if msg.Time.Before(cutoff) {
+			continue
+		}
+		c.publishStreamEvent(StreamEvent{
+			RoomID:  roomID,
+			Type:    EventDanmaku,
+			Title:   title,
+			Danmaku: &msg,
+		})
+	}
+}
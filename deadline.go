@@ -0,0 +1,73 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// readDeadliner is implemented by capture readers and the readers
+// StreamClient wraps around them.
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// setReadDeadline sets the read deadline of r, or returns os.ErrNoDeadline
+// if r does not support one.
+func setReadDeadline(r any, t time.Time) error {
+	if d, ok := r.(readDeadliner); ok {
+		return d.SetReadDeadline(t)
+	}
+	return os.ErrNoDeadline
+}
+
+// pastDeadline is a deadline that has already passed, to wake pending
+// Reads.
+var pastDeadline = time.Unix(1, 0)
+
+// readContext reads from r, returning ctx's error if ctx is done before
+// the Read completes. The pending Read is woken through r's read deadline,
+// which is cleared afterwards; if r has no deadline support, it is a plain
+// Read.
+func readContext(ctx context.Context, r io.Reader, p []byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if ctx.Done() == nil {
+		return r.Read(p)
+	}
+	fired := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		defer close(fired)
+		setReadDeadline(r, pastDeadline)
+	})
+	n, err := r.Read(p)
+	if stop() {
+		return n, err
+	}
+	<-fired
+	setReadDeadline(r, time.Time{})
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		err = ctx.Err()
+	}
+	return n, err
+}
+
+// SetReadDeadline sets the deadline for pending and future Reads of
+// Reader. A Read that reaches it fails with an error wrapping
+// os.ErrDeadlineExceeded and the capture keeps running, so the consumer
+// can read again. A zero t disables the deadline. Returns
+// os.ErrNoDeadline where pipes have no deadlines (Windows).
+func (a *AudioStream) SetReadDeadline(t time.Time) error {
+	return setReadDeadline(a.Reader, t)
+}
+
+// ReadContext reads from Reader like Read, but returns ctx's error once
+// ctx is done, even if ffmpeg is stuck. The capture keeps running. It uses
+// and afterwards clears the read deadline (see SetReadDeadline); where
+// deadlines are unsupported it blocks like Read.
+func (a *AudioStream) ReadContext(ctx context.Context, p []byte) (int, error) {
+	return readContext(ctx, a.Reader, p)
+}
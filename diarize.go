@@ -0,0 +1,241 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// diarizeQueue is how many chunks read by the consumer may wait for
+	// the diarizer before audio is replaced by silence.
+	diarizeQueue = 256
+
+	// diarizeMaxGap is the most silence fed in place of audio the diarizer
+	// missed; longer gaps are shortened, shifting later offsets.
+	diarizeMaxGap = time.Minute
+
+	// diarizeZeroBuf is the size of the buffer silence is written from.
+	diarizeZeroBuf = 32 << 10
+)
+
+// SpeakerChange marks the point in a capture where a different speaker
+// starts talking.
+type SpeakerChange struct {
+	Offset     time.Duration `json:"offset"`               // from the first byte of the capture
+	Speaker    string        `json:"speaker"`              // label assigned by the diarizer, e.g. "S1"
+	Confidence float64       `json:"confidence,omitempty"` // 0-1, if the diarizer reports it
+}
+
+// DiarizeInput is the audio of one capture given to a Diarizer.
+type DiarizeInput struct {
+	RoomID     int64
+	SampleRate int
+	Channels   int
+	Encoding   string    // raw PCM format, e.g. "s16le"
+	Audio      io.Reader // PCM as read by the consumer; EOF when the capture ends
+}
+
+// Diarizer finds speaker changes in a PCM stream, e.g. by running an
+// external program (ProcessDiarizer) or a model in-process. Diarize reads
+// in.Audio until EOF or ctx is done and calls emit for every change; emit
+// must not be called after Diarize returns.
+type Diarizer interface {
+	Diarize(ctx context.Context, in DiarizeInput, emit func(SpeakerChange)) error
+}
+
+// ProcessDiarizer runs an external diarization program per capture. The
+// program reads raw PCM on stdin, in the format given by the environment
+// variables SAMPLE_RATE, CHANNELS and ENCODING, and writes one JSON object
+// per speaker change to stdout:
+//
+//	{"offset": 12.48, "speaker": "S2", "confidence": 0.91}
+//
+// with offset in seconds from the start of its input. Anything on stderr
+// is logged.
+type ProcessDiarizer struct {
+	Path string
+	Args []string
+}
+
+// Diarize implements Diarizer.
+func (p ProcessDiarizer) Diarize(ctx context.Context, in DiarizeInput, emit func(SpeakerChange)) error {
+	cmd := exec.CommandContext(ctx, p.Path, p.Args...)
+	cmd.Env = append(os.Environ(),
+		"SAMPLE_RATE="+strconv.Itoa(in.SampleRate),
+		"CHANNELS="+strconv.Itoa(in.Channels),
+		"ENCODING="+in.Encoding,
+	)
+	cmd.Stdin = in.Audio
+	cmd.Stderr = &logWriter{log: roomLogger(in.RoomID, ""), msg: "diarize: stderr"}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("diarize: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("diarize: start: %w", err)
+	}
+
+	sc := bufio.NewScanner(stdout)
+	for sc.Scan() {
+		var line struct {
+			Offset     float64 `json:"offset"`
+			Speaker    string  `json:"speaker"`
+			Confidence float64 `json:"confidence"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &line); err != nil {
+			roomLogger(in.RoomID, "").Warn("diarize: skipping invalid output line", "error", err)
+			continue
+		}
+		emit(SpeakerChange{
+			Offset:     time.Duration(line.Offset * float64(time.Second)),
+			Speaker:    line.Speaker,
+			Confidence: line.Confidence,
+		})
+	}
+	if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("diarize: %w", err)
+	}
+	return nil
+}
+
+// logWriter logs each write as one line.
+type logWriter struct {
+	log *slog.Logger
+	msg string
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.log.Info(w.msg, "line", string(p))
+	return len(p), nil
+}
+
+// diarizeChunk is audio read by the consumer, preceded by gap bytes that
+// were dropped because the diarizer fell behind.
+type diarizeChunk struct {
+	gap  int
+	data *AudioBuffer // pooled; released by feed
+}
+
+// diarizeTee passes audio read by the consumer on to a diarizer without
+// ever blocking the consumer. Audio the diarizer is too slow for is
+// replaced by silence, so offsets stay aligned with the capture.
+type diarizeTee struct {
+	io.ReadCloser
+	ch      chan diarizeChunk
+	gap     int // bytes dropped since the last queued chunk
+	frame   int // PCM frame size
+	maxGap  int // diarizeMaxGap in bytes, a multiple of frame
+	dropped bool
+	log     *slog.Logger
+	once    sync.Once
+}
+
+func (t *diarizeTee) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		b := copyAudioBuf(p[:n])
+		select {
+		case t.ch <- diarizeChunk{gap: t.gap, data: b}:
+			t.gap = 0
+		default:
+			b.Release()
+			t.gap += n
+			if !t.dropped {
+				t.dropped = true
+				t.log.Warn("diarize: diarizer is falling behind, feeding silence")
+			}
+		}
+	}
+	return n, err
+}
+
+func (t *diarizeTee) SetReadDeadline(d time.Time) error {
+	return setReadDeadline(t.ReadCloser, d)
+}
+
+func (t *diarizeTee) Close() error {
+	err := t.ReadCloser.Close()
+	t.once.Do(func() { close(t.ch) })
+	return err
+}
+
+// feed writes queued chunks to w, with silence for the gaps.
+func (t *diarizeTee) feed(w *io.PipeWriter) {
+	zeros := make([]byte, diarizeZeroBuf)
+	for c := range t.ch {
+		gap := c.gap
+		if gap > t.maxGap {
+			t.log.Warn("diarize: gap too long, shortening its silence", "bytes", gap)
+			gap = t.maxGap + gap%t.frame // keep frames aligned
+		}
+		var err error
+		for gap > 0 && err == nil {
+			n := min(gap, len(zeros))
+			_, err = w.Write(zeros[:n])
+			gap -= n
+		}
+		if err == nil {
+			_, err = w.Write(c.data.Data)
+		}
+		c.data.Release()
+		if err != nil {
+			break
+		}
+	}
+	w.Close()
+	for c := range t.ch {
+		// Drain until Close after the diarizer stopped reading.
+		c.data.Release()
+	}
+}
+
+// startDiarizer runs the client's Diarizer over a PCM capture and returns
+// the reader to hand to the consumer instead of r.
+func (c *StreamClient) startDiarizer(ctx context.Context, audio *AudioStream, r io.ReadCloser, title string) io.ReadCloser {
+	if c.cfg.diarizer == nil || audio.Encoding == FormatADTS {
+		return r
+	}
+	roomID := audio.RoomID
+	frame := max(audio.BytesPerFrame, 1)
+	tee := &diarizeTee{
+		ReadCloser: r,
+		ch:         make(chan diarizeChunk, diarizeQueue),
+		frame:      frame,
+		maxGap:     frame * audio.SampleRate * int(diarizeMaxGap/time.Second),
+		log:        c.monitor.roomLogger(roomID),
+	}
+	pr, pw := io.Pipe()
+	go tee.feed(pw)
+	go func() {
+		in := DiarizeInput{
+			RoomID:     roomID,
+			SampleRate: audio.SampleRate,
+			Channels:   audio.Channels,
+			Encoding:   audio.Encoding,
+			Audio:      pr,
+		}
+		err := c.cfg.diarizer.Diarize(ctx, in, func(sc SpeakerChange) {
+			c.publishStreamEvent(StreamEvent{
+				RoomID:  roomID,
+				Type:    EventSpeakerChange,
+				Title:   title,
+				Speaker: &sc,
+			})
+		})
+		// Keep the feeder from blocking if the diarizer stopped early.
+		pr.CloseWithError(io.ErrClosedPipe)
+		if err != nil && ctx.Err() == nil {
+			c.monitor.roomLogger(roomID).Warn("client: diarizer failed", "error", err)
+		}
+	}()
+	return tee
+}
@@ -0,0 +1,210 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	navURL       = "https://api.bilibili.com/x/web-interface/nav"
+	serverNowURL = "https://api.bilibili.com/x/report/click/now"
+
+	// doctorRoomID is a long-lived official room used to probe the live API.
+	doctorRoomID = 1
+
+	maxClockSkew = 30 * time.Second
+)
+
+// DoctorCheck is the result of a single diagnostic check.
+type DoctorCheck struct {
+	Name    string
+	OK      bool
+	Skipped bool   // true if the check did not apply (e.g. no cookie configured)
+	Detail  string // human-readable result or error description
+}
+
+// DoctorReport is the structured result of Doctor.
+type DoctorReport struct {
+	Checks []DoctorCheck
+
+	FFmpegPath    string
+	FFmpegVersion string
+	LoggedIn      bool
+	Username      string
+	ClockSkew     time.Duration // local clock minus Bilibili server clock
+}
+
+// OK reports whether every check that ran passed.
+func (r *DoctorReport) OK() bool {
+	for _, c := range r.Checks {
+		if !c.OK && !c.Skipped {
+			return false
+		}
+	}
+	return true
+}
+
+// doctorConfig holds internal configuration for Doctor.
+type doctorConfig struct {
+	cookie  string
+	ffmpegs []string
+}
+
+// DoctorOption configures Doctor.
+type DoctorOption func(*doctorConfig)
+
+// WithDoctorCookie sets the SESSDATA cookie whose validity Doctor checks.
+// Without it the credential check is skipped.
+func WithDoctorCookie(sessdata string) DoctorOption {
+	return func(c *doctorConfig) {
+		c.cookie = sessdata
+	}
+}
+
+// WithDoctorFFmpeg additionally checks the given ffmpeg binaries (paths or
+// names in PATH), e.g. the CaptureConfig.FFmpeg builds of a fleet. Each is
+// reported as a check named "ffmpeg:<binary>".
+func WithDoctorFFmpeg(binaries ...string) DoctorOption {
+	return func(c *doctorConfig) {
+		c.ffmpegs = append(c.ffmpegs, binaries...)
+	}
+}
+
+// Doctor diagnoses the environment the library depends on: ffmpeg
+// availability and version, Bilibili API reachability, credential validity
+// and local clock skew. It never returns an error; failures are reported
+// in the individual checks.
+func Doctor(ctx context.Context, opts ...DoctorOption) *DoctorReport {
+	var cfg doctorConfig
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	r := &DoctorReport{}
+	r.Checks = append(r.Checks,
+		r.checkFFmpeg(ctx),
+		r.checkAPI(ctx),
+		r.checkCredentials(ctx, cfg.cookie),
+		r.checkClock(ctx),
+	)
+	for _, bin := range cfg.ffmpegs {
+		r.Checks = append(r.Checks, checkFFmpegBinary(ctx, bin))
+	}
+	return r
+}
+
+func (r *DoctorReport) checkFFmpeg(ctx context.Context) DoctorCheck {
+	check := DoctorCheck{Name: "ffmpeg"}
+
+	info, err := CheckFFmpeg(ctx, defaultFFmpeg)
+	r.FFmpegPath = info.Path
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	r.FFmpegVersion = info.Version
+
+	check.OK = true
+	check.Detail = r.FFmpegVersion
+	return check
+}
+
+// checkFFmpegBinary checks a WithDoctorFFmpeg binary.
+func checkFFmpegBinary(ctx context.Context, bin string) DoctorCheck {
+	check := DoctorCheck{Name: "ffmpeg:" + bin}
+	info, err := CheckFFmpeg(ctx, bin)
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	check.OK = true
+	check.Detail = info.Path + ": " + info.Version
+	return check
+}
+
+func (r *DoctorReport) checkAPI(ctx context.Context) DoctorCheck {
+	check := DoctorCheck{Name: "api"}
+
+	start := time.Now()
+	if _, err := ResolveRoomID(ctx, doctorRoomID); err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+
+	check.OK = true
+	check.Detail = fmt.Sprintf("live API reachable (%s)", time.Since(start).Round(time.Millisecond))
+	return check
+}
+
+func (r *DoctorReport) checkCredentials(ctx context.Context, cookie string) DoctorCheck {
+	check := DoctorCheck{Name: "credentials"}
+	if cookie == "" {
+		check.Skipped = true
+		check.Detail = "no cookie configured"
+		return check
+	}
+
+	apiResp, err := doGet(ctx, navURL, cookie)
+	if err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.Code == codeNotLoggedIn {
+			check.Detail = "cookie rejected (not logged in)"
+		} else {
+			check.Detail = err.Error()
+		}
+		return check
+	}
+
+	var data struct {
+		IsLogin bool   `json:"isLogin"`
+		Uname   string `json:"uname"`
+	}
+	if err := decodeData(apiResp, &data); err != nil {
+		check.Detail = fmt.Sprintf("parse nav: %v", err)
+		return check
+	}
+	r.LoggedIn = data.IsLogin
+	r.Username = data.Uname
+	if !data.IsLogin {
+		check.Detail = "cookie rejected (not logged in)"
+		return check
+	}
+
+	check.OK = true
+	check.Detail = "logged in as " + data.Uname
+	return check
+}
+
+func (r *DoctorReport) checkClock(ctx context.Context) DoctorCheck {
+	check := DoctorCheck{Name: "clock"}
+
+	before := time.Now()
+	apiResp, err := doGet(ctx, serverNowURL, "")
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	after := time.Now()
+
+	var data struct {
+		Now int64 `json:"now"`
+	}
+	if err := decodeData(apiResp, &data); err != nil {
+		check.Detail = fmt.Sprintf("parse server time: %v", err)
+		return check
+	}
+
+	// Compare against the midpoint of the request to cancel out latency.
+	local := before.Add(after.Sub(before) / 2)
+	r.ClockSkew = local.Sub(time.Unix(data.Now, 0)).Round(time.Second)
+
+	skew := r.ClockSkew
+	if skew < 0 {
+		skew = -skew
+	}
+	check.OK = skew <= maxClockSkew
+	check.Detail = fmt.Sprintf("local clock skew %s", r.ClockSkew)
+	return check
+}
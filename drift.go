@@ -0,0 +1,129 @@
+package stream
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// SchemaDrift describes a difference between an API response and the
+// fields the library decodes from it.
+type SchemaDrift struct {
+	Endpoint string   // request URL path, e.g. "/room/v1/Room/get_info"
+	Unknown  []string // fields in the response the library does not decode
+	Missing  []string // fields the library decodes that the response lacks
+}
+
+// driftHandler is the handler installed by SetSchemaDriftHandler.
+var driftHandler atomic.Pointer[func(SchemaDrift)]
+
+// driftSeen records drifts already reported, keyed by endpoint and fields,
+// so each distinct drift is reported once per process.
+var driftSeen sync.Map
+
+// SetSchemaDriftHandler enables strict decoding of API responses. Each
+// distinct drift between a response and the library's expected shape is
+// reported to fn once, so integrators learn about Bilibili API changes
+// before they surface as silently empty fields. Passing nil disables it.
+func SetSchemaDriftHandler(fn func(SchemaDrift)) {
+	if fn == nil {
+		driftHandler.Store(nil)
+		return
+	}
+	driftHandler.Store(&fn)
+}
+
+// decodeData unmarshals the envelope's data into v and, in strict mode,
+// reports schema drift for the endpoint.
+func decodeData(apiResp *apiResponse, v any) error {
+	if err := json.Unmarshal(apiResp.Data, v); err != nil {
+		return err
+	}
+
+	fn := driftHandler.Load()
+	if fn == nil {
+		return nil
+	}
+	drift := SchemaDrift{Endpoint: apiResp.endpoint}
+	schemaDiff(apiResp.Data, reflect.TypeOf(v), "", &drift)
+	if len(drift.Unknown) == 0 && len(drift.Missing) == 0 {
+		return nil
+	}
+	sort.Strings(drift.Unknown)
+	sort.Strings(drift.Missing)
+
+	key := drift.Endpoint + "|" + strings.Join(drift.Unknown, ",") + "|" + strings.Join(drift.Missing, ",")
+	if _, seen := driftSeen.LoadOrStore(key, struct{}{}); !seen {
+		(*fn)(drift)
+	}
+	return nil
+}
+
+// schemaDiff compares raw JSON against the decoded Go type t, recording
+// field paths (e.g. "durl[].url") that are unknown or missing.
+func schemaDiff(raw json.RawMessage, t reflect.Type, path string, d *SchemaDrift) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &obj); err != nil || obj == nil {
+			return
+		}
+		known := make(map[string]bool)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := jsonFieldName(f)
+			if name == "" {
+				continue
+			}
+			known[name] = true
+			v, ok := obj[name]
+			if !ok {
+				d.Missing = append(d.Missing, joinPath(path, name))
+				continue
+			}
+			schemaDiff(v, f.Type, joinPath(path, name), d)
+		}
+		for k := range obj {
+			if !known[k] {
+				d.Unknown = append(d.Unknown, joinPath(path, k))
+			}
+		}
+
+	case reflect.Slice, reflect.Array:
+		var arr []json.RawMessage
+		if err := json.Unmarshal(raw, &arr); err != nil || len(arr) == 0 {
+			return
+		}
+		schemaDiff(arr[0], t.Elem(), path+"[]", d)
+	}
+}
+
+// jsonFieldName returns the JSON key for a struct field, or "" if the
+// field is not decoded.
+func jsonFieldName(f reflect.StructField) string {
+	if !f.IsExported() {
+		return ""
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+	if name, _, _ := strings.Cut(tag, ","); name != "" {
+		return name
+	}
+	return f.Name
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,421 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDVRRetention       = 2 * time.Hour
+	defaultDVRSegmentDuration = time.Minute
+	dvrMarkInterval           = time.Second
+)
+
+// ErrDVRRangeUnavailable is returned by DVR.ReadRange when no retained data
+// overlaps the requested time range.
+var ErrDVRRangeUnavailable = errors.New("dvr: no data retained for range")
+
+// dvrConfig holds internal configuration for DVR.
+type dvrConfig struct {
+	retention       time.Duration
+	segmentDuration time.Duration
+	clock           Clock
+}
+
+// DVROption configures a DVR.
+type DVROption func(*dvrConfig)
+
+// WithDVRRetention sets how much of each room's stream is kept on disk.
+// Default is 2 hours.
+func WithDVRRetention(d time.Duration) DVROption {
+	return func(c *dvrConfig) {
+		c.retention = d
+	}
+}
+
+// WithDVRSegmentDuration sets the length of each segment file. Retention is
+// enforced at segment granularity. Default is 1 minute.
+func WithDVRSegmentDuration(d time.Duration) DVROption {
+	return func(c *dvrConfig) {
+		c.segmentDuration = d
+	}
+}
+
+// WithDVRClock sets the clock used to time segments and pruning. Default
+// is SystemClock().
+func WithDVRClock(clock Clock) DVROption {
+	return func(c *dvrConfig) {
+		c.clock = clock
+	}
+}
+
+// DVR retains the most recent portion of each room's captured stream on
+// disk as a rolling set of segment files, and serves time-ranged reads so
+// processing pipelines can run behind live.
+type DVR struct {
+	dir string
+	cfg dvrConfig
+
+	mu    sync.Mutex
+	rooms map[int64]*dvrRoom
+}
+
+// NewDVR creates a DVR storing segments under dir, which is created if
+// needed. Segments left in dir by an earlier run are kept for reads and
+// pruned like new ones; those past the retention window are removed now.
+func NewDVR(dir string, opts ...DVROption) (*DVR, error) {
+	cfg := dvrConfig{
+		retention:       defaultDVRRetention,
+		segmentDuration: defaultDVRSegmentDuration,
+		clock:           SystemClock(),
+	}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("dvr: create dir: %w", err)
+	}
+	d := &DVR{
+		dir:   dir,
+		cfg:   cfg,
+		rooms: make(map[int64]*dvrRoom),
+	}
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	d.prune()
+	return d, nil
+}
+
+// load picks up the segments of earlier runs. Their byte offsets were not
+// indexed, so reads that overlap them get whole segments.
+func (d *DVR) load() error {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return fmt.Errorf("dvr: read dir: %w", err)
+	}
+	for _, e := range entries {
+		roomID, err := strconv.ParseInt(e.Name(), 10, 64)
+		if err != nil || !e.IsDir() {
+			continue
+		}
+		room := d.room(roomID)
+		files, err := os.ReadDir(room.dir)
+		if err != nil {
+			return fmt.Errorf("dvr: read room dir: %w", err)
+		}
+		// ReadDir sorts by name, and names are start times of equal length.
+		for _, f := range files {
+			nanos, err := strconv.ParseInt(strings.TrimSuffix(f.Name(), ".seg"), 10, 64)
+			if err != nil || !strings.HasSuffix(f.Name(), ".seg") {
+				continue
+			}
+			info, err := f.Info()
+			if err != nil {
+				continue
+			}
+			room.segments = append(room.segments, &dvrSegment{
+				path:  filepath.Join(room.dir, f.Name()),
+				start: time.Unix(0, nanos),
+				end:   info.ModTime(),
+				size:  info.Size(),
+			})
+		}
+	}
+	return nil
+}
+
+// Run prunes the segments of every room, including rooms that are no
+// longer captured, once per segment duration until ctx is done.
+// StreamClient runs it while subscribed if the DVR is set with WithDVR.
+func (d *DVR) Run(ctx context.Context) {
+	ticker := d.cfg.clock.NewTicker(d.cfg.segmentDuration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			d.prune()
+		}
+	}
+}
+
+// prune removes the segments of all rooms that ended before the
+// retention window.
+func (d *DVR) prune() {
+	d.mu.Lock()
+	rooms := make([]*dvrRoom, 0, len(d.rooms))
+	for _, room := range d.rooms {
+		rooms = append(rooms, room)
+	}
+	d.mu.Unlock()
+
+	now := d.cfg.clock.Now()
+	for _, room := range rooms {
+		room.mu.Lock()
+		room.prune(now)
+		room.mu.Unlock()
+	}
+}
+
+// Tee returns a ReadCloser that passes through r while writing everything
+// read into the DVR for roomID. Closing it closes r and the open segment.
+func (d *DVR) Tee(roomID int64, r io.ReadCloser) io.ReadCloser {
+	return &dvrTee{ReadCloser: r, room: d.room(roomID)}
+}
+
+// ReadRange returns the retained stream data for roomID between from and to.
+// Boundaries are resolved to within about one second. The reader opens
+// segment files lazily, so segments pruned mid-read produce an error. The
+// caller must close it to release the open segment file.
+func (d *DVR) ReadRange(roomID int64, from, to time.Time) (io.ReadCloser, error) {
+	if !to.After(from) {
+		return nil, fmt.Errorf("dvr: invalid range %s - %s", from, to)
+	}
+
+	d.mu.Lock()
+	room, ok := d.rooms[roomID]
+	d.mu.Unlock()
+	if !ok {
+		return nil, ErrDVRRangeUnavailable
+	}
+
+	parts := room.rangeParts(from, to)
+	if len(parts) == 0 {
+		return nil, ErrDVRRangeUnavailable
+	}
+	return &dvrRangeReader{parts: parts}, nil
+}
+
+// room returns the per-room store, creating it on first use.
+func (d *DVR) room(roomID int64) *dvrRoom {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	room, ok := d.rooms[roomID]
+	if !ok {
+		room = &dvrRoom{
+			dir: filepath.Join(d.dir, strconv.FormatInt(roomID, 10)),
+			cfg: d.cfg,
+		}
+		d.rooms[roomID] = room
+	}
+	return room
+}
+
+// dvrRoom is the rolling segment store for a single room.
+type dvrRoom struct {
+	dir string
+	cfg dvrConfig
+
+	mu       sync.Mutex
+	segments []*dvrSegment
+	file     *os.File // open handle of the newest segment, nil between captures
+}
+
+// dvrSegment is one segment file with a coarse time → byte offset index.
+type dvrSegment struct {
+	path  string
+	start time.Time
+	end   time.Time // time of the last write
+	size  int64
+	marks []dvrMark
+}
+
+type dvrMark struct {
+	at     time.Time
+	offset int64
+}
+
+// write appends p to the current segment, rotating and pruning as needed.
+func (r *dvrRoom) write(p []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.cfg.clock.Now()
+	if r.file == nil || now.Sub(r.current().start) >= r.cfg.segmentDuration {
+		if err := r.rotate(now); err != nil {
+			return err
+		}
+	}
+
+	seg := r.current()
+	if len(seg.marks) == 0 || now.Sub(seg.marks[len(seg.marks)-1].at) >= dvrMarkInterval {
+		seg.marks = append(seg.marks, dvrMark{at: now, offset: seg.size})
+	}
+	n, err := r.file.Write(p)
+	seg.size += int64(n)
+	seg.end = now
+	return err
+}
+
+// rotate closes the current segment and opens a new one starting at now.
+func (r *dvrRoom) rotate(now time.Time) error {
+	r.closeFile()
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return fmt.Errorf("dvr: create room dir: %w", err)
+	}
+	path := filepath.Join(r.dir, strconv.FormatInt(now.UnixNano(), 10)+".seg")
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("dvr: create segment: %w", err)
+	}
+	r.file = f
+	r.segments = append(r.segments, &dvrSegment{path: path, start: now, end: now})
+	r.prune(now)
+	return nil
+}
+
+// prune removes segments that ended before the retention window, except
+// the one being written.
+func (r *dvrRoom) prune(now time.Time) {
+	cutoff := now.Add(-r.cfg.retention)
+	keep := r.segments[:0]
+	for _, seg := range r.segments {
+		if (r.file == nil || seg != r.current()) && seg.end.Before(cutoff) {
+			if err := os.Remove(seg.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				slog.Warn("dvr: failed to remove segment", "path", seg.path, "error", err)
+			}
+			continue
+		}
+		keep = append(keep, seg)
+	}
+	r.segments = keep
+	if len(keep) == 0 {
+		os.Remove(r.dir) // only if empty; recreated by rotate
+	}
+}
+
+func (r *dvrRoom) current() *dvrSegment {
+	return r.segments[len(r.segments)-1]
+}
+
+func (r *dvrRoom) closeFile() {
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+}
+
+// rangeParts resolves [from, to) into byte ranges of the overlapping segments.
+func (r *dvrRoom) rangeParts(from, to time.Time) []dvrPart {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var parts []dvrPart
+	for _, seg := range r.segments {
+		if seg.size == 0 || seg.end.Before(from) || !seg.start.Before(to) {
+			continue
+		}
+		start, end := int64(0), seg.size
+		for _, m := range seg.marks {
+			if !m.at.After(from) {
+				start = m.offset
+			}
+			if m.at.After(to) {
+				end = m.offset
+				break
+			}
+		}
+		if end > start {
+			parts = append(parts, dvrPart{path: seg.path, offset: start, length: end - start})
+		}
+	}
+	return parts
+}
+
+// dvrTee copies data read from the capture into the room's segment store.
+type dvrTee struct {
+	io.ReadCloser
+	room *dvrRoom
+}
+
+func (t *dvrTee) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		if werr := t.room.write(p[:n]); werr != nil {
+			slog.Warn("dvr: write failed", "error", werr)
+		}
+	}
+	return n, err
+}
+
+func (t *dvrTee) SetReadDeadline(d time.Time) error {
+	return setReadDeadline(t.ReadCloser, d)
+}
+
+func (t *dvrTee) Close() error {
+	t.room.mu.Lock()
+	t.room.closeFile()
+	t.room.mu.Unlock()
+	return t.ReadCloser.Close()
+}
+
+// dvrPart is a byte range of one segment file.
+type dvrPart struct {
+	path   string
+	offset int64
+	length int64
+}
+
+// dvrRangeReader reads a sequence of segment byte ranges, opening each
+// file only while it is being read.
+type dvrRangeReader struct {
+	parts  []dvrPart
+	file   *os.File
+	cur    io.Reader
+	closed bool
+}
+
+func (r *dvrRangeReader) Read(p []byte) (int, error) {
+	for {
+		if r.closed {
+			return 0, os.ErrClosed
+		}
+		if r.cur == nil {
+			if len(r.parts) == 0 {
+				return 0, io.EOF
+			}
+			part := r.parts[0]
+			r.parts = r.parts[1:]
+			f, err := os.Open(part.path)
+			if err != nil {
+				return 0, fmt.Errorf("dvr: open segment: %w", err)
+			}
+			r.file = f
+			r.cur = io.NewSectionReader(f, part.offset, part.length)
+		}
+
+		n, err := r.cur.Read(p)
+		if err == io.EOF {
+			r.file.Close()
+			r.file, r.cur = nil, nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// Close closes the segment file being read and ends the reader.
+func (r *dvrRangeReader) Close() error {
+	r.closed = true
+	r.parts, r.cur = nil, nil
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
@@ -3,15 +3,45 @@ package stream
 import (
 	"context"
 	"io"
+	"log/slog"
+	"time"
 )
 
 // RoomEvent represents a live/offline transition detected by Monitor.
 type RoomEvent struct {
 	RoomID int64
+	UID    int64  // streamer UID
+	Name   string // alias set with WithName, if any
 	Live   bool   // true = went live, false = went offline
 	Title  string // room title (populated when going live)
+	Source string // detection source: SourcePoll, SourceFeed or SourcePush
+
+	// Sources lists every source that reported the transition, Source
+	// first. Without WithSourceCoalescing it is just Source.
+	Sources []string
+
+	Area         AreaHints // hints from the room's live area, as of the last poll
+	LanguageHint string    // WithLanguageHint, else Area.Language
+
+	// SessionID correlates everything from one live session: it is issued
+	// when the room goes live and repeated on the offline event that ends
+	// the session. See Monitor.SessionID.
+	SessionID string
+
+	Muted bool // raised inside one of the room's WithMuteWindows
+
+	// Latency measures how long the live transition took to detect; set on
+	// live events unless the room was already live when first checked.
+	Latency *GoLiveLatency
 }
 
+// Detection sources for RoomEvent.Source.
+const (
+	SourcePoll = "poll" // room info polling
+	SourceFeed = "feed" // streamer's dynamic feed (开播 posts)
+	SourcePush = "push" // LIVE/PREPARING commands on the danmaku connection (PushMode)
+)
+
 // RoomInfo holds metadata about a Bilibili live room.
 type RoomInfo struct {
 	RoomID     int64
@@ -20,15 +50,115 @@ type RoomInfo struct {
 	LiveStatus int // 0=offline, 1=live, 2=rotation
 	Title      string
 	LiveTime   string
+	Online     int64    // popularity (人气) shown on the room page
+	Tags       []string // room tags set by the streamer
+	Cover      string   // cover image URL
+
+	AreaID         int
+	AreaName       string // sub-area (分区), e.g. "虚拟日常"
+	ParentAreaID   int
+	ParentAreaName string // parent area, e.g. "虚拟主播"
 }
 
 // CaptureConfig controls ffmpeg audio capture parameters.
 type CaptureConfig struct {
 	SampleRate int    // default 16000
 	Channels   int    // default 1 (mono)
-	Format     string // default "s16le"
+	Format     string // default "s16le"; FormatADTS copies AAC without transcoding
+
+	// ChannelMap selects which source channels make up the PCM output:
+	// ChannelLeft or ChannelRight takes one channel, ChannelMono averages
+	// both and ChannelStereo keeps them apart (Channels must be 2). A mono
+	// source counts as two identical channels. Empty leaves it to ffmpeg's
+	// default downmix. Setting it with FormatADTS is an error.
+	ChannelMap string
+
+	// FFmpeg is the ffmpeg binary to run: a path, or a name looked up in
+	// PATH. Default "ffmpeg". Captures with different configs can use
+	// different builds, e.g. a minimal static build for audio and a
+	// hardware-accelerated one for video (VideoConfig).
+	FFmpeg string
+
+	LogLevel  string       // ffmpeg -loglevel; default "error"
+	LogStderr bool         // log each ffmpeg stderr line via Logger as it is written
+	Logger    *slog.Logger // logger for capture messages; default slog.Default()
+
+	// Outputs adds outputs produced by the same ffmpeg process as the PCM
+	// pipe (e.g. a file archive), so the stream is downloaded and demuxed once.
+	// Existing files are never overwritten: if Path exists, as after a
+	// capture restart, the output goes to Path with _2, _3, ... before the
+	// extension.
+	Outputs []OutputSpec
+
+	// FirstByteTimeout bounds the time from ffmpeg's start to the first
+	// audio byte, and StallTimeout how long a Read may then wait for more.
+	// When either is exceeded, ffmpeg is stopped and reads fail with
+	// ErrCaptureStalled. Zero disables the limit.
+	FirstByteTimeout time.Duration
+	StallTimeout     time.Duration
+
+	// ProbeTimeout makes CaptureAudio check the URL with ProbeStreamURL
+	// before starting ffmpeg, so a dead URL fails within ProbeTimeout
+	// instead of after ffmpeg's analysis. It costs one extra request per
+	// capture start. Zero disables the probe. It is skipped when the
+	// library downloads the stream itself, which checks the response too.
+	ProbeTimeout time.Duration
+
+	// UnderrunWindow enables the byte-rate watchdog for raw PCM output:
+	// when ffmpeg delivers less than UnderrunRatio (default 0.5) of the
+	// bytes per second the format requires over the last UnderrunWindow,
+	// the capture is reported as underrunning (EventCaptureUnderrun). With
+	// RestartOnUnderrun, ffmpeg is also stopped and reads fail with
+	// ErrCaptureUnderrun, so StreamClient restarts the capture. The rate is
+	// measured as the reader is read, so consumers must keep up with real
+	// time. Zero disables the watchdog.
+	UnderrunWindow    time.Duration
+	UnderrunRatio     float64
+	RestartOnUnderrun bool
+
+	// StreamPTS records the broadcast's own timestamp of the first audio
+	// sample, read from the FLV stream, so output can be placed on the
+	// stream timeline (see StreamPTS, AudioStream.StreamPTS and
+	// WithWAVStreamPTS). Positions after it are derived from the sample
+	// count, which assumes the audio has no gaps. The library downloads the
+	// stream and pipes it to ffmpeg, as with a Resolver.
+	StreamPTS bool
+
+	// Isolation restricts ffmpeg's environment, working directory and
+	// resources. Nil runs it like any child process.
+	Isolation *CaptureIsolation
+
+	onCrash func(CaptureCrash) // set by StreamClient to emit EventCaptureCrashed
+	onStall func(error)        // set by StreamClient to restart stalled captures
+
+	onUnderrun func(CaptureUnderrun) // set by StreamClient to emit EventCaptureUnderrun
+
+	clock Clock // times the stall and underrun watchdogs; set by StreamClient, default SystemClock()
+}
+
+// OutputSpec describes an additional ffmpeg output for CaptureConfig.Outputs.
+type OutputSpec struct {
+	Path      string   // output file path or URL
+	Format    string   // ffmpeg muxer (-f), e.g. "flv", "mpegts"; empty lets ffmpeg guess from Path
+	Codec     string   // codec for all streams (-c); default "copy" (remux, no transcoding)
+	AudioOnly bool     // drop video (-vn)
+	Args      []string // extra output options placed before Path
 }
 
+// FormatADTS is a CaptureConfig.Format that extracts the stream's AAC audio
+// without transcoding (-acodec copy -f adts). It uses far less CPU than PCM
+// output and suits archival; SampleRate and Channels are ignored and the
+// reader yields ADTS-framed AAC as broadcast.
+const FormatADTS = "adts"
+
+// CaptureConfig.ChannelMap values.
+const (
+	ChannelLeft   = "left"   // left channel only, e.g. commentary on one side
+	ChannelRight  = "right"  // right channel only
+	ChannelMono   = "mono"   // average of left and right
+	ChannelStereo = "stereo" // left and right kept as a stereo pair
+)
+
 // DefaultCaptureConfig returns a CaptureConfig with sensible defaults
 // for speech processing: 16kHz mono signed 16-bit little-endian PCM.
 func DefaultCaptureConfig() CaptureConfig {
@@ -39,23 +169,141 @@ func DefaultCaptureConfig() CaptureConfig {
 	}
 }
 
+// logger returns the configured logger, or the default logger.
+func (c *CaptureConfig) logger() *slog.Logger {
+	if c.Logger != nil {
+		return c.Logger
+	}
+	return slog.Default()
+}
+
 // AudioStream represents an active audio capture from a live stream.
-// Reader delivers raw PCM data according to the CaptureConfig used.
+// Reader delivers audio as described by the format fields, which reflect
+// the actual output rather than the requested CaptureConfig: raw PCM in
+// Encoding, or ADTS-framed AAC when Encoding is FormatADTS.
 // Call Cancel to stop the ffmpeg process and release resources.
 type AudioStream struct {
 	RoomID int64
 	Reader io.ReadCloser
 	Cancel context.CancelFunc
+
+	SampleRate    int    // Hz; 0 if unknown (ADTS with an unreadable header)
+	Channels      int    // 0 if unknown
+	Encoding      string // ffmpeg raw PCM format name (e.g. "s16le") or FormatADTS
+	BytesPerFrame int    // bytes per sample frame across all channels; 0 for ADTS
+
+	// StreamPTS is the stream timestamp of the first byte of Reader; valid
+	// if HasStreamPTS, which needs CaptureConfig.StreamPTS. Recordings of
+	// the same broadcast share this timeline.
+	StreamPTS    time.Duration
+	HasStreamPTS bool
+
+	// ChatSync places chat messages on Reader's timeline (see
+	// Danmaku.AudioOffset); nil for ADTS.
+	ChatSync *ChatSync
+
+	// WorkDir is a scratch directory for files derived from this session's
+	// audio, removed when the room goes offline. Empty unless the client
+	// was created with WithWorkDir.
+	WorkDir string
 }
 
 // StreamEvent is emitted by StreamClient to report room state changes
 // and audio capture lifecycle events.
 type StreamEvent struct {
 	RoomID int64
-	Type   string       // "live", "offline", "audio_ready", "error"
+	UID    int64        // streamer UID, once known (see LookupUID)
+	Name   string       // alias set with WithName, if any
+	Type   string       // "live", "offline", "audio_ready", "audio_resumed", "audio_gap", "video_ready", "error", "capture_crashed", "capture_preempted", "capture_skipped", "rank", "capture_underrun", "quality_fallback", "danmaku", "chat", "announcement_changed", "tags_changed", "room_info_changed", "auth_expired", "admin_action", "speaker_change", "monitor_*"
 	Audio  *AudioStream // non-nil when Type == "audio_ready"
-	Error  error        // non-nil when Type == "error"
+	Video  *VideoStream // non-nil when Type == "video_ready"
+	Error  error        // non-nil when Type == "error", or "monitor_stopped" after an internal error
 	Title  string
+	Reason string // why monitoring changed, for the "monitor_*" types (ReasonWatch, ...)
+
+	Session  *SessionSummary // non-nil when Type == "offline"
+	Streamer *StreamerInfo   // streamer profile, set on "live" when available
+
+	Group        string // collab group of the room (WithCollabGroup), if any
+	GroupSession string // ID shared by all members' events during one collab
+
+	Crash    *CaptureCrash    // non-nil when Type == "capture_crashed"
+	Rank     *RankSnapshot    // non-nil when Type == "rank"
+	Underrun *CaptureUnderrun // non-nil when Type == "capture_underrun"
+	Quality  *QualityFallback // non-nil when Type == "quality_fallback"
+	Danmaku  *Danmaku         // non-nil when Type == "danmaku"
+	Chat     *ChatEvent       // non-nil when Type == "chat"
+	Admin    *AdminAction     // non-nil when Type == "admin_action", and on "offline" after a cut-off
+
+	Announcement *AnnouncementChange // non-nil when Type == "announcement_changed"
+	Tags         *TagsChange         // non-nil when Type == "tags_changed"
+	RoomInfo     *RoomInfoChange     // non-nil when Type == "room_info_changed"
+	Speaker      *SpeakerChange      // non-nil when Type == "speaker_change"
+	Latency      *GoLiveLatency      // go-live latency on "live" and the session's first "audio_ready", if measured
+	Resume       *AudioResume        // non-nil when Type == "audio_resumed"
+	Gap          *AudioGap           // non-nil when Type == "audio_gap"
+	Preemption   *CapturePreemption  // non-nil when Type == "capture_preempted" or "capture_skipped"
+
+	Area         AreaHints // hints from the room's live area, as of the last poll
+	LanguageHint string    // WithLanguageHint, else Area.Language; route to STT models with this
+
+	// SessionID is the live session the event belongs to (RoomEvent.SessionID);
+	// empty for captures started while the room is not live.
+	SessionID string
+
+	// Muted is set for events raised inside one of the room's
+	// WithMuteWindows. They are delivered as usual; alerting consumers
+	// should skip them (see WithSinkSkipMuted).
+	Muted bool
+}
+
+// releaseStreams stops the captures ev carries and closes their readers,
+// for code that consumes an event without handing it on.
+func releaseStreams(ev StreamEvent) {
+	if a := ev.Audio; a != nil {
+		if a.Cancel != nil {
+			a.Cancel()
+		}
+		a.Reader.Close()
+	}
+	if v := ev.Video; v != nil {
+		if v.Cancel != nil {
+			v.Cancel()
+		}
+		v.Reader.Close()
+	}
+}
+
+// CaptureCrash describes an ffmpeg process that exited with an error on
+// its own, as opposed to being stopped by cancelling the capture.
+type CaptureCrash struct {
+	ExitCode int           // process exit code; -1 if killed by a signal or unknown
+	Signal   string        // terminating signal (e.g. "segmentation fault"), if any
+	Stderr   string        // last 4 KiB of ffmpeg's stderr
+	Uptime   time.Duration // time from ffmpeg start to exit
+	Err      error         // classified exit error (e.g. wrapping ErrStreamForbidden)
+}
+
+// StreamerInfo is the profile of the streamer who owns a live room.
+type StreamerInfo struct {
+	UID       int64  `json:"uid"`
+	Name      string `json:"name"` // display name (uname)
+	Face      string `json:"face"` // avatar image URL
+	RoomID    int64  `json:"room_id"`
+	RoomNews  string `json:"room_news"` // room announcement
+	Followers int64  `json:"followers"`
+}
+
+// SessionSummary describes a live session that has ended. It is attached
+// to the "offline" StreamEvent so consumers can log a summary without
+// tracking session state themselves.
+type SessionSummary struct {
+	StartedAt       time.Time     `json:"started_at"`       // when the room was detected live
+	EndedAt         time.Time     `json:"ended_at"`         // when the room was detected offline
+	Duration        time.Duration `json:"duration"`         // EndedAt - StartedAt
+	AudioBytes      int64         `json:"audio_bytes"`      // raw PCM bytes read by the consumer
+	AudioDuration   time.Duration `json:"audio_duration"`   // AudioBytes converted using the CaptureConfig
+	CaptureRestarts int           `json:"capture_restarts"` // capture attempts beyond the first
 }
 
 // Event type constants for StreamEvent.Type.
@@ -64,4 +312,73 @@ const (
 	EventOffline    = "offline"
 	EventAudioReady = "audio_ready"
 	EventError      = "error"
+
+	// EventAudioResumed reports that a capture's ffmpeg process ended
+	// while the room was still live, usually because the stream URL
+	// expired, and a fresh URL now feeds the same AudioStream.Reader
+	// (StreamEvent.Resume). Error holds why the process ended. Consumers
+	// keep reading; the audio skips the gap.
+	EventAudioResumed = "audio_resumed"
+
+	// EventAudioGap precedes EventAudioResumed and marks where on the
+	// reader's timeline audio is missing and for how long
+	// (StreamEvent.Gap), so consumers can keep timestamps aligned; see
+	// also WithAudioGapFill.
+	EventAudioGap = "audio_gap"
+
+	// EventVideoReady carries a video capture (StreamEvent.Video) started
+	// next to the audio capture (WithVideoConfig).
+	EventVideoReady = "video_ready"
+
+	// EventCaptureCrashed reports an ffmpeg crash (StreamEvent.Crash), either
+	// while starting or after audio was delivered. Supervisors can count
+	// these per room; the client's own retry handling is unaffected.
+	EventCaptureCrashed = "capture_crashed"
+
+	// EventCapturePreempted reports that the room's capture was stopped
+	// to free a slot for a higher-priority room (StreamEvent.Preemption),
+	// and EventCaptureSkipped that the room's capture was not started
+	// because every slot is taken by rooms of equal or higher priority;
+	// see WithMaxConcurrentCaptures. Either room is captured once a slot
+	// frees up while it is live.
+	EventCapturePreempted = "capture_preempted"
+	EventCaptureSkipped   = "capture_skipped"
+
+	// EventRank carries a periodic RankSnapshot (WithRankSampling).
+	EventRank = "rank"
+
+	// EventCaptureUnderrun reports a capture delivering too little audio
+	// (StreamEvent.Underrun); see CaptureConfig.UnderrunWindow. It is
+	// emitted once per episode, until the rate recovers or the capture is
+	// restarted.
+	EventCaptureUnderrun = "capture_underrun"
+
+	// EventQualityFallback reports a capture running at a different quality
+	// than requested with WithQuality (StreamEvent.Quality), usually because
+	// 原画 needs a logged-in cookie. The capture proceeds at the best
+	// available quality.
+	EventQualityFallback = "quality_fallback"
+
+	// EventDanmaku carries a chat message (StreamEvent.Danmaku). Messages
+	// recovered from the room's history are marked Backfilled; see
+	// WithDanmakuBackfill.
+	EventDanmaku = "danmaku"
+
+	// EventChat carries every chat command other than a danmaku
+	// (StreamEvent.Chat). Gifts, super chats, guard purchases, viewer
+	// interactions, and the watched, like and popularity counters have a
+	// typed payload; any other command, or one whose payload could not be
+	// parsed, comes as ChatEvent.Raw. Only commands selected with
+	// WithChatCommands are emitted.
+	EventChat = "chat"
+
+	// EventAnnouncementChanged reports an edited room announcement
+	// (StreamEvent.Announcement), and EventTagsChanged changed room tags
+	// (StreamEvent.Tags); see WithAnnouncementPolling.
+	EventAnnouncementChanged = "announcement_changed"
+	EventTagsChanged         = "tags_changed"
+
+	// EventSpeakerChange marks a new speaker in a capture
+	// (StreamEvent.Speaker); see WithDiarizer.
+	EventSpeakerChange = "speaker_change"
 )
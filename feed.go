@@ -0,0 +1,74 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const spaceFeedURL = "https://api.bilibili.com/x/polymer/web-dynamic/v1/feed/space?host_mid=%d"
+
+// feedLiveStatus is the live state announced by a streamer's most recent
+// "went live" (开播了) dynamic post.
+type feedLiveStatus struct {
+	RoomID    int64
+	Live      bool
+	Title     string
+	StartedAt time.Time
+}
+
+// getFeedLiveStatus scans the streamer's space dynamic feed for the most
+// recent live recommendation post. Returns nil if the first page of the
+// feed contains none.
+func getFeedLiveStatus(ctx context.Context, uid int64) (*feedLiveStatus, error) {
+	apiResp, err := doGet(ctx, fmt.Sprintf(spaceFeedURL, uid), "")
+	if err != nil {
+		return nil, fmt.Errorf("get space feed: %w", err)
+	}
+
+	var data struct {
+		Items []struct {
+			Type    string `json:"type"`
+			Modules struct {
+				ModuleDynamic struct {
+					Major struct {
+						LiveRcmd struct {
+							Content string `json:"content"`
+						} `json:"live_rcmd"`
+					} `json:"major"`
+				} `json:"module_dynamic"`
+			} `json:"modules"`
+		} `json:"items"`
+	}
+	// Feed items are heterogeneous, so strict drift checking is skipped here.
+	if err := json.Unmarshal(apiResp.Data, &data); err != nil {
+		return nil, fmt.Errorf("parse space feed: %w", err)
+	}
+
+	for _, item := range data.Items {
+		if item.Type != "DYNAMIC_TYPE_LIVE_RCMD" {
+			continue
+		}
+		// The live card is itself a JSON document embedded as a string.
+		var card struct {
+			LivePlayInfo struct {
+				RoomID        int64  `json:"room_id"`
+				LiveStatus    int    `json:"live_status"`
+				Title         string `json:"title"`
+				LiveStartTime int64  `json:"live_start_time"`
+			} `json:"live_play_info"`
+		}
+		if err := json.Unmarshal([]byte(item.Modules.ModuleDynamic.Major.LiveRcmd.Content), &card); err != nil {
+			return nil, fmt.Errorf("parse live card: %w", err)
+		}
+		info := card.LivePlayInfo
+		return &feedLiveStatus{
+			RoomID:    info.RoomID,
+			Live:      info.LiveStatus == 1,
+			Title:     info.Title,
+			StartedAt: time.Unix(info.LiveStartTime, 0),
+		}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,92 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"time"
+)
+
+// defaultFFmpeg is the binary run when a config names none.
+const defaultFFmpeg = "ffmpeg"
+
+// ffmpegCheckTimeout bounds the startup check of each ffmpeg binary.
+const ffmpegCheckTimeout = 10 * time.Second
+
+// ErrFFmpegUnavailable is returned by CheckFFmpeg when a binary cannot be
+// found or run.
+var ErrFFmpegUnavailable = errors.New("ffmpeg unavailable")
+
+// FFmpegInfo describes an ffmpeg binary checked by CheckFFmpeg.
+type FFmpegInfo struct {
+	Binary  string // as configured, e.g. "ffmpeg" or "/opt/ffmpeg-nvenc/bin/ffmpeg"
+	Path    string // resolved path
+	Version string // first line of -version, e.g. "ffmpeg version 6.1.1 ..."
+}
+
+// ffmpegBinary returns the binary to run for a config's FFmpeg field.
+func ffmpegBinary(name string) string {
+	if name == "" {
+		return defaultFFmpeg
+	}
+	return name
+}
+
+// CheckFFmpeg checks that binary (a path, or a name looked up in PATH;
+// empty means "ffmpeg") exists and runs, and reports its version. Errors
+// wrap ErrFFmpegUnavailable.
+func CheckFFmpeg(ctx context.Context, binary string) (FFmpegInfo, error) {
+	info := FFmpegInfo{Binary: ffmpegBinary(binary)}
+	path, err := exec.LookPath(info.Binary)
+	if err != nil {
+		return info, fmt.Errorf("%w: %w", ErrFFmpegUnavailable, err)
+	}
+	info.Path = path
+
+	out, err := exec.CommandContext(ctx, path, "-hide_banner", "-version").Output()
+	if err != nil {
+		return info, fmt.Errorf("%w: run %s -version: %w", ErrFFmpegUnavailable, path, err)
+	}
+	line, _, _ := bufio.NewReader(bytes.NewReader(out)).ReadLine()
+	info.Version = string(line)
+	return info, nil
+}
+
+// ffmpegBinaries returns the distinct ffmpeg binaries the client's
+// captures run.
+func (c *StreamClient) ffmpegBinaries() []string {
+	bins := []string{ffmpegBinary(c.cfg.audioCfg.FFmpeg)}
+	if v := c.cfg.videoCfg; v != nil {
+		if b := ffmpegBinary(v.FFmpeg); b != bins[0] {
+			bins = append(bins, b)
+		}
+	}
+	return bins
+}
+
+// checkFFmpeg health-checks the client's ffmpeg binaries at startup and
+// reports each that cannot run as EventError, so a broken install shows up
+// before the first broadcast rather than at it.
+func (c *StreamClient) checkFFmpeg(ctx context.Context) {
+	if !c.cfg.autoCapture && c.cfg.videoCfg == nil {
+		return
+	}
+	for _, bin := range c.ffmpegBinaries() {
+		checkCtx, cancel := context.WithTimeout(ctx, ffmpegCheckTimeout)
+		info, err := CheckFFmpeg(checkCtx, bin)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.Error("client: ffmpeg check failed", "binary", bin, "error", err)
+			c.publishStreamEvent(StreamEvent{Type: EventError, Error: err})
+			continue
+		}
+		slog.Info("client: ffmpeg ready", "binary", bin, "path", info.Path, "version", info.Version)
+	}
+}
@@ -0,0 +1,196 @@
+package stream
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maxFilenameBytes is the common per-component limit (ext4, NTFS via UTF-16
+	// is 255 units; bytes is the stricter bound for CJK titles).
+	maxFilenameBytes = 255
+
+	defaultTimeLayout = "20060102-150405"
+)
+
+// FilenameVars are the values available to a FilenameTemplate.
+type FilenameVars struct {
+	RoomID    int64
+	UID       int64
+	Name      string // room alias (WithName)
+	Title     string
+	StartTime time.Time
+	Segment   int           // segment number within a session, starting at 1
+	PTS       time.Duration // stream timestamp of the file's start (see PTSRange)
+}
+
+// FilenameTemplate renders file names for recordings from templates such as
+// "{room_id}_{title}_{start_time}". Supported placeholders:
+//
+//	{room_id} {uid} {name} {title}
+//	{start_time}          formatted as 20060102-150405
+//	{start_time:LAYOUT}   formatted with a Go time layout, e.g. {start_time:2006-01-02}
+//	{segment}             zero-padded to 3 digits
+//	{pts}                 stream timestamp in milliseconds, zero-padded to 9 digits
+//
+// Substituted values are sanitized with SanitizeFilename, so titles with
+// path separators, reserved characters or emoji never break a save.
+type FilenameTemplate struct {
+	parts []templatePart
+
+	// Transliterate, if set, is applied to name and title before sanitizing,
+	// e.g. a pinyin converter for tools that cannot handle CJK paths.
+	Transliterate func(string) string
+}
+
+type templatePart struct {
+	literal string
+	field   string // placeholder name; empty for literals
+	arg     string // text after ':' in the placeholder
+}
+
+// ParseFilenameTemplate parses a template, rejecting unknown placeholders
+// and unbalanced braces.
+func ParseFilenameTemplate(tmpl string) (*FilenameTemplate, error) {
+	t := &FilenameTemplate{}
+	rest := tmpl
+	for rest != "" {
+		i := strings.IndexByte(rest, '{')
+		if i < 0 {
+			t.parts = append(t.parts, templatePart{literal: rest})
+			break
+		}
+		if i > 0 {
+			t.parts = append(t.parts, templatePart{literal: rest[:i]})
+		}
+		end := strings.IndexByte(rest[i:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("filename template %q: unclosed '{'", tmpl)
+		}
+		field, arg, _ := strings.Cut(rest[i+1:i+end], ":")
+		switch field {
+		case "room_id", "uid", "name", "title", "segment", "pts":
+			if arg != "" {
+				return nil, fmt.Errorf("filename template %q: {%s} takes no argument", tmpl, field)
+			}
+		case "start_time":
+		default:
+			return nil, fmt.Errorf("filename template %q: unknown placeholder {%s}", tmpl, field)
+		}
+		t.parts = append(t.parts, templatePart{field: field, arg: arg})
+		rest = rest[i+end+1:]
+	}
+	return t, nil
+}
+
+// Render expands the template for v. The result is a single sanitized path
+// component; literal text in the template is sanitized as well.
+func (t *FilenameTemplate) Render(v FilenameVars) string {
+	var b strings.Builder
+	for _, p := range t.parts {
+		if p.field == "" {
+			b.WriteString(p.literal)
+			continue
+		}
+		b.WriteString(SanitizeFilename(t.value(p, v)))
+	}
+	return SanitizeFilename(b.String())
+}
+
+func (t *FilenameTemplate) value(p templatePart, v FilenameVars) string {
+	text := func(s string) string {
+		if t.Transliterate != nil {
+			return t.Transliterate(s)
+		}
+		return s
+	}
+	switch p.field {
+	case "room_id":
+		return strconv.FormatInt(v.RoomID, 10)
+	case "uid":
+		return strconv.FormatInt(v.UID, 10)
+	case "name":
+		return text(v.Name)
+	case "title":
+		return text(v.Title)
+	case "segment":
+		return fmt.Sprintf("%03d", v.Segment)
+	case "pts":
+		return fmt.Sprintf("%09d", v.PTS.Milliseconds())
+	case "start_time":
+		layout := p.arg
+		if layout == "" {
+			layout = defaultTimeLayout
+		}
+		return v.StartTime.Format(layout)
+	}
+	return ""
+}
+
+// SanitizeFilename makes s safe to use as a single file name on Windows,
+// macOS and Linux: path separators and reserved characters (<>:"/\|?*)
+// become '_', control characters and emoji are dropped, trailing dots and
+// spaces are trimmed, Windows device names (CON, NUL, COM1, ...) are
+// prefixed, and the result is cut to 255 bytes on a UTF-8 boundary.
+// An empty result is returned as "_".
+func SanitizeFilename(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case strings.ContainsRune(`<>:"/\|?*`, r):
+			b.WriteByte('_')
+		case r == utf8.RuneError, unicode.IsControl(r), isEmoji(r):
+			// drop
+		default:
+			b.WriteRune(r)
+		}
+	}
+	out := strings.TrimSpace(b.String())
+	out = strings.TrimRight(out, ". ")
+
+	if isWindowsReserved(out) {
+		out = "_" + out
+	}
+	if len(out) > maxFilenameBytes {
+		out = out[:maxFilenameBytes]
+		for !utf8.ValidString(out) {
+			out = out[:len(out)-1]
+		}
+		out = strings.TrimRight(out, ". ")
+	}
+	if out == "" {
+		return "_"
+	}
+	return out
+}
+
+// isEmoji reports whether r is a pictographic symbol or an emoji modifier.
+// These render inconsistently and break some archive and sync tools.
+func isEmoji(r rune) bool {
+	switch {
+	case r >= 0x1F000 && r <= 0x1FAFF: // emoji, pictographs, transport, flags
+		return true
+	case r >= 0x2600 && r <= 0x27BF: // misc symbols, dingbats
+		return true
+	case r == 0x200D, r == 0xFE0F, r == 0xFE0E: // ZWJ, variation selectors
+		return true
+	}
+	return false
+}
+
+// isWindowsReserved reports whether name (without extension) is a DOS
+// device name that Windows refuses to create.
+func isWindowsReserved(name string) bool {
+	base, _, _ := strings.Cut(name, ".")
+	switch strings.ToUpper(strings.TrimSpace(base)) {
+	case "CON", "PRN", "AUX", "NUL",
+		"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+		"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9":
+		return true
+	}
+	return false
+}
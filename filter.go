@@ -0,0 +1,421 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EventFilter is a compiled filter expression over StreamEvent fields, so
+// consumers can select events declaratively instead of writing custom
+// filtering code. Expressions look like:
+//
+//	type == "live" and room_id in (1, 2)
+//	title contains "歌" or not (name == "test")
+//
+// Fields: room_id and uid (numbers), type, name, title, error (strings;
+// error is the error message or ""). Operators: == != on any field, in (...)
+// and not in (...) with a list of values, and contains on strings. Conditions
+// combine with and/&&, or/|| and not/!, with parentheses for grouping;
+// and binds tighter than or. Strings use Go quoted syntax.
+type EventFilter struct {
+	expr  string
+	match func(*StreamEvent) bool
+}
+
+// ParseEventFilter compiles expr. An empty expression matches every event.
+func ParseEventFilter(expr string) (*EventFilter, error) {
+	f := &EventFilter{expr: expr}
+	if strings.TrimSpace(expr) == "" {
+		f.match = func(*StreamEvent) bool { return true }
+		return f, nil
+	}
+
+	toks, err := lexFilter(expr)
+	if err != nil {
+		return nil, fmt.Errorf("event filter %q: %w", expr, err)
+	}
+	p := &filterParser{toks: toks}
+	match, err := p.parseOr()
+	if err == nil && p.pos < len(p.toks) {
+		err = fmt.Errorf("unexpected %q", p.toks[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("event filter %q: %w", expr, err)
+	}
+	f.match = match
+	return f, nil
+}
+
+// MustParseEventFilter is like ParseEventFilter but panics on error. It is
+// intended for filters fixed at compile time.
+func MustParseEventFilter(expr string) *EventFilter {
+	f, err := ParseEventFilter(expr)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// String returns the source expression.
+func (f *EventFilter) String() string {
+	return f.expr
+}
+
+// Match reports whether ev satisfies the filter.
+func (f *EventFilter) Match(ev StreamEvent) bool {
+	return f.match(&ev)
+}
+
+// FilterEvents forwards the events from in that match f to the returned
+// channel, which is closed when in is closed or ctx is done. The captures
+// of "audio_ready" and "video_ready" events that are filtered out, or
+// still undelivered when ctx is done, are stopped and closed.
+func FilterEvents(ctx context.Context, in <-chan StreamEvent, f *EventFilter) <-chan StreamEvent {
+	out := make(chan StreamEvent, streamEventBufSize)
+	go func() {
+		defer close(out)
+		for {
+			var ev StreamEvent
+			select {
+			case <-ctx.Done():
+				return
+			case e, ok := <-in:
+				if !ok {
+					return
+				}
+				ev = e
+			}
+			if !f.Match(ev) {
+				releaseStreams(ev)
+				continue
+			}
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+				releaseStreams(ev)
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// filterFields maps field names to their kind: true for numeric fields.
+var filterFields = map[string]bool{
+	"room_id": true,
+	"uid":     true,
+	"type":    false,
+	"name":    false,
+	"title":   false,
+	"error":   false,
+}
+
+func filterNumber(ev *StreamEvent, field string) int64 {
+	if field == "uid" {
+		return ev.UID
+	}
+	return ev.RoomID
+}
+
+func filterString(ev *StreamEvent, field string) string {
+	switch field {
+	case "type":
+		return ev.Type
+	case "name":
+		return ev.Name
+	case "title":
+		return ev.Title
+	case "error":
+		if ev.Error != nil {
+			return ev.Error.Error()
+		}
+	}
+	return ""
+}
+
+type filterTokKind int
+
+const (
+	tokIdent filterTokKind = iota
+	tokNumber
+	tokString
+	tokPunct
+)
+
+type filterTok struct {
+	kind filterTokKind
+	text string // identifiers are lower-cased; strings are unquoted
+}
+
+// lexFilter splits a filter expression into tokens.
+func lexFilter(s string) ([]filterTok, error) {
+	var toks []filterTok
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '`':
+			j := i + 1
+			for j < len(s) && s[j] != c {
+				if c == '"' && s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			v, err := strconv.Unquote(s[i : j+1])
+			if err != nil {
+				return nil, fmt.Errorf("bad string at offset %d: %w", i, err)
+			}
+			toks = append(toks, filterTok{tokString, v})
+			i = j + 1
+		case c == '-' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+				j++
+			}
+			toks = append(toks, filterTok{tokNumber, s[i:j]})
+			i = j
+		case isIdentByte(c):
+			j := i + 1
+			for j < len(s) && (isIdentByte(s[j]) || (s[j] >= '0' && s[j] <= '9')) {
+				j++
+			}
+			toks = append(toks, filterTok{tokIdent, strings.ToLower(s[i:j])})
+			i = j
+		default:
+			if i+1 < len(s) {
+				switch two := s[i : i+2]; two {
+				case "==", "!=", "&&", "||":
+					toks = append(toks, filterTok{tokPunct, two})
+					i += 2
+					continue
+				}
+			}
+			if !strings.ContainsRune("(),!", rune(c)) {
+				return nil, fmt.Errorf("unexpected character %q at offset %d", c, i)
+			}
+			toks = append(toks, filterTok{tokPunct, string(c)})
+			i++
+		}
+	}
+	return toks, nil
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// filterParser is a recursive-descent parser producing match closures.
+type filterParser struct {
+	toks []filterTok
+	pos  int
+}
+
+func (p *filterParser) peek() (filterTok, bool) {
+	if p.pos >= len(p.toks) {
+		return filterTok{}, false
+	}
+	return p.toks[p.pos], true
+}
+
+// accept consumes the next token if it is one of words (keywords or
+// punctuation).
+func (p *filterParser) accept(words ...string) bool {
+	t, ok := p.peek()
+	if !ok || t.kind == tokString || t.kind == tokNumber {
+		return false
+	}
+	for _, w := range words {
+		if t.text == w {
+			p.pos++
+			return true
+		}
+	}
+	return false
+}
+
+func (p *filterParser) expect(word string) error {
+	if !p.accept(word) {
+		return p.errorf("expected %q", word)
+	}
+	return nil
+}
+
+func (p *filterParser) errorf(format string, args ...any) error {
+	msg := fmt.Sprintf(format, args...)
+	if t, ok := p.peek(); ok {
+		return fmt.Errorf("%s, got %q", msg, t.text)
+	}
+	return fmt.Errorf("%s at end of expression", msg)
+}
+
+func (p *filterParser) parseOr() (func(*StreamEvent) bool, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or", "||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(ev *StreamEvent) bool { return l(ev) || right(ev) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (func(*StreamEvent) bool, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and", "&&") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(ev *StreamEvent) bool { return l(ev) && right(ev) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseNot() (func(*StreamEvent) bool, error) {
+	if p.accept("not", "!") {
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(ev *StreamEvent) bool { return !inner(ev) }, nil
+	}
+	if p.accept("(") {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	}
+	return p.parseCondition()
+}
+
+// parseCondition parses "field op value".
+func (p *filterParser) parseCondition() (func(*StreamEvent) bool, error) {
+	t, ok := p.peek()
+	if !ok || t.kind != tokIdent {
+		return nil, p.errorf("expected field name")
+	}
+	numeric, known := filterFields[t.text]
+	if !known {
+		return nil, fmt.Errorf("unknown field %q", t.text)
+	}
+	field := t.text
+	p.pos++
+
+	switch {
+	case p.accept("=="), p.accept("!="):
+		negate := p.toks[p.pos-1].text == "!="
+		v, err := p.parseValue(numeric)
+		if err != nil {
+			return nil, err
+		}
+		return filterIn(field, numeric, []string{v}, negate), nil
+
+	case p.accept("in"):
+		vs, err := p.parseList(numeric)
+		if err != nil {
+			return nil, err
+		}
+		return filterIn(field, numeric, vs, false), nil
+
+	case p.accept("not"):
+		if err := p.expect("in"); err != nil {
+			return nil, err
+		}
+		vs, err := p.parseList(numeric)
+		if err != nil {
+			return nil, err
+		}
+		return filterIn(field, numeric, vs, true), nil
+
+	case p.accept("contains"):
+		if numeric {
+			return nil, fmt.Errorf("contains is not supported on numeric field %q", field)
+		}
+		v, err := p.parseValue(false)
+		if err != nil {
+			return nil, err
+		}
+		return func(ev *StreamEvent) bool {
+			return strings.Contains(filterString(ev, field), v)
+		}, nil
+	}
+	return nil, p.errorf("expected operator after %q", field)
+}
+
+func (p *filterParser) parseValue(numeric bool) (string, error) {
+	t, ok := p.peek()
+	want := tokString
+	if numeric {
+		want = tokNumber
+	}
+	if !ok || t.kind != want {
+		if numeric {
+			return "", p.errorf("expected number")
+		}
+		return "", p.errorf("expected quoted string")
+	}
+	if numeric {
+		if _, err := strconv.ParseInt(t.text, 10, 64); err != nil {
+			return "", fmt.Errorf("bad number %q", t.text)
+		}
+	}
+	p.pos++
+	return t.text, nil
+}
+
+func (p *filterParser) parseList(numeric bool) ([]string, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var vs []string
+	for {
+		v, err := p.parseValue(numeric)
+		if err != nil {
+			return nil, err
+		}
+		vs = append(vs, v)
+		if p.accept(")") {
+			return vs, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// filterIn matches field against a set of values, optionally negated.
+func filterIn(field string, numeric bool, values []string, negate bool) func(*StreamEvent) bool {
+	if numeric {
+		set := make(map[int64]bool, len(values))
+		for _, v := range values {
+			n, _ := strconv.ParseInt(v, 10, 64)
+			set[n] = true
+		}
+		return func(ev *StreamEvent) bool { return set[filterNumber(ev, field)] != negate }
+	}
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return func(ev *StreamEvent) bool { return set[filterString(ev, field)] != negate }
+}
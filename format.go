@@ -0,0 +1,48 @@
+package stream
+
+import (
+	"bufio"
+	"io"
+)
+
+// adtsSampleRates maps the ADTS sampling_frequency_index to Hz.
+var adtsSampleRates = [...]int{
+	96000, 88200, 64000, 48000, 44100, 32000, 24000,
+	22050, 16000, 12000, 11025, 8000, 7350,
+}
+
+// setFormat fills the format fields of a from what the capture actually
+// produces. PCM output is resampled by ffmpeg exactly as configured, so cfg
+// is authoritative. ADTS passthrough keeps the source's sample rate and
+// channel layout, which are read from the first frame header when r is a
+// buffered capture reader; they stay 0 if the header cannot be read.
+func (a *AudioStream) setFormat(r io.Reader, cfg CaptureConfig) {
+	a.Encoding = cfg.Format
+
+	if cfg.Format != FormatADTS {
+		a.SampleRate = cfg.SampleRate
+		a.Channels = cfg.Channels
+		a.BytesPerFrame = sampleSize(cfg.Format) * cfg.Channels
+		return
+	}
+
+	br, ok := r.(*bufferedReadCloser)
+	if !ok {
+		return
+	}
+	a.SampleRate, a.Channels = peekADTS(br.Reader)
+}
+
+// peekADTS parses the fixed header of the next ADTS frame without
+// consuming it. Returns zeros if the data is not ADTS.
+func peekADTS(br *bufio.Reader) (sampleRate, channels int) {
+	hdr, err := br.Peek(4)
+	if err != nil || hdr[0] != 0xFF || hdr[1]&0xF0 != 0xF0 {
+		return 0, 0
+	}
+	if idx := int(hdr[2]>>2) & 0x0F; idx < len(adtsSampleRates) {
+		sampleRate = adtsSampleRates[idx]
+	}
+	channels = int(hdr[2]&0x01)<<2 | int(hdr[3]>>6)
+	return sampleRate, channels
+}
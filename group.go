@@ -0,0 +1,114 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// collabGroup is a set of rooms whose captures start together, e.g. the
+// points of view of a multi-streamer collab.
+type collabGroup struct {
+	name  string
+	rooms []int64
+	wait  time.Duration
+
+	mu      sync.Mutex
+	session string // current group session ID; "" while no member is live
+	ready   bool   // straggler wait is over; members start capturing on live
+}
+
+// groupSession returns the group name and current session ID for roomID,
+// or empty strings if the room is not in a group or the group is idle.
+func (c *StreamClient) groupSession(roomID int64) (name, session string) {
+	g := c.groups[roomID]
+	if g == nil {
+		return "", ""
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.name, g.session
+}
+
+// joinGroup records that a grouped room went live. The first member to go
+// live opens a group session, probes the other members immediately instead
+// of waiting for their next poll, and schedules a synchronized capture
+// start after the group's wait. It reports whether the caller should hold
+// off starting capture because that synchronized start is still pending.
+func (c *StreamClient) joinGroup(ctx context.Context, roomID int64) bool {
+	g := c.groups[roomID]
+	if g == nil {
+		return false
+	}
+
+	g.mu.Lock()
+	if g.session != "" {
+		defer g.mu.Unlock()
+		return !g.ready
+	}
+	session := fmt.Sprintf("%s-%d", g.name, c.cfg.clock.Now().Unix())
+	g.session = session
+	g.ready = false
+	g.mu.Unlock()
+
+	roomLogger(roomID, c.monitor.RoomName(roomID)).Info("client: collab group session started",
+		"group", g.name, "group_session", session)
+
+	for _, id := range g.rooms {
+		if id != roomID {
+			go c.monitor.checkRoom(ctx, id)
+		}
+	}
+	go func() {
+		select {
+		case <-c.cfg.clock.After(g.wait):
+		case <-ctx.Done():
+			return
+		}
+		c.startGroup(ctx, g, session)
+	}()
+	return true
+}
+
+// startGroup starts capture for every member of g that is live, once the
+// straggler wait of session is over.
+func (c *StreamClient) startGroup(ctx context.Context, g *collabGroup, session string) {
+	g.mu.Lock()
+	if g.session != session {
+		g.mu.Unlock()
+		return
+	}
+	g.ready = true
+	g.mu.Unlock()
+
+	for _, id := range g.rooms {
+		if !c.monitor.isLive(id) || c.monitor.IsPaused(id) || !c.autoCaptureFor(id) {
+			continue
+		}
+		c.capturesMu.Lock()
+		s, ok := c.sessions[id]
+		_, capturing := c.captures[id]
+		c.capturesMu.Unlock()
+		if ok && !capturing {
+			go c.startCapture(ctx, id, s.title, s, false)
+		}
+	}
+}
+
+// leaveGroup closes the group session of roomID once no member is live.
+func (c *StreamClient) leaveGroup(roomID int64) {
+	g := c.groups[roomID]
+	if g == nil {
+		return
+	}
+	for _, id := range g.rooms {
+		if c.monitor.isLive(id) {
+			return
+		}
+	}
+	g.mu.Lock()
+	g.session = ""
+	g.ready = false
+	g.mu.Unlock()
+}
@@ -0,0 +1,66 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Guard (大航海) membership levels. Lower values are higher ranks.
+const (
+	GuardGovernor = 1 // 总督
+	GuardAdmiral  = 2 // 提督
+	GuardCaptain  = 3 // 舰长
+)
+
+// ErrGuardRequired matches (via errors.Is) a GuardRequiredError.
+var ErrGuardRequired = errors.New("guard membership required")
+
+// GuardRequiredError is returned when a stream is restricted to guard
+// (大航海) members and the account used for the request does not qualify.
+// Configure a qualifying account's cookie to fetch the play URL.
+type GuardRequiredError struct {
+	RoomID int64
+	Level  int    // minimum guard level required, e.g. GuardCaptain
+	Reason string // Bilibili's message
+}
+
+func (e *GuardRequiredError) Error() string {
+	return fmt.Sprintf("room %d requires %s or above: %s", e.RoomID, guardName(e.Level), e.Reason)
+}
+
+func (e *GuardRequiredError) Is(target error) bool {
+	return target == ErrGuardRequired
+}
+
+// guardRestriction inspects an API error from the play URL endpoint and
+// returns a GuardRequiredError if it reports a member-only stream. Bilibili
+// does not use a dedicated code for this, so the message is matched against
+// the guard rank names it mentions.
+func guardRestriction(roomID int64, err error) error {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return nil
+	}
+	for _, level := range []int{GuardCaptain, GuardAdmiral, GuardGovernor} {
+		if strings.Contains(apiErr.Message, guardName(level)) {
+			return &GuardRequiredError{RoomID: roomID, Level: level, Reason: apiErr.Message}
+		}
+	}
+	if strings.Contains(apiErr.Message, "大航海") {
+		return &GuardRequiredError{RoomID: roomID, Level: GuardCaptain, Reason: apiErr.Message}
+	}
+	return nil
+}
+
+func guardName(level int) string {
+	switch level {
+	case GuardGovernor:
+		return "总督"
+	case GuardAdmiral:
+		return "提督"
+	case GuardCaptain:
+		return "舰长"
+	}
+	return fmt.Sprintf("guard level %d", level)
+}
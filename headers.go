@@ -0,0 +1,107 @@
+package stream
+
+import (
+	"fmt"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// FFmpegHeaders formats h for ffmpeg's -headers option: one "Name: value"
+// line per header, sorted by name, each terminated by CRLF. ffmpeg copies
+// the string into its requests verbatim, so a stray CR or LF in a value
+// would split it into extra header lines. Names must be valid HTTP tokens
+// and values must not contain control characters; anything else is
+// reported as an error. Names are canonicalized (e.g. "referer" becomes
+// "Referer") and must be unique after that.
+func FFmpegHeaders(h map[string]string) (string, error) {
+	canonical := make(map[string]string, len(h))
+	names := make([]string, 0, len(h))
+	for name, value := range h {
+		if err := validateHeader(name, value); err != nil {
+			return "", err
+		}
+		key := textproto.CanonicalMIMEHeaderKey(name)
+		if _, dup := canonical[key]; dup {
+			return "", fmt.Errorf("header %s: given more than once", key)
+		}
+		canonical[key] = value
+		names = append(names, key)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteString(": ")
+		b.WriteString(strings.TrimSpace(canonical[name]))
+		b.WriteString("\r\n")
+	}
+	return b.String(), nil
+}
+
+// validateHeader reports whether name and value can be sent unchanged.
+func validateHeader(name, value string) error {
+	if name == "" {
+		return fmt.Errorf("header: empty name")
+	}
+	for i := 0; i < len(name); i++ {
+		if !isTokenByte(name[i]) {
+			return fmt.Errorf("header: invalid name %q", name)
+		}
+	}
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; (c < ' ' && c != '\t') || c == 0x7f {
+			return fmt.Errorf("header %s: invalid character %q in value", name, c)
+		}
+	}
+	return nil
+}
+
+// isTokenByte reports whether c may appear in an HTTP header name (RFC 9110
+// token).
+func isTokenByte(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}
+
+// requestHeaders returns the headers sent with API requests and stream
+// downloads for opts, using cookie as SESSDATA. Extra cookies from
+// opts.Headers are appended to SESSDATA instead of replacing it; other
+// extra headers override the defaults. Keys are canonical.
+func requestHeaders(opts RequestOptions, cookie string) (map[string]string, error) {
+	h := map[string]string{
+		"User-Agent": opts.userAgentOr(),
+		"Referer":    referer,
+	}
+	var cookies []string
+	if cookie != "" {
+		cookies = append(cookies, "SESSDATA="+cookie)
+	}
+	for name, value := range opts.Headers {
+		if err := validateHeader(name, value); err != nil {
+			return nil, err
+		}
+		name = textproto.CanonicalMIMEHeaderKey(name)
+		if name == "Cookie" {
+			if value = strings.TrimSpace(value); value != "" {
+				cookies = append(cookies, value)
+			}
+			continue
+		}
+		h[name] = value
+	}
+	if len(cookies) > 0 {
+		h["Cookie"] = strings.Join(cookies, "; ")
+	}
+	// The defaults may carry caller values too (UserAgent, Cookie).
+	for name, value := range h {
+		if err := validateHeader(name, value); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
@@ -0,0 +1,63 @@
+package stream
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	webHeartbeatURL = "https://live-trace.bilibili.com/xlive/rdata-interface/v1/heartbeat/webHeartBeat?pf=web&hb=%s"
+
+	defaultHeartbeatInterval = 60 * time.Second
+)
+
+// sendWebHeartbeat reports that the logged-in account is watching roomID,
+// as the web player does. It returns the interval the server asks for
+// before the next heartbeat.
+func sendWebHeartbeat(ctx context.Context, roomID int64, interval time.Duration, cookie string) (time.Duration, error) {
+	hb := fmt.Sprintf("%d|%d|1|0", int(interval.Seconds()), roomID)
+	u := fmt.Sprintf(webHeartbeatURL, url.QueryEscape(base64.StdEncoding.EncodeToString([]byte(hb))))
+
+	apiResp, err := doGet(ctx, u, cookie)
+	if err != nil {
+		return 0, fmt.Errorf("web heartbeat: %w", err)
+	}
+
+	var data struct {
+		NextInterval int `json:"next_interval"`
+	}
+	if err := decodeData(apiResp, &data); err != nil {
+		return 0, fmt.Errorf("parse web heartbeat: %w", err)
+	}
+	if data.NextInterval <= 0 {
+		return defaultHeartbeatInterval, nil
+	}
+	return time.Duration(data.NextInterval) * time.Second, nil
+}
+
+// runHeartbeat sends watch heartbeats for a room until ctx is cancelled.
+// Failures are logged and retried at the default interval.
+func (c *StreamClient) runHeartbeat(ctx context.Context, roomID int64) {
+	log := c.monitor.roomLogger(roomID)
+	interval := defaultHeartbeatInterval
+	for {
+		next, err := sendWebHeartbeat(ctx, roomID, interval, c.cfg.cookie)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Warn("client: heartbeat failed", "error", err)
+			next = defaultHeartbeatInterval
+		}
+		interval = next
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.cfg.clock.After(interval):
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+const statusByUIDsURL = "https://api.live.bilibili.com/room/v1/Room/get_status_info_by_uids?"
+
+// maxUIDsPerRequest is how many UIDs get_status_info_by_uids is asked for
+// at once.
+const maxUIDsPerRequest = 50
+
+// ErrNoLiveRoom is returned by GetRoomIDByUID for users without a live room.
+var ErrNoLiveRoom = errors.New("user has no live room")
+
+// idCache maps streamer UIDs to live room IDs and back. A UID owns at most
+// one room and the pairing never changes, so entries are kept for the life
+// of the process. It is filled by every API call that returns both IDs.
+var idCache = &uidRoomCache{
+	byUID:  make(map[int64]int64),
+	byRoom: make(map[int64]int64),
+}
+
+type uidRoomCache struct {
+	mu     sync.RWMutex
+	byUID  map[int64]int64
+	byRoom map[int64]int64
+}
+
+// store records that uid owns the (long) room ID roomID.
+func (c *uidRoomCache) store(uid, roomID int64) {
+	if uid == 0 || roomID == 0 {
+		return
+	}
+	c.mu.Lock()
+	c.byUID[uid] = roomID
+	c.byRoom[roomID] = uid
+	c.mu.Unlock()
+}
+
+func (c *uidRoomCache) roomID(uid int64) (int64, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	id, ok := c.byUID[uid]
+	return id, ok
+}
+
+func (c *uidRoomCache) uid(roomID int64) (int64, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	uid, ok := c.byRoom[roomID]
+	return uid, ok
+}
+
+// LookupRoomID returns the room ID of the streamer with the given UID if
+// the library has already seen it, without making a request.
+func LookupRoomID(uid int64) (int64, bool) {
+	return idCache.roomID(uid)
+}
+
+// LookupUID returns the UID of the streamer owning a (long) room ID if the
+// library has already seen it, without making a request.
+func LookupUID(roomID int64) (int64, bool) {
+	return idCache.uid(roomID)
+}
+
+// GetRoomIDByUID returns the live room ID of the streamer with the given
+// UID, or ErrNoLiveRoom if the user has never opened one. Known UIDs are
+// answered from the cache.
+func GetRoomIDByUID(ctx context.Context, uid int64) (int64, error) {
+	ids, err := GetRoomIDsByUIDs(ctx, []int64{uid})
+	if err != nil {
+		return 0, err
+	}
+	id, ok := ids[uid]
+	if !ok {
+		return 0, fmt.Errorf("get room id of uid %d: %w", uid, ErrNoLiveRoom)
+	}
+	return id, nil
+}
+
+// GetRoomIDsByUIDs returns the live room IDs of several streamers, keyed by
+// UID. UIDs without a live room are absent from the result. Known UIDs are
+// answered from the cache; the rest are fetched in batches.
+func GetRoomIDsByUIDs(ctx context.Context, uids []int64) (map[int64]int64, error) {
+	out := make(map[int64]int64, len(uids))
+	var missing []int64
+	seen := make(map[int64]bool, len(uids))
+	for _, uid := range uids {
+		if seen[uid] {
+			continue
+		}
+		seen[uid] = true
+		if id, ok := idCache.roomID(uid); ok {
+			out[uid] = id
+		} else {
+			missing = append(missing, uid)
+		}
+	}
+
+	for len(missing) > 0 {
+		batch := missing[:min(len(missing), maxUIDsPerRequest)]
+		missing = missing[len(batch):]
+		if err := getStatusByUIDs(ctx, batch, out); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// getStatusByUIDs fetches the rooms of uids into out.
+func getStatusByUIDs(ctx context.Context, uids []int64, out map[int64]int64) error {
+	rooms, err := fetchStatusByUIDs(ctx, uids)
+	if err != nil {
+		return err
+	}
+	for _, s := range rooms {
+		out[s.UID] = s.RoomID
+	}
+	return nil
+}
+
+// uidStatus is a streamer's room as reported by get_status_info_by_uids.
+type uidStatus struct {
+	RoomID     int64  `json:"room_id"`
+	ShortID    int64  `json:"short_id"`
+	UID        int64  `json:"uid"`
+	LiveStatus int    `json:"live_status"`
+	Title      string `json:"title"`
+	LiveTime   int64  `json:"live_time"` // unix seconds; 0 when offline
+	Online     int64  `json:"online"`
+	Tags       string `json:"tags"`
+	Cover      string `json:"cover_from_user"`
+
+	AreaID         int    `json:"area_v2_id"`
+	AreaName       string `json:"area_v2_name"`
+	ParentAreaID   int    `json:"area_v2_parent_id"`
+	ParentAreaName string `json:"area_v2_parent_name"`
+}
+
+// fetchStatusByUIDs fetches the rooms of at most maxUIDsPerRequest uids in
+// one request and records their IDs in idCache. UIDs without a live room
+// are missing from the result.
+func fetchStatusByUIDs(ctx context.Context, uids []int64) ([]uidStatus, error) {
+	q := url.Values{}
+	for _, uid := range uids {
+		q.Add("uids[]", strconv.FormatInt(uid, 10))
+	}
+	apiResp, err := doGet(ctx, statusByUIDsURL+q.Encode(), "")
+	if err != nil {
+		return nil, fmt.Errorf("get status info by uids: %w", err)
+	}
+
+	// data is an object keyed by UID, or an empty array when no UID has a
+	// room.
+	if len(apiResp.Data) > 0 && apiResp.Data[0] == '[' {
+		return nil, nil
+	}
+	var data map[string]uidStatus
+	if err := decodeData(apiResp, &data); err != nil {
+		return nil, fmt.Errorf("parse status info by uids: %w", err)
+	}
+	rooms := make([]uidStatus, 0, len(data))
+	for _, s := range data {
+		if s.UID == 0 || s.RoomID == 0 {
+			continue
+		}
+		idCache.store(s.UID, s.RoomID)
+		rooms = append(rooms, s)
+	}
+	return rooms, nil
+}
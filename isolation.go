@@ -0,0 +1,48 @@
+package stream
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// ErrCgroupUnsupported is returned when CaptureIsolation asks for cgroup
+// limits on a platform without cgroup v2 support.
+var ErrCgroupUnsupported = errors.New("cgroup limits are only supported on linux")
+
+// CaptureIsolation restricts the ffmpeg process of a capture, so that one
+// runaway capture cannot starve the others on a shared host.
+type CaptureIsolation struct {
+	// Env, if non-nil, replaces ffmpeg's environment (instead of inheriting
+	// the process's), e.g. []string{"LC_ALL=C"}. An empty, non-nil slice
+	// runs ffmpeg with no environment at all.
+	Env []string
+
+	// Dir is ffmpeg's working directory; relative output paths in
+	// CaptureConfig.Outputs resolve against it. Default is the current one.
+	Dir string
+
+	// CgroupParent is a cgroup v2 directory the process may manage, e.g.
+	// "/sys/fs/cgroup/bili.slice" with the memory and cpu controllers
+	// enabled for its children. Each capture gets its own child cgroup,
+	// created before ffmpeg starts and removed after it exits, with the
+	// limits below. Linux only.
+	CgroupParent string
+	MemoryMax    int64   // bytes (memory.max); 0 = no limit
+	CPUMax       float64 // CPU cores (cpu.max), e.g. 0.5; 0 = no limit
+}
+
+// apply configures cmd for the isolation settings. The returned cleanup
+// must be called once the process has exited (or failed to start).
+func (iso *CaptureIsolation) apply(cmd *exec.Cmd) (cleanup func(), err error) {
+	if iso == nil {
+		return func() {}, nil
+	}
+	if iso.Env != nil {
+		cmd.Env = iso.Env
+	}
+	cmd.Dir = iso.Dir
+	if iso.CgroupParent == "" {
+		return func() {}, nil
+	}
+	return applyCgroup(cmd, iso)
+}
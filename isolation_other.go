@@ -0,0 +1,10 @@
+//go:build !linux
+
+package stream
+
+import "os/exec"
+
+// applyCgroup always fails on this platform.
+func applyCgroup(cmd *exec.Cmd, iso *CaptureIsolation) (func(), error) {
+	return nil, ErrCgroupUnsupported
+}
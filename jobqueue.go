@@ -0,0 +1,393 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Common job kinds. Any non-empty string may be used as a kind.
+const (
+	JobTranscode  = "transcode"
+	JobTranscribe = "transcribe"
+	JobUpload     = "upload"
+)
+
+const (
+	defaultJobConcurrency = 2
+	defaultJobMaxAttempts = 5
+	defaultJobBackoff     = 30 * time.Second
+	maxJobBackoff         = 30 * time.Minute
+
+	// jobIdleWait is how long Run sleeps when nothing is scheduled; Enqueue
+	// and finishing jobs wake it earlier.
+	jobIdleWait = time.Hour
+)
+
+// Job is a unit of deferred post-processing, such as transcoding or
+// uploading a finished recording. Jobs are persisted as JSON files, so
+// pending work survives process restarts.
+type Job struct {
+	ID     string            `json:"id"` // assigned by Enqueue
+	Kind   string            `json:"kind"`
+	RoomID int64             `json:"room_id,omitempty"`
+	Path   string            `json:"path,omitempty"` // input file, typically a recording
+	Params map[string]string `json:"params,omitempty"`
+
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	NotBefore time.Time `json:"not_before,omitempty"` // earliest time of the next attempt
+}
+
+// JobHandler processes a job. A nil error completes the job; any other
+// error schedules a retry with exponential backoff until the attempt limit
+// is reached. ctx is cancelled when Run stops; a job interrupted that way
+// is retried on the next Run without counting an attempt.
+type JobHandler func(ctx context.Context, job Job) error
+
+// jobQueueConfig holds internal configuration for JobQueue.
+type jobQueueConfig struct {
+	concurrency int
+	maxAttempts int
+	backoff     time.Duration
+	clock       Clock
+}
+
+// JobQueueOption configures a JobQueue.
+type JobQueueOption func(*jobQueueConfig)
+
+// WithJobConcurrency sets how many jobs run at once. Default is 2.
+func WithJobConcurrency(n int) JobQueueOption {
+	return func(c *jobQueueConfig) {
+		c.concurrency = n
+	}
+}
+
+// WithJobMaxAttempts sets how many times a job is tried before it is moved
+// to the failed set. Default is 5.
+func WithJobMaxAttempts(n int) JobQueueOption {
+	return func(c *jobQueueConfig) {
+		c.maxAttempts = n
+	}
+}
+
+// WithJobBackoff sets the delay before the first retry; it doubles with
+// each further attempt, up to 30 minutes. Default is 30 seconds.
+func WithJobBackoff(d time.Duration) JobQueueOption {
+	return func(c *jobQueueConfig) {
+		c.backoff = d
+	}
+}
+
+// WithJobClock sets the clock timing retry backoff. Default is
+// SystemClock().
+func WithJobClock(clock Clock) JobQueueOption {
+	return func(c *jobQueueConfig) {
+		c.clock = clock
+	}
+}
+
+// JobQueue is a persistent queue of post-processing jobs with retries and a
+// concurrency limit. Pending jobs are stored as one JSON file each in the
+// queue directory and jobs that exhausted their attempts under "failed/".
+// Delivery is at-least-once: a job is only removed after its handler
+// returns nil, so handlers should be idempotent.
+type JobQueue struct {
+	dir string
+	cfg jobQueueConfig
+
+	mu       sync.Mutex
+	handlers map[string]JobHandler
+	pending  map[string]*Job
+	running  map[string]bool
+
+	wake chan struct{}
+	seq  atomic.Uint64
+}
+
+// NewJobQueue opens the queue stored in dir, creating it if needed, and
+// loads any jobs left pending by a previous process.
+func NewJobQueue(dir string, opts ...JobQueueOption) (*JobQueue, error) {
+	cfg := jobQueueConfig{
+		concurrency: defaultJobConcurrency,
+		maxAttempts: defaultJobMaxAttempts,
+		backoff:     defaultJobBackoff,
+		clock:       SystemClock(),
+	}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	if cfg.concurrency < 1 {
+		cfg.concurrency = 1
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "failed"), 0o755); err != nil {
+		return nil, fmt.Errorf("job queue: create dir: %w", err)
+	}
+
+	q := &JobQueue{
+		dir:      dir,
+		cfg:      cfg,
+		handlers: make(map[string]JobHandler),
+		pending:  make(map[string]*Job),
+		running:  make(map[string]bool),
+		wake:     make(chan struct{}, 1),
+	}
+	jobs, err := readJobs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		q.pending[job.ID] = job
+	}
+	return q, nil
+}
+
+// Handle registers h for jobs of the given kind. Jobs whose kind has no
+// handler stay pending until one is registered.
+func (q *JobQueue) Handle(kind string, h JobHandler) {
+	q.mu.Lock()
+	q.handlers[kind] = h
+	q.mu.Unlock()
+	q.notify()
+}
+
+// Enqueue persists job and schedules it for immediate processing. ID,
+// CreatedAt and Attempts are assigned by the queue. Returns the job ID.
+func (q *JobQueue) Enqueue(job Job) (string, error) {
+	if job.Kind == "" {
+		return "", errors.New("job queue: job kind is required")
+	}
+	now := q.cfg.clock.Now()
+	job.ID = strconv.FormatInt(now.UnixNano(), 10) + "-" + strconv.FormatUint(q.seq.Add(1), 10)
+	job.CreatedAt = now
+	job.Attempts = 0
+	job.LastError = ""
+	job.NotBefore = time.Time{}
+
+	if err := writeJob(q.jobPath(job.ID), &job); err != nil {
+		return "", err
+	}
+	q.mu.Lock()
+	q.pending[job.ID] = &job
+	q.mu.Unlock()
+	q.notify()
+	return job.ID, nil
+}
+
+// Pending returns the jobs waiting to run or running, oldest first.
+func (q *JobQueue) Pending() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]Job, 0, len(q.pending))
+	for _, job := range q.pending {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+	return jobs
+}
+
+// Failed returns the jobs that exhausted their attempts, oldest first.
+func (q *JobQueue) Failed() ([]Job, error) {
+	jobs, err := readJobs(filepath.Join(q.dir, "failed"))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Job, len(jobs))
+	for i, job := range jobs {
+		out[i] = *job
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+// Run processes jobs until ctx is cancelled, then waits for running
+// handlers to return. It always returns ctx.Err().
+func (q *JobQueue) Run(ctx context.Context) error {
+	sem := make(chan struct{}, q.cfg.concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		job, err := q.waitNext(ctx)
+		if err != nil {
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			q.run(ctx, job)
+		}()
+	}
+}
+
+// waitNext blocks until a job is due and marks it running.
+func (q *JobQueue) waitNext(ctx context.Context) (*Job, error) {
+	for {
+		job, wait := q.next()
+		if job != nil {
+			return job, nil
+		}
+		timer, stop := newTimer(q.cfg.clock, wait)
+		select {
+		case <-ctx.Done():
+			stop()
+			return nil, ctx.Err()
+		case <-q.wake:
+		case <-timer:
+		}
+		stop()
+	}
+}
+
+// next returns the oldest due job with a registered handler, marking it
+// running. If none is due it returns the time until the earliest one is.
+func (q *JobQueue) next() (*Job, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.cfg.clock.Now()
+	var due *Job
+	wait := jobIdleWait
+	for id, job := range q.pending {
+		if q.running[id] || q.handlers[job.Kind] == nil {
+			continue
+		}
+		if d := job.NotBefore.Sub(now); d > 0 {
+			wait = min(wait, d)
+			continue
+		}
+		if due == nil || job.CreatedAt.Before(due.CreatedAt) {
+			due = job
+		}
+	}
+	if due != nil {
+		q.running[due.ID] = true
+	}
+	return due, wait
+}
+
+// run executes one job and records the outcome.
+func (q *JobQueue) run(ctx context.Context, job *Job) {
+	q.mu.Lock()
+	h := q.handlers[job.Kind]
+	snapshot := *job
+	q.mu.Unlock()
+
+	log := slog.With("job_id", job.ID, "kind", job.Kind)
+	err := h(ctx, snapshot)
+
+	q.mu.Lock()
+	defer q.notify()
+	defer q.mu.Unlock()
+	delete(q.running, job.ID)
+
+	switch {
+	case err == nil:
+		delete(q.pending, job.ID)
+		if rmErr := os.Remove(q.jobPath(job.ID)); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) {
+			log.Warn("job queue: remove completed job", "err", rmErr)
+		}
+		log.Info("job queue: job completed")
+
+	case ctx.Err() != nil:
+		// Interrupted by shutdown; the job stays on disk for the next Run.
+
+	default:
+		job.Attempts++
+		job.LastError = err.Error()
+		if job.Attempts >= q.cfg.maxAttempts {
+			delete(q.pending, job.ID)
+			if mvErr := writeJob(filepath.Join(q.dir, "failed", job.ID+".json"), job); mvErr != nil {
+				log.Error("job queue: record failed job", "err", mvErr)
+				return
+			}
+			os.Remove(q.jobPath(job.ID))
+			log.Error("job queue: job failed permanently", "attempts", job.Attempts, "err", err)
+			return
+		}
+		job.NotBefore = q.cfg.clock.Now().Add(q.backoff(job.Attempts))
+		if wErr := writeJob(q.jobPath(job.ID), job); wErr != nil {
+			log.Error("job queue: persist retry", "err", wErr)
+		}
+		log.Warn("job queue: job failed, will retry", "attempt", job.Attempts, "retry_at", job.NotBefore, "err", err)
+	}
+}
+
+// backoff returns the delay before retry number attempt (1-based).
+func (q *JobQueue) backoff(attempt int) time.Duration {
+	d := q.cfg.backoff
+	for i := 1; i < attempt && d < maxJobBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxJobBackoff)
+}
+
+func (q *JobQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *JobQueue) jobPath(id string) string {
+	return filepath.Join(q.dir, id+".json")
+}
+
+// writeJob stores job at path atomically (write to a temp file, then rename).
+func writeJob(path string, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("job queue: encode job: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("job queue: write job: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("job queue: write job: %w", err)
+	}
+	return nil
+}
+
+// readJobs loads every job file in dir. Leftover temp files from an
+// interrupted write are ignored.
+func readJobs(dir string) ([]*Job, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("job queue: read dir: %w", err)
+	}
+	var jobs []*Job
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("job queue: read job: %w", err)
+		}
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			return nil, fmt.Errorf("job queue: parse %s: %w", e.Name(), err)
+		}
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
@@ -0,0 +1,43 @@
+package stream
+
+import "time"
+
+// GoLiveLatency measures how long it took to notice a broadcast and to
+// get its first audio, against the start time Bilibili reports
+// (live_time). It is attached to the live event and to the first
+// audio_ready event of a session, to tune polling intervals and capture
+// settings with data.
+//
+// LiveTime has one-second precision and comes from Bilibili's clock, so
+// durations measured from it are approximate and are clamped at zero.
+type GoLiveLatency struct {
+	LiveTime     time.Time `json:"live_time"`      // broadcast start reported by Bilibili; zero if unknown
+	DetectedAt   time.Time `json:"detected_at"`    // when the live transition was detected
+	FirstAudioAt time.Time `json:"first_audio_at"` // when the first audio byte arrived; zero on live events
+
+	Detection  time.Duration `json:"detection"`   // DetectedAt - LiveTime; 0 if LiveTime is unknown
+	FirstAudio time.Duration `json:"first_audio"` // FirstAudioAt - DetectedAt
+	Total      time.Duration `json:"total"`       // FirstAudioAt - LiveTime; 0 if LiveTime is unknown
+}
+
+// newGoLiveLatency returns the latency of a detection at detected of a
+// broadcast that started at liveTime (zero if unknown).
+func newGoLiveLatency(liveTime, detected time.Time) *GoLiveLatency {
+	l := &GoLiveLatency{LiveTime: liveTime, DetectedAt: detected}
+	if !liveTime.IsZero() {
+		l.Detection = max(detected.Sub(liveTime), 0)
+	}
+	return l
+}
+
+// withFirstAudio returns a copy of l completed with the first audio byte's
+// arrival at t.
+func (l *GoLiveLatency) withFirstAudio(t time.Time) *GoLiveLatency {
+	out := *l
+	out.FirstAudioAt = t
+	out.FirstAudio = max(t.Sub(l.DetectedAt), 0)
+	if !l.LiveTime.IsZero() {
+		out.Total = max(t.Sub(l.LiveTime), 0)
+	}
+	return &out
+}
@@ -0,0 +1,87 @@
+package stream
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// Lifecycle event types, used for RoomLifecycle.Type and StreamEvent.Type.
+const (
+	EventMonitorStarted = "monitor_started"
+	EventMonitorStopped = "monitor_stopped"
+	EventMonitorPaused  = "monitor_paused"
+	EventMonitorResumed = "monitor_resumed"
+)
+
+// Reasons for RoomLifecycle.Reason and StreamEvent.Reason.
+const (
+	ReasonWatch         = "watch"          // started: room passed to Watch or Subscribe
+	ReasonAdded         = "added"          // started: AddRoom
+	ReasonRemoved       = "removed"        // stopped: RemoveRoom
+	ReasonShutdown      = "shutdown"       // stopped: the Watch context ended
+	ReasonInternalError = "internal_error" // stopped: polling the room failed unexpectedly (Err)
+	ReasonRoom          = "room"           // paused/resumed: PauseRoom or ResumeRoom
+	ReasonAll           = "all"            // paused/resumed: Pause or Resume
+)
+
+// RoomLifecycle reports a change in whether a room is being monitored, so
+// operators can audit that configuration changes took effect and notice
+// rooms that were dropped.
+type RoomLifecycle struct {
+	RoomID int64
+	Type   string // EventMonitorStarted, EventMonitorStopped, EventMonitorPaused or EventMonitorResumed
+	Reason string // one of the Reason constants
+	Err    error  // set with ReasonInternalError
+	At     time.Time
+}
+
+// WithLifecycleCallback registers fn to be called when monitoring of a room
+// starts, stops, pauses or resumes. It is called synchronously and must not
+// block.
+func WithLifecycleCallback(fn func(RoomLifecycle)) MonitorOption {
+	return func(c *monitorConfig) {
+		c.onLifecycle = fn
+	}
+}
+
+// lifecycle reports a lifecycle change of a room.
+func (m *Monitor) lifecycle(roomID int64, typ, reason string, err error) {
+	if m.cfg.onLifecycle == nil {
+		return
+	}
+	m.cfg.onLifecycle(RoomLifecycle{
+		RoomID: roomID,
+		Type:   typ,
+		Reason: reason,
+		Err:    err,
+		At:     m.cfg.clock.Now(),
+	})
+}
+
+// recoverRoom, deferred around a room's polling, turns a panic into the
+// room being dropped with ReasonInternalError, instead of taking down the
+// whole process.
+func (m *Monitor) recoverRoom(roomID int64) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	err := fmt.Errorf("panic while polling room: %v", r)
+	m.roomLogger(roomID).Error("monitor: dropping room after internal error",
+		"error", err, "stack", string(debug.Stack()))
+	if m.removeRoom(roomID) {
+		m.lifecycle(roomID, EventMonitorStopped, ReasonInternalError, err)
+	}
+}
+
+// watchEnded reports a room whose polling stopped because its context
+// ended, unless it was removed (RemoveRoom reports that itself).
+func (m *Monitor) watchEnded(roomID int64) {
+	m.mu.Lock()
+	_, watched := m.rooms[roomID]
+	m.mu.Unlock()
+	if watched {
+		m.lifecycle(roomID, EventMonitorStopped, ReasonShutdown, nil)
+	}
+}
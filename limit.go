@@ -0,0 +1,213 @@
+package stream
+
+import "context"
+
+// CapturePreemption describes a capture stopped or not started because of
+// WithMaxConcurrentCaptures; see EventCapturePreempted and
+// EventCaptureSkipped.
+type CapturePreemption struct {
+	Limit      int   `json:"limit"`                 // WithMaxConcurrentCaptures
+	Priority   int   `json:"priority"`              // priority of the event's room (WithCapturePriority)
+	By         int64 `json:"by,omitempty"`          // room that took the slot; 0 for EventCaptureSkipped
+	ByPriority int   `json:"by_priority,omitempty"` // priority of By
+}
+
+// WithCapturePriority sets the room's capture priority for
+// WithMaxConcurrentCaptures: when every slot is taken, a room that goes
+// live preempts the capture of a room with a lower priority. Default is 0.
+func WithCapturePriority(p int) RoomOption {
+	return func(c *roomConfig) {
+		c.priority = p
+	}
+}
+
+// capturePriority returns the room's WithCapturePriority.
+func (m *Monitor) capturePriority(roomID int64) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.roomCfgs[roomID].priority
+}
+
+// admitCaptureLocked reports whether a new capture of roomID fits under
+// WithMaxConcurrentCaptures. When every slot is taken, the capture with the
+// lowest priority below roomID's is chosen to make room, the one of the
+// most recent session among equals; victim is 0 if none was needed.
+// c.capturesMu must be held.
+func (c *StreamClient) admitCaptureLocked(roomID int64) (victim int64, ok bool) {
+	limit := c.cfg.maxCaptures
+	if limit <= 0 || len(c.captures) < limit {
+		return 0, true
+	}
+	prio := c.monitor.capturePriority(roomID)
+	victimPrio := prio
+	for id := range c.captures {
+		p := c.monitor.capturePriority(id)
+		switch {
+		case p < victimPrio:
+		case p == victimPrio && victim != 0 && c.startedAfter(id, victim):
+		default:
+			continue
+		}
+		victim, victimPrio = id, p
+	}
+	return victim, victim != 0
+}
+
+// startedAfter reports whether a's live session started after b's.
+// c.capturesMu must be held.
+func (c *StreamClient) startedAfter(a, b int64) bool {
+	sa, sb := c.sessions[a], c.sessions[b]
+	return sa != nil && sb != nil && sa.startedAt.After(sb.startedAt)
+}
+
+// captureSlot is a capture's entry in StreamClient.captures. The pointer
+// identifies the capture, so one that ends frees only its own slot.
+type captureSlot struct {
+	cancel context.CancelFunc
+	manual bool // started with StartCapture rather than by auto-capture
+}
+
+// claimCaptureSlot registers slot as roomID's capture, replacing an active
+// one, if it fits under WithMaxConcurrentCaptures, preempting a
+// lower-priority capture if needed. A room that does not fit, or is
+// preempted, waits for a free slot (fillCaptureSlots). Returns false if
+// the capture must not start.
+func (c *StreamClient) claimCaptureSlot(roomID int64, title string, slot *captureSlot) bool {
+	c.capturesMu.Lock()
+	slot.manual = slot.manual || c.waiting[roomID]
+	var victim int64
+	if prev, ok := c.captures[roomID]; ok {
+		prev.cancel()
+	} else {
+		var ok bool
+		if victim, ok = c.admitCaptureLocked(roomID); !ok {
+			c.waiting[roomID] = slot.manual
+			c.capturesMu.Unlock()
+			prio := c.monitor.capturePriority(roomID)
+			c.monitor.roomLogger(roomID).Warn("client: capture limit reached, not capturing",
+				"limit", c.cfg.maxCaptures, "priority", prio)
+			c.publishStreamEvent(StreamEvent{
+				RoomID:     roomID,
+				Type:       EventCaptureSkipped,
+				Title:      title,
+				Preemption: &CapturePreemption{Limit: c.cfg.maxCaptures, Priority: prio},
+			})
+			return false
+		}
+		if victim != 0 {
+			manual := c.captures[victim].manual
+			c.cancelCaptureLocked(victim)
+			c.waiting[victim] = manual
+		}
+	}
+	delete(c.waiting, roomID)
+	c.captures[roomID] = slot
+	delete(c.syncs, roomID)
+	var victimTitle string
+	if s := c.sessions[victim]; s != nil {
+		victimTitle = s.title
+	}
+	c.capturesMu.Unlock()
+
+	if victim != 0 {
+		prio, victimPrio := c.monitor.capturePriority(roomID), c.monitor.capturePriority(victim)
+		c.monitor.roomLogger(victim).Info("client: capture preempted by higher-priority room",
+			"by", roomID, "priority", victimPrio, "by_priority", prio)
+		c.publishStreamEvent(StreamEvent{
+			RoomID: victim,
+			Type:   EventCapturePreempted,
+			Title:  victimTitle,
+			Preemption: &CapturePreemption{
+				Limit:      c.cfg.maxCaptures,
+				Priority:   victimPrio,
+				By:         roomID,
+				ByPriority: prio,
+			},
+		})
+	}
+	return true
+}
+
+// releaseCaptureSlot frees roomID's slot once the capture holding it has
+// ended, unless it was already replaced or cancelled, and hands the slot
+// to a waiting room.
+func (c *StreamClient) releaseCaptureSlot(roomID int64, slot *captureSlot) {
+	c.capturesMu.Lock()
+	ours := c.captures[roomID] == slot
+	if ours {
+		delete(c.captures, roomID)
+		delete(c.syncs, roomID)
+	}
+	c.capturesMu.Unlock()
+	if ours {
+		c.snapshotChanged()
+		c.fillCaptureSlots()
+	}
+}
+
+// fillCaptureSlots starts the captures of live rooms waiting for a slot,
+// highest priority first, while slots are free. The slots are taken before
+// capturesMu is released, so concurrent fills cannot overcommit. Captures
+// started with StartCapture are resumed even if the room does not
+// auto-capture, and keep waiting while the room is not live or paused.
+func (c *StreamClient) fillCaptureSlots() {
+	if c.cfg.maxCaptures <= 0 {
+		return
+	}
+	type candidate struct {
+		roomID  int64
+		session *liveSession
+		ctx     context.Context
+		slot    *captureSlot
+	}
+	var start []candidate
+	c.capturesMu.Lock()
+	ctx := c.ctx
+	if ctx == nil || ctx.Err() != nil {
+		c.capturesMu.Unlock()
+		return
+	}
+	for free := c.cfg.maxCaptures - len(c.captures); free > 0 && len(c.waiting) > 0; free-- {
+		var best int64
+		bestPrio := 0
+		for id, manual := range c.waiting {
+			if !c.monitor.isLive(id) || c.monitor.IsPaused(id) {
+				if !manual {
+					delete(c.waiting, id)
+				}
+				continue
+			}
+			if !manual && !c.autoCaptureFor(id) {
+				delete(c.waiting, id)
+				continue
+			}
+			if p := c.monitor.capturePriority(id); best == 0 || p > bestPrio {
+				best, bestPrio = id, p
+			}
+		}
+		if best == 0 {
+			break
+		}
+		manual := c.waiting[best]
+		delete(c.waiting, best)
+		session, ok := c.sessions[best]
+		if !ok {
+			session = newLiveSession(c.cfg.clock.Now())
+			c.sessions[best] = session
+		}
+		captureCtx, cancel := context.WithCancel(c.monitor.roomContext(ctx, best))
+		slot := &captureSlot{cancel: cancel, manual: manual}
+		c.captures[best] = slot
+		delete(c.syncs, best)
+		start = append(start, candidate{best, session, captureCtx, slot})
+	}
+	c.capturesMu.Unlock()
+
+	for _, s := range start {
+		c.monitor.roomLogger(s.roomID).Info("client: capture slot free, starting capture")
+		go c.runCapture(s.ctx, s.roomID, s.session.title, s.session, s.slot)
+	}
+	if len(start) > 0 {
+		c.snapshotChanged()
+	}
+}
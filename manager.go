@@ -0,0 +1,279 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const defaultManagerShutdownTimeout = 10 * time.Second
+
+// ManagerConfig configures a Manager. Only Rooms is required.
+type ManagerConfig struct {
+	Rooms         []int64
+	ClientOptions []ClientOption // polling, cookies, capture, ...; see NewStreamClient
+
+	// LiveDanmaku relays every live room's chat as EventDanmaku
+	// (WithLiveDanmaku), configured by DanmakuOptions.
+	LiveDanmaku    bool
+	DanmakuOptions []DanmakuOption
+
+	// Record records every live room's stream to disk (WithAutoRecord),
+	// with a Recorder configured by RecordOptions.
+	Record        bool
+	RecordOptions []RecorderOption
+
+	// Sinks receive every event through a SinkManager. Webhooks is a
+	// shorthand for WebhookSink sinks named "webhook:<url>".
+	Sinks    []ManagerSink
+	Webhooks []string
+
+	// Addr is the listen address of the HTTP server, e.g. ":8080", serving
+	// Handler. Empty disables it; Handler can still be mounted elsewhere.
+	Addr string
+
+	// OnAudio consumes each captured audio stream (EventAudioReady), in its
+	// own goroutine. It must read ev.Audio.Reader until it ends and close
+	// it. Nil reads and discards the audio, which still feeds WithDVR,
+	// WithDiarizer and the session statistics.
+	OnAudio func(ctx context.Context, ev StreamEvent)
+
+	// OnVideo consumes each video stream (EventVideoReady, enabled by
+	// WithVideoConfig in ClientOptions) like OnAudio. Nil stops the video
+	// capture.
+	OnVideo func(ctx context.Context, ev StreamEvent)
+
+	// ShutdownTimeout bounds how long Run waits for sinks to drain and the
+	// HTTP server to finish requests after ctx is done. Default is 10
+	// seconds.
+	ShutdownTimeout time.Duration
+}
+
+// ManagerSink is an EventSink of a Manager (see SinkManager.Add).
+type ManagerSink struct {
+	Name    string
+	Sink    EventSink
+	Options []SinkOption
+}
+
+// Manager runs the whole stack — live detection, capture, recording, chat,
+// event delivery, metrics and the HTTP control server — from one
+// ManagerConfig, for
+// embedding in an existing service:
+//
+//	m := stream.NewManager(stream.ManagerConfig{
+//		Rooms:    []int64{21452505},
+//		Webhooks: []string{"https://example.com/hook"},
+//		Addr:     ":8080",
+//	})
+//	err := m.Run(ctx)
+//
+// The parts stay reachable through Client and Sinks for anything the
+// config does not cover.
+type Manager struct {
+	cfg     ManagerConfig
+	client  *StreamClient
+	sinks   *SinkManager
+	handler http.Handler
+}
+
+// NewManager creates a Manager from cfg. Nothing runs until Run.
+func NewManager(cfg ManagerConfig) *Manager {
+	if cfg.ShutdownTimeout <= 0 {
+		cfg.ShutdownTimeout = defaultManagerShutdownTimeout
+	}
+	opts := cfg.ClientOptions
+	if cfg.LiveDanmaku {
+		opts = append(opts[:len(opts):len(opts)], WithLiveDanmaku(cfg.DanmakuOptions...))
+	}
+	if cfg.Record {
+		opts = append(opts[:len(opts):len(opts)], WithAutoRecord(true, cfg.RecordOptions...))
+	}
+	m := &Manager{
+		cfg:    cfg,
+		client: NewStreamClient(opts...),
+		sinks:  NewSinkManager(),
+	}
+	for _, s := range cfg.Sinks {
+		m.sinks.Add(s.Name, s.Sink, s.Options...)
+	}
+	for _, url := range cfg.Webhooks {
+		m.sinks.Add("webhook:"+url, WebhookSink(url))
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", NewServer(m.client))
+	mux.HandleFunc("GET /snapshot", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, m.client.Snapshot())
+	})
+	mux.HandleFunc("GET /diagnostics", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, m.client.Diagnostics())
+	})
+	mux.HandleFunc("GET /sinks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, m.sinks.Stats())
+	})
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w, m.client.Snapshot(), m.sinks.Stats())
+	})
+	m.handler = mux
+	return m
+}
+
+// Client returns the Manager's StreamClient.
+func (m *Manager) Client() *StreamClient { return m.client }
+
+// Sinks returns the SinkManager delivering the Manager's events.
+func (m *Manager) Sinks() *SinkManager { return m.sinks }
+
+// Handler serves the control endpoints of NewServer plus read-only state:
+//
+//	GET /snapshot     the client's Snapshot
+//	GET /diagnostics  the client's Diagnostics
+//	GET /sinks        delivery counters of each sink (SinkManager.Stats)
+//	GET /metrics      room and sink counters in the Prometheus text format
+func (m *Manager) Handler() http.Handler { return m.handler }
+
+// Run starts monitoring and serving and blocks until ctx is done or the
+// HTTP server fails, then shuts down within ShutdownTimeout. It returns
+// nil after ctx is done. If Addr cannot be listened on, Run fails before
+// anything starts. Run may be called once.
+func (m *Manager) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var ln net.Listener
+	if m.cfg.Addr != "" {
+		var err error
+		if ln, err = net.Listen("tcp", m.cfg.Addr); err != nil {
+			return fmt.Errorf("manager: %w", err)
+		}
+	}
+
+	events, err := m.client.Subscribe(ctx, m.cfg.Rooms)
+	if err != nil {
+		if ln != nil {
+			ln.Close()
+		}
+		return fmt.Errorf("manager: %w", err)
+	}
+
+	var srv *http.Server
+	srvErr := make(chan error, 1)
+	if ln != nil {
+		srv = &http.Server{Handler: m.handler}
+		go func() {
+			if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+				srvErr <- err
+			}
+		}()
+	}
+
+	var runErr error
+	for events != nil {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			m.sinks.Publish(ev)
+			if ev.Type == EventAudioReady && ev.Audio != nil {
+				go m.consumeAudio(ctx, ev)
+			}
+			if ev.Type == EventVideoReady && ev.Video != nil {
+				go m.consumeVideo(ctx, ev)
+			}
+		case err := <-srvErr:
+			runErr = fmt.Errorf("manager: server: %w", err)
+			cancel()
+		}
+	}
+
+	shutdownCtx, stop := context.WithTimeout(context.Background(), m.cfg.ShutdownTimeout)
+	defer stop()
+	if srv != nil {
+		srv.Shutdown(shutdownCtx)
+	}
+	m.sinks.Close(shutdownCtx)
+	return runErr
+}
+
+// consumeAudio hands a capture to OnAudio, or discards it.
+func (m *Manager) consumeAudio(ctx context.Context, ev StreamEvent) {
+	if m.cfg.OnAudio != nil {
+		m.cfg.OnAudio(ctx, ev)
+		return
+	}
+	defer ev.Audio.Reader.Close()
+	io.Copy(io.Discard, ev.Audio.Reader)
+}
+
+// consumeVideo hands a video capture to OnVideo, or stops it.
+func (m *Manager) consumeVideo(ctx context.Context, ev StreamEvent) {
+	if m.cfg.OnVideo != nil {
+		m.cfg.OnVideo(ctx, ev)
+		return
+	}
+	ev.Video.Cancel()
+	ev.Video.Reader.Close()
+}
+
+// writeMetrics renders snap and sinks in the Prometheus text format.
+func writeMetrics(w io.Writer, snap *ClientSnapshot, sinks map[string]SinkStats) {
+	gauge := func(name, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	}
+	counter := func(name, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	}
+	rooms := func(name string, value func(RoomSnapshot) int64) {
+		for _, r := range snap.Rooms {
+			fmt.Fprintf(w, "%s{room_id=\"%d\"} %d\n", name, r.RoomID, value(r))
+		}
+	}
+	bit := func(b bool) int64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+
+	gauge("bilibili_stream_rooms", "Watched rooms.")
+	fmt.Fprintf(w, "bilibili_stream_rooms %d\n", len(snap.Rooms))
+	gauge("bilibili_stream_room_live", "Whether the room is live.")
+	rooms("bilibili_stream_room_live", func(r RoomSnapshot) int64 { return bit(r.State == StateLive) })
+	gauge("bilibili_stream_room_capturing", "Whether the room's audio is being captured.")
+	rooms("bilibili_stream_room_capturing", func(r RoomSnapshot) int64 { return bit(r.Capturing) })
+	gauge("bilibili_stream_room_audio_bytes", "Audio bytes captured in the room's live session.")
+	rooms("bilibili_stream_room_audio_bytes", func(r RoomSnapshot) int64 { return r.AudioBytes })
+	gauge("bilibili_stream_room_capture_restarts", "Capture restarts in the room's live session.")
+	rooms("bilibili_stream_room_capture_restarts", func(r RoomSnapshot) int64 { return int64(r.CaptureRestarts) })
+
+	names := make([]string, 0, len(sinks))
+	for name := range sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	perSink := func(name string, value func(SinkStats) uint64) {
+		for _, n := range names {
+			fmt.Fprintf(w, "%s{sink=%s} %d\n", name, strconv.Quote(n), value(sinks[n]))
+		}
+	}
+	counter("bilibili_stream_sink_delivered_total", "Events the sink accepted.")
+	perSink("bilibili_stream_sink_delivered_total", func(s SinkStats) uint64 { return s.Delivered })
+	counter("bilibili_stream_sink_failed_total", "Events given up after all attempts.")
+	perSink("bilibili_stream_sink_failed_total", func(s SinkStats) uint64 { return s.Failed })
+	counter("bilibili_stream_sink_dropped_total", "Events dropped by a full queue or an open breaker.")
+	perSink("bilibili_stream_sink_dropped_total", func(s SinkStats) uint64 { return s.Dropped })
+	gauge("bilibili_stream_sink_queued", "Events waiting for the sink.")
+	perSink("bilibili_stream_sink_queued", func(s SinkStats) uint64 { return uint64(s.Queued) })
+	gauge("bilibili_stream_sink_breaker_open", "Whether the sink's circuit breaker is open.")
+	perSink("bilibili_stream_sink_breaker_open", func(s SinkStats) uint64 { return uint64(bit(s.BreakerOpen)) })
+}
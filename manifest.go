@@ -0,0 +1,192 @@
+package stream
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ManifestSegment is one finished segment file in a SessionManifest.
+type ManifestSegment struct {
+	Name     string        `json:"name"` // file name, relative to the manifest's directory
+	Index    int           `json:"index"`
+	Size     int64         `json:"size"`
+	SHA256   string        `json:"sha256"` // hex
+	Start    time.Time     `json:"start"`  // wall-clock time the segment's first data was written
+	End      time.Time     `json:"end"`    // wall-clock time the segment was finished
+	Duration time.Duration `json:"duration,omitempty"`
+	PTS      *PTSRange     `json:"pts,omitempty"`   // stream timeline covered, if known
+	Title    string        `json:"title,omitempty"` // stream title when the segment started
+}
+
+// ManifestTitle is a title change during a recording session.
+type ManifestTitle struct {
+	At    time.Time `json:"at"`
+	Title string    `json:"title"`
+}
+
+// SessionManifest records the segments of a recording session with their
+// sizes and SHA-256 hashes in a JSON file next to them, so the set can be
+// checked after an upload or a crash with VerifyManifest. The file is
+// rewritten atomically as each segment is added, so it always lists
+// exactly the segments that were finished.
+type SessionManifest struct {
+	path string
+
+	mu       sync.Mutex
+	Session  string            `json:"session,omitempty"` // e.g. StreamEvent.SessionID
+	RoomID   int64             `json:"room_id,omitempty"`
+	Created  time.Time         `json:"created"`
+	Segments []ManifestSegment `json:"segments"`
+	Titles   []ManifestTitle   `json:"titles,omitempty"`
+}
+
+// NewSessionManifest creates the manifest file at path, which should be in
+// the directory the segments are written to. An existing manifest at path
+// is loaded and appended to, so a restarted session continues its list.
+func NewSessionManifest(path, session string, roomID int64) (*SessionManifest, error) {
+	m, err := ReadManifest(path)
+	switch {
+	case err == nil:
+		return m, nil
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+	m = &SessionManifest{path: path, Session: session, RoomID: roomID, Created: time.Now()}
+	if err := m.save(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ReadManifest loads the manifest at path.
+func ReadManifest(path string) (*SessionManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("manifest: %w", err)
+	}
+	m := &SessionManifest{path: path}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("manifest: parse %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// AddFile hashes the finished segment file at path and appends it to the
+// manifest. start and end are the wall-clock times it covers.
+func (m *SessionManifest) AddFile(path string, index int, start, end time.Time, duration time.Duration) error {
+	return m.addSegment(path, ManifestSegment{Index: index, Start: start, End: end, Duration: duration})
+}
+
+// addSegment hashes the file at path into seg and appends it.
+func (m *SessionManifest) addSegment(path string, seg ManifestSegment) error {
+	size, sum, err := HashFile(path)
+	if err != nil {
+		return err
+	}
+	seg.Name, seg.Size, seg.SHA256 = filepath.Base(path), size, sum
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Segments = append(m.Segments, seg)
+	return m.saveLocked()
+}
+
+// AddTitle records that the stream title changed to title at at, e.g. on
+// EventRoomInfoChanged, for the chapters of ConcatSession.
+func (m *SessionManifest) AddTitle(at time.Time, title string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Titles = append(m.Titles, ManifestTitle{At: at, Title: title})
+	return m.saveLocked()
+}
+
+// segmentCount returns the number of segments listed.
+func (m *SessionManifest) segmentCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.Segments)
+}
+
+// Path returns the manifest file's path.
+func (m *SessionManifest) Path() string {
+	return m.path
+}
+
+func (m *SessionManifest) save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.saveLocked()
+}
+
+func (m *SessionManifest) saveLocked() error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("manifest: encode: %w", err)
+	}
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("manifest: write: %w", err)
+	}
+	if err := os.Rename(tmp, m.path); err != nil {
+		return fmt.Errorf("manifest: write: %w", err)
+	}
+	return nil
+}
+
+// HashFile returns the size and hex SHA-256 of the file at path.
+func HashFile(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", fmt.Errorf("hash file: %w", err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", fmt.Errorf("hash file: %w", err)
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ManifestProblem is a segment whose file does not match its manifest
+// entry.
+type ManifestProblem struct {
+	Segment ManifestSegment
+	Problem string // "missing", "truncated", "size mismatch" or "hash mismatch"
+}
+
+// VerifyManifest checks every segment listed in the manifest at path
+// against the file next to it and returns the ones that are missing,
+// shorter than recorded (truncated), or differ in size or content. An
+// empty result means the set is intact.
+func VerifyManifest(path string) ([]ManifestProblem, error) {
+	m, err := ReadManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(path)
+	var problems []ManifestProblem
+	for _, seg := range m.Segments {
+		size, sum, err := HashFile(filepath.Join(dir, seg.Name))
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			problems = append(problems, ManifestProblem{seg, "missing"})
+		case err != nil:
+			return nil, err
+		case size < seg.Size:
+			problems = append(problems, ManifestProblem{seg, "truncated"})
+		case size != seg.Size:
+			problems = append(problems, ManifestProblem{seg, "size mismatch"})
+		case sum != seg.SHA256:
+			problems = append(problems, ManifestProblem{seg, "hash mismatch"})
+		}
+	}
+	return problems, nil
+}
@@ -2,6 +2,7 @@ package stream
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"sync"
 	"time"
@@ -10,6 +11,10 @@ import (
 const (
 	defaultMonitorInterval = 30 * time.Second
 	eventBufSize           = 64
+
+	// minPollInterval bounds how often a single room is polled under
+	// WithPollBudget.
+	minPollInterval = 5 * time.Second
 )
 
 // Monitor watches Bilibili live rooms for live/offline transitions
@@ -18,10 +23,34 @@ type Monitor struct {
 	cfg monitorConfig
 
 	mu        sync.Mutex
+	cookie    string                       // SESSDATA; replaced by WithCredentialRefresh
 	rooms     map[int64]context.CancelFunc // roomID -> cancel
-	status    map[int64]bool               // roomID -> last known live status
+	states    map[int64]roomStateEntry     // roomID -> last known state
+	stateSeqs map[int64]uint64             // roomID -> last transition Seq of a removed room
+	roomCfgs  map[int64]roomConfig         // roomID -> options given to AddRoom
+	uids      map[int64]int64              // roomID -> streamer UID, learned from room info
+	areas     map[int64]AreaHints          // roomID -> live area hints, learned from room info
+	tags      map[int64][]string           // roomID -> room tags, learned from room info
+	lastPoll  map[int64]time.Time          // roomID -> last successful room info poll
+	titles    map[int64]string             // roomID -> last known title
+	infos     map[int64]RoomInfoFields     // roomID -> fields as of the last poll (WithRoomInfoChanges)
+	liveTimes map[int64]time.Time          // roomID -> broadcast start reported by Bilibili, while live
+	batched   map[int64]time.Time          // roomID -> last status from a batch poll (WithBatchPolling)
+	pushUp    map[int64]bool               // roomID -> push connection established (PushMode)
+	pending   map[int64]*pendingEvent      // roomID -> event held by WithSourceCoalescing
+	expedited map[int64]time.Time          // roomID -> end of faster polling (StreamClient.Standby)
+	pollWake  map[int64]chan struct{}      // roomID -> wakes the room's poll goroutine
 	parentCtx context.Context
 	started   bool
+	paused    bool           // global pause
+	pausedIDs map[int64]bool // rooms paused individually
+
+	creds *credentialPool // WithCookies; nil with a single cookie
+	sched *pollScheduler  // WithPollWorkers; nil polls from a goroutine per room
+
+	refreshMu      sync.Mutex      // serializes credential refreshes
+	replacedCookie string          // last cookie replaced by a refresh; guarded by mu
+	expiredCookies map[string]bool // cookies reported by authExpired; guarded by mu
 
 	subsMu sync.RWMutex
 	subs   []chan RoomEvent
@@ -32,15 +61,41 @@ type Monitor struct {
 func NewMonitor(opts ...MonitorOption) *Monitor {
 	cfg := monitorConfig{
 		interval: defaultMonitorInterval,
+		clock:    SystemClock(),
 	}
 	for _, o := range opts {
 		o(&cfg)
 	}
-	return &Monitor{
-		cfg:    cfg,
-		rooms:  make(map[int64]context.CancelFunc),
-		status: make(map[int64]bool),
+	m := &Monitor{
+		cfg:       cfg,
+		cookie:    cfg.cookie,
+		rooms:     make(map[int64]context.CancelFunc),
+		states:    make(map[int64]roomStateEntry),
+		stateSeqs: make(map[int64]uint64),
+		roomCfgs:  make(map[int64]roomConfig),
+		uids:      make(map[int64]int64),
+		areas:     make(map[int64]AreaHints),
+		tags:      make(map[int64][]string),
+		lastPoll:  make(map[int64]time.Time),
+		titles:    make(map[int64]string),
+		infos:     make(map[int64]RoomInfoFields),
+		liveTimes: make(map[int64]time.Time),
+		batched:   make(map[int64]time.Time),
+		pushUp:    make(map[int64]bool),
+		pending:   make(map[int64]*pendingEvent),
+		expedited: make(map[int64]time.Time),
+		pollWake:  make(map[int64]chan struct{}),
+		pausedIDs: make(map[int64]bool),
+
+		expiredCookies: make(map[string]bool),
 	}
+	if len(cfg.cookies) > 0 {
+		m.creds = newCredentialPool(cfg.cookies, cfg.clock)
+	}
+	if cfg.pollWorkers > 0 {
+		m.sched = newPollScheduler(m, cfg.pollWorkers)
+	}
+	return m
 }
 
 // Watch begins monitoring the given rooms and returns a channel that
@@ -58,8 +113,17 @@ func (m *Monitor) Watch(ctx context.Context, roomIDs []int64) (<-chan RoomEvent,
 	m.started = true
 	m.mu.Unlock()
 
+	if m.sched != nil {
+		m.sched.start(ctx)
+	}
+	if m.cfg.credManager != nil {
+		go m.validateCredentials(ctx)
+	}
+	if m.cfg.batchPolling {
+		go m.pollBatch(ctx)
+	}
 	for _, id := range roomIDs {
-		m.startRoom(ctx, id)
+		m.startRoom(ctx, id, ReasonWatch)
 	}
 
 	// Close subscriber channels when context is done.
@@ -78,8 +142,15 @@ func (m *Monitor) Watch(ctx context.Context, roomIDs []int64) (<-chan RoomEvent,
 }
 
 // AddRoom adds a room to the monitor. Safe to call after Watch().
-func (m *Monitor) AddRoom(roomID int64) {
+// Options are applied on top of any given earlier for the same room, even
+// if the room is already watched.
+func (m *Monitor) AddRoom(roomID int64, opts ...RoomOption) {
 	m.mu.Lock()
+	rc := m.roomCfgs[roomID]
+	for _, o := range opts {
+		o(&rc)
+	}
+	m.roomCfgs[roomID] = rc
 	if _, exists := m.rooms[roomID]; exists {
 		m.mu.Unlock()
 		return
@@ -89,94 +160,646 @@ func (m *Monitor) AddRoom(roomID int64) {
 	m.mu.Unlock()
 
 	if started && ctx != nil {
-		m.startRoom(ctx, roomID)
+		m.startRoom(ctx, roomID, ReasonAdded)
 	}
 }
 
 // RemoveRoom stops monitoring a room.
 func (m *Monitor) RemoveRoom(roomID int64) {
+	if m.removeRoom(roomID) {
+		m.lifecycle(roomID, EventMonitorStopped, ReasonRemoved, nil)
+	}
+}
+
+// removeRoom stops polling a room and forgets its state. It reports whether
+// the room was being watched.
+func (m *Monitor) removeRoom(roomID int64) bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	if cancel, ok := m.rooms[roomID]; ok {
+	cancel, ok := m.rooms[roomID]
+	if ok {
 		cancel()
 		delete(m.rooms, roomID)
-		delete(m.status, roomID)
+		if seq := m.states[roomID].seq; seq > 0 {
+			m.stateSeqs[roomID] = seq
+		}
+		delete(m.states, roomID)
+		delete(m.roomCfgs, roomID)
+		delete(m.uids, roomID)
+		delete(m.areas, roomID)
+		delete(m.tags, roomID)
+		delete(m.lastPoll, roomID)
+		delete(m.titles, roomID)
+		delete(m.infos, roomID)
+		delete(m.liveTimes, roomID)
+		delete(m.batched, roomID)
+		delete(m.pausedIDs, roomID)
+		delete(m.expedited, roomID)
+	}
+	if m.creds != nil {
+		m.creds.release(roomID)
+	}
+	return ok
+}
+
+// Diagnostics returns a snapshot of the monitor's credential allocation.
+func (m *Monitor) Diagnostics() Diagnostics {
+	var d Diagnostics
+	if m.creds != nil {
+		d.Credentials = m.creds.stats()
+	}
+	return d
+}
+
+// Pause suspends polling for all rooms. Rooms and their last known status
+// are kept, so Resume continues where monitoring left off and only reports
+// transitions that happened in between.
+func (m *Monitor) Pause() {
+	m.mu.Lock()
+	affected := m.unpausedRoomsLocked()
+	m.paused = true
+	m.mu.Unlock()
+	slog.Info("monitor: paused")
+	for _, id := range affected {
+		m.lifecycle(id, EventMonitorPaused, ReasonAll, nil)
+	}
+}
+
+// Resume re-enables polling after Pause. Rooms paused with PauseRoom stay
+// paused until ResumeRoom.
+func (m *Monitor) Resume() {
+	m.mu.Lock()
+	m.paused = false
+	affected := m.unpausedRoomsLocked()
+	m.mu.Unlock()
+	slog.Info("monitor: resumed")
+	for _, id := range affected {
+		m.lifecycle(id, EventMonitorResumed, ReasonAll, nil)
+	}
+}
+
+// unpausedRoomsLocked returns the watched rooms that are being polled, or
+// would be if not for a global Pause.
+func (m *Monitor) unpausedRoomsLocked() []int64 {
+	if m.paused {
+		return nil
+	}
+	var ids []int64
+	for id := range m.rooms {
+		if !m.pausedIDs[id] {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// PauseRoom suspends polling for a single room.
+func (m *Monitor) PauseRoom(roomID int64) {
+	m.mu.Lock()
+	changed := !m.pausedIDs[roomID]
+	m.pausedIDs[roomID] = true
+	m.mu.Unlock()
+	m.roomLogger(roomID).Info("monitor: room paused")
+	if changed {
+		m.lifecycle(roomID, EventMonitorPaused, ReasonRoom, nil)
+	}
+}
+
+// ResumeRoom re-enables polling for a room paused with PauseRoom.
+func (m *Monitor) ResumeRoom(roomID int64) {
+	m.mu.Lock()
+	changed := m.pausedIDs[roomID]
+	delete(m.pausedIDs, roomID)
+	m.mu.Unlock()
+	m.roomLogger(roomID).Info("monitor: room resumed")
+	if changed {
+		m.lifecycle(roomID, EventMonitorResumed, ReasonRoom, nil)
+	}
+}
+
+// IsPaused reports whether polling for roomID is currently suspended,
+// either globally or for the room.
+func (m *Monitor) IsPaused(roomID int64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.paused || m.pausedIDs[roomID]
+}
+
+// liveRooms returns the rooms whose last known status is live.
+func (m *Monitor) liveRooms() []int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ids []int64
+	for id, e := range m.states {
+		if e.state == StateLive {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// isLive reports whether the last known status of roomID is live.
+func (m *Monitor) isLive(roomID int64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.states[roomID].state == StateLive
+}
+
+// watching reports whether the room is being monitored.
+func (m *Monitor) watching(roomID int64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.rooms[roomID]
+	return ok
+}
+
+// watchedRooms returns the IDs of the rooms being monitored.
+func (m *Monitor) watchedRooms() []int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := make([]int64, 0, len(m.rooms))
+	for id := range m.rooms {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// roomTags returns the room's tags as of the last poll; ok is false if it
+// has not been polled successfully yet.
+func (m *Monitor) roomTags(roomID int64) (tags []string, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tags, ok = m.tags[roomID]
+	return tags, ok
+}
+
+// State returns the last known state of a room.
+func (m *Monitor) State(roomID int64) RoomState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.states[roomID].state
+}
+
+// RoomName returns the alias registered with WithName, or "" if none.
+func (m *Monitor) RoomName(roomID int64) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.roomCfgs[roomID].name
+}
+
+// roomHints returns the room's area hints and its language hint: the one
+// set with WithLanguageHint, else the one derived from the area.
+func (m *Monitor) roomHints(roomID int64) (AreaHints, string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	area := m.areas[roomID]
+	if hint := m.roomCfgs[roomID].languageHint; hint != "" {
+		return area, hint
+	}
+	return area, area.Language
+}
+
+// roomContext returns ctx carrying the configured cookie and the room's
+// WithRoomRequestOptions, if any. roomID 0 stands for no room; see
+// requestContext.
+func (m *Monitor) roomContext(ctx context.Context, roomID int64) context.Context {
+	m.mu.Lock()
+	rc := m.roomCfgs[roomID]
+	base := RequestOptions{
+		Cookie:   m.cookie,
+		Resolver: m.cfg.resolver,
+		TraceID:  m.states[roomID].session,
+	}
+	if m.cfg.refresh != nil {
+		base.RefreshCredentials = m.refreshCookie
+	}
+	m.mu.Unlock()
+	base.onExpired = func(cookie string, err error) {
+		m.authExpired(roomID, cookie, err)
+	}
+	switch {
+	case m.creds != nil && rc.reqOpts.Cookie == "" && roomID == 0:
+		base.Cookie = m.creds.borrow()
+		base.onResult = m.creds.record
+	case m.creds != nil && rc.reqOpts.Cookie == "":
+		base.Cookie = m.creds.cookie(roomID)
+		base.onResult = m.creds.record
+	case m.cfg.credManager != nil && rc.reqOpts.Cookie == "":
+		creds := m.cfg.credManager.Credentials().RequestOptions()
+		base.Cookie, base.Headers = creds.Cookie, creds.Headers
+		base.RefreshCredentials = nil
+		if m.cfg.credManager.cfg.refresher != nil {
+			base.RefreshCredentials = m.cfg.credManager.refreshCookie
+		}
+	case m.creds == nil && rc.reqOpts.Cookie == "" && m.cfg.extraCookies != "":
+		base.Headers = map[string]string{"Cookie": m.cfg.extraCookies}
+	}
+
+	if m.cfg.apiClient != nil {
+		ctx = m.cfg.apiClient.Context(ctx)
+	}
+	return WithRequestOptions(ctx, base.merge(rc.reqOpts))
+}
+
+// requestContext returns ctx carrying the configured cookie for requests
+// on behalf of no single room, such as batch polls. With several
+// credentials (WithCookies) it borrows the best usable one without
+// assigning it a room.
+func (m *Monitor) requestContext(ctx context.Context) context.Context {
+	return m.roomContext(ctx, 0)
+}
+
+// refreshCookie is the RefreshCredentials callback for monitored rooms.
+// The monitor's cookie is replaced once per expiry: callers that hit the
+// replaced cookie after another caller refreshed it get the new one without
+// calling the user's refresher again.
+func (m *Monitor) refreshCookie(ctx context.Context, expired string) (string, error) {
+	m.refreshMu.Lock()
+	defer m.refreshMu.Unlock()
+
+	if m.creds != nil {
+		fresh, ok, err := m.creds.replace(expired, func() (string, error) {
+			return m.cfg.refresh(ctx, expired)
+		})
+		if ok {
+			return fresh, err
+		}
 	}
+
+	m.mu.Lock()
+	current, replaced := m.cookie, m.replacedCookie
+	m.mu.Unlock()
+	if expired == replaced {
+		return current, nil
+	}
+
+	fresh, err := m.cfg.refresh(ctx, expired)
+	if err != nil {
+		return "", err
+	}
+	// Per-room cookies (WithRoomRequestOptions) are refreshed for the
+	// request but do not replace the monitor's cookie.
+	if expired == current {
+		m.mu.Lock()
+		m.cookie, m.replacedCookie = fresh, expired
+		m.mu.Unlock()
+		slog.Info("monitor: credentials refreshed")
+	}
+	return fresh, nil
+}
+
+// roomLogger returns a logger annotated with the room ID and alias.
+// The logger also carries session_id while the room is live.
+func (m *Monitor) roomLogger(roomID int64) *slog.Logger {
+	log := roomLogger(roomID, m.RoomName(roomID))
+	if session := m.SessionID(roomID); session != "" {
+		log = log.With("session_id", session)
+	}
+	return log
+}
+
+// SessionID returns the correlation ID of a room's current live session,
+// or "" if the room is not live. A new ID is issued on every live
+// transition and reported as RoomEvent.SessionID, so logs, events and
+// derived artifacts of one broadcast can be joined on it.
+func (m *Monitor) SessionID(roomID int64) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.states[roomID].session
 }
 
-// startRoom launches a polling goroutine for a single room.
-func (m *Monitor) startRoom(ctx context.Context, roomID int64) {
+// newSessionID returns the live session ID for a room going live at t.
+func newSessionID(roomID int64, t time.Time) string {
+	return fmt.Sprintf("%d-%d", roomID, t.Unix())
+}
+
+// roomLogger returns the default logger annotated with room_id, and
+// room_name when an alias is set.
+func roomLogger(roomID int64, name string) *slog.Logger {
+	if name == "" {
+		return slog.With("room_id", roomID)
+	}
+	return slog.With("room_id", roomID, "room_name", name)
+}
+
+// startRoom launches a polling goroutine for a single room, or queues the
+// room with the scheduler under WithPollWorkers. reason is reported with
+// EventMonitorStarted.
+func (m *Monitor) startRoom(ctx context.Context, roomID int64, reason string) {
 	roomCtx, cancel := context.WithCancel(ctx)
 
 	m.mu.Lock()
 	m.rooms[roomID] = cancel
 	m.mu.Unlock()
+	m.lifecycle(roomID, EventMonitorStarted, reason, nil)
+	if m.cfg.mode == PushMode {
+		go m.watchPush(roomCtx, roomID)
+	}
 
-	go m.pollRoom(roomCtx, roomID)
+	if m.sched == nil {
+		go m.pollRoom(roomCtx, roomID)
+		return
+	}
+	m.roomLogger(roomID).Info("monitor: watching room")
+	context.AfterFunc(roomCtx, func() {
+		m.roomLogger(roomID).Info("monitor: stopped watching room")
+		m.watchEnded(roomID)
+	})
+	m.sched.add(roomCtx, roomID)
 }
 
 // pollRoom periodically checks a room's live status and emits events on transitions.
 func (m *Monitor) pollRoom(ctx context.Context, roomID int64) {
-	slog.Info("monitor: watching room", "room_id", roomID)
+	defer m.recoverRoom(roomID)
+	m.roomLogger(roomID).Info("monitor: watching room")
+
+	// expedite wakes the loop to poll at once.
+	wake := make(chan struct{}, 1)
+	m.mu.Lock()
+	m.pollWake[roomID] = wake
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		if m.pollWake[roomID] == wake {
+			delete(m.pollWake, roomID)
+		}
+		m.mu.Unlock()
+	}()
 
 	// Do an initial check immediately.
 	m.checkRoom(ctx, roomID)
 
-	ticker := time.NewTicker(m.cfg.interval)
-	defer ticker.Stop()
+	// A fresh timer per poll lets the interval follow the poll budget.
+	pollC := m.cfg.clock.After(m.pollInterval(roomID))
+
+	// Optional low-frequency backup detection via the dynamic feed.
+	var feedC <-chan time.Time
+	if m.cfg.feedInterval > 0 {
+		feedTicker := m.cfg.clock.NewTicker(m.cfg.feedInterval)
+		defer feedTicker.Stop()
+		feedC = feedTicker.C()
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
-			slog.Info("monitor: stopped watching room", "room_id", roomID)
+			m.roomLogger(roomID).Info("monitor: stopped watching room")
+			m.watchEnded(roomID)
 			return
-		case <-ticker.C:
+		case <-feedC:
+			m.checkFeed(ctx, roomID)
+			continue
+		case <-pollC:
+		case <-wake:
+		}
+		if !m.pushActive(roomID) && !m.batchCovers(roomID) {
 			m.checkRoom(ctx, roomID)
 		}
+		pollC = m.cfg.clock.After(m.pollInterval(roomID))
+	}
+}
+
+// pollInterval returns the delay until a room's next poll. Without a poll
+// budget it is the configured interval; with one, the budget is split
+// evenly across rooms that are being polled. An expedited room is polled
+// every standbyPollInterval, or under a budget standbyBudgetShare times
+// as often as the others, counting that many times against it.
+func (m *Monitor) pollInterval(roomID int64) time.Duration {
+	now := m.cfg.clock.Now()
+	m.mu.Lock()
+	fast := now.Before(m.expedited[roomID])
+	if m.cfg.pollBudget <= 0 {
+		m.mu.Unlock()
+		if fast {
+			return min(m.cfg.interval, standbyPollInterval)
+		}
+		return m.cfg.interval
+	}
+
+	n := 0
+	if !m.paused {
+		for id := range m.rooms {
+			switch {
+			case m.pausedIDs[id]:
+			case now.Before(m.expedited[id]):
+				n += standbyBudgetShare
+			default:
+				n++
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	d := time.Duration(n) * time.Minute / time.Duration(m.cfg.pollBudget)
+	if fast {
+		d /= standbyBudgetShare
+	}
+	if d < minPollInterval {
+		d = minPollInterval
+	}
+	return d
+}
+
+// expedite polls a room faster (see pollInterval) until until, starting
+// with a poll now. Push connections and batch polls still replace its
+// polls.
+func (m *Monitor) expedite(roomID int64, until time.Time) {
+	m.mu.Lock()
+	m.expedited[roomID] = until
+	wake := m.pollWake[roomID]
+	m.mu.Unlock()
+	if m.sched != nil {
+		m.sched.expedite(roomID)
+		return
+	}
+	if wake != nil {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
 	}
 }
 
+// unexpedite returns a room to its normal poll interval.
+func (m *Monitor) unexpedite(roomID int64) {
+	m.mu.Lock()
+	delete(m.expedited, roomID)
+	m.mu.Unlock()
+}
+
 // checkRoom queries room info and emits an event if the live status changed.
+// Paused rooms are skipped.
 func (m *Monitor) checkRoom(ctx context.Context, roomID int64) {
+	if m.IsPaused(roomID) {
+		return
+	}
+	ctx = m.roomContext(ctx, roomID)
+
 	info, err := GetRoomInfo(ctx, roomID)
 	if err != nil {
 		if ctx.Err() != nil {
 			return
 		}
-		slog.Warn("monitor: failed to get room info", "room_id", roomID, "error", err)
+		m.roomLogger(roomID).Warn("monitor: failed to get room info", "error", err)
 		return
 	}
+	m.applyRoomInfo(roomID, info)
+}
+
+// applyRoomInfo records a polled room's info and emits an event if the
+// live status changed.
+func (m *Monitor) applyRoomInfo(roomID int64, info *RoomInfo) {
+	m.mu.Lock()
+	m.uids[roomID] = info.UID
+	m.areas[roomID] = NewAreaHints(info.AreaName, info.ParentAreaName)
+	m.tags[roomID] = info.Tags
+	m.lastPoll[roomID] = m.cfg.clock.Now()
+	m.titles[roomID] = info.Title
+	if t, ok := liveStartTime(info); ok {
+		m.liveTimes[roomID] = t
+	} else {
+		delete(m.liveTimes, roomID)
+	}
+	m.mu.Unlock()
 
-	live := info.LiveStatus == 1
+	m.updateState(roomID, info.UID, roomStateFromLiveStatus(info.LiveStatus), info.Title, SourcePoll)
+	m.observeRoomInfo(roomID, info)
+}
+
+// checkFeed consults the streamer's dynamic feed as a backup signal. It is
+// only used while room info polling is failing (e.g. rate limited), since
+// the feed lags behind the live API.
+func (m *Monitor) checkFeed(ctx context.Context, roomID int64) {
+	if m.IsPaused(roomID) {
+		return
+	}
 
 	m.mu.Lock()
-	prevLive, known := m.status[roomID]
-	m.status[roomID] = live
+	uid := m.uids[roomID]
+	lastPoll := m.lastPoll[roomID]
 	m.mu.Unlock()
+	if uid == 0 || m.cfg.clock.Now().Sub(lastPoll) < 2*m.cfg.interval {
+		return
+	}
 
-	// Only emit on transitions, not on initial check (unless room is already live).
-	if known && live == prevLive {
+	ctx = m.roomContext(ctx, roomID)
+	st, err := getFeedLiveStatus(ctx, uid)
+	if err != nil {
+		if ctx.Err() == nil {
+			m.roomLogger(roomID).Warn("monitor: failed to check dynamic feed", "error", err)
+		}
 		return
 	}
+	if st == nil || st.RoomID != roomID {
+		return
+	}
+	state := StateLive
+	if !st.Live {
+		// The feed cannot tell offline from rotation; only use it to end a
+		// live session.
+		if m.State(roomID) != StateLive {
+			return
+		}
+		state = StateOffline
+	}
+	m.updateState(roomID, uid, state, st.Title, SourceFeed)
+}
 
-	if !known && !live {
-		// First check shows offline — don't emit an event.
+// updateState records a room's state as reported by source, invokes the
+// state callback on transitions, and emits a RoomEvent when the room enters
+// or leaves StateLive.
+func (m *Monitor) updateState(roomID, uid int64, state RoomState, title, source string) {
+	if uid == 0 {
+		uid, _ = LookupUID(roomID)
+	}
+	now := m.cfg.clock.Now()
+	live := state == StateLive
+	m.mu.Lock()
+	prev, ok := m.states[roomID]
+	if !ok {
+		prev.seq = m.stateSeqs[roomID] // continue the Seq of a re-added room
+	}
+	if m.coalescing(prev, now) {
+		if live == (prev.state == StateLive) {
+			m.confirmLocked(roomID, source)
+		} else if source != prev.changedBy {
+			// Another source still reports the state before the change,
+			// e.g. a cached room info response after a push LIVE.
+			m.mu.Unlock()
+			m.roomLogger(roomID).Debug("monitor: ignoring stale report within coalescing window",
+				"state", state, "source", source, "changed_by", prev.changedBy)
+			return
+		}
+	}
+	if state == prev.state {
+		m.mu.Unlock()
+		return
+	}
+	tr := StateTransition{
+		RoomID:    roomID,
+		From:      prev.state,
+		To:        state,
+		Seq:       prev.seq + 1,
+		At:        now,
+		Source:    source,
+		SessionID: prev.session,
+	}
+	if state == StateLive && prev.state != StateLive {
+		tr.SessionID = newSessionID(roomID, tr.At)
+	}
+	entry := roomStateEntry{state: state, seq: tr.Seq, changedAt: prev.changedAt, changedBy: prev.changedBy}
+	if state == StateLive {
+		entry.session = tr.SessionID
+	}
+	// Only live/not-live changes produce events; Unknown → Offline and
+	// Offline ↔ Rotating are not reported.
+	changed := live != (prev.state == StateLive)
+	var held, flush *pendingEvent
+	if changed {
+		entry.changedAt, entry.changedBy = now, source
+		held, flush = m.holdLocked(roomID, source)
+	}
+	m.states[roomID] = entry
+	delete(m.stateSeqs, roomID)
+	var latency *GoLiveLatency
+	if state == StateLive && prev.state != StateUnknown {
+		// A room already live when first checked was not just detected.
+		latency = newGoLiveLatency(m.liveTimes[roomID], tr.At)
+	}
+	m.mu.Unlock()
+	if flush != nil {
+		m.publishEvent(flush.ev)
+	}
+
+	if m.cfg.onTransition != nil {
+		m.cfg.onTransition(tr)
+	}
+	if !changed {
 		return
 	}
 
 	ev := RoomEvent{
 		RoomID: roomID,
+		UID:    uid,
+		Name:   m.RoomName(roomID),
 		Live:   live,
-		Title:  info.Title,
+		Title:  title,
+		Source: source,
+
+		SessionID: tr.SessionID,
+		Muted:     m.IsMuted(roomID),
+		Latency:   latency,
 	}
+	ev.Area, ev.LanguageHint = m.roomHints(roomID)
 
+	log := roomLogger(roomID, ev.Name).With("session_id", ev.SessionID)
 	if live {
-		slog.Info("monitor: room went live", "room_id", roomID, "title", info.Title)
+		log.Info("monitor: room went live", "title", title, "source", source)
 	} else {
-		slog.Info("monitor: room went offline", "room_id", roomID)
+		log.Info("monitor: room went offline", "source", source)
 	}
 
-	m.publishEvent(ev)
+	m.emitEvent(held, ev)
 }
 
 // publishEvent fans out an event to all subscriber channels.
@@ -191,8 +814,7 @@ func (m *Monitor) publishEvent(ev RoomEvent) {
 		select {
 		case ch <- ev:
 		default:
-			slog.Warn("monitor: subscriber channel full, dropping event",
-				"room_id", ev.RoomID)
+			roomLogger(ev.RoomID, ev.Name).Warn("monitor: subscriber channel full, dropping event")
 		}
 	}
 }
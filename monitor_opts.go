@@ -4,8 +4,26 @@ import "time"
 
 // monitorConfig holds internal configuration for Monitor.
 type monitorConfig struct {
-	interval time.Duration
-	cookie   string
+	interval      time.Duration
+	cookie        string
+	cookies       []string
+	extraCookies  string        // cookies besides SESSDATA (WithCredentials)
+	feedInterval  time.Duration // 0 disables feed detection
+	onTransition  func(StateTransition)
+	clock         Clock
+	pollBudget    int // room info requests per minute across all rooms; 0 disables
+	refresh       CredentialRefresher
+	resolver      Resolver
+	pollWorkers   int // 0 polls each room from its own goroutine
+	onLifecycle   func(RoomLifecycle)
+	mode          MonitorMode
+	coalesce      time.Duration // 0 disables source coalescing
+	apiClient     *APIClient    // nil uses the default client
+	onInfoChange  func(RoomInfoChange)
+	infoFields    []string // fields compared for onInfoChange; nil for all
+	credManager   *CredentialManager
+	onAuthExpired func(AuthExpiry)
+	batchPolling  bool
 }
 
 // MonitorOption configures a Monitor.
@@ -26,3 +44,172 @@ func WithCookie(sessdata string) MonitorOption {
 		c.cookie = sessdata
 	}
 }
+
+// WithCredentials authenticates API requests with the full cookie set of
+// a login: SESSDATA, which WithCredentialRefresh may replace, plus
+// bili_jct, the buvid IDs, DedeUserID and any extra cookies. Replaces
+// WithCookie; with WithCookies, or for rooms with their own cookie
+// (WithRoomRequestOptions), only SESSDATA differs per request and the
+// other cookies are not sent.
+func WithCredentials(creds Credentials) MonitorOption {
+	return func(c *monitorConfig) {
+		c.cookie = creds.SESSDATA
+		c.extraCookies = creds.otherCookies()
+	}
+}
+
+// WithCookies spreads room polling over several SESSDATA cookies (one per
+// account) instead of a single one. Each room is assigned the credential
+// with the fewest rooms; credentials that hit risk control are parked for
+// 10 minutes and their rooms move to the others. Request counts, error
+// rates and the room allocation are reported by Monitor.Diagnostics.
+// Rooms with their own cookie (WithRoomRequestOptions) keep it. Takes
+// precedence over WithCookie.
+func WithCookies(sessdata ...string) MonitorOption {
+	return func(c *monitorConfig) {
+		c.cookies = sessdata
+	}
+}
+
+// WithCredentialRefresh registers fn to obtain a new SESSDATA when the
+// configured cookie stops being honored. Requests that hit a login-required
+// response are retried once with the new cookie, which then replaces the
+// configured one for all rooms. Concurrent expiries trigger a single
+// refresh. Without it such requests fail with ErrCredentialsExpired.
+func WithCredentialRefresh(fn CredentialRefresher) MonitorOption {
+	return func(c *monitorConfig) {
+		c.refresh = fn
+	}
+}
+
+// WithResolver resolves host names for all API requests and captures of
+// the monitor's rooms with r (see RequestOptions.Resolver), e.g. a
+// DoHResolver or StaticResolver.
+func WithResolver(r Resolver) MonitorOption {
+	return func(c *monitorConfig) {
+		c.resolver = r
+	}
+}
+
+// WithFeedDetection enables the streamer's dynamic feed ("开播了" posts) as a
+// low-frequency backup detection source, checked every d. It only takes
+// effect while room info polling fails, e.g. when the live API is rate
+// limiting the process. Disabled by default.
+func WithFeedDetection(d time.Duration) MonitorOption {
+	return func(c *monitorConfig) {
+		c.feedInterval = d
+	}
+}
+
+// WithStateCallback registers fn to be called on every room state
+// transition (see RoomState), including those that do not produce a
+// RoomEvent such as Offline → Rotating. fn runs on the polling goroutine
+// and must not block.
+func WithStateCallback(fn func(StateTransition)) MonitorOption {
+	return func(c *monitorConfig) {
+		c.onTransition = fn
+	}
+}
+
+// WithPollBudget caps total room info polling at perMinute requests per
+// minute, shared by the rooms that currently need polling (paused rooms
+// are excluded). Each room's interval is recomputed before every poll, so
+// total API traffic stays constant as rooms are added, removed, paused or
+// resumed. The budget replaces WithMonitorInterval, but a room is never
+// polled more often than every minPollInterval.
+func WithPollBudget(perMinute int) MonitorOption {
+	return func(c *monitorConfig) {
+		c.pollBudget = perMinute
+	}
+}
+
+// WithPollWorkers polls rooms from n shared workers instead of a goroutine
+// and timer per room, for monitors watching hundreds or thousands of rooms.
+// Rooms wait in a queue ordered by their next check, so at most n requests
+// are in flight and the burst of first checks after Watch is spread out.
+// Intervals, poll budgets and feed detection behave as without it. Default
+// is 0: one goroutine per room, which suits small room counts.
+func WithPollWorkers(n int) MonitorOption {
+	return func(c *monitorConfig) {
+		c.pollWorkers = n
+	}
+}
+
+// WithMonitorMode selects how live transitions are detected. Default is
+// PollMode.
+func WithMonitorMode(mode MonitorMode) MonitorOption {
+	return func(c *monitorConfig) {
+		c.mode = mode
+	}
+}
+
+// WithSourceCoalescing coalesces the reports of detection sources that see
+// the same live/offline transition, for monitors using more than one (push,
+// polling, feed). Each RoomEvent is held for window and then emitted once,
+// with RoomEvent.Sources listing every source that confirmed it. Within the
+// window, reports from other sources that contradict the transition are
+// taken to be stale and ignored, so a lagging source cannot end a session
+// that just started and cause a second live event. Events are delayed by
+// window; default is 0, which emits them immediately.
+func WithSourceCoalescing(window time.Duration) MonitorOption {
+	return func(c *monitorConfig) {
+		c.coalesce = window
+	}
+}
+
+// WithAPIClient makes the monitor's API requests, and those of captures
+// and chat connections started for its rooms, with c instead of the
+// default client. Cookies set with WithCookie, WithCookies or
+// WithRoomRequestOptions take priority over c's.
+func WithAPIClient(c *APIClient) MonitorOption {
+	return func(cfg *monitorConfig) {
+		cfg.apiClient = c
+	}
+}
+
+// WithMonitorClock sets the time source for polling intervals and event
+// timestamps. Default is SystemClock().
+func WithMonitorClock(c Clock) MonitorOption {
+	return func(cfg *monitorConfig) {
+		cfg.clock = c
+	}
+}
+
+// roomConfig holds per-room settings given to AddRoom.
+type roomConfig struct {
+	name         string
+	reqOpts      RequestOptions
+	languageHint string
+	mutes        []MuteWindow
+	relays       []string
+	priority     int
+}
+
+// RoomOption configures a single room added via AddRoom.
+type RoomOption func(*roomConfig)
+
+// WithName sets a human-friendly alias for the room. The alias is attached
+// to log lines and to RoomEvent/StreamEvent as Name.
+func WithName(name string) RoomOption {
+	return func(c *roomConfig) {
+		c.name = name
+	}
+}
+
+// WithRoomRequestOptions routes all API requests and captures for the room
+// through opts (cookie, user agent, proxy, trace ID), so one client can
+// serve rooms under different identities.
+func WithRoomRequestOptions(opts RequestOptions) RoomOption {
+	return func(c *roomConfig) {
+		c.reqOpts = opts
+	}
+}
+
+// WithLanguageHint sets the room's spoken language as a BCP 47 tag (e.g.
+// "ja", "en"). It is attached to the room's events as LanguageHint and
+// takes precedence over the hint derived from the live area.
+func WithLanguageHint(tag string) RoomOption {
+	return func(c *roomConfig) {
+		c.languageHint = tag
+	}
+}
@@ -0,0 +1,54 @@
+package stream
+
+import "time"
+
+// MuteWindow is a daily quiet period of a room, e.g. 01:00–08:00 for an
+// overnight endurance stream. Events of the room raised inside a window
+// are marked Muted, so notification paths can skip them while recording
+// and other processing carry on.
+type MuteWindow struct {
+	Start time.Duration // offset from local midnight, e.g. 23 * time.Hour
+	End   time.Duration // offset from local midnight; before Start wraps past midnight
+	// Location is the time zone of the offsets; nil means time.Local.
+	Location *time.Location
+}
+
+// Contains reports whether t falls inside the window. The window includes
+// Start and excludes End.
+func (w MuteWindow) Contains(t time.Time) bool {
+	loc := w.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	// Wall-clock offset, so windows keep their hours across DST changes.
+	h, m, s := t.In(loc).Clock()
+	off := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second
+	if w.Start <= w.End {
+		return off >= w.Start && off < w.End
+	}
+	return off >= w.Start || off < w.End
+}
+
+// WithMuteWindows sets the room's quiet hours, replacing any set before.
+// While one of the windows contains the current time, the room's
+// RoomEvents and StreamEvents carry Muted = true; captures are unaffected.
+// Sinks added WithSinkSkipMuted do not receive them.
+func WithMuteWindows(windows ...MuteWindow) RoomOption {
+	return func(c *roomConfig) {
+		c.mutes = append([]MuteWindow(nil), windows...)
+	}
+}
+
+// IsMuted reports whether the room is inside one of its WithMuteWindows
+// right now.
+func (m *Monitor) IsMuted(roomID int64) bool {
+	now := m.cfg.clock.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, w := range m.roomCfgs[roomID].mutes {
+		if w.Contains(now) {
+			return true
+		}
+	}
+	return false
+}
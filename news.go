@@ -0,0 +1,149 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const roomNewsURL = "https://api.live.bilibili.com/room_ex/v1/RoomNews/get?roomid=%d"
+
+// RoomNews is a room's announcement (主播公告), where streamers often post
+// schedule updates.
+type RoomNews struct {
+	Content string
+	Updated time.Time // when the announcement was last edited; zero if unknown
+}
+
+// GetRoomNews fetches the announcement of a live room.
+func GetRoomNews(ctx context.Context, roomID int64) (*RoomNews, error) {
+	apiResp, err := doGet(ctx, fmt.Sprintf(roomNewsURL, roomID), "")
+	if err != nil {
+		return nil, fmt.Errorf("get room news: %w", err)
+	}
+
+	var data struct {
+		Content string `json:"content"`
+		Ctime   string `json:"ctime"` // "2006-01-02 15:04:05", China time
+	}
+	if err := decodeData(apiResp, &data); err != nil {
+		return nil, fmt.Errorf("parse room news: %w", err)
+	}
+	news := &RoomNews{Content: data.Content}
+	news.Updated, _ = time.ParseInLocation(time.DateTime, data.Ctime, chinaTime)
+	return news, nil
+}
+
+// parseTags splits the comma-separated tags of the room info.
+func parseTags(s string) []string {
+	var tags []string
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// AnnouncementChange is attached to EventAnnouncementChanged.
+type AnnouncementChange struct {
+	Old     string    `json:"old"`
+	New     string    `json:"new"`
+	Updated time.Time `json:"updated,omitempty"`
+}
+
+// TagsChange is attached to EventTagsChanged.
+type TagsChange struct {
+	Old []string `json:"old"`
+	New []string `json:"new"`
+}
+
+// newsWatcher remembers the last announcement and tags seen per room, to
+// report changes (WithAnnouncementPolling).
+type newsWatcher struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	news map[int64]string
+	tags map[int64][]string
+}
+
+func newNewsWatcher(interval time.Duration) *newsWatcher {
+	return &newsWatcher{
+		interval: interval,
+		news:     make(map[int64]string),
+		tags:     make(map[int64][]string),
+	}
+}
+
+// watchNews checks the announcements and tags of all watched rooms every
+// interval until ctx is done. The first value seen for a room is its
+// baseline and produces no event.
+func (c *StreamClient) watchNews(ctx context.Context) {
+	ticker := c.cfg.clock.NewTicker(c.news.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+		for _, id := range c.monitor.watchedRooms() {
+			if ctx.Err() != nil {
+				return
+			}
+			if c.monitor.IsPaused(id) {
+				continue
+			}
+			c.checkTags(id)
+			c.checkNews(ctx, id)
+		}
+	}
+}
+
+func (c *StreamClient) checkNews(ctx context.Context, roomID int64) {
+	news, err := GetRoomNews(c.monitor.roomContext(ctx, roomID), roomID)
+	if err != nil {
+		if ctx.Err() == nil {
+			c.monitor.roomLogger(roomID).Warn("client: failed to get room news", "error", err)
+		}
+		return
+	}
+	w := c.news
+	w.mu.Lock()
+	old, seen := w.news[roomID]
+	w.news[roomID] = news.Content
+	w.mu.Unlock()
+	if !seen || old == news.Content {
+		return
+	}
+	c.publishStreamEvent(StreamEvent{
+		RoomID:       roomID,
+		Type:         EventAnnouncementChanged,
+		Announcement: &AnnouncementChange{Old: old, New: news.Content, Updated: news.Updated},
+	})
+}
+
+// checkTags compares the tags from the monitor's last room info poll.
+func (c *StreamClient) checkTags(roomID int64) {
+	tags, ok := c.monitor.roomTags(roomID)
+	if !ok {
+		return
+	}
+	w := c.news
+	w.mu.Lock()
+	old, seen := w.tags[roomID]
+	w.tags[roomID] = tags
+	w.mu.Unlock()
+	if !seen || slices.Equal(old, tags) {
+		return
+	}
+	c.publishStreamEvent(StreamEvent{
+		RoomID: roomID,
+		Type:   EventTagsChanged,
+		Tags:   &TagsChange{Old: old, New: tags},
+	})
+}
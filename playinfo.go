@@ -0,0 +1,128 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+)
+
+const roomPlayInfoURL = "https://api.live.bilibili.com/xlive/web-room/v2/index/getRoomPlayInfo?room_id=%d&protocol=0,1&format=0,1,2&codec=0,1&qn=%d&platform=web&ptype=8"
+
+// Stream protocols, formats and codecs of the play info API.
+const (
+	ProtocolHTTPStream = "http_stream" // progressive download; FLV
+	ProtocolHLS        = "http_hls"    // HLS playlist; TS or fMP4 segments
+
+	PlayFormatFLV  = "flv"
+	PlayFormatTS   = "ts"
+	PlayFormatFMP4 = "fmp4"
+
+	CodecAVC  = "avc"  // H.264
+	CodecHEVC = "hevc" // H.265
+)
+
+// PlayStream is one protocol/format/codec variant of a live stream.
+type PlayStream struct {
+	Protocol string   // ProtocolHTTPStream or ProtocolHLS
+	Format   string   // PlayFormatFLV, PlayFormatTS or PlayFormatFMP4
+	Codec    string   // CodecAVC or CodecHEVC
+	Quality  int      // quality served (qn)
+	Accepted []int    // qualities offered for this variant
+	URLs     []string // one per CDN host, in Bilibili's order of preference
+}
+
+// PlayInfo is the result of GetRoomPlayInfo.
+type PlayInfo struct {
+	RoomID     int64
+	LiveStatus int // 0=offline, 1=live, 2=rotation
+	Streams    []PlayStream
+}
+
+// Select returns the first variant matching protocol, format and codec;
+// an empty argument matches any value.
+func (p *PlayInfo) Select(protocol, format, codec string) (*PlayStream, bool) {
+	for i := range p.Streams {
+		s := &p.Streams[i]
+		if (protocol == "" || s.Protocol == protocol) &&
+			(format == "" || s.Format == format) &&
+			(codec == "" || s.Codec == codec) {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// GetRoomPlayInfo fetches the stream variants of a live room at quality qn
+// from the newer play info API (getRoomPlayInfo), which also offers HLS
+// with TS or fMP4 segments and HEVC, where the playUrl API used by
+// GetPlayURLs only serves FLV. Use Select to choose a variant; its URLs
+// work with CaptureAudio and CaptureVideo, while StreamPTS and Recorder
+// need FLV. Without credentials Bilibili may serve a lower quality;
+// compare PlayStream.Quality with qn.
+//
+// Member-only (大航海专属) streams return a *GuardRequiredError, as with
+// GetStreamURLs.
+func GetRoomPlayInfo(ctx context.Context, roomID int64, qn int) (*PlayInfo, error) {
+	apiResp, err := doGet(ctx, fmt.Sprintf(roomPlayInfoURL, roomID, qn), "")
+	if err != nil {
+		if guardErr := guardRestriction(roomID, err); guardErr != nil {
+			return nil, guardErr
+		}
+		return nil, fmt.Errorf("get play info: %w", err)
+	}
+
+	var data struct {
+		RoomID      int64 `json:"room_id"`
+		LiveStatus  int   `json:"live_status"`
+		PlayURLInfo *struct {
+			PlayURL struct {
+				Stream []struct {
+					ProtocolName string `json:"protocol_name"`
+					Format       []struct {
+						FormatName string `json:"format_name"`
+						Codec      []struct {
+							CodecName string `json:"codec_name"`
+							CurrentQn int    `json:"current_qn"`
+							AcceptQn  []int  `json:"accept_qn"`
+							BaseURL   string `json:"base_url"`
+							URLInfo   []struct {
+								Host  string `json:"host"`
+								Extra string `json:"extra"`
+							} `json:"url_info"`
+						} `json:"codec"`
+					} `json:"format"`
+				} `json:"stream"`
+			} `json:"playurl"`
+		} `json:"playurl_info"`
+	}
+	if err := decodeData(apiResp, &data); err != nil {
+		return nil, fmt.Errorf("parse play info: %w", err)
+	}
+
+	if data.PlayURLInfo == nil {
+		return nil, fmt.Errorf("no play info returned (room may be offline)")
+	}
+	info := &PlayInfo{RoomID: data.RoomID, LiveStatus: data.LiveStatus}
+	for _, s := range data.PlayURLInfo.PlayURL.Stream {
+		for _, f := range s.Format {
+			for _, c := range f.Codec {
+				ps := PlayStream{
+					Protocol: s.ProtocolName,
+					Format:   f.FormatName,
+					Codec:    c.CodecName,
+					Quality:  c.CurrentQn,
+					Accepted: c.AcceptQn,
+				}
+				for _, u := range c.URLInfo {
+					ps.URLs = append(ps.URLs, u.Host+c.BaseURL+u.Extra)
+				}
+				if len(ps.URLs) > 0 {
+					info.Streams = append(info.Streams, ps)
+				}
+			}
+		}
+	}
+	if len(info.Streams) == 0 {
+		return nil, fmt.Errorf("no stream urls returned (room may be offline)")
+	}
+	return info, nil
+}
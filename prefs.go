@@ -0,0 +1,250 @@
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// RoomPrefs are per-room overrides of a StreamClient's settings that can
+// be changed at runtime (StreamClient.SetRoomPrefs, or PUT
+// /rooms/{id}/prefs on NewServer) and survive restarts in a PrefStore.
+// Zero fields keep the client's setting.
+type RoomPrefs struct {
+	Quality   int               `json:"quality,omitempty"` // stream quality (qn), e.g. QualityHD; see WithQuality
+	Capture   *bool             `json:"capture,omitempty"` // auto-capture on or off; see WithAutoCapture
+	Labels    map[string]string `json:"labels,omitempty"`  // free-form, reported in Snapshot
+	Schedules []PrefSchedule    `json:"schedules,omitempty"`
+}
+
+// PrefSchedule runs a built-in action for the room on a cron schedule
+// (see StreamClient.Schedule).
+type PrefSchedule struct {
+	Spec   string `json:"spec"`   // see ParseSchedule
+	Action string `json:"action"` // "check_status", "rotate_capture", "refresh_credentials" or "warm_standby" (30 minutes)
+}
+
+// prefActions maps PrefSchedule.Action names to actions.
+var prefActions = map[string]Action{
+	"check_status":        ActionCheckStatus,
+	"rotate_capture":      ActionRotateCapture,
+	"refresh_credentials": ActionRefreshCredentials,
+	"warm_standby":        WarmStandby(defaultStandbyWindow),
+}
+
+// errInvalidPrefs wraps validation failures of RoomPrefs.
+var errInvalidPrefs = errors.New("invalid prefs")
+
+// validate checks the schedules.
+func (p RoomPrefs) validate() error {
+	for _, s := range p.Schedules {
+		if _, ok := prefActions[s.Action]; !ok {
+			return fmt.Errorf("%w: unknown action %q", errInvalidPrefs, s.Action)
+		}
+		if _, err := ParseSchedule(s.Spec); err != nil {
+			return fmt.Errorf("%w: %w", errInvalidPrefs, err)
+		}
+	}
+	return nil
+}
+
+// PrefStore keeps RoomPrefs in a JSON file. Every change is written to
+// disk atomically before it returns.
+type PrefStore struct {
+	path string
+
+	mu    sync.Mutex
+	rooms map[int64]RoomPrefs
+}
+
+// OpenPrefStore loads the preferences stored at path, starting empty if the
+// file does not exist yet.
+func OpenPrefStore(path string) (*PrefStore, error) {
+	s := &PrefStore{path: path, rooms: make(map[int64]RoomPrefs)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("prefs: %w", err)
+	}
+	var file struct {
+		Rooms map[string]RoomPrefs `json:"rooms"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("prefs: parse %s: %w", path, err)
+	}
+	for key, p := range file.Rooms {
+		id, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("prefs: parse %s: invalid room id %q", path, key)
+		}
+		s.rooms[id] = p
+	}
+	return s, nil
+}
+
+// Get returns the preferences of roomID, if any are stored.
+func (s *PrefStore) Get(roomID int64) (RoomPrefs, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.rooms[roomID]
+	return p, ok
+}
+
+// All returns the stored preferences of every room.
+func (s *PrefStore) All() map[int64]RoomPrefs {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all := make(map[int64]RoomPrefs, len(s.rooms))
+	for id, p := range s.rooms {
+		all[id] = p
+	}
+	return all
+}
+
+// Set stores the preferences of roomID, replacing earlier ones.
+func (s *PrefStore) Set(roomID int64, p RoomPrefs) error {
+	p.Labels = maps.Clone(p.Labels)
+	p.Schedules = slices.Clone(p.Schedules)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, had := s.rooms[roomID]
+	s.rooms[roomID] = p
+	if err := s.saveLocked(); err != nil {
+		if had {
+			s.rooms[roomID] = prev
+		} else {
+			delete(s.rooms, roomID)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes the preferences of roomID.
+func (s *PrefStore) Delete(roomID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, had := s.rooms[roomID]
+	if !had {
+		return nil
+	}
+	delete(s.rooms, roomID)
+	if err := s.saveLocked(); err != nil {
+		s.rooms[roomID] = prev
+		return err
+	}
+	return nil
+}
+
+func (s *PrefStore) saveLocked() error {
+	file := struct {
+		Rooms map[string]RoomPrefs `json:"rooms"`
+	}{Rooms: make(map[string]RoomPrefs, len(s.rooms))}
+	for id, p := range s.rooms {
+		file.Rooms[strconv.FormatInt(id, 10)] = p
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("prefs: encode: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := writeFileSync(tmp, data); err != nil {
+		return fmt.Errorf("prefs: write: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("prefs: write: %w", err)
+	}
+	return nil
+}
+
+// ErrNoPrefStore is returned by StreamClient.SetRoomPrefs without
+// WithPrefStore.
+var ErrNoPrefStore = errors.New("no preference store configured")
+
+// RoomPrefs returns the room's current overrides.
+func (c *StreamClient) RoomPrefs(roomID int64) RoomPrefs {
+	if c.cfg.prefs == nil {
+		return RoomPrefs{}
+	}
+	p, _ := c.cfg.prefs.Get(roomID)
+	return p
+}
+
+// SetRoomPrefs replaces the room's overrides, persists them in the
+// client's PrefStore and applies them: quality and capture take effect at
+// the next capture start, schedules immediately. A zero RoomPrefs removes
+// all overrides.
+func (c *StreamClient) SetRoomPrefs(roomID int64, p RoomPrefs) error {
+	if c.cfg.prefs == nil {
+		return ErrNoPrefStore
+	}
+	if err := p.validate(); err != nil {
+		return err
+	}
+	var err error
+	if p.Quality == 0 && p.Capture == nil && len(p.Labels) == 0 && len(p.Schedules) == 0 {
+		err = c.cfg.prefs.Delete(roomID)
+	} else {
+		err = c.cfg.prefs.Set(roomID, p)
+	}
+	if err != nil {
+		return err
+	}
+	c.applyPrefSchedules(roomID, p)
+	c.snapshotChanged()
+	return nil
+}
+
+// applyPrefSchedules replaces the room's scheduled jobs with those of p.
+func (c *StreamClient) applyPrefSchedules(roomID int64, p RoomPrefs) {
+	c.prefJobsMu.Lock()
+	defer c.prefJobsMu.Unlock()
+	for _, j := range c.prefJobs[roomID] {
+		j.Stop()
+	}
+	delete(c.prefJobs, roomID)
+	for _, s := range p.Schedules {
+		action, ok := prefActions[s.Action]
+		if !ok {
+			c.monitor.roomLogger(roomID).Warn("client: skipping unknown scheduled action", "action", s.Action)
+			continue
+		}
+		j, err := c.Schedule(s.Spec, action, roomID)
+		if err != nil {
+			c.monitor.roomLogger(roomID).Warn("client: skipping invalid scheduled action",
+				"spec", s.Spec, "action", s.Action, "error", err)
+			continue
+		}
+		c.prefJobs[roomID] = append(c.prefJobs[roomID], j)
+	}
+}
+
+// loadPrefs schedules the stored rooms' actions at construction.
+func (c *StreamClient) loadPrefs() {
+	for id, p := range c.cfg.prefs.All() {
+		c.applyPrefSchedules(id, p)
+	}
+}
+
+// roomQuality returns the quality to request for roomID.
+func (c *StreamClient) roomQuality(roomID int64) int {
+	if q := c.RoomPrefs(roomID).Quality; q > 0 {
+		return q
+	}
+	return c.cfg.quality
+}
+
+// autoCaptureFor reports whether roomID is captured automatically.
+func (c *StreamClient) autoCaptureFor(roomID int64) bool {
+	if on := c.RoomPrefs(roomID).Capture; on != nil {
+		return *on
+	}
+	return c.cfg.autoCapture
+}
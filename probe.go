@@ -0,0 +1,73 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ErrStreamDead is returned (wrapped) by ProbeStreamURL, and by
+// CaptureAudio with CaptureConfig.ProbeTimeout, when a stream URL does not
+// deliver an FLV stream in time.
+var ErrStreamDead = errors.New("stream url is dead")
+
+// flvSignature starts every FLV stream.
+const flvSignature = "FLV"
+
+// ProbeStreamURL checks within timeout that streamURL starts delivering an
+// FLV stream, by requesting it and reading its first bytes. It takes a
+// fraction of the time ffmpeg needs to give up on a dead URL, which waits
+// for its whole analyzeduration. RequestOptions attached to ctx are used as
+// for the capture.
+//
+// A 403 or 404 response is reported as ErrStreamForbidden or
+// ErrStreamNotFound; other failures, including the timeout, wrap
+// ErrStreamDead.
+func ProbeStreamURL(ctx context.Context, streamURL string, timeout time.Duration) error {
+	opts, _ := RequestOptionsFromContext(ctx)
+	client, err := httpClientFor(opts)
+	if err != nil {
+		return fmt.Errorf("probe stream: invalid proxy: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, streamURL, nil)
+	if err != nil {
+		return fmt.Errorf("probe stream: %w", err)
+	}
+	headers, err := requestHeaders(opts, opts.Cookie)
+	if err != nil {
+		return fmt.Errorf("probe stream: %w", err)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("probe stream: %w: %w", ErrStreamDead, err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusForbidden:
+		return fmt.Errorf("probe stream: %w", ErrStreamForbidden)
+	case http.StatusNotFound:
+		return fmt.Errorf("probe stream: %w", ErrStreamNotFound)
+	default:
+		return fmt.Errorf("probe stream: %w: http status %d", ErrStreamDead, resp.StatusCode)
+	}
+
+	sig := make([]byte, len(flvSignature))
+	if _, err := io.ReadFull(resp.Body, sig); err != nil {
+		return fmt.Errorf("probe stream: %w: no data within %s: %w", ErrStreamDead, timeout, err)
+	}
+	if string(sig) != flvSignature {
+		return fmt.Errorf("probe stream: %w: not an FLV stream", ErrStreamDead)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package stream
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// PTSRange is a span of the broadcast's own timeline, taken from the
+// stream's timestamps rather than the local clock, so recordings of the
+// same broadcast made on different machines can be aligned on it.
+type PTSRange struct {
+	Start time.Duration `json:"start"`
+	End   time.Duration `json:"end"`
+}
+
+// flvAudioTag is the FLV tag type of audio data.
+const flvAudioTag = 8
+
+// flvPTS watches an FLV download on its way to ffmpeg and records the
+// timestamp of the first audio tag, which is the stream time of the first
+// sample ffmpeg outputs. It stops parsing once that tag is found.
+type flvPTS struct {
+	io.ReadCloser
+
+	hdr  []byte // pending header bytes: the file header, then each tag header
+	skip int64  // bytes of tag data (and previous tag size) left to skip
+	file bool   // the file header has been consumed
+
+	found atomic.Bool
+	pts   atomic.Int64 // milliseconds; valid once found
+}
+
+func newFLVPTS(r io.ReadCloser) *flvPTS {
+	return &flvPTS{ReadCloser: r}
+}
+
+func (f *flvPTS) Read(p []byte) (int, error) {
+	n, err := f.ReadCloser.Read(p)
+	if n > 0 && !f.found.Load() {
+		f.scan(p[:n])
+	}
+	return n, err
+}
+
+// scan advances the parser over b.
+func (f *flvPTS) scan(b []byte) {
+	for len(b) > 0 && !f.found.Load() {
+		if f.skip > 0 {
+			k := min(f.skip, int64(len(b)))
+			f.skip -= k
+			b = b[k:]
+			continue
+		}
+		need := 11 // tag header
+		if !f.file {
+			need = 9 + 4 // file header and the first previous tag size
+		}
+		k := min(need-len(f.hdr), len(b))
+		f.hdr = append(f.hdr, b[:k]...)
+		b = b[k:]
+		if len(f.hdr) < need {
+			return
+		}
+		h := f.hdr
+		f.hdr = f.hdr[:0]
+		if !f.file {
+			f.file = true
+			if string(h[:3]) != "FLV" {
+				f.found.Store(true) // not FLV; give up without a timestamp
+				f.pts.Store(-1)
+			}
+			continue
+		}
+		size := int64(h[1])<<16 | int64(h[2])<<8 | int64(h[3])
+		ts := int64(h[7])<<24 | int64(h[4])<<16 | int64(h[5])<<8 | int64(h[6])
+		if h[0]&0x1f == flvAudioTag {
+			f.pts.Store(ts)
+			f.found.Store(true)
+			return
+		}
+		f.skip = size + 4
+	}
+}
+
+// streamPTS returns the timestamp of the first audio tag, once seen.
+func (f *flvPTS) streamPTS() (time.Duration, bool) {
+	if f == nil || !f.found.Load() {
+		return 0, false
+	}
+	ms := f.pts.Load()
+	if ms < 0 {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+// StreamPTS returns the stream timestamp of the first byte of a capture
+// reader from CaptureAudio with CaptureConfig.StreamPTS. ok is false for
+// other readers, and until the capture has produced audio.
+func StreamPTS(r io.Reader) (pts time.Duration, ok bool) {
+	switch r := r.(type) {
+	case *ffmpegReader:
+		return r.pts.streamPTS()
+	case *bufferedReadCloser:
+		if c, ok := r.Closer.(io.Reader); ok {
+			return StreamPTS(c)
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,133 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// MonitorMode selects how a Monitor detects live transitions.
+type MonitorMode int
+
+const (
+	// PollMode polls room info every interval (WithMonitorInterval).
+	PollMode MonitorMode = iota
+
+	// PushMode keeps each room's danmaku connection open and reacts to its
+	// LIVE and PREPARING commands within a second, so short broadcasts are
+	// not missed and no polling requests are made while it is up. Room
+	// info is still fetched once when a room is added and whenever the
+	// connection is re-established; while it is down, rooms are polled as
+	// in PollMode.
+	PushMode
+)
+
+// Room status commands on the danmaku connection.
+const (
+	chatCmdLive       = "LIVE"
+	chatCmdPreparing  = "PREPARING"
+	chatCmdRoomChange = "ROOM_CHANGE"
+)
+
+// pushActive reports whether roomID's push connection is up, so polls can
+// be skipped.
+func (m *Monitor) pushActive(roomID int64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.pushUp[roomID]
+}
+
+// watchPush follows the room's danmaku connection until ctx is done
+// (PushMode).
+func (m *Monitor) watchPush(ctx context.Context, roomID int64) {
+	var reconnected bool
+	client := NewDanmakuClient(func(c *danmakuConfig) {
+		c.clock = m.cfg.clock
+		c.onConn = func(up bool) {
+			m.mu.Lock()
+			was := m.pushUp[roomID]
+			m.pushUp[roomID] = up
+			m.mu.Unlock()
+			if up && !was && reconnected {
+				// Catch up on transitions missed while disconnected.
+				go m.checkRoom(ctx, roomID)
+			}
+			if !up && was && ctx.Err() == nil {
+				m.roomLogger(roomID).Warn("monitor: push connection lost, polling until it is back")
+			}
+			reconnected = true
+		}
+	})
+	defer func() {
+		m.mu.Lock()
+		delete(m.pushUp, roomID)
+		m.mu.Unlock()
+	}()
+
+	for {
+		events, err := client.Connect(m.roomContext(ctx, roomID), roomID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			m.roomLogger(roomID).Warn("monitor: push connection failed, polling", "error", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-m.cfg.clock.After(m.cfg.interval):
+			}
+			continue
+		}
+		for ev := range events {
+			m.handlePush(roomID, ev)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// handlePush applies a room status command.
+func (m *Monitor) handlePush(roomID int64, ev ChatEvent) {
+	if m.IsPaused(roomID) {
+		return
+	}
+	switch ev.Cmd {
+	case chatCmdLive:
+		var msg struct {
+			LiveTime int64 `json:"live_time"` // unix seconds; missing on some LIVE messages
+		}
+		json.Unmarshal(ev.Raw, &msg)
+		m.mu.Lock()
+		if msg.LiveTime > 0 {
+			m.liveTimes[roomID] = time.Unix(msg.LiveTime, 0)
+		}
+		uid, title := m.uids[roomID], m.titles[roomID]
+		m.mu.Unlock()
+		m.updateState(roomID, uid, StateLive, title, SourcePush)
+	case chatCmdPreparing:
+		var msg struct {
+			Round int `json:"round"` // 1 when the room switches to 轮播
+		}
+		json.Unmarshal(ev.Raw, &msg)
+		state := StateOffline
+		if msg.Round == 1 {
+			state = StateRotating
+		}
+		m.mu.Lock()
+		uid, title := m.uids[roomID], m.titles[roomID]
+		m.mu.Unlock()
+		m.updateState(roomID, uid, state, title, SourcePush)
+	case chatCmdRoomChange:
+		var msg struct {
+			Data struct {
+				Title string `json:"title"`
+			} `json:"data"`
+		}
+		if json.Unmarshal(ev.Raw, &msg) == nil && msg.Data.Title != "" {
+			m.mu.Lock()
+			m.titles[roomID] = msg.Data.Title
+			m.mu.Unlock()
+		}
+	}
+}
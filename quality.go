@@ -0,0 +1,182 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Stream qualities (qn) offered by the play URL API, best first.
+const (
+	QualityOriginal = 10000 // 原画
+	QualityBluRay   = 400   // 蓝光
+	QualitySuperHD  = 250   // 超清
+	QualityHD       = 150   // 高清
+	QualitySmooth   = 80    // 流畅
+)
+
+// qualityLadder lists the qualities tried, in order, when a request is
+// refused for lack of credentials.
+var qualityLadder = []int{QualityOriginal, QualityBluRay, QualitySuperHD, QualityHD, QualitySmooth}
+
+// PlayURLs is the result of GetPlayURLs.
+type PlayURLs struct {
+	URLs      []string // candidate FLV URLs, in Bilibili's order of preference
+	Requested int      // quality asked for
+	Quality   int      // quality actually served
+	Accepted  []int    // qualities the room offers to the request's credentials
+}
+
+// Fallback reports whether the served quality differs from the requested
+// one.
+func (p *PlayURLs) Fallback() bool {
+	return p.Quality != p.Requested
+}
+
+// QualityFallback is attached to EventQualityFallback: the quality asked
+// for was not available (typically 原画 without a logged-in cookie), and
+// the best available one is captured instead.
+type QualityFallback struct {
+	Requested int   `json:"requested"`
+	Actual    int   `json:"actual"`
+	Accepted  []int `json:"accepted,omitempty"`
+}
+
+// GetPlayURLs fetches the FLV stream URLs of a live room at quality qn
+// (e.g. QualityOriginal). If qn is not available without credentials, it
+// falls back to the best quality that is: Bilibili either serves a lower
+// quality itself, or refuses the request as not logged in, in which case
+// the next lower quality is asked for. Compare Quality with Requested (or
+// use Fallback) to detect this.
+//
+// Member-only (大航海专属) streams return a *GuardRequiredError, as with
+// GetStreamURLs.
+func GetPlayURLs(ctx context.Context, roomID int64, qn int) (*PlayURLs, error) {
+	var lastErr error
+	for _, q := range qualitySteps(qn) {
+		play, err := getPlayURLs(ctx, roomID, q)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.Code == codeNotLoggedIn {
+			lastErr = err
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		play.Requested = qn
+		return play, nil
+	}
+	return nil, lastErr
+}
+
+// ErrQualityUnavailable is returned by GetStreamURLWithOptions with
+// StreamURLOptions.Strict when the requested quality is not granted.
+var ErrQualityUnavailable = errors.New("stream quality unavailable")
+
+// StreamURLOptions selects the stream of GetStreamURLWithOptions.
+type StreamURLOptions struct {
+	// Quality is the qn to request, e.g. QualityBluRay. Zero means
+	// QualityOriginal.
+	Quality int
+
+	// Strict fails with ErrQualityUnavailable instead of accepting a lower
+	// quality, e.g. to insist on 原画 when a cookie is expected to be
+	// configured.
+	Strict bool
+}
+
+// GetStreamURLWithOptions fetches the FLV stream URLs of a live room at the
+// quality selected by opts. The result reports the quality actually
+// granted (Quality; see Fallback) and the qualities the room offers to
+// the request's credentials (Accepted), since requests without a
+// logged-in cookie are downgraded. Without Strict it behaves like
+// GetPlayURLs.
+func GetStreamURLWithOptions(ctx context.Context, roomID int64, opts StreamURLOptions) (*PlayURLs, error) {
+	qn := opts.Quality
+	if qn <= 0 {
+		qn = QualityOriginal
+	}
+	if !opts.Strict {
+		return GetPlayURLs(ctx, roomID, qn)
+	}
+	play, err := getPlayURLs(ctx, roomID, qn)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.Code == codeNotLoggedIn {
+		return nil, fmt.Errorf("%w: %s requires login: %w", ErrQualityUnavailable, QualityName(qn), err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	play.Requested = qn
+	if play.Fallback() {
+		return nil, fmt.Errorf("%w: asked for %s, granted %s", ErrQualityUnavailable,
+			QualityName(qn), QualityName(play.Quality))
+	}
+	return play, nil
+}
+
+// qualitySteps returns qn followed by the lower ladder qualities.
+func qualitySteps(qn int) []int {
+	steps := []int{qn}
+	for _, q := range qualityLadder {
+		if q < qn {
+			steps = append(steps, q)
+		}
+	}
+	return steps
+}
+
+func getPlayURLs(ctx context.Context, roomID int64, qn int) (*PlayURLs, error) {
+	apiResp, err := doGet(ctx, fmt.Sprintf(playURL, roomID, qn), "")
+	if err != nil {
+		if guardErr := guardRestriction(roomID, err); guardErr != nil {
+			return nil, guardErr
+		}
+		return nil, fmt.Errorf("get stream url: %w", err)
+	}
+
+	var data struct {
+		CurrentQn          int `json:"current_qn"`
+		QualityDescription []struct {
+			Qn int `json:"qn"`
+		} `json:"quality_description"`
+		Durl []struct {
+			URL string `json:"url"`
+		} `json:"durl"`
+	}
+	if err := decodeData(apiResp, &data); err != nil {
+		return nil, fmt.Errorf("parse play url: %w", err)
+	}
+	if len(data.Durl) == 0 {
+		return nil, fmt.Errorf("no stream urls returned (room may be offline)")
+	}
+
+	play := &PlayURLs{Quality: data.CurrentQn}
+	if play.Quality == 0 {
+		play.Quality = qn
+	}
+	for _, d := range data.Durl {
+		play.URLs = append(play.URLs, d.URL)
+	}
+	for _, d := range data.QualityDescription {
+		play.Accepted = append(play.Accepted, d.Qn)
+	}
+	return play, nil
+}
+
+// QualityName returns the Chinese label of a quality, e.g. "原画".
+func QualityName(qn int) string {
+	switch qn {
+	case QualityOriginal:
+		return "原画"
+	case QualityBluRay:
+		return "蓝光"
+	case QualitySuperHD:
+		return "超清"
+	case QualityHD:
+		return "高清"
+	case QualitySmooth:
+		return "流畅"
+	}
+	return fmt.Sprintf("qn %d", qn)
+}
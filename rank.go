@@ -0,0 +1,158 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	hotRankURL  = "https://api.live.bilibili.com/xlive/general-interface/v1/rank/getHotRank?ruid=%d&room_id=%d&is_pre=0&page_size=50&source=2&area_id=%d"
+	areaListURL = "https://api.live.bilibili.com/xlive/web-interface/v1/second/getList?platform=web&parent_area_id=%d&area_id=%d&sort_type=online&page=%d"
+)
+
+// HotRank is a room's position on the popularity (人气) rank of its area.
+type HotRank struct {
+	Rank  int   // 1-based; 0 if the room is not ranked
+	Score int64 // ranking score
+}
+
+// GetHotRank fetches the popularity rank of a room within its sub-area.
+// uid is the streamer's UID and areaID the room's sub-area (see RoomInfo).
+func GetHotRank(ctx context.Context, roomID, uid int64, areaID int) (*HotRank, error) {
+	apiResp, err := doGet(ctx, fmt.Sprintf(hotRankURL, uid, roomID, areaID), "")
+	if err != nil {
+		return nil, fmt.Errorf("get hot rank: %w", err)
+	}
+
+	var data struct {
+		Own struct {
+			Rank  int   `json:"rank"`
+			Score int64 `json:"score"`
+		} `json:"own"`
+	}
+	if err := decodeData(apiResp, &data); err != nil {
+		return nil, fmt.Errorf("parse hot rank: %w", err)
+	}
+	return &HotRank{Rank: data.Own.Rank, Score: data.Own.Score}, nil
+}
+
+// AreaRoom is one entry of an area's room list.
+type AreaRoom struct {
+	RoomID int64
+	UID    int64
+	Name   string // streamer name
+	Title  string
+	Online int64
+}
+
+// GetAreaRooms returns one page (starting at 1) of the live rooms in an
+// area, ordered by popularity. A room's index in this list is its area
+// rank.
+func GetAreaRooms(ctx context.Context, parentAreaID, areaID, page int) ([]AreaRoom, error) {
+	apiResp, err := doGet(ctx, fmt.Sprintf(areaListURL, parentAreaID, areaID, page), "")
+	if err != nil {
+		return nil, fmt.Errorf("get area rooms: %w", err)
+	}
+
+	var data struct {
+		List []struct {
+			RoomID int64  `json:"roomid"`
+			UID    int64  `json:"uid"`
+			Uname  string `json:"uname"`
+			Title  string `json:"title"`
+			Online int64  `json:"online"`
+		} `json:"list"`
+	}
+	if err := decodeData(apiResp, &data); err != nil {
+		return nil, fmt.Errorf("parse area rooms: %w", err)
+	}
+
+	rooms := make([]AreaRoom, 0, len(data.List))
+	for _, r := range data.List {
+		rooms = append(rooms, AreaRoom{
+			RoomID: r.RoomID,
+			UID:    r.UID,
+			Name:   r.Uname,
+			Title:  r.Title,
+			Online: r.Online,
+		})
+	}
+	return rooms, nil
+}
+
+// RankSnapshot is a room's ranking at one point in a broadcast.
+type RankSnapshot struct {
+	RoomID   int64     `json:"room_id"`
+	At       time.Time `json:"at"`
+	Online   int64     `json:"online"`    // popularity shown on the room page
+	AreaID   int       `json:"area_id"`   // sub-area the ranks refer to
+	HotRank  int       `json:"hot_rank"`  // popularity rank in the sub-area; 0 if unranked
+	HotScore int64     `json:"hot_score"` // popularity rank score
+	AreaRank int       `json:"area_rank"` // position in the area's room list; 0 if beyond the first page
+}
+
+// RankSampler takes periodic rank snapshots of rooms, so analytics can
+// correlate rank changes with the rest of a broadcast's events.
+type RankSampler struct {
+	interval time.Duration
+	clock    Clock
+}
+
+// NewRankSampler creates a sampler taking a snapshot every interval.
+func NewRankSampler(interval time.Duration) *RankSampler {
+	return &RankSampler{interval: interval, clock: SystemClock()}
+}
+
+// Sample takes one rank snapshot of a room. It costs three API requests:
+// room info, hot rank and the first page of the area's room list.
+func (s *RankSampler) Sample(ctx context.Context, roomID int64) (*RankSnapshot, error) {
+	info, err := GetRoomInfo(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	snap := &RankSnapshot{
+		RoomID: roomID,
+		At:     s.clock.Now(),
+		Online: info.Online,
+		AreaID: info.AreaID,
+	}
+
+	hot, err := GetHotRank(ctx, roomID, info.UID, info.AreaID)
+	if err != nil {
+		return nil, err
+	}
+	snap.HotRank, snap.HotScore = hot.Rank, hot.Score
+
+	rooms, err := GetAreaRooms(ctx, info.ParentAreaID, info.AreaID, 1)
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range rooms {
+		if r.RoomID == roomID {
+			snap.AreaRank = i + 1
+			break
+		}
+	}
+	return snap, nil
+}
+
+// Run samples a room every interval until ctx is done, passing each
+// snapshot (or the error of a failed sample) to fn.
+func (s *RankSampler) Run(ctx context.Context, roomID int64, fn func(*RankSnapshot, error)) {
+	ticker := s.clock.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		snap, err := s.Sample(ctx, roomID)
+		if ctx.Err() != nil {
+			return
+		}
+		fn(snap, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// rateLimitBackoff is the first pause after a rejection; it doubles
+	// with each further rejection up to rateLimitMaxBackoff.
+	rateLimitBackoff    = 10 * time.Second
+	rateLimitMaxBackoff = 5 * time.Minute
+)
+
+// RateLimiter is a token bucket Limiter: it allows rps requests per second
+// on average and bursts of up to burst. When a request it paced is
+// rejected with HTTP 412 or 429, or by risk control (see IsRiskControl),
+// it pauses all requests, for 10 seconds at first and twice as long after
+// each further rejection, up to 5 minutes; a successful request resets the
+// pause. Rejections of requests already in flight when the pause began do
+// not lengthen it. It is safe for concurrent use, and may be shared by
+// several clients to budget them together.
+type RateLimiter struct {
+	rate  float64
+	burst float64
+	clock Clock
+
+	mu      sync.Mutex
+	tokens  float64
+	last    time.Time
+	paused  time.Time // no requests until then
+	backoff time.Duration
+}
+
+// NewRateLimiter creates a RateLimiter allowing rps requests per second
+// with bursts of burst (at least 1).
+func NewRateLimiter(rps float64, burst int) *RateLimiter {
+	b := float64(max(burst, 1))
+	return &RateLimiter{rate: rps, burst: b, tokens: b, clock: SystemClock()}
+}
+
+// Wait blocks until a request may be made, or returns ctx's error once ctx
+// is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		d := l.reserve(l.clock.Now())
+		if d <= 0 {
+			return nil
+		}
+		c, stop := newTimer(l.clock, d)
+		select {
+		case <-ctx.Done():
+			stop()
+			return ctx.Err()
+		case <-c:
+		}
+	}
+}
+
+// reserve takes a token and returns 0, or returns how long to wait before
+// trying again.
+func (l *RateLimiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Before(l.paused) {
+		return l.paused.Sub(now)
+	}
+	if !l.last.IsZero() {
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	if l.rate <= 0 {
+		return time.Second
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// observe adjusts the pause to the outcome of a request. A rejection
+// during a pause was a request sent before it began, and escalates
+// nothing.
+func (l *RateLimiter) observe(err error) {
+	if !isRateLimited(err) {
+		if err == nil {
+			l.mu.Lock()
+			l.backoff = 0
+			l.mu.Unlock()
+		}
+		return
+	}
+	now := l.clock.Now()
+	l.mu.Lock()
+	if now.Before(l.paused) {
+		l.mu.Unlock()
+		return
+	}
+	if l.backoff == 0 {
+		l.backoff = rateLimitBackoff
+	} else {
+		l.backoff = min(2*l.backoff, rateLimitMaxBackoff)
+	}
+	d := l.backoff
+	l.paused = now.Add(d)
+	l.mu.Unlock()
+	slog.Warn("api: rate limited, pausing requests", "delay", d, "error", err)
+}
+
+// isRateLimited reports whether err asks the client to slow down.
+func isRateLimited(err error) bool {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) && statusErr.code == http.StatusTooManyRequests {
+		return true
+	}
+	return isRiskControl(err)
+}
+
+// WithRateLimit paces the client's requests, including retries, with a
+// RateLimiter of rps requests per second and bursts of burst, timed by the
+// client's clock (WithAPIClock). It replaces WithAPILimiter.
+func WithRateLimit(rps float64, burst int) APIClientOption {
+	return func(c *apiClientConfig) {
+		c.limiter = NewRateLimiter(rps, burst)
+		c.ownLimiter = true
+	}
+}
+
+var processLimiter atomic.Pointer[RateLimiter]
+
+// SetRateLimit paces every API request of the process, across all clients,
+// with a RateLimiter of rps requests per second and bursts of burst, in
+// addition to each client's own limiter. rps <= 0 removes the limit.
+func SetRateLimit(rps float64, burst int) {
+	if rps <= 0 {
+		processLimiter.Store(nil)
+		return
+	}
+	processLimiter.Store(NewRateLimiter(rps, burst))
+}
+
+// limiters returns the limiters that pace c's requests.
+func (c *APIClient) limiters() []Limiter {
+	var ls []Limiter
+	if l := processLimiter.Load(); l != nil {
+		ls = append(ls, l)
+	}
+	if c.cfg.limiter != nil {
+		ls = append(ls, c.cfg.limiter)
+	}
+	return ls
+}
+
+// paced makes a request with do once c's limiters allow it, and reports
+// its outcome to those that adapt to rejections.
+func (c *APIClient) paced(ctx context.Context, do func() (*apiResponse, error)) (*apiResponse, error) {
+	limiters := c.limiters()
+	for _, l := range limiters {
+		if err := l.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	apiResp, err := do()
+	for _, l := range limiters {
+		if rl, ok := l.(*RateLimiter); ok {
+			rl.observe(err)
+		}
+	}
+	return apiResp, err
+}
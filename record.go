@@ -0,0 +1,635 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultRecordTemplate = "{room_id}_{title}_{start_time}.flv"
+	defaultRecordStall    = 30 * time.Second
+)
+
+// FLV tag types besides flvAudioTag.
+const (
+	flvVideoTag  = 9
+	flvScriptTag = 18
+)
+
+// ErrNotFLV is returned by Recorder when the stream is not FLV.
+var ErrNotFLV = errors.New("record: stream is not FLV")
+
+// RecordSegment describes a finished file of a Recorder.
+type RecordSegment struct {
+	Path     string
+	Index    int           // segment number, starting at 1
+	Size     int64         // bytes
+	Duration time.Duration // media time covered, from the stream's timestamps
+	Start    time.Time     // wall-clock time the file was opened
+	End      time.Time     // wall-clock time the file was finished
+	PTS      PTSRange      // stream timeline covered
+}
+
+// recorderConfig holds internal configuration for Recorder.
+type recorderConfig struct {
+	dir         string
+	tmpl        *FilenameTemplate
+	maxDuration time.Duration
+	maxSize     int64
+	quality     int
+	stall       time.Duration
+	onSegment   func(RecordSegment)
+	manifest    *SessionManifest
+	logger      *slog.Logger
+	clock       Clock
+}
+
+// RecorderOption configures a Recorder.
+type RecorderOption func(*recorderConfig)
+
+// WithRecordDir sets the directory files are written to, created if
+// needed. Default is the working directory.
+func WithRecordDir(dir string) RecorderOption {
+	return func(c *recorderConfig) {
+		c.dir = dir
+	}
+}
+
+// WithRecordTemplate names the files. FilenameVars.StartTime is the time
+// each file was opened. Default is "{room_id}_{title}_{start_time}.flv".
+// A name that already exists gets a numeric suffix instead of being
+// overwritten.
+func WithRecordTemplate(tmpl *FilenameTemplate) RecorderOption {
+	return func(c *recorderConfig) {
+		c.tmpl = tmpl
+	}
+}
+
+// WithRecordMaxDuration starts a new file once the current one holds d of
+// media. Zero (the default) disables the limit.
+func WithRecordMaxDuration(d time.Duration) RecorderOption {
+	return func(c *recorderConfig) {
+		c.maxDuration = d
+	}
+}
+
+// WithRecordMaxSize starts a new file once the current one has reached n
+// bytes. Zero (the default) disables the limit.
+func WithRecordMaxSize(n int64) RecorderOption {
+	return func(c *recorderConfig) {
+		c.maxSize = n
+	}
+}
+
+// WithRecordQuality sets the quality (qn) Record asks for. Default is
+// QualityOriginal, with GetPlayURLs' fallback.
+func WithRecordQuality(qn int) RecorderOption {
+	return func(c *recorderConfig) {
+		c.quality = qn
+	}
+}
+
+// WithRecordStallTimeout stops a recording that received no data for d,
+// returning ErrCaptureStalled. Default is 30 seconds; zero disables it.
+func WithRecordStallTimeout(d time.Duration) RecorderOption {
+	return func(c *recorderConfig) {
+		c.stall = d
+	}
+}
+
+// WithRecordOnSegment calls fn each time a file is finished, on rotation
+// and when a recording ends.
+func WithRecordOnSegment(fn func(RecordSegment)) RecorderOption {
+	return func(c *recorderConfig) {
+		c.onSegment = fn
+	}
+}
+
+// WithRecordManifest adds every finished file, with its size and SHA-256,
+// to m. The manifest should live in the recorder's directory.
+func WithRecordManifest(m *SessionManifest) RecorderOption {
+	return func(c *recorderConfig) {
+		c.manifest = m
+	}
+}
+
+// WithRecordLogger sets the logger for recorder messages. Default is
+// slog.Default().
+func WithRecordLogger(l *slog.Logger) RecorderOption {
+	return func(c *recorderConfig) {
+		c.logger = l
+	}
+}
+
+// WithRecordClock sets the clock timing the stall timeout and segment
+// times. StreamClient passes its own (WithClock). Default is SystemClock().
+func WithRecordClock(clock Clock) RecorderOption {
+	return func(c *recorderConfig) {
+		c.clock = clock
+	}
+}
+
+// Recorder records a room's live stream to disk as it is delivered, video
+// included and without ffmpeg, rotating files by duration and size.
+// Files are cut at video keyframes (at any audio tag for audio-only
+// streams) and each starts with the stream's metadata and codec headers
+// and timestamps from zero, so every file plays on its own. A rotation
+// waits for the next keyframe after a limit is reached, so files can
+// exceed it by up to one keyframe interval.
+//
+// Segment numbers continue across Record calls, so a Recorder can be
+// reused after a dropped connection to continue one broadcast. A Recorder
+// is not safe for concurrent use.
+type Recorder struct {
+	roomID int64
+	cfg    recorderConfig
+	index  int
+}
+
+// NewRecorder creates a Recorder for roomID.
+func NewRecorder(roomID int64, opts ...RecorderOption) *Recorder {
+	r := &Recorder{
+		roomID: roomID,
+		cfg: recorderConfig{
+			quality: QualityOriginal,
+			stall:   defaultRecordStall,
+		},
+	}
+	for _, o := range opts {
+		o(&r.cfg)
+	}
+	if r.cfg.tmpl == nil {
+		r.cfg.tmpl, _ = ParseFilenameTemplate(defaultRecordTemplate)
+	}
+	if r.cfg.logger == nil {
+		r.cfg.logger = slog.Default()
+	}
+	if r.cfg.clock == nil {
+		r.cfg.clock = SystemClock()
+	}
+	return r
+}
+
+// Record looks up the room's title and stream URL and records until the
+// stream ends or ctx is done, returning nil in both cases; a dropped
+// connection counts as the end of the stream. It does not wait for the
+// room to go live or reconnect; see WithAutoRecord for that.
+func (r *Recorder) Record(ctx context.Context) error {
+	info, err := GetRoomInfo(ctx, r.roomID)
+	if err != nil {
+		return fmt.Errorf("record: %w", err)
+	}
+	play, err := GetPlayURLs(ctx, r.roomID, r.cfg.quality)
+	if err != nil {
+		return fmt.Errorf("record: %w", err)
+	}
+	return r.RecordURL(ctx, play.URLs[0], FilenameVars{UID: info.UID, Title: info.Title})
+}
+
+// RecordURL records the FLV stream at streamURL like Record, naming files
+// with vars (RoomID, StartTime, Segment and PTS are filled in).
+// RequestOptions attached to ctx apply to the download.
+func (r *Recorder) RecordURL(ctx context.Context, streamURL string, vars FilenameVars) error {
+	opts, _ := RequestOptionsFromContext(ctx)
+	body, err := openStream(ctx, streamURL, opts)
+	if err != nil {
+		return fmt.Errorf("record: %w", err)
+	}
+	defer body.Close()
+	if r.cfg.dir != "" {
+		if err := os.MkdirAll(r.cfg.dir, 0o755); err != nil {
+			return fmt.Errorf("record: create dir: %w", err)
+		}
+	}
+
+	var stalled atomic.Bool
+	if r.cfg.stall > 0 {
+		timer := afterFunc(r.cfg.clock, r.cfg.stall, func() {
+			stalled.Store(true)
+			body.Close()
+		})
+		defer timer.Stop()
+		body = &activityReader{ReadCloser: body, timer: timer, d: r.cfg.stall}
+	}
+
+	vars.RoomID = r.roomID
+	w := &flvSegmenter{rec: r, vars: vars}
+	r.cfg.logger.Info("record: started", "room_id", r.roomID, "stream_url_prefix", truncateURL(streamURL))
+	err = w.copy(bufio.NewReaderSize(body, 64<<10))
+	if closeErr := w.finish(); err == nil {
+		err = closeErr
+	}
+	switch {
+	case stalled.Load():
+		return fmt.Errorf("record: %w: no data for %s", ErrCaptureStalled, r.cfg.stall)
+	case ctx.Err() != nil:
+		return nil
+	}
+	return err
+}
+
+// activityReader resets a stall timer on every Read that returns data.
+type activityReader struct {
+	io.ReadCloser
+	timer clockTimer
+	d     time.Duration
+}
+
+func (a *activityReader) Read(p []byte) (int, error) {
+	n, err := a.ReadCloser.Read(p)
+	if n > 0 {
+		a.timer.Reset(a.d)
+	}
+	return n, err
+}
+
+// flvSegmenter splits one FLV download into segment files.
+type flvSegmenter struct {
+	rec  *Recorder
+	vars FilenameVars
+
+	header   []byte // FLV file header
+	meta     []byte // first script tag (onMetaData) data
+	videoCfg []byte // latest video sequence header data
+	audioCfg []byte // latest audio sequence header data
+	hasVideo bool
+
+	f      *os.File
+	bw     *bufio.Writer
+	path   string
+	size   int64
+	opened time.Time
+	base   uint32 // stream timestamp of the file's first media tag
+	last   uint32 // stream timestamp of the latest media tag
+}
+
+// copy reads tags from src until it ends and writes them out.
+func (s *flvSegmenter) copy(src *bufio.Reader) error {
+	hdr := make([]byte, 9)
+	if _, err := io.ReadFull(src, hdr); err != nil {
+		return fmt.Errorf("record: read header: %w", err)
+	}
+	if string(hdr[:3]) != "FLV" {
+		return ErrNotFLV
+	}
+	// Skip the rest of an extended header and the first previous tag size.
+	offset := int64(binary.BigEndian.Uint32(hdr[5:9]))
+	if _, err := io.CopyN(io.Discard, src, max(offset-9, 0)+4); err != nil {
+		return nil
+	}
+	binary.BigEndian.PutUint32(hdr[5:9], 9)
+	s.header = hdr
+
+	th := make([]byte, 11)
+	var data []byte
+	for {
+		if _, err := io.ReadFull(src, th); err != nil {
+			return nil // end of stream; a partial tag is dropped
+		}
+		typ := th[0] & 0x1f
+		size := int(th[1])<<16 | int(th[2])<<8 | int(th[3])
+		ts := uint32(th[7])<<24 | uint32(th[4])<<16 | uint32(th[5])<<8 | uint32(th[6])
+		if cap(data) < size+4 {
+			data = make([]byte, size+4)
+		}
+		data = data[:size+4]
+		if _, err := io.ReadFull(src, data); err != nil {
+			return nil
+		}
+		if err := s.tag(typ, ts, data[:size]); err != nil {
+			return err
+		}
+	}
+}
+
+// tag handles one tag of the download.
+func (s *flvSegmenter) tag(typ byte, ts uint32, data []byte) error {
+	switch {
+	case typ == flvScriptTag:
+		if s.meta == nil {
+			s.meta = append([]byte(nil), data...)
+			return nil
+		}
+	case typ == flvVideoTag && isFLVVideoConfig(data):
+		s.hasVideo = true
+		s.videoCfg = append(s.videoCfg[:0], data...)
+		if s.f == nil {
+			return nil
+		}
+	case typ == flvAudioTag && isFLVAudioConfig(data):
+		s.audioCfg = append(s.audioCfg[:0], data...)
+		if s.f == nil {
+			return nil
+		}
+	case typ == flvVideoTag || typ == flvAudioTag:
+		if typ == flvVideoTag {
+			s.hasVideo = true
+		}
+		cut := typ == flvVideoTag && isFLVKeyframe(data) || typ == flvAudioTag && !s.hasVideo
+		if s.f != nil && cut && s.full(ts) {
+			if err := s.finish(); err != nil {
+				return err
+			}
+		}
+		if s.f == nil {
+			if err := s.open(ts); err != nil {
+				return err
+			}
+		}
+		s.last = max(s.last, ts)
+	default:
+		return nil
+	}
+	if s.f == nil {
+		return nil // script tags before the first file
+	}
+	return s.write(typ, ts, data)
+}
+
+// full reports whether the current file has reached a limit at ts.
+func (s *flvSegmenter) full(ts uint32) bool {
+	cfg := &s.rec.cfg
+	if cfg.maxDuration > 0 && ts >= s.base && time.Duration(ts-s.base)*time.Millisecond >= cfg.maxDuration {
+		return true
+	}
+	return cfg.maxSize > 0 && s.size >= cfg.maxSize
+}
+
+// open starts the next file with the header, metadata and codec headers.
+func (s *flvSegmenter) open(ts uint32) error {
+	r := s.rec
+	r.index++
+	vars := s.vars
+	vars.Segment = r.index
+	vars.StartTime = r.cfg.clock.Now()
+	vars.PTS = time.Duration(ts) * time.Millisecond
+
+	path, f, err := createUnique(filepath.Join(r.cfg.dir, r.cfg.tmpl.Render(vars)))
+	if err != nil {
+		r.index--
+		return fmt.Errorf("record: create file: %w", err)
+	}
+	s.f, s.path, s.opened = f, path, vars.StartTime
+	s.bw = bufio.NewWriterSize(f, 256<<10)
+	s.size, s.base, s.last = 0, ts, ts
+
+	s.bw.Write(s.header)
+	s.bw.Write([]byte{0, 0, 0, 0})
+	s.size += int64(len(s.header)) + 4
+	// Written at the file's start time, ts.
+	for _, h := range []struct {
+		typ  byte
+		data []byte
+	}{{flvScriptTag, s.meta}, {flvVideoTag, s.videoCfg}, {flvAudioTag, s.audioCfg}} {
+		if h.data != nil {
+			if err := s.write(h.typ, ts, h.data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// write appends a tag with its timestamp rebased to the file's start.
+func (s *flvSegmenter) write(typ byte, ts uint32, data []byte) error {
+	rel := uint32(0)
+	if ts > s.base {
+		rel = ts - s.base
+	}
+	size := len(data)
+	var th [11]byte
+	th[0] = typ
+	th[1], th[2], th[3] = byte(size>>16), byte(size>>8), byte(size)
+	th[4], th[5], th[6], th[7] = byte(rel>>16), byte(rel>>8), byte(rel), byte(rel>>24)
+	s.bw.Write(th[:])
+	s.bw.Write(data)
+	var prev [4]byte
+	binary.BigEndian.PutUint32(prev[:], uint32(11+size))
+	if _, err := s.bw.Write(prev[:]); err != nil {
+		return fmt.Errorf("record: write: %w", err)
+	}
+	s.size += int64(11 + size + 4)
+	return nil
+}
+
+// finish flushes and closes the current file, if any, and reports it.
+func (s *flvSegmenter) finish() error {
+	if s.f == nil {
+		return nil
+	}
+	r := s.rec
+	f := s.f
+	s.f = nil
+	err := s.bw.Flush()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("record: finish %s: %w", s.path, err)
+	}
+	seg := RecordSegment{
+		Path:     s.path,
+		Index:    r.index,
+		Size:     s.size,
+		Duration: time.Duration(s.last-s.base) * time.Millisecond,
+		Start:    s.opened,
+		End:      r.cfg.clock.Now(),
+		PTS: PTSRange{
+			Start: time.Duration(s.base) * time.Millisecond,
+			End:   time.Duration(s.last) * time.Millisecond,
+		},
+	}
+	r.cfg.logger.Info("record: segment finished", "room_id", r.roomID,
+		"path", seg.Path, "size", seg.Size, "duration", seg.Duration)
+	if m := r.cfg.manifest; m != nil {
+		pts := seg.PTS
+		err := m.addSegment(seg.Path, ManifestSegment{
+			Index:    seg.Index,
+			Start:    seg.Start,
+			End:      seg.End,
+			Duration: seg.Duration,
+			PTS:      &pts,
+			Title:    s.vars.Title,
+		})
+		if err != nil {
+			return fmt.Errorf("record: %w", err)
+		}
+	}
+	if r.cfg.onSegment != nil {
+		r.cfg.onSegment(seg)
+	}
+	return nil
+}
+
+// createUnique creates path, or path with "_2", "_3", ... before its
+// extension if it exists.
+func createUnique(path string) (string, *os.File, error) {
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+	for i := 1; ; i++ {
+		p := path
+		if i > 1 {
+			p = stem + "_" + strconv.Itoa(i) + ext
+		}
+		f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		return p, f, err
+	}
+}
+
+// isFLVVideoConfig reports whether a video tag carries a decoder
+// configuration (AVC/HEVC sequence header), in legacy or enhanced FLV.
+func isFLVVideoConfig(data []byte) bool {
+	if len(data) < 2 {
+		return false
+	}
+	if data[0]&0x80 != 0 {
+		return data[0]&0x0f == 0 // enhanced: PacketTypeSequenceStart
+	}
+	codec := data[0] & 0x0f
+	return (codec == 7 || codec == 12) && data[1] == 0
+}
+
+// isFLVKeyframe reports whether a video tag holds a keyframe.
+func isFLVKeyframe(data []byte) bool {
+	return len(data) > 0 && (data[0]>>4)&0x07 == 1
+}
+
+// isFLVAudioConfig reports whether an audio tag is an AAC sequence header.
+func isFLVAudioConfig(data []byte) bool {
+	return len(data) >= 2 && data[0]>>4 == 10 && data[1] == 0
+}
+
+// recording is a room's WithAutoRecord recording.
+type recording struct {
+	cancel context.CancelFunc
+	rec    *Recorder
+}
+
+// titleChanged records a title change in the recorder's manifest, for the
+// chapters of ConcatSession.
+func (r *Recorder) titleChanged(at time.Time, title string) {
+	if m := r.cfg.manifest; m != nil {
+		if err := m.AddTitle(at, title); err != nil {
+			r.cfg.logger.Warn("record: failed to update manifest", "path", m.Path(), "error", err)
+		}
+	}
+}
+
+// recordTitle passes a title change of roomID to its recording, if any.
+func (c *StreamClient) recordTitle(roomID int64, at time.Time, title string) {
+	c.capturesMu.Lock()
+	rec := c.recordings[roomID]
+	c.capturesMu.Unlock()
+	if rec != nil {
+		rec.rec.titleChanged(at, title)
+	}
+}
+
+// startRecording records a live room until it goes offline, if
+// WithAutoRecord is set, reconnecting when the download ends early.
+func (c *StreamClient) startRecording(ctx context.Context, ev RoomEvent) {
+	if c.cfg.recordOpts == nil {
+		return
+	}
+	roomID := ev.RoomID
+	log := c.monitor.roomLogger(roomID)
+	opts := append([]RecorderOption{WithRecordLogger(log), WithRecordClock(c.cfg.clock)}, c.cfg.recordOpts...)
+	rec := NewRecorder(roomID, opts...)
+	vars := FilenameVars{UID: ev.UID, Name: c.monitor.RoomName(roomID), Title: ev.Title}
+	if c.cfg.concatQueue != nil {
+		if m, err := c.sessionManifest(roomID, rec.cfg.dir); err != nil {
+			log.Warn("client: failed to create session manifest", "error", err)
+		} else {
+			rec.cfg.manifest = m
+		}
+	}
+
+	recCtx, cancel := context.WithCancel(c.monitor.roomContext(ctx, roomID))
+	c.capturesMu.Lock()
+	if prev, ok := c.recordings[roomID]; ok {
+		prev.cancel()
+	}
+	c.recordings[roomID] = &recording{cancel: cancel, rec: rec}
+	c.capturesMu.Unlock()
+
+	go func() {
+		defer c.enqueueConcat(roomID, rec)
+		badHosts := make(map[string]bool)
+		fails := 0
+		for recCtx.Err() == nil && c.monitor.isLive(roomID) {
+			streamURL, _, err := pickStreamURL(recCtx, roomID, c.roomQuality(roomID), badHosts)
+			if err == nil {
+				err = rec.RecordURL(recCtx, streamURL, vars)
+				if isCDNError(err) {
+					badHosts[streamHost(streamURL)] = true
+				}
+			}
+			if recCtx.Err() != nil {
+				return
+			}
+			if err == nil {
+				// The CDN closed the stream; reconnect while the room is live.
+				fails = 0
+				if !c.retryWait(recCtx, 0) {
+					return
+				}
+				continue
+			}
+			fails++
+			log.Warn("client: recording failed", "attempt", fails, "error", err)
+			c.publishStreamEvent(StreamEvent{
+				RoomID: roomID,
+				Type:   EventError,
+				Error:  err,
+				Title:  ev.Title,
+			})
+			if fails >= c.cfg.captureRetries || !c.retryWait(recCtx, fails-1) {
+				return
+			}
+		}
+	}()
+}
+
+// sessionManifest creates the WithAutoConcat manifest of roomID's current
+// session in dir, or loads it if the session's recording restarted.
+func (c *StreamClient) sessionManifest(roomID int64, dir string) (*SessionManifest, error) {
+	session := c.monitor.SessionID(roomID)
+	if session == "" {
+		session = newSessionID(roomID, c.cfg.clock.Now())
+	}
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return NewSessionManifest(filepath.Join(dir, session+".json"), session, roomID)
+}
+
+// enqueueConcat queues the WithAutoConcat job of a recording that ended
+// because its room went offline.
+func (c *StreamClient) enqueueConcat(roomID int64, rec *Recorder) {
+	m := rec.cfg.manifest
+	if c.cfg.concatQueue == nil || m == nil || c.monitor.isLive(roomID) || m.segmentCount() == 0 {
+		return
+	}
+	id, err := c.cfg.concatQueue.Enqueue(Job{Kind: JobConcat, RoomID: roomID, Path: m.Path()})
+	if err != nil {
+		c.monitor.roomLogger(roomID).Warn("client: failed to enqueue concat job", "manifest", m.Path(), "error", err)
+		return
+	}
+	c.monitor.roomLogger(roomID).Info("client: session recording queued for concat", "job", id, "manifest", m.Path())
+}
@@ -0,0 +1,172 @@
+package stream
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// RedactRule is one rule of a Redactor: a word list, a regular expression,
+// or both.
+type RedactRule struct {
+	Words   []string // literals, matched case-insensitively anywhere in the text
+	Pattern string   // regular expression in RE2 syntax
+	Replace string   // replacement text; empty masks every matched character with '*'
+}
+
+// Common rules for personal data in Chinese chat.
+var (
+	RedactPhoneNumbers = RedactRule{Pattern: `\b1[3-9]\d{9}\b`}                       // mainland mobile numbers
+	RedactIDNumbers    = RedactRule{Pattern: `\b\d{17}[\dXx]\b`}                      // resident ID card numbers
+	RedactEmails       = RedactRule{Pattern: `[\w.+-]+@[\w-]+(?:\.[\w-]+)+`}          // e-mail addresses
+	RedactURLs         = RedactRule{Pattern: `(?i)\bhttps?://\S+`, Replace: "[link]"} // links
+)
+
+// Redactor scrubs banned words and personal data from text before it
+// leaves the pipeline: transcripts, chat exports and events sent to sinks
+// (WithSinkRedactor). Rules apply in order. A Redactor is safe for
+// concurrent use.
+type Redactor struct {
+	rules []compiledRedactRule
+}
+
+type compiledRedactRule struct {
+	re      *regexp.Regexp
+	replace string
+}
+
+// NewRedactor compiles rules.
+func NewRedactor(rules ...RedactRule) (*Redactor, error) {
+	r := &Redactor{}
+	for i, rule := range rules {
+		var exprs []string
+		if words := wordsPattern(rule.Words); words != "" {
+			exprs = append(exprs, words)
+		}
+		if rule.Pattern != "" {
+			exprs = append(exprs, rule.Pattern)
+		}
+		for _, expr := range exprs {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("redact: rule %d: %w", i, err)
+			}
+			r.rules = append(r.rules, compiledRedactRule{re: re, replace: rule.Replace})
+		}
+	}
+	return r, nil
+}
+
+// wordsPattern returns a case-insensitive alternation of words, longest
+// first so that longer entries win over their prefixes.
+func wordsPattern(words []string) string {
+	var quoted []string
+	for _, w := range words {
+		if w = strings.TrimSpace(w); w != "" {
+			quoted = append(quoted, regexp.QuoteMeta(w))
+		}
+	}
+	if len(quoted) == 0 {
+		return ""
+	}
+	sort.SliceStable(quoted, func(i, j int) bool { return len(quoted[i]) > len(quoted[j]) })
+	return "(?i)(?:" + strings.Join(quoted, "|") + ")"
+}
+
+// LoadRedactWords reads a word list with one entry per line. Blank lines
+// and lines starting with '#' are skipped.
+func LoadRedactWords(path string) (RedactRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return RedactRule{}, fmt.Errorf("redact: %w", err)
+	}
+	defer f.Close()
+	var rule RedactRule
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule.Words = append(rule.Words, line)
+	}
+	if err := sc.Err(); err != nil {
+		return RedactRule{}, fmt.Errorf("redact: read %s: %w", path, err)
+	}
+	return rule, nil
+}
+
+// Redact returns s with every rule applied.
+func (r *Redactor) Redact(s string) string {
+	for _, rule := range r.rules {
+		if rule.replace != "" {
+			s = rule.re.ReplaceAllLiteralString(s, rule.replace)
+			continue
+		}
+		s = rule.re.ReplaceAllStringFunc(s, func(m string) string {
+			return strings.Repeat("*", utf8.RuneCountInString(m))
+		})
+	}
+	return s
+}
+
+// RedactEvent returns a copy of ev with its user-written text redacted:
+// danmaku text and nickname, other chat commands (see RedactChat), and the
+// room announcement. Other fields are shared with ev.
+func (r *Redactor) RedactEvent(ev StreamEvent) StreamEvent {
+	if ev.Danmaku != nil {
+		dm := *ev.Danmaku
+		dm.Text = r.Redact(dm.Text)
+		dm.Nickname = r.Redact(dm.Nickname)
+		ev.Danmaku = &dm
+	}
+	if ev.Chat != nil {
+		chat := r.RedactChat(*ev.Chat)
+		ev.Chat = &chat
+	}
+	if ev.Announcement != nil {
+		a := *ev.Announcement
+		a.Old = r.Redact(a.Old)
+		a.New = r.Redact(a.New)
+		ev.Announcement = &a
+	}
+	return ev
+}
+
+// RedactChat returns a copy of ev with its messages and nicknames
+// redacted. Raw is dropped, since it holds the original text.
+func (r *Redactor) RedactChat(ev ChatEvent) ChatEvent {
+	ev.Raw = nil
+	if ev.Danmaku != nil {
+		dm := *ev.Danmaku
+		dm.Text = r.Redact(dm.Text)
+		dm.Nickname = r.Redact(dm.Nickname)
+		ev.Danmaku = &dm
+	}
+	if ev.SuperChat != nil {
+		sc := *ev.SuperChat
+		sc.Text = r.Redact(sc.Text)
+		sc.Nickname = r.Redact(sc.Nickname)
+		ev.SuperChat = &sc
+	}
+	if ev.Gift != nil {
+		g := *ev.Gift
+		g.Nickname = r.Redact(g.Nickname)
+		ev.Gift = &g
+	}
+	if ev.Guard != nil {
+		g := *ev.Guard
+		g.Nickname = r.Redact(g.Nickname)
+		ev.Guard = &g
+	}
+	if ev.Interaction != nil {
+		in := *ev.Interaction
+		in.Nickname = r.Redact(in.Nickname)
+		ev.Interaction = &in
+	}
+	return ev
+}
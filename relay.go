@@ -0,0 +1,73 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// RelayOutput returns an OutputSpec that restreams the captured live stream,
+// video included and without transcoding, to an RTMP(S) or SRT endpoint such
+// as a private media server. Add it to CaptureConfig.Outputs, or use
+// WithRelay to relay a room's StreamClient captures.
+//
+// The relay is written through ffmpeg's tee muxer with onfail=ignore, so an
+// unreachable or failing endpoint drops only the relay; the capture and any
+// other outputs keep running.
+func RelayOutput(endpoint string) (OutputSpec, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return OutputSpec{}, fmt.Errorf("relay: %w", err)
+	}
+	var format string
+	switch u.Scheme {
+	case "rtmp", "rtmps":
+		format = "flv"
+	case "srt":
+		format = "mpegts"
+	default:
+		return OutputSpec{}, fmt.Errorf("relay: unsupported scheme %q (want rtmp, rtmps or srt)", u.Scheme)
+	}
+	if u.Host == "" {
+		return OutputSpec{}, fmt.Errorf("relay: missing host in %s endpoint", u.Scheme)
+	}
+	// "|" separates tee outputs and "[" starts their options.
+	if strings.ContainsAny(endpoint, "|[") {
+		return OutputSpec{}, errors.New("relay: endpoint must not contain | or [")
+	}
+	return OutputSpec{
+		Path:   "[f=" + format + ":onfail=ignore]" + endpoint,
+		Format: "tee",
+		// tee needs explicit stream selection.
+		Args: []string{"-map", "0:v?", "-map", "0:a?"},
+	}, nil
+}
+
+// WithRelay restreams the room's captures to the given RTMP(S) or SRT
+// endpoints (see RelayOutput), from the same ffmpeg process that produces
+// the audio. It replaces relays set before; invalid endpoints are logged
+// and skipped when a capture starts.
+func WithRelay(endpoints ...string) RoomOption {
+	return func(c *roomConfig) {
+		c.relays = append([]string(nil), endpoints...)
+	}
+}
+
+// relayOutputs returns the room's WithRelay outputs.
+func (m *Monitor) relayOutputs(roomID int64) []OutputSpec {
+	m.mu.Lock()
+	endpoints := m.roomCfgs[roomID].relays
+	m.mu.Unlock()
+
+	var outs []OutputSpec
+	for _, ep := range endpoints {
+		out, err := RelayOutput(ep)
+		if err != nil {
+			m.roomLogger(roomID).Warn("relay: skipping invalid endpoint", "error", err)
+			continue
+		}
+		outs = append(outs, out)
+	}
+	return outs
+}
@@ -0,0 +1,166 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	replayListURL = "https://api.live.bilibili.com/xlive/web-room/v1/record/getList?room_id=%d&page=%d&page_size=20"
+	replayURLURL  = "https://api.live.bilibili.com/xlive/web-room/v1/record/getLiveRecordUrl?rid=%s&platform=html5"
+)
+
+// Replay is a finished broadcast kept by Bilibili's live replay (直播回放)
+// service. Only streamers who enable replays have them.
+type Replay struct {
+	RID       string // replay ID, used by GetReplayURLs and CaptureReplay
+	RoomID    int64
+	UID       int64
+	Title     string
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+// Duration returns the length of the broadcast.
+func (r Replay) Duration() time.Duration {
+	return r.EndTime.Sub(r.StartTime)
+}
+
+// GetReplays returns one page (starting at 1) of a room's replays, newest
+// first, and the total number of replays.
+func GetReplays(ctx context.Context, roomID int64, page int) ([]Replay, int, error) {
+	apiResp, err := doGet(ctx, fmt.Sprintf(replayListURL, roomID, page), "")
+	if err != nil {
+		return nil, 0, fmt.Errorf("get replays: %w", err)
+	}
+
+	var data struct {
+		Count int `json:"count"`
+		List  []struct {
+			RID            string `json:"rid"`
+			RoomID         int64  `json:"room_id"`
+			UID            int64  `json:"uid"`
+			Title          string `json:"title"`
+			StartTimestamp int64  `json:"start_timestamp"`
+			EndTimestamp   int64  `json:"end_timestamp"`
+		} `json:"list"`
+	}
+	if err := decodeData(apiResp, &data); err != nil {
+		return nil, 0, fmt.Errorf("parse replays: %w", err)
+	}
+
+	replays := make([]Replay, 0, len(data.List))
+	for _, r := range data.List {
+		replays = append(replays, Replay{
+			RID:       r.RID,
+			RoomID:    r.RoomID,
+			UID:       r.UID,
+			Title:     r.Title,
+			StartTime: time.Unix(r.StartTimestamp, 0),
+			EndTime:   time.Unix(r.EndTimestamp, 0),
+		})
+	}
+	return replays, data.Count, nil
+}
+
+// GetReplayURLs returns the playback URLs of a replay's parts, in order.
+// Long broadcasts are split into several files.
+func GetReplayURLs(ctx context.Context, rid string) ([]string, error) {
+	apiResp, err := doGet(ctx, fmt.Sprintf(replayURLURL, rid), "")
+	if err != nil {
+		return nil, fmt.Errorf("get replay url: %w", err)
+	}
+
+	var data struct {
+		List []struct {
+			URL string `json:"url"`
+		} `json:"list"`
+	}
+	if err := decodeData(apiResp, &data); err != nil {
+		return nil, fmt.Errorf("parse replay url: %w", err)
+	}
+	if len(data.List) == 0 {
+		return nil, errors.New("no replay urls returned")
+	}
+
+	urls := make([]string, 0, len(data.List))
+	for _, p := range data.List {
+		urls = append(urls, p.URL)
+	}
+	return urls, nil
+}
+
+// CaptureReplay extracts audio from a replay with the same ffmpeg pipeline
+// as CaptureAudio, for backfilling sessions the monitor missed. The parts
+// of the replay are captured one after another and delivered as a single
+// continuous stream in cfg's format. Unlike a live capture, the reader runs
+// as fast as ffmpeg can download and decode, and ends with io.EOF when the
+// last part is done.
+func CaptureReplay(ctx context.Context, rid string, cfg *CaptureConfig) (io.ReadCloser, error) {
+	urls, err := GetReplayURLs(ctx, rid)
+	if err != nil {
+		return nil, err
+	}
+	r := &replayReader{ctx: ctx, urls: urls, cfg: cfg}
+	if err := r.next(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// replayReader concatenates captures of consecutive replay parts.
+type replayReader struct {
+	ctx  context.Context
+	urls []string
+	cfg  *CaptureConfig
+	cur  io.ReadCloser
+}
+
+// next starts capturing the next part.
+func (r *replayReader) next() error {
+	cur, err := CaptureAudio(r.ctx, r.urls[0], r.cfg)
+	if err != nil {
+		return fmt.Errorf("capture replay part: %w", err)
+	}
+	r.cur = cur
+	r.urls = r.urls[1:]
+	return nil
+}
+
+func (r *replayReader) Read(p []byte) (int, error) {
+	for {
+		if r.cur == nil {
+			return 0, io.EOF
+		}
+		n, err := r.cur.Read(p)
+		if err != io.EOF {
+			return n, err
+		}
+		if closeErr := r.cur.Close(); closeErr != nil {
+			r.cur = nil
+			return n, closeErr
+		}
+		r.cur = nil
+		if len(r.urls) > 0 {
+			if err := r.next(); err != nil {
+				return n, err
+			}
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (r *replayReader) Close() error {
+	if r.cur == nil {
+		return nil
+	}
+	err := r.cur.Close()
+	r.cur = nil
+	r.urls = nil
+	return err
+}
@@ -0,0 +1,174 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
+)
+
+// RequestOptions overrides request metadata for a single call or room.
+// Attach it to a context with WithRequestOptions; API requests and ffmpeg
+// captures made with that context honor the non-empty fields.
+type RequestOptions struct {
+	Cookie    string // SESSDATA cookie, overrides any configured cookie
+	UserAgent string // User-Agent header, overrides the library default
+	Proxy     string // HTTP proxy URL, e.g. "http://127.0.0.1:8080"
+	TraceID   string // caller trace ID, attached to log lines
+
+	// Headers adds or overrides HTTP headers of API requests and stream
+	// downloads, including ffmpeg's. A "Cookie" entry is appended to the
+	// SESSDATA cookie, e.g. "buvid3=..." for member streams. Values must
+	// not contain CR, LF or other control characters.
+	Headers map[string]string
+
+	// Resolver, if set, resolves API and CDN host names instead of the
+	// system resolver, with Happy Eyeballs dialing. Captures then download
+	// the stream in Go and feed it to ffmpeg, since ffmpeg cannot use it.
+	Resolver Resolver
+
+	// RefreshCredentials, if set, is called when Bilibili stops honoring
+	// Cookie (a login-required response to a request that sent it). It
+	// returns a fresh SESSDATA, and the request is retried once with it.
+	RefreshCredentials CredentialRefresher
+
+	// onResult, if set, is told the outcome of every API request, for the
+	// Monitor's per-credential accounting.
+	onResult func(cookie string, err error)
+
+	// onExpired, if set, is told when a request fails with
+	// ErrCredentialsExpired, so the Monitor can report EventAuthExpired.
+	onExpired func(cookie string, err error)
+}
+
+// CredentialRefresher obtains a fresh SESSDATA cookie after expired was
+// rejected, e.g. by re-running a login flow or reading a credential store.
+type CredentialRefresher func(ctx context.Context, expired string) (string, error)
+
+// ErrCredentialsExpired is returned (wrapping the *APIError) when a request
+// sent a cookie and Bilibili answered that the user is not logged in, and
+// no RefreshCredentials callback could supply a working one.
+var ErrCredentialsExpired = errors.New("credentials expired")
+
+// codeNotLoggedIn is the API code for "账号未登录".
+const codeNotLoggedIn = -101
+
+type requestOptionsKey struct{}
+
+// WithRequestOptions returns a copy of ctx carrying opts. Options already
+// present in ctx are merged, with non-empty fields in opts taking priority.
+func WithRequestOptions(ctx context.Context, opts RequestOptions) context.Context {
+	if prev, ok := RequestOptionsFromContext(ctx); ok {
+		opts = prev.merge(opts)
+	}
+	return context.WithValue(ctx, requestOptionsKey{}, opts)
+}
+
+// RequestOptionsFromContext returns the RequestOptions attached to ctx.
+func RequestOptionsFromContext(ctx context.Context) (RequestOptions, bool) {
+	opts, ok := ctx.Value(requestOptionsKey{}).(RequestOptions)
+	return opts, ok
+}
+
+// merge returns o with every non-empty field of override applied.
+func (o RequestOptions) merge(override RequestOptions) RequestOptions {
+	if override.Cookie != "" {
+		o.Cookie = override.Cookie
+	}
+	if override.UserAgent != "" {
+		o.UserAgent = override.UserAgent
+	}
+	if override.Proxy != "" {
+		o.Proxy = override.Proxy
+	}
+	if override.TraceID != "" {
+		o.TraceID = override.TraceID
+	}
+	if len(override.Headers) > 0 {
+		headers := make(map[string]string, len(o.Headers)+len(override.Headers))
+		for k, v := range o.Headers {
+			headers[k] = v
+		}
+		for k, v := range override.Headers {
+			headers[k] = v
+		}
+		o.Headers = headers
+	}
+	if override.Resolver != nil {
+		o.Resolver = override.Resolver
+	}
+	if override.RefreshCredentials != nil {
+		o.RefreshCredentials = override.RefreshCredentials
+	}
+	if override.onResult != nil {
+		o.onResult = override.onResult
+	}
+	if override.onExpired != nil {
+		o.onExpired = override.onExpired
+	}
+	return o
+}
+
+// expired reports err, the final rejection of cookie, to onExpired and
+// returns it.
+func (o RequestOptions) expired(cookie string, err error) error {
+	if o.onExpired != nil {
+		o.onExpired(cookie, err)
+	}
+	return err
+}
+
+// userAgentOr returns the overriding User-Agent, or the library default.
+func (o RequestOptions) userAgentOr() string {
+	if o.UserAgent != "" {
+		return o.UserAgent
+	}
+	return userAgent
+}
+
+// transportKey identifies an HTTP client configuration.
+type transportKey struct {
+	proxy    string
+	resolver Resolver
+}
+
+// httpClients caches one http.Client per proxy URL and resolver so
+// connections are reused across requests routed the same way.
+var httpClients sync.Map // transportKey -> *http.Client
+
+// httpClientFor returns the HTTP client to use for a request with opts.
+// A resolver of an uncomparable type cannot key the cache; it gets a
+// client of its own without keep-alives, so no idle connections pile up.
+func httpClientFor(opts RequestOptions) (*http.Client, error) {
+	if opts.Proxy == "" && opts.Resolver == nil {
+		return http.DefaultClient, nil
+	}
+	cacheable := opts.Resolver == nil || reflect.TypeOf(opts.Resolver).Comparable()
+	key := transportKey{proxy: opts.Proxy}
+	if cacheable {
+		key.resolver = opts.Resolver
+		if c, ok := httpClients.Load(key); ok {
+			return c.(*http.Client), nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.Proxy != "" {
+		proxyURL, err := url.Parse(opts.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if opts.Resolver != nil {
+		transport.DialContext = dialerFor(opts.Resolver)
+	}
+	if !cacheable {
+		transport.DisableKeepAlives = true
+		return &http.Client{Transport: transport}, nil
+	}
+	c, _ := httpClients.LoadOrStore(key, &http.Client{Transport: transport})
+	return c.(*http.Client), nil
+}
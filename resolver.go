@@ -0,0 +1,241 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// fallbackDelay is how long a Happy Eyeballs dial waits on one address
+// before racing the next (RFC 8305 recommends 250ms).
+const fallbackDelay = 250 * time.Millisecond
+
+// Resolver resolves host names for API requests and stream downloads.
+// *net.Resolver satisfies it. Set it with RequestOptions.Resolver to work
+// around poisoned or geo-differentiated DNS answers for CDN hosts.
+//
+// Requests through the same comparable resolver, such as a pointer like
+// all resolvers in this package, share an HTTP client and its pooled
+// connections. Resolvers of uncomparable types (e.g. structs holding a
+// slice or map) work too, but each request then opens its own connection.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// StaticResolver answers from a fixed host → IP table (like /etc/hosts)
+// and defers other names to fallback, or the system resolver if nil.
+type StaticResolver struct {
+	hosts    map[string][]net.IPAddr
+	fallback Resolver
+}
+
+// NewStaticResolver creates a StaticResolver. Values of hosts are IP
+// address strings; invalid ones are reported as an error.
+func NewStaticResolver(hosts map[string][]string, fallback Resolver) (*StaticResolver, error) {
+	r := &StaticResolver{hosts: make(map[string][]net.IPAddr), fallback: fallback}
+	for host, ips := range hosts {
+		for _, s := range ips {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("static resolver: invalid IP %q for %s", s, host)
+			}
+			key := strings.ToLower(host)
+			r.hosts[key] = append(r.hosts[key], net.IPAddr{IP: ip})
+		}
+	}
+	return r, nil
+}
+
+// LookupIPAddr implements Resolver.
+func (r *StaticResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	if addrs, ok := r.hosts[strings.ToLower(host)]; ok {
+		return addrs, nil
+	}
+	if r.fallback != nil {
+		return r.fallback.LookupIPAddr(ctx, host)
+	}
+	return net.DefaultResolver.LookupIPAddr(ctx, host)
+}
+
+// DoHResolver resolves names with DNS-over-HTTPS using the JSON API
+// offered by public resolvers, e.g. "https://cloudflare-dns.com/dns-query"
+// or "https://dns.google/resolve". Queries go through http.DefaultClient,
+// so the resolver host itself is resolved by the system.
+type DoHResolver struct {
+	endpoint string
+}
+
+// NewDoHResolver creates a DoHResolver for a JSON DoH endpoint.
+func NewDoHResolver(endpoint string) *DoHResolver {
+	return &DoHResolver{endpoint: endpoint}
+}
+
+// LookupIPAddr implements Resolver, querying A and AAAA records.
+func (r *DoHResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IPAddr{{IP: ip}}, nil
+	}
+	var addrs []net.IPAddr
+	var firstErr error
+	for _, qtype := range []string{"AAAA", "A"} {
+		ips, err := r.query(ctx, host, qtype)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		addrs = append(addrs, ips...)
+	}
+	if len(addrs) == 0 {
+		if firstErr == nil {
+			firstErr = fmt.Errorf("doh: no addresses for %s", host)
+		}
+		return nil, firstErr
+	}
+	return addrs, nil
+}
+
+func (r *DoHResolver) query(ctx context.Context, host, qtype string) ([]net.IPAddr, error) {
+	u := r.endpoint + "?name=" + url.QueryEscape(host) + "&type=" + qtype
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("doh: create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/dns-json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("doh: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("doh: http status %d", resp.StatusCode)
+	}
+
+	var msg struct {
+		Status int `json:"Status"`
+		Answer []struct {
+			Type int    `json:"type"`
+			Data string `json:"data"`
+		} `json:"Answer"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		return nil, fmt.Errorf("doh: decode response: %w", err)
+	}
+	if msg.Status != 0 {
+		return nil, fmt.Errorf("doh: %s %s: rcode %d", host, qtype, msg.Status)
+	}
+	var addrs []net.IPAddr
+	for _, a := range msg.Answer {
+		// Skip CNAMEs and other records; only keep addresses.
+		if ip := net.ParseIP(a.Data); ip != nil && (a.Type == 1 || a.Type == 28) {
+			addrs = append(addrs, net.IPAddr{IP: ip})
+		}
+	}
+	return addrs, nil
+}
+
+// dialerFor returns a DialContext that resolves with r and connects with
+// Happy Eyeballs: addresses alternate between IPv6 and IPv4, and each
+// further address is raced after fallbackDelay.
+func dialerFor(r Resolver) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		ips, err := r.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("resolve %s: %w", host, err)
+		}
+		if len(ips) == 0 {
+			return nil, fmt.Errorf("resolve %s: no addresses", host)
+		}
+		return dialHappyEyeballs(ctx, network, interleaveFamilies(ips), port)
+	}
+}
+
+// interleaveFamilies orders addresses IPv6, IPv4, IPv6, ... (RFC 8305).
+func interleaveFamilies(ips []net.IPAddr) []net.IPAddr {
+	var v4, v6 []net.IPAddr
+	for _, ip := range ips {
+		if ip.IP.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+	out := make([]net.IPAddr, 0, len(ips))
+	for i := 0; i < len(v4) || i < len(v6); i++ {
+		if i < len(v6) {
+			out = append(out, v6[i])
+		}
+		if i < len(v4) {
+			out = append(out, v4[i])
+		}
+	}
+	return out
+}
+
+// dialHappyEyeballs races connections to ips, starting one every
+// fallbackDelay (or immediately after a failure), and returns the first
+// that succeeds.
+func dialHappyEyeballs(ctx context.Context, network string, ips []net.IPAddr, port string) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result, len(ips))
+	var d net.Dialer
+	next, pending := 0, 0
+	var errs []error
+
+	start := func() {
+		addr := net.JoinHostPort(ips[next].String(), port)
+		next++
+		pending++
+		go func() {
+			c, err := d.DialContext(ctx, network, addr)
+			results <- result{c, err}
+		}()
+	}
+	start()
+
+	timer := time.NewTimer(fallbackDelay)
+	defer timer.Stop()
+	for pending > 0 {
+		select {
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				// Close connections from dials still in flight.
+				go func(n int) {
+					for ; n > 0; n-- {
+						if r := <-results; r.conn != nil {
+							r.conn.Close()
+						}
+					}
+				}(pending)
+				return res.conn, nil
+			}
+			errs = append(errs, res.err)
+			if next < len(ips) {
+				start()
+				timer.Reset(fallbackDelay)
+			}
+		case <-timer.C:
+			if next < len(ips) {
+				start()
+				timer.Reset(fallbackDelay)
+			}
+		}
+	}
+	return nil, errors.Join(errs...)
+}
@@ -0,0 +1,272 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// AudioResume describes a capture that was restarted in place after its
+// ffmpeg process ended while the room was still live, usually because the
+// stream URL expired. See EventAudioResumed; the gap it left is reported
+// by the EventAudioGap before it.
+type AudioResume struct {
+	Padding int `json:"padding"` // zero bytes inserted to complete the last PCM frame
+	Count   int `json:"count"`   // resumes of this capture so far, including this one
+}
+
+// resumable wraps a capture reader so that, when its ffmpeg process ends
+// while the capture is running and the room is live, a fresh stream URL is
+// fetched and the new process's output continues the same reader. This is
+// the capture's only restart path: stalls and underruns end the process
+// too. Each resume emits EventAudioResumed and restarts the video capture
+// (WithVideoConfig) on the new URL.
+func (c *StreamClient) resumable(captureCtx context.Context, audio *AudioStream, reader io.ReadCloser, title string, session *liveSession, audioCfg *CaptureConfig) io.ReadCloser {
+	roomID := audio.RoomID
+	r := &resumingReader{
+		cur:     reader,
+		clock:   c.cfg.clock,
+		frame:   audio.BytesPerFrame,
+		rate:    int64(audio.BytesPerFrame * audio.SampleRate),
+		fillMax: c.cfg.gapFill,
+	}
+	r.reopen = func(cause error) (io.ReadCloser, bool) {
+		if captureCtx.Err() != nil || !c.monitor.isLive(roomID) {
+			return nil, false
+		}
+		c.monitor.roomLogger(roomID).Info("client: capture ended while live, resuming", "error", cause)
+		next, streamURL, ok := c.openCapture(captureCtx, roomID, title, session, audioCfg, true)
+		if !ok {
+			return nil, false
+		}
+		audio.ChatSync.reanchor()
+		c.startVideo(captureCtx, roomID, streamURL, title)
+		return next, true
+	}
+	r.resumed = func(cause error, padding int, gap AudioGap) {
+		r.mu.Lock()
+		r.count++
+		count := r.count
+		r.mu.Unlock()
+		c.monitor.roomLogger(roomID).Info("client: audio capture resumed",
+			"gap", gap.Duration, "silence", gap.Silence, "count", count)
+		c.publishStreamEvent(StreamEvent{
+			RoomID: roomID,
+			Type:   EventAudioGap,
+			Title:  title,
+			Gap:    &gap,
+		})
+		c.publishStreamEvent(StreamEvent{
+			RoomID: roomID,
+			Type:   EventAudioResumed,
+			Error:  cause,
+			Title:  title,
+			Resume: &AudioResume{Padding: padding, Count: count},
+		})
+	}
+	return r
+}
+
+// AudioGap marks a discontinuity in a capture's audio: the stream was
+// missing for Duration, starting Offset into the reader's audio. See
+// EventAudioGap.
+type AudioGap struct {
+	Offset   time.Duration `json:"offset"`   // audio read before the gap, including earlier silence; 0 for ADTS
+	Duration time.Duration `json:"duration"` // wall-clock time without audio
+	Silence  time.Duration `json:"silence"`  // silence inserted in its place (WithAudioGapFill)
+}
+
+// resumingReader reads from the current capture of a room and switches to
+// a new one when it ends. For PCM, an incomplete last frame of the old
+// capture is completed with zero bytes so samples stay aligned, and up to
+// fillMax of the gap is filled with silence.
+type resumingReader struct {
+	clock   Clock
+	frame   int                                     // PCM frame size; 0 for ADTS
+	rate    int64                                   // PCM bytes per second; 0 for ADTS
+	fillMax time.Duration                           // WithAudioGapFill
+	reopen  func(cause error) (io.ReadCloser, bool) // blocks until a new capture delivers audio
+	resumed func(cause error, padding int, gap AudioGap)
+
+	mu       sync.Mutex
+	cur      io.ReadCloser
+	pos      int64 // bytes delivered, including padding and silence
+	partial  int   // bytes of an incomplete frame read from cur
+	pad      int   // zero bytes still to deliver
+	closed   bool
+	count    int
+	deadline time.Time
+	wake     chan struct{} // closed when the deadline changes
+	resuming chan struct{} // closed when a pending reopen finishes
+	failed   error         // cause of the last failed reopen
+}
+
+func (r *resumingReader) Read(p []byte) (int, error) {
+	for {
+		r.mu.Lock()
+		if r.pad > 0 {
+			n := min(r.pad, len(p))
+			clear(p[:n])
+			r.pad -= n
+			r.pos += int64(n)
+			r.mu.Unlock()
+			return n, nil
+		}
+		if r.failed != nil {
+			err := r.failed
+			r.mu.Unlock()
+			return 0, err
+		}
+		cur, resuming := r.cur, r.resuming
+		r.mu.Unlock()
+
+		if resuming == nil {
+			n, err := cur.Read(p)
+			if err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+				r.account(n)
+				return n, err
+			}
+			r.account(n)
+			if n > 0 {
+				// Deliver the data; the ended capture reports the error again.
+				return n, nil
+			}
+			if resuming = r.startResume(cur, err); resuming == nil {
+				return 0, err
+			}
+		}
+		if err := r.await(resuming); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// account records n bytes read from the current capture.
+func (r *resumingReader) account(n int) {
+	if n == 0 {
+		return
+	}
+	r.mu.Lock()
+	r.pos += int64(n)
+	if r.frame > 0 {
+		r.partial = (r.partial + n) % r.frame
+	}
+	r.mu.Unlock()
+}
+
+// duration converts a PCM byte count to audio time; 0 for ADTS.
+func (r *resumingReader) duration(n int64) time.Duration {
+	if r.rate <= 0 {
+		return 0
+	}
+	return time.Duration(n * int64(time.Second) / r.rate)
+}
+
+// startResume starts reopening the capture after cur ended with cause and
+// returns the channel closed when that finishes, or nil if the reader was
+// closed.
+func (r *resumingReader) startResume(cur io.ReadCloser, cause error) chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	if r.resuming != nil {
+		return r.resuming
+	}
+	if r.cur != cur {
+		// Another Read already switched captures.
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+	done := make(chan struct{})
+	r.resuming = done
+	go func() {
+		defer close(done)
+		ended := r.clock.Now()
+		next, ok := r.reopen(cause)
+		r.mu.Lock()
+		r.resuming = nil
+		if !ok || r.closed {
+			r.failed = cause
+			r.mu.Unlock()
+			if next != nil {
+				next.Close()
+			}
+			return
+		}
+		old := r.cur
+		r.cur = next
+		padding := 0
+		if r.partial > 0 {
+			padding = r.frame - r.partial
+			r.pad, r.partial = padding, 0
+		}
+		gap := AudioGap{Offset: r.duration(r.pos + int64(padding)), Duration: r.clock.Now().Sub(ended)}
+		if r.fillMax > 0 && r.rate > 0 {
+			silence := int64(min(gap.Duration, r.fillMax)) * r.rate / int64(time.Second)
+			silence -= silence % int64(r.frame)
+			r.pad += int(silence)
+			gap.Silence = r.duration(silence)
+		}
+		setReadDeadline(next, r.deadline)
+		r.mu.Unlock()
+		old.Close()
+		r.resumed(cause, padding, gap)
+	}()
+	return done
+}
+
+// await waits for a pending reopen, or returns os.ErrDeadlineExceeded once
+// the read deadline passes.
+func (r *resumingReader) await(resuming chan struct{}) error {
+	for {
+		r.mu.Lock()
+		deadline, wake := r.deadline, r.wake
+		if wake == nil {
+			wake = make(chan struct{})
+			r.wake = wake
+		}
+		r.mu.Unlock()
+
+		var expired <-chan time.Time
+		if !deadline.IsZero() {
+			d := deadline.Sub(r.clock.Now())
+			if d <= 0 {
+				return os.ErrDeadlineExceeded
+			}
+			expired = r.clock.After(d)
+		}
+		select {
+		case <-resuming:
+			return nil
+		case <-expired:
+			return os.ErrDeadlineExceeded
+		case <-wake:
+		}
+	}
+}
+
+func (r *resumingReader) SetReadDeadline(t time.Time) error {
+	r.mu.Lock()
+	r.deadline = t
+	cur := r.cur
+	if r.wake != nil {
+		close(r.wake)
+		r.wake = nil
+	}
+	r.mu.Unlock()
+	return setReadDeadline(cur, t)
+}
+
+func (r *resumingReader) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	cur := r.cur
+	r.mu.Unlock()
+	return cur.Close()
+}
@@ -0,0 +1,78 @@
+package stream
+
+import (
+	"context"
+	"log/slog"
+)
+
+// defaultRetryAttempts is the attempts Retry makes when the APIClient has
+// no RetryPolicy.
+const defaultRetryAttempts = 3
+
+// IsRetryable reports whether err is worth retrying: a network error or an
+// HTTP 429 or 5xx response. API errors and risk control rejections are
+// not; see IsRiskControl.
+func IsRetryable(err error) bool {
+	return err != nil && isTransientAPIError(err) && !isRiskControl(err)
+}
+
+// IsRiskControl reports whether err is a risk control (风控) rejection: API
+// code -352 or -412, or HTTP 412. Bilibili ties these to the credential
+// and IP that made the request; repeating it only prolongs the ban.
+func IsRiskControl(err error) bool {
+	return err != nil && isRiskControl(err)
+}
+
+type noRetryKey struct{}
+
+// Retry calls fn until it succeeds or fails with an error that is not
+// IsRetryable, with the RetryPolicy of the APIClient attached to ctx (or
+// the default client). If that client does not retry, 3 attempts with the
+// default backoff are made. It lets callers' own sequences of API calls
+// behave like the library's requests.
+//
+// API requests fn makes with the ctx it is passed use the same client and
+// are paced by its Limiter, but are not retried one by one, so retries do
+// not multiply. Retry returns fn's last error.
+func Retry(ctx context.Context, fn func(ctx context.Context) error) error {
+	return apiClientFrom(ctx).Retry(ctx, fn)
+}
+
+// RetryValue is Retry for calls that return a value.
+func RetryValue[T any](ctx context.Context, fn func(ctx context.Context) (T, error)) (T, error) {
+	var v T
+	err := Retry(ctx, func(ctx context.Context) error {
+		var err error
+		v, err = fn(ctx)
+		return err
+	})
+	return v, err
+}
+
+// Retry is Retry using c.
+func (c *APIClient) Retry(ctx context.Context, fn func(ctx context.Context) error) error {
+	policy := c.cfg.retry
+	if policy.MaxAttempts <= 1 {
+		policy.MaxAttempts = defaultRetryAttempts
+	}
+	inner := context.WithValue(c.Context(ctx), noRetryKey{}, true)
+	for attempt := 1; ; attempt++ {
+		err := fn(inner)
+		if err == nil || attempt >= policy.MaxAttempts || !IsRetryable(err) || ctx.Err() != nil {
+			return err
+		}
+		delay := policy.delay(attempt)
+		slog.Debug("api: call failed, retrying", "attempt", attempt, "delay", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-c.cfg.clock.After(delay):
+		}
+	}
+}
+
+// retrying reports whether requests made with ctx may be retried by the
+// client, i.e. are not inside Retry.
+func retrying(ctx context.Context) bool {
+	return ctx.Value(noRetryKey{}) == nil
+}
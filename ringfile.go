@@ -0,0 +1,113 @@
+package stream
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Ring file layout: a fixed header followed by the circular data region.
+//
+//	[0:8]   magic "BSRING1\x00"
+//	[8:16]  data capacity in bytes
+//	[16:24] write offset within the data region
+//	[24:32] total bytes ever written
+const (
+	ringMagic      = "BSRING1\x00"
+	ringHeaderSize = 32
+)
+
+var (
+	// ErrNotRingFile is returned by SalvageRingFile for files that were not
+	// written by RingFile.
+	ErrNotRingFile = errors.New("ring file: bad header")
+
+	// ErrRingFileUnsupported is returned by NewRingFile on platforms without
+	// memory mapping support. SalvageRingFile works everywhere.
+	ErrRingFileUnsupported = errors.New("ring file: not supported on this platform")
+)
+
+// Tee returns a ReadCloser that passes through r while writing everything
+// read into the ring. Closing it closes r but not the ring.
+func (rf *RingFile) Tee(r io.ReadCloser) io.ReadCloser {
+	return &ringTee{ReadCloser: r, ring: rf}
+}
+
+type ringTee struct {
+	io.ReadCloser
+	ring *RingFile
+}
+
+func (t *ringTee) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		t.ring.Write(p[:n])
+	}
+	return n, err
+}
+
+// ringHeader is the decoded ring file header.
+type ringHeader struct {
+	capacity uint64
+	head     uint64
+	written  uint64
+}
+
+func decodeRingHeader(b []byte) (ringHeader, error) {
+	if len(b) < ringHeaderSize || string(b[:8]) != ringMagic {
+		return ringHeader{}, ErrNotRingFile
+	}
+	h := ringHeader{
+		capacity: binary.LittleEndian.Uint64(b[8:]),
+		head:     binary.LittleEndian.Uint64(b[16:]),
+		written:  binary.LittleEndian.Uint64(b[24:]),
+	}
+	if h.capacity == 0 || h.head >= h.capacity {
+		return ringHeader{}, ErrNotRingFile
+	}
+	return h, nil
+}
+
+func encodeRingHeader(b []byte, h ringHeader) {
+	copy(b, ringMagic)
+	binary.LittleEndian.PutUint64(b[8:], h.capacity)
+	binary.LittleEndian.PutUint64(b[16:], h.head)
+	binary.LittleEndian.PutUint64(b[24:], h.written)
+}
+
+// SalvageRingFile copies the data retained in the ring file at path to w,
+// oldest byte first, and returns the number of bytes copied. Use it on
+// restart to turn the ring left behind by a crashed process into a normal
+// recording. It does not need memory mapping and works on every platform.
+func SalvageRingFile(path string, w io.Writer) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("ring file: %w", err)
+	}
+	defer f.Close()
+
+	hdr := make([]byte, ringHeaderSize)
+	if _, err := io.ReadFull(f, hdr); err != nil {
+		return 0, ErrNotRingFile
+	}
+	h, err := decodeRingHeader(hdr)
+	if err != nil {
+		return 0, err
+	}
+
+	data := io.NewSectionReader(f, ringHeaderSize, int64(h.capacity))
+	var parts []io.Reader
+	if h.written >= h.capacity {
+		// Wrapped: the oldest data starts at the write offset.
+		parts = append(parts, io.NewSectionReader(data, int64(h.head), int64(h.capacity-h.head)))
+	}
+	parts = append(parts, io.NewSectionReader(data, 0, int64(h.head)))
+
+	n, err := io.Copy(w, io.MultiReader(parts...))
+	if err != nil {
+		return n, fmt.Errorf("ring file: salvage: %w", err)
+	}
+	return n, nil
+}
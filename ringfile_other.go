@@ -0,0 +1,23 @@
+//go:build !unix
+
+package stream
+
+import "os"
+
+// RingFile is a fixed-size circular buffer backed by a memory-mapped file.
+// It is only available on unix platforms.
+type RingFile struct{}
+
+// NewRingFile returns ErrRingFileUnsupported on this platform.
+func NewRingFile(path string, size int64) (*RingFile, error) {
+	return nil, ErrRingFileUnsupported
+}
+
+// Write always fails on this platform.
+func (rf *RingFile) Write(p []byte) (int, error) { return 0, os.ErrClosed }
+
+// Sync always fails on this platform.
+func (rf *RingFile) Sync() error { return os.ErrClosed }
+
+// Close is a no-op on this platform.
+func (rf *RingFile) Close() error { return nil }
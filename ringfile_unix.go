@@ -0,0 +1,113 @@
+//go:build unix
+
+package stream
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// RingFile is a fixed-size circular buffer backed by a memory-mapped file.
+// Writes go straight to the page cache instead of the Go heap, and because
+// the mapping is shared with the file, the most recent data survives a
+// process crash and can be recovered with SalvageRingFile. Call Sync to
+// also survive an OS crash or power loss up to that point.
+//
+// RingFile is standalone: DVR does not use it. The DVR's segment files
+// already live on disk rather than in the heap, and survive a crash as
+// they are; a RingFile bounds the disk used instead, and keeps no time
+// index.
+type RingFile struct {
+	mu   sync.Mutex
+	f    *os.File
+	mem  []byte // header followed by the data region
+	hdr  ringHeader
+	data []byte
+}
+
+// NewRingFile creates (or truncates) the ring file at path holding the
+// most recent size bytes written to it.
+func NewRingFile(path string, size int64) (*RingFile, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("ring file: invalid size %d", size)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("ring file: %w", err)
+	}
+	total := ringHeaderSize + size
+	if err := f.Truncate(total); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("ring file: allocate: %w", err)
+	}
+	mem, err := syscall.Mmap(int(f.Fd()), 0, int(total), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("ring file: mmap: %w", err)
+	}
+
+	rf := &RingFile{
+		f:    f,
+		mem:  mem,
+		hdr:  ringHeader{capacity: uint64(size)},
+		data: mem[ringHeaderSize:],
+	}
+	encodeRingHeader(rf.mem, rf.hdr)
+	return rf, nil
+}
+
+// Write appends p to the ring, overwriting the oldest data once full.
+// It never fails while the ring is open.
+func (rf *RingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.mem == nil {
+		return 0, os.ErrClosed
+	}
+
+	n := len(p)
+	if uint64(n) > rf.hdr.capacity {
+		// Only the tail fits; keep the stream position consistent.
+		skip := uint64(n) - rf.hdr.capacity
+		rf.hdr.head = (rf.hdr.head + skip) % rf.hdr.capacity
+		rf.hdr.written += skip
+		p = p[skip:]
+	}
+	for len(p) > 0 {
+		c := copy(rf.data[rf.hdr.head:], p)
+		p = p[c:]
+		rf.hdr.head = (rf.hdr.head + uint64(c)) % rf.hdr.capacity
+		rf.hdr.written += uint64(c)
+	}
+	// The header is updated after the data, so a crash mid-write loses at
+	// most the bytes of this call.
+	encodeRingHeader(rf.mem, rf.hdr)
+	return n, nil
+}
+
+// Sync flushes the mapped pages to stable storage.
+func (rf *RingFile) Sync() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.mem == nil {
+		return os.ErrClosed
+	}
+	return rf.f.Sync()
+}
+
+// Close unmaps and closes the file. The file is left on disk.
+func (rf *RingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.mem == nil {
+		return nil
+	}
+	err := syscall.Munmap(rf.mem)
+	rf.mem, rf.data = nil, nil
+	if closeErr := rf.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
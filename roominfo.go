@@ -0,0 +1,113 @@
+package stream
+
+import (
+	"slices"
+	"time"
+)
+
+// Room info fields tracked for RoomInfoChange.Fields.
+const (
+	RoomInfoTitle  = "title"
+	RoomInfoArea   = "area"
+	RoomInfoCover  = "cover"
+	RoomInfoOnline = "online"
+)
+
+// EventRoomInfoChanged reports room metadata that changed between two
+// polls (StreamEvent.RoomInfo); see WithRoomInfoEvents.
+const EventRoomInfoChanged = "room_info_changed"
+
+// RoomInfoFields are the room info fields compared between polls.
+type RoomInfoFields struct {
+	Title          string `json:"title"`
+	AreaID         int    `json:"area_id"`
+	AreaName       string `json:"area_name"`
+	ParentAreaID   int    `json:"parent_area_id"`
+	ParentAreaName string `json:"parent_area_name"`
+	Cover          string `json:"cover"`
+	Online         int64  `json:"online"`
+}
+
+func roomInfoFields(info *RoomInfo) RoomInfoFields {
+	return RoomInfoFields{
+		Title:          info.Title,
+		AreaID:         info.AreaID,
+		AreaName:       info.AreaName,
+		ParentAreaID:   info.ParentAreaID,
+		ParentAreaName: info.ParentAreaName,
+		Cover:          info.Cover,
+		Online:         info.Online,
+	}
+}
+
+// RoomInfoChange is a field-level diff of a room's info between two polls.
+// Old and New hold every tracked field; Fields names those that differ.
+type RoomInfoChange struct {
+	RoomID int64          `json:"room_id"`
+	Fields []string       `json:"fields"` // RoomInfoTitle, RoomInfoArea, RoomInfoCover, RoomInfoOnline
+	Old    RoomInfoFields `json:"old"`
+	New    RoomInfoFields `json:"new"`
+	At     time.Time      `json:"at"`
+}
+
+// Changed reports whether field is among c.Fields.
+func (c RoomInfoChange) Changed(field string) bool {
+	return slices.Contains(c.Fields, field)
+}
+
+// WithRoomInfoChanges registers fn to be called when a poll finds a
+// room's title, area, cover or online count changed since the previous
+// one. fields limits the comparison to the given RoomInfo* fields; none
+// means all. The first poll of a room is its baseline and is not
+// reported. fn runs on the polling goroutine and must not block.
+func WithRoomInfoChanges(fn func(RoomInfoChange), fields ...string) MonitorOption {
+	return func(c *monitorConfig) {
+		c.onInfoChange = fn
+		c.infoFields = fields
+	}
+}
+
+// diffRoomInfo returns the tracked fields that differ between old and new.
+func diffRoomInfo(old, new RoomInfoFields, tracked []string) []string {
+	var fields []string
+	check := func(field string, changed bool) {
+		if changed && (len(tracked) == 0 || slices.Contains(tracked, field)) {
+			fields = append(fields, field)
+		}
+	}
+	check(RoomInfoTitle, old.Title != new.Title)
+	check(RoomInfoArea, old.AreaID != new.AreaID || old.ParentAreaID != new.ParentAreaID)
+	check(RoomInfoCover, old.Cover != new.Cover)
+	check(RoomInfoOnline, old.Online != new.Online)
+	return fields
+}
+
+// observeRoomInfo records the fields of a polled room info and reports
+// the change from the previous poll, if any (WithRoomInfoChanges).
+func (m *Monitor) observeRoomInfo(roomID int64, info *RoomInfo) {
+	if m.cfg.onInfoChange == nil {
+		return
+	}
+	now := roomInfoFields(info)
+	m.mu.Lock()
+	old, seen := m.infos[roomID]
+	if _, watched := m.rooms[roomID]; watched {
+		m.infos[roomID] = now
+	}
+	m.mu.Unlock()
+	if !seen {
+		return
+	}
+	fields := diffRoomInfo(old, now, m.cfg.infoFields)
+	if len(fields) == 0 {
+		return
+	}
+	m.roomLogger(roomID).Debug("monitor: room info changed", "fields", fields)
+	m.cfg.onInfoChange(RoomInfoChange{
+		RoomID: roomID,
+		Fields: fields,
+		Old:    old,
+		New:    now,
+		At:     m.cfg.clock.Now(),
+	})
+}
@@ -0,0 +1,233 @@
+package stream
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+const defaultRouterQueueSize = 64
+
+// routerConfig holds internal configuration for Router.
+type routerConfig struct {
+	byUID     bool
+	queueSize int
+	sessions  bool
+}
+
+// RouterOption configures a Router.
+type RouterOption func(*routerConfig)
+
+// WithRouteByUID keys routes by streamer UID (StreamEvent.UID) instead of
+// room ID. Events whose UID is not yet known go to the Default handler.
+func WithRouteByUID() RouterOption {
+	return func(c *routerConfig) {
+		c.byUID = true
+	}
+}
+
+// WithRouterQueueSize sets how many events may wait for a key's handler
+// before new ones are dropped. Default is 64.
+func WithRouterQueueSize(n int) RouterOption {
+	return func(c *routerConfig) {
+		c.queueSize = n
+	}
+}
+
+// WithRouterSessions ends a key's route after its "offline" event, so the
+// route's handler returns and the next event of the key starts a new one.
+// Handlers then see exactly one live session each.
+func WithRouterSessions() RouterOption {
+	return func(c *routerConfig) {
+		c.sessions = true
+	}
+}
+
+// RouterStats counts the events handled by a Router.
+type RouterStats struct {
+	Routed  uint64 // events queued for a handler
+	Dropped uint64 // events dropped because a handler's queue was full or nothing handled them
+	Active  int    // routes currently running
+}
+
+// Router demultiplexes a StreamEvent channel, such as the one returned by
+// StreamClient.Subscribe, into one ordered stream per room or, with
+// WithRouteByUID, per streamer. Each key gets its own goroutine and
+// bounded queue, so a slow room does not hold up the others.
+//
+// A key's events go to the callback registered with Handle, or else to a
+// handler started with the key's event channel by HandleRooms. The route
+// ends, closing the channel and waiting for the handler, when Run returns
+// or, with WithRouterSessions, after the key's "offline" event.
+//
+// Events that cannot be delivered are dropped; a dropped "audio_ready" or
+// "video_ready" has its capture cancelled and closed so ffmpeg does not
+// keep running unread.
+type Router struct {
+	cfg routerConfig
+
+	mu       sync.Mutex
+	handlers map[int64]func(StreamEvent)
+	rooms    func(key int64, events <-chan StreamEvent)
+	fallback func(StreamEvent)
+	routes   map[int64]chan StreamEvent
+
+	wg      sync.WaitGroup
+	routed  atomic.Uint64
+	dropped atomic.Uint64
+}
+
+// NewRouter creates a Router with the given options.
+func NewRouter(opts ...RouterOption) *Router {
+	cfg := routerConfig{queueSize: defaultRouterQueueSize}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	if cfg.queueSize < 1 {
+		cfg.queueSize = 1
+	}
+	return &Router{
+		cfg:      cfg,
+		handlers: make(map[int64]func(StreamEvent)),
+		routes:   make(map[int64]chan StreamEvent),
+	}
+}
+
+// Handle calls fn with every event of key, one at a time and in order. It
+// takes precedence over HandleRooms for key and applies to routes started
+// after it is called. A nil fn removes the callback.
+func (r *Router) Handle(key int64, fn func(StreamEvent)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if fn == nil {
+		delete(r.handlers, key)
+		return
+	}
+	r.handlers[key] = fn
+}
+
+// HandleRooms starts fn in its own goroutine for every key without a
+// Handle callback when the key's first event arrives. fn must read events
+// until it is closed.
+func (r *Router) HandleRooms(fn func(key int64, events <-chan StreamEvent)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rooms = fn
+}
+
+// Default calls fn, on Run's goroutine, with events that have no key (a
+// zero UID with WithRouteByUID) or no handler. fn must not block.
+func (r *Router) Default(fn func(StreamEvent)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fallback = fn
+}
+
+// Run routes events until events is closed or ctx is done, then ends all
+// routes and waits for their handlers to return.
+func (r *Router) Run(ctx context.Context, events <-chan StreamEvent) {
+	defer r.closeAll()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			r.route(ev)
+		}
+	}
+}
+
+// Stats returns the router's counters.
+func (r *Router) Stats() RouterStats {
+	r.mu.Lock()
+	active := len(r.routes)
+	r.mu.Unlock()
+	return RouterStats{Routed: r.routed.Load(), Dropped: r.dropped.Load(), Active: active}
+}
+
+// key returns the routing key of ev; 0 if it has none.
+func (r *Router) key(ev StreamEvent) int64 {
+	if r.cfg.byUID {
+		return ev.UID
+	}
+	return ev.RoomID
+}
+
+// route delivers ev to its key's route, starting the route if needed.
+func (r *Router) route(ev StreamEvent) {
+	key := r.key(ev)
+	r.mu.Lock()
+	ch, ok := r.routes[key]
+	if !ok && key != 0 {
+		ch = r.startLocked(key)
+	}
+	fallback := r.fallback
+	r.mu.Unlock()
+
+	if ch == nil {
+		if fallback != nil {
+			fallback(ev)
+			return
+		}
+		r.drop(ev)
+		return
+	}
+	select {
+	case ch <- ev:
+		r.routed.Add(1)
+	default:
+		slog.Warn("router: queue full, dropping event", "key", key, "type", ev.Type, "room_id", ev.RoomID)
+		r.drop(ev)
+	}
+	if r.cfg.sessions && ev.Type == EventOffline {
+		r.mu.Lock()
+		delete(r.routes, key)
+		r.mu.Unlock()
+		close(ch)
+	}
+}
+
+// startLocked starts the route of key and returns its channel, or nil if
+// nothing handles key. r.mu must be held.
+func (r *Router) startLocked(key int64) chan StreamEvent {
+	fn, rooms := r.handlers[key], r.rooms
+	if fn == nil && rooms == nil {
+		return nil
+	}
+	ch := make(chan StreamEvent, r.cfg.queueSize)
+	r.routes[key] = ch
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		if fn == nil {
+			rooms(key, ch)
+			return
+		}
+		for ev := range ch {
+			fn(ev)
+		}
+	}()
+	return ch
+}
+
+// drop counts ev as dropped and releases any capture it carries.
+func (r *Router) drop(ev StreamEvent) {
+	r.dropped.Add(1)
+	releaseStreams(ev)
+}
+
+// closeAll ends every route and waits for the handlers.
+func (r *Router) closeAll() {
+	r.mu.Lock()
+	routes := r.routes
+	r.routes = make(map[int64]chan StreamEvent)
+	r.mu.Unlock()
+	for _, ch := range routes {
+		close(ch)
+	}
+	r.wg.Wait()
+}
@@ -0,0 +1,201 @@
+package stream
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// pollTask is one recurring check of a room in a pollScheduler.
+type pollTask struct {
+	ctx    context.Context // the room's context; the task ends when it is done
+	roomID int64
+	feed   bool // checkFeed rather than checkRoom
+	at     time.Time
+	index  int // position in the heap
+}
+
+// pollQueue is a min-heap of tasks ordered by due time.
+type pollQueue []*pollTask
+
+func (q pollQueue) Len() int           { return len(q) }
+func (q pollQueue) Less(i, j int) bool { return q[i].at.Before(q[j].at) }
+func (q pollQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index, q[j].index = i, j
+}
+func (q *pollQueue) Push(x any) {
+	t := x.(*pollTask)
+	t.index = len(*q)
+	*q = append(*q, t)
+}
+func (q *pollQueue) Pop() any {
+	old := *q
+	t := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return t
+}
+
+// pollScheduler polls rooms from a fixed number of workers instead of one
+// goroutine per room (WithPollWorkers). Tasks wait in a queue ordered by
+// their next check time; a dispatcher hands due tasks to idle workers, so
+// at most workers requests are in flight and a backlog (e.g. all rooms
+// being due right after start) is worked off at the pace the API answers.
+type pollScheduler struct {
+	m       *Monitor
+	workers int
+
+	mu      sync.Mutex
+	queue   pollQueue
+	running bool
+	wake    chan struct{} // signals the dispatcher that the queue head changed
+}
+
+func newPollScheduler(m *Monitor, workers int) *pollScheduler {
+	return &pollScheduler{m: m, workers: workers, wake: make(chan struct{}, 1)}
+}
+
+// start runs the dispatcher and workers until ctx is done, unless they are
+// already running.
+func (s *pollScheduler) start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return
+	}
+	s.running = true
+	go s.run(ctx)
+}
+
+// add schedules the room's checks, the first one immediately. They stop
+// when ctx is done.
+func (s *pollScheduler) add(ctx context.Context, roomID int64) {
+	now := s.m.cfg.clock.Now()
+	s.push(&pollTask{ctx: ctx, roomID: roomID, at: now})
+	if s.m.cfg.feedInterval > 0 {
+		s.push(&pollTask{ctx: ctx, roomID: roomID, feed: true, at: now.Add(s.m.cfg.feedInterval)})
+	}
+}
+
+func (s *pollScheduler) push(t *pollTask) {
+	s.mu.Lock()
+	heap.Push(&s.queue, t)
+	head := t.index == 0
+	s.mu.Unlock()
+	if head {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// expedite moves the room's next status check to now, unless it is
+// running.
+func (s *pollScheduler) expedite(roomID int64) {
+	now := s.m.cfg.clock.Now()
+	s.mu.Lock()
+	head := false
+	for _, t := range s.queue {
+		if t.roomID == roomID && !t.feed && t.ctx.Err() == nil && t.at.After(now) {
+			t.at = now
+			heap.Fix(&s.queue, t.index)
+			head = t.index == 0
+			break
+		}
+	}
+	s.mu.Unlock()
+	if head {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// next removes and returns the first due task, or returns how long until
+// one is due (negative if the queue is empty).
+func (s *pollScheduler) next(now time.Time) (*pollTask, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.queue) > 0 {
+		t := s.queue[0]
+		if t.ctx.Err() != nil {
+			// Removed room; drop its tasks.
+			heap.Pop(&s.queue)
+			continue
+		}
+		if wait := t.at.Sub(now); wait > 0 {
+			return nil, wait
+		}
+		return heap.Pop(&s.queue).(*pollTask), 0
+	}
+	return nil, -1
+}
+
+func (s *pollScheduler) run(ctx context.Context) {
+	defer func() {
+		s.mu.Lock()
+		s.running = false
+		s.mu.Unlock()
+	}()
+
+	jobs := make(chan *pollTask)
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range jobs {
+				s.runTask(t)
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(jobs)
+
+	for {
+		t, wait := s.next(s.m.cfg.clock.Now())
+		if t != nil {
+			// Blocks while every worker is busy.
+			select {
+			case jobs <- t:
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+		var timer <-chan time.Time
+		if wait > 0 {
+			timer = s.m.cfg.clock.After(wait)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer:
+		case <-s.wake:
+		}
+	}
+}
+
+// runTask performs one check and queues the task's next run.
+func (s *pollScheduler) runTask(t *pollTask) {
+	defer s.m.recoverRoom(t.roomID)
+	var d time.Duration
+	if t.feed {
+		s.m.checkFeed(t.ctx, t.roomID)
+		d = s.m.cfg.feedInterval
+	} else {
+		if !s.m.pushActive(t.roomID) && !s.m.batchCovers(t.roomID) {
+			s.m.checkRoom(t.ctx, t.roomID)
+		}
+		d = s.m.pollInterval(t.roomID)
+	}
+	if t.ctx.Err() != nil {
+		return
+	}
+	t.at = s.m.cfg.clock.Now().Add(d)
+	s.push(t)
+}
@@ -0,0 +1,109 @@
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// NewServer returns an HTTP handler that lets external systems (schedulers,
+// webhooks) command c beyond automatic live detection:
+//
+//	POST /rooms/{id}/capture/start  start capture for a room now
+//	POST /rooms/{id}/capture/stop   stop the room's active capture
+//	GET  /rooms/{id}/prefs          the room's RoomPrefs
+//	PUT  /rooms/{id}/prefs          replace the room's RoomPrefs (WithPrefStore)
+//
+// Responses are JSON. Mount the handler on any server or mux; it performs no
+// authentication of its own.
+func NewServer(c *StreamClient) http.Handler {
+	s := &server{client: c}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /rooms/{id}/capture/start", s.handleCaptureStart)
+	mux.HandleFunc("POST /rooms/{id}/capture/stop", s.handleCaptureStop)
+	mux.HandleFunc("GET /rooms/{id}/prefs", s.handleGetPrefs)
+	mux.HandleFunc("PUT /rooms/{id}/prefs", s.handlePutPrefs)
+	return mux
+}
+
+type server struct {
+	client *StreamClient
+}
+
+func (s *server) handleCaptureStart(w http.ResponseWriter, r *http.Request) {
+	roomID, ok := roomIDParam(w, r)
+	if !ok {
+		return
+	}
+	if err := s.client.StartCapture(roomID); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrNotSubscribed) {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSONError(w, status, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]any{"room_id": roomID, "capture": "starting"})
+}
+
+func (s *server) handleCaptureStop(w http.ResponseWriter, r *http.Request) {
+	roomID, ok := roomIDParam(w, r)
+	if !ok {
+		return
+	}
+	s.client.StopCapture(roomID)
+	writeJSON(w, http.StatusOK, map[string]any{"room_id": roomID, "capture": "stopped"})
+}
+
+func (s *server) handleGetPrefs(w http.ResponseWriter, r *http.Request) {
+	roomID, ok := roomIDParam(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.client.RoomPrefs(roomID))
+}
+
+func (s *server) handlePutPrefs(w http.ResponseWriter, r *http.Request) {
+	roomID, ok := roomIDParam(w, r)
+	if !ok {
+		return
+	}
+	var prefs RoomPrefs
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&prefs); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid prefs: "+err.Error())
+		return
+	}
+	if err := s.client.SetRoomPrefs(roomID, prefs); err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, ErrNoPrefStore):
+			status = http.StatusServiceUnavailable
+		case !errors.Is(err, errInvalidPrefs):
+			status = http.StatusInternalServerError
+		}
+		writeJSONError(w, status, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, prefs)
+}
+
+// roomIDParam parses the {id} path value, writing a 400 response if invalid.
+func roomIDParam(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeJSONError(w, http.StatusBadRequest, "invalid room id")
+		return 0, false
+	}
+	return id, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
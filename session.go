@@ -0,0 +1,104 @@
+package stream
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// liveSession accumulates statistics for a single live session of a room,
+// from the live transition until the room goes offline.
+type liveSession struct {
+	startedAt time.Time
+	title     string // room title at the live transition
+	bytes     atomic.Int64
+	restarts  atomic.Int32
+	quality   atomic.Int32 // fallback quality last reported (EventQualityFallback), 0 if none
+
+	latency   *GoLiveLatency // from the live event; nil if not measured
+	audioSeen atomic.Bool    // the session's first audio_ready was published
+
+	workMu  sync.Mutex
+	workDir string // session directory from WithWorkDir, created on first capture
+}
+
+func newLiveSession(now time.Time) *liveSession {
+	return &liveSession{startedAt: now}
+}
+
+// summary builds the SessionSummary for a session ending at now.
+func (s *liveSession) summary(cfg CaptureConfig, now time.Time) *SessionSummary {
+	bytes := s.bytes.Load()
+	return &SessionSummary{
+		StartedAt:       s.startedAt,
+		EndedAt:         now,
+		Duration:        now.Sub(s.startedAt),
+		AudioBytes:      bytes,
+		AudioDuration:   pcmDuration(bytes, cfg),
+		CaptureRestarts: int(s.restarts.Load()),
+	}
+}
+
+// countingReader counts bytes read through it into the owning session,
+// and calls ended once the capture's audio ends or the reader is closed.
+type countingReader struct {
+	io.ReadCloser
+	session *liveSession
+	sync    *ChatSync // nil for ADTS
+	clock   Clock
+	ended   func()
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.session.bytes.Add(int64(n))
+	r.sync.observe(r.clock.Now(), n)
+	if err != nil && !errors.Is(err, os.ErrDeadlineExceeded) && r.ended != nil {
+		r.ended()
+	}
+	return n, err
+}
+
+func (r *countingReader) Close() error {
+	err := r.ReadCloser.Close()
+	if r.ended != nil {
+		r.ended()
+	}
+	return err
+}
+
+func (r *countingReader) SetReadDeadline(t time.Time) error {
+	return setReadDeadline(r.ReadCloser, t)
+}
+
+// pcmDuration converts a raw PCM byte count into playback duration.
+// Returns 0 if the format is not a known PCM sample format.
+func pcmDuration(bytes int64, cfg CaptureConfig) time.Duration {
+	bps := sampleSize(cfg.Format)
+	if bps == 0 || cfg.SampleRate <= 0 || cfg.Channels <= 0 {
+		return 0
+	}
+	frames := bytes / int64(bps*cfg.Channels)
+	return time.Duration(float64(frames) / float64(cfg.SampleRate) * float64(time.Second))
+}
+
+// sampleSize returns the size in bytes of one sample for an ffmpeg raw
+// PCM format name, or 0 if the format is unknown.
+func sampleSize(format string) int {
+	switch format {
+	case "u8", "s8":
+		return 1
+	case "s16le", "s16be", "u16le", "u16be":
+		return 2
+	case "s24le", "s24be", "u24le", "u24be":
+		return 3
+	case "s32le", "s32be", "u32le", "u32be", "f32le", "f32be":
+		return 4
+	case "f64le", "f64be":
+		return 8
+	}
+	return 0
+}
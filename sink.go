@@ -0,0 +1,390 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultSinkQueueSize        = 256
+	defaultSinkMaxAttempts      = 3
+	defaultSinkBackoff          = time.Second
+	maxSinkBackoff              = 30 * time.Second
+	defaultSinkBreakerThreshold = 5
+	defaultSinkBreakerCooldown  = 30 * time.Second
+)
+
+// EventSink receives StreamEvents from a SinkManager. Handle returns an
+// error to have the event retried.
+type EventSink interface {
+	Handle(ctx context.Context, ev StreamEvent) error
+}
+
+// EventSinkFunc adapts a function to an EventSink.
+type EventSinkFunc func(ctx context.Context, ev StreamEvent) error
+
+// Handle calls f.
+func (f EventSinkFunc) Handle(ctx context.Context, ev StreamEvent) error {
+	return f(ctx, ev)
+}
+
+// ChannelSink delivers events to ch, waiting while it is full.
+func ChannelSink(ch chan<- StreamEvent) EventSink {
+	return EventSinkFunc(func(ctx context.Context, ev StreamEvent) error {
+		select {
+		case ch <- ev:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// WriterSink writes each event to w as a line of JSON (see
+// StreamEvent.MarshalJSON), e.g. to append to a file.
+func WriterSink(w io.Writer) EventSink {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	return EventSinkFunc(func(ctx context.Context, ev StreamEvent) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return enc.Encode(ev)
+	})
+}
+
+// WebhookSink POSTs each event as JSON to url. Responses other than 2xx
+// are errors, so the event is retried.
+func WebhookSink(url string) EventSink {
+	return EventSinkFunc(func(ctx context.Context, ev StreamEvent) error {
+		body, err := json.Marshal(ev)
+		if err != nil {
+			return fmt.Errorf("webhook: encode event: %w", err)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("webhook: create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("webhook: %w", err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("webhook: http status %d", resp.StatusCode)
+		}
+		return nil
+	})
+}
+
+// sinkConfig holds internal configuration for one sink of a SinkManager.
+type sinkConfig struct {
+	queueSize        int
+	maxAttempts      int
+	backoff          time.Duration
+	breakerThreshold int
+	breakerCooldown  time.Duration
+	filter           *EventFilter
+	skipMuted        bool
+	redactor         *Redactor
+	clock            Clock
+}
+
+// SinkOption configures a sink added to a SinkManager.
+type SinkOption func(*sinkConfig)
+
+// WithSinkQueueSize sets how many events may wait for the sink before new
+// ones are dropped. Default is 256.
+func WithSinkQueueSize(n int) SinkOption {
+	return func(c *sinkConfig) {
+		c.queueSize = n
+	}
+}
+
+// WithSinkRetries sets how often an event is attempted before it is given
+// up, and the backoff before the first retry (doubling, up to 30 seconds).
+// Default is 3 attempts with a 1 second backoff.
+func WithSinkRetries(maxAttempts int, backoff time.Duration) SinkOption {
+	return func(c *sinkConfig) {
+		c.maxAttempts = maxAttempts
+		c.backoff = backoff
+	}
+}
+
+// WithSinkBreaker opens the sink's circuit breaker after threshold events
+// in a row failed all their attempts. While open, events for the sink are
+// dropped without calling it; after cooldown one event is let through, and
+// its success closes the breaker again. Default is 5 failures and 30
+// seconds.
+func WithSinkBreaker(threshold int, cooldown time.Duration) SinkOption {
+	return func(c *sinkConfig) {
+		c.breakerThreshold = threshold
+		c.breakerCooldown = cooldown
+	}
+}
+
+// WithSinkFilter delivers only events matching f to the sink.
+func WithSinkFilter(f *EventFilter) SinkOption {
+	return func(c *sinkConfig) {
+		c.filter = f
+	}
+}
+
+// WithSinkSkipMuted keeps events raised during a room's quiet hours
+// (StreamEvent.Muted, see WithMuteWindows) from the sink, e.g. for alert
+// channels that should not fire at night.
+func WithSinkSkipMuted() SinkOption {
+	return func(c *sinkConfig) {
+		c.skipMuted = true
+	}
+}
+
+// WithSinkRedactor scrubs the user-written text of events (see
+// Redactor.RedactEvent) before the sink sees them, e.g. for webhooks
+// leaving a content-policy boundary.
+func WithSinkRedactor(r *Redactor) SinkOption {
+	return func(c *sinkConfig) {
+		c.redactor = r
+	}
+}
+
+// WithSinkClock sets the clock timing the sink's retry backoff and breaker
+// cooldown. Default is SystemClock().
+func WithSinkClock(clock Clock) SinkOption {
+	return func(c *sinkConfig) {
+		c.clock = clock
+	}
+}
+
+// SinkStats counts the events handled by one sink.
+type SinkStats struct {
+	Delivered   uint64 // events the sink accepted
+	Failed      uint64 // events given up after all attempts
+	Dropped     uint64 // events dropped because the queue was full or the breaker open
+	Queued      int    // events waiting for the sink
+	BreakerOpen bool
+}
+
+// managedSink is one sink of a SinkManager with its queue and worker.
+type managedSink struct {
+	name  string
+	sink  EventSink
+	cfg   sinkConfig
+	queue chan StreamEvent
+
+	delivered atomic.Uint64
+	failed    atomic.Uint64
+	dropped   atomic.Uint64
+
+	failures  int       // consecutive failed events; worker only
+	openUntil time.Time // breaker open until; worker only
+	open      atomic.Bool
+}
+
+// SinkManager fans StreamEvents out to a set of EventSinks. Each sink has
+// its own bounded queue and worker, so a slow or failing sink never delays
+// the others: failed events are retried with backoff, a sink that keeps
+// failing is cut off by a circuit breaker, and events that do not fit in a
+// queue are dropped and counted.
+type SinkManager struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	sinks  []*managedSink
+	closed bool
+}
+
+// NewSinkManager creates an empty SinkManager.
+func NewSinkManager() *SinkManager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &SinkManager{ctx: ctx, cancel: cancel}
+}
+
+// Add registers sink under name and starts delivering published events to
+// it. Names label log lines and Stats.
+func (m *SinkManager) Add(name string, sink EventSink, opts ...SinkOption) {
+	cfg := sinkConfig{
+		queueSize:        defaultSinkQueueSize,
+		maxAttempts:      defaultSinkMaxAttempts,
+		backoff:          defaultSinkBackoff,
+		breakerThreshold: defaultSinkBreakerThreshold,
+		breakerCooldown:  defaultSinkBreakerCooldown,
+		clock:            SystemClock(),
+	}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	cfg.queueSize = max(cfg.queueSize, 1)
+	cfg.maxAttempts = max(cfg.maxAttempts, 1)
+
+	s := &managedSink{name: name, sink: sink, cfg: cfg, queue: make(chan StreamEvent, cfg.queueSize)}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return
+	}
+	m.sinks = append(m.sinks, s)
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.work(s)
+	}()
+}
+
+// Publish queues ev for every sink whose filter it matches. It never
+// blocks.
+func (m *SinkManager) Publish(ev StreamEvent) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return
+	}
+	for _, s := range m.sinks {
+		if s.cfg.filter != nil && !s.cfg.filter.Match(ev) {
+			continue
+		}
+		if s.cfg.skipMuted && ev.Muted {
+			continue
+		}
+		select {
+		case s.queue <- ev:
+		default:
+			if s.dropped.Add(1) == 1 {
+				slog.Warn("sink: queue full, dropping events", "sink", s.name, "type", ev.Type)
+			}
+		}
+	}
+}
+
+// Run publishes every event from events until it is closed or ctx is
+// done, then closes the manager, letting the sinks finish queued events
+// for as long as ctx allows.
+func (m *SinkManager) Run(ctx context.Context, events <-chan StreamEvent) {
+	defer m.Close(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			m.Publish(ev)
+		}
+	}
+}
+
+// Close stops accepting events and waits until the sinks have handled
+// their queued events or ctx is done; then pending deliveries are
+// cancelled. It returns ctx's error if the queues could not be drained.
+func (m *SinkManager) Close(ctx context.Context) error {
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		for _, s := range m.sinks {
+			close(s.queue)
+		}
+	}
+	m.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		m.cancel()
+		return nil
+	case <-ctx.Done():
+		m.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Stats returns the counters of each sink by name.
+func (m *SinkManager) Stats() map[string]SinkStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make(map[string]SinkStats, len(m.sinks))
+	for _, s := range m.sinks {
+		out[s.name] = SinkStats{
+			Delivered:   s.delivered.Load(),
+			Failed:      s.failed.Load(),
+			Dropped:     s.dropped.Load(),
+			Queued:      len(s.queue),
+			BreakerOpen: s.open.Load(),
+		}
+	}
+	return out
+}
+
+// work delivers a sink's queued events until the queue is closed.
+func (m *SinkManager) work(s *managedSink) {
+	for ev := range s.queue {
+		if m.ctx.Err() != nil {
+			s.dropped.Add(1)
+			continue
+		}
+		if s.open.Load() && s.cfg.clock.Now().Before(s.openUntil) {
+			s.dropped.Add(1)
+			continue
+		}
+		if s.cfg.redactor != nil {
+			ev = s.cfg.redactor.RedactEvent(ev)
+		}
+		// Closed, or half-open: this event probes the sink.
+		if m.deliver(s, ev) {
+			s.delivered.Add(1)
+			s.failures = 0
+			if s.open.Swap(false) {
+				slog.Info("sink: recovered, closing breaker", "sink", s.name)
+			}
+			continue
+		}
+		s.failed.Add(1)
+		s.failures++
+		if s.open.Load() || s.failures >= s.cfg.breakerThreshold {
+			s.openUntil = s.cfg.clock.Now().Add(s.cfg.breakerCooldown)
+			if !s.open.Swap(true) {
+				slog.Warn("sink: failing repeatedly, opening breaker",
+					"sink", s.name, "failures", s.failures, "cooldown", s.cfg.breakerCooldown)
+			}
+		}
+	}
+}
+
+// deliver hands ev to the sink, retrying with backoff. It reports whether
+// the sink accepted the event.
+func (m *SinkManager) deliver(s *managedSink, ev StreamEvent) bool {
+	delay := s.cfg.backoff
+	for attempt := 1; ; attempt++ {
+		err := s.sink.Handle(m.ctx, ev)
+		if err == nil {
+			return true
+		}
+		if attempt >= s.cfg.maxAttempts || m.ctx.Err() != nil {
+			slog.Warn("sink: giving up on event", "sink", s.name, "type", ev.Type,
+				"room_id", ev.RoomID, "attempts", attempt, "error", err)
+			return false
+		}
+		select {
+		case <-m.ctx.Done():
+			return false
+		case <-s.cfg.clock.After(delay):
+		}
+		delay = min(delay*2, maxSinkBackoff)
+	}
+}
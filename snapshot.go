@@ -0,0 +1,138 @@
+package stream
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// snapshotRefresh is how often the snapshot is rebuilt without a change
+// notification, to pick up counters such as captured bytes.
+const snapshotRefresh = time.Second
+
+// ClientSnapshot is a read-only view of a StreamClient's state at one
+// point in time. It is never modified after it is published, so it can be
+// read and shared freely.
+type ClientSnapshot struct {
+	At     time.Time      `json:"at"`
+	Paused bool           `json:"paused"` // Pause is in effect
+	Rooms  []RoomSnapshot `json:"rooms"`  // ordered by room ID
+}
+
+// Room returns the snapshot of roomID, if it is watched.
+func (s *ClientSnapshot) Room(roomID int64) (RoomSnapshot, bool) {
+	i := sort.Search(len(s.Rooms), func(i int) bool { return s.Rooms[i].RoomID >= roomID })
+	if i < len(s.Rooms) && s.Rooms[i].RoomID == roomID {
+		return s.Rooms[i], true
+	}
+	return RoomSnapshot{}, false
+}
+
+// RoomSnapshot is one room in a ClientSnapshot.
+type RoomSnapshot struct {
+	RoomID    int64     `json:"room_id"`
+	UID       int64     `json:"uid,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	State     RoomState `json:"state"`
+	Paused    bool      `json:"paused,omitempty"`
+	Muted     bool      `json:"muted,omitempty"`
+	SessionID string    `json:"session_id,omitempty"`
+	Title     string    `json:"title,omitempty"`
+
+	Labels map[string]string `json:"labels,omitempty"` // RoomPrefs.Labels
+
+	Capturing       bool          `json:"capturing"`
+	SessionStarted  time.Time     `json:"session_started"` // zero without a live session
+	AudioBytes      int64         `json:"audio_bytes,omitempty"`
+	AudioDuration   time.Duration `json:"audio_duration,omitempty"`
+	CaptureRestarts int           `json:"capture_restarts,omitempty"`
+}
+
+// MarshalText encodes the state by name, e.g. "live".
+func (s RoomState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Snapshot returns the client's current state: watched rooms with their
+// status, pause and capture state and session counters. It only loads a
+// prebuilt copy and takes no locks, so HTTP handlers and metrics scrapers
+// may call it as often as they like. The copy is rebuilt in the background
+// on every event and at least every second while subscribed.
+func (c *StreamClient) Snapshot() *ClientSnapshot {
+	if s := c.snap.Load(); s != nil {
+		return s
+	}
+	s := c.buildSnapshot()
+	c.snap.CompareAndSwap(nil, s)
+	return c.snap.Load()
+}
+
+// snapshotChanged asks the snapshot refresher to rebuild soon.
+func (c *StreamClient) snapshotChanged() {
+	select {
+	case c.snapDirty <- struct{}{}:
+	default:
+	}
+}
+
+// refreshSnapshots rebuilds the snapshot on changes and periodically until
+// ctx is done.
+func (c *StreamClient) refreshSnapshots(ctx context.Context) {
+	ticker := c.cfg.clock.NewTicker(snapshotRefresh)
+	defer ticker.Stop()
+	for {
+		c.snap.Store(c.buildSnapshot())
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.snapDirty:
+		case <-ticker.C():
+		}
+	}
+}
+
+// buildSnapshot collects the current state from the monitor and client.
+func (c *StreamClient) buildSnapshot() *ClientSnapshot {
+	s := &ClientSnapshot{At: c.cfg.clock.Now()}
+	m := c.monitor
+
+	m.mu.Lock()
+	s.Paused = m.paused
+	for id := range m.rooms {
+		st := m.states[id]
+		s.Rooms = append(s.Rooms, RoomSnapshot{
+			RoomID:    id,
+			UID:       m.uids[id],
+			Name:      m.roomCfgs[id].name,
+			State:     st.state,
+			Paused:    m.paused || m.pausedIDs[id],
+			SessionID: st.session,
+		})
+	}
+	m.mu.Unlock()
+	sort.Slice(s.Rooms, func(i, j int) bool { return s.Rooms[i].RoomID < s.Rooms[j].RoomID })
+
+	c.capturesMu.Lock()
+	for i := range s.Rooms {
+		r := &s.Rooms[i]
+		_, r.Capturing = c.captures[r.RoomID]
+		if session := c.sessions[r.RoomID]; session != nil {
+			r.Title = session.title
+			r.SessionStarted = session.startedAt
+			r.AudioBytes = session.bytes.Load()
+			r.AudioDuration = pcmDuration(r.AudioBytes, c.cfg.audioCfg)
+			r.CaptureRestarts = int(session.restarts.Load())
+		}
+	}
+	c.capturesMu.Unlock()
+
+	for i := range s.Rooms {
+		r := &s.Rooms[i]
+		if r.UID == 0 {
+			r.UID, _ = LookupUID(r.RoomID)
+		}
+		r.Muted = m.IsMuted(r.RoomID)
+		r.Labels = c.RoomPrefs(r.RoomID).Labels
+	}
+	return s
+}
@@ -0,0 +1,151 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// defaultStandbyWindow is the standby of the "warm_standby" pref action.
+	defaultStandbyWindow = 30 * time.Minute
+
+	// standbyPollInterval is how often a room in standby is polled. It is
+	// well under http.Transport's default 90s idle timeout, so the API
+	// connection stays open.
+	standbyPollInterval = 5 * time.Second
+
+	// standbyBudgetShare is how many rooms a room in standby counts as
+	// under WithPollBudget; it is polled that many times as often.
+	standbyBudgetShare = 4
+)
+
+// Standby puts a room in warm standby for d, for broadcasts expected to
+// start soon (e.g. from a known schedule) where the go-live to capture
+// latency matters. The room is resolved and its cookie checked right
+// away, so expired credentials surface as EventAuthExpired before the
+// broadcast, and it is then polled every 5 seconds, which detects going
+// live quickly and keeps a warm HTTP connection to the API. The polls go
+// through the monitor's usual polling: push connections and batch polls
+// (WithBatchPolling) still replace them, and under WithPollBudget the room
+// counts as four rooms and is polled four times as often as the others,
+// at most every 5 seconds. Standby ends
+// after d, when the room goes live, or when it is removed; calling
+// Standby again replaces it. Returns ErrNotSubscribed if Subscribe has not
+// been called.
+func (c *StreamClient) Standby(roomID int64, d time.Duration) error {
+	c.capturesMu.Lock()
+	ctx := c.ctx
+	if ctx == nil || ctx.Err() != nil {
+		c.capturesMu.Unlock()
+		return ErrNotSubscribed
+	}
+	if prev, ok := c.standby[roomID]; ok {
+		prev.cancel()
+	}
+	standbyCtx, cancel := context.WithCancel(ctx)
+	s := &standby{cancel: cancel, until: c.cfg.clock.Now().Add(d)}
+	c.standby[roomID] = s
+	c.capturesMu.Unlock()
+
+	go c.runStandby(standbyCtx, roomID, s, c.cfg.clock.After(d))
+	return nil
+}
+
+// standby is a room's warm standby.
+type standby struct {
+	cancel context.CancelFunc
+	until  time.Time
+}
+
+// runStandby prepares a room for going live and has the monitor poll it
+// faster until it is live, expired fires or ctx ends.
+func (c *StreamClient) runStandby(ctx context.Context, roomID int64, s *standby, expired <-chan time.Time) {
+	defer func() {
+		s.cancel()
+		c.capturesMu.Lock()
+		// A later Standby call may have replaced this one.
+		if c.standby[roomID] == s {
+			delete(c.standby, roomID)
+			c.monitor.unexpedite(roomID)
+		}
+		c.capturesMu.Unlock()
+	}()
+
+	log := c.monitor.roomLogger(roomID)
+	log.Info("client: warm standby", "until", s.until)
+	if err := c.prepareStandby(ctx, roomID); err != nil && ctx.Err() == nil {
+		log.Warn("client: warm standby preparation failed", "error", err)
+	}
+
+	c.monitor.expedite(roomID, s.until)
+	ticker := c.cfg.clock.NewTicker(standbyPollInterval)
+	defer ticker.Stop()
+	for {
+		if c.monitor.isLive(roomID) {
+			log.Info("client: warm standby ended, room is live")
+			return
+		}
+		if !c.monitor.watching(roomID) {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-expired:
+			log.Info("client: warm standby expired")
+			return
+		case <-ticker.C():
+		}
+	}
+}
+
+// prepareStandby resolves the room and, if a cookie is configured, checks
+// that it is logged in. Rejected credentials are reported by the room's
+// request context as EventAuthExpired.
+func (c *StreamClient) prepareStandby(ctx context.Context, roomID int64) error {
+	roomCtx := c.monitor.roomContext(ctx, roomID)
+	if _, err := GetRoomInfo(roomCtx, roomID); err != nil {
+		return err
+	}
+	opts, _ := RequestOptionsFromContext(roomCtx)
+	if opts.Cookie == "" {
+		return nil
+	}
+	info, err := GetLoginInfo(roomCtx)
+	if err != nil {
+		if errors.Is(err, ErrCredentialsExpired) {
+			return nil // reported as EventAuthExpired
+		}
+		return err
+	}
+	if !info.LoggedIn {
+		return fmt.Errorf("%w: cookie not logged in", ErrCredentialsExpired)
+	}
+	return nil
+}
+
+// WarmStandby returns an Action that puts the rooms in warm standby for d
+// (see StreamClient.Standby). Schedule it shortly before known broadcasts:
+//
+//	c.Schedule("50 19 * * 5", stream.WarmStandby(30*time.Minute), 21452505)
+func WarmStandby(d time.Duration) Action {
+	return func(ctx context.Context, c *StreamClient, roomIDs []int64) error {
+		var errs []error
+		for _, id := range roomIDs {
+			if err := c.Standby(id, d); err != nil {
+				errs = append(errs, fmt.Errorf("room %d: %w", id, err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// InStandby reports whether the room is in warm standby.
+func (c *StreamClient) InStandby(roomID int64) bool {
+	c.capturesMu.Lock()
+	defer c.capturesMu.Unlock()
+	_, ok := c.standby[roomID]
+	return ok
+}
@@ -0,0 +1,91 @@
+package stream
+
+import (
+	"slices"
+	"time"
+)
+
+// RoomState is a room's broadcast state as tracked by Monitor.
+//
+// Defined transitions:
+//
+//	Unknown  → Offline | Live | Rotating   (first successful check)
+//	Offline  → Live | Rotating
+//	Live     → Offline | Rotating
+//	Rotating → Live | Offline
+//
+// Every status Bilibili reports maps to one of the three known states, so
+// any change between them is defined; a room only returns to Unknown by
+// being removed from the Monitor.
+type RoomState int
+
+const (
+	StateUnknown  RoomState = iota // not yet checked
+	StateOffline                   // not broadcasting
+	StateLive                      // broadcasting live
+	StateRotating                  // 轮播: replaying recorded videos, not live
+)
+
+func (s RoomState) String() string {
+	switch s {
+	case StateOffline:
+		return "offline"
+	case StateLive:
+		return "live"
+	case StateRotating:
+		return "rotating"
+	}
+	return "unknown"
+}
+
+// roomStateFromLiveStatus maps the API live_status field to a RoomState.
+func roomStateFromLiveStatus(liveStatus int) RoomState {
+	switch liveStatus {
+	case 1:
+		return StateLive
+	case 2:
+		return StateRotating
+	}
+	return StateOffline
+}
+
+// transitions is the transition table of the room state machine.
+var transitions = map[RoomState][]RoomState{
+	StateUnknown:  {StateOffline, StateLive, StateRotating},
+	StateOffline:  {StateLive, StateRotating},
+	StateLive:     {StateOffline, StateRotating},
+	StateRotating: {StateLive, StateOffline},
+}
+
+// ValidTransition reports whether from → to is a defined transition of the
+// room state machine.
+func ValidTransition(from, to RoomState) bool {
+	return slices.Contains(transitions[from], to)
+}
+
+// StateTransition describes one change of a room's RoomState. Seq increases
+// by one with every transition of the room, also across RemoveRoom and
+// AddRoom, so consumers can detect gaps and order transitions without
+// relying on clocks.
+type StateTransition struct {
+	RoomID int64
+	From   RoomState
+	To     RoomState
+	Seq    uint64
+	At     time.Time
+	Source string // detection source: SourcePoll, SourceFeed or SourcePush
+
+	// SessionID is the live session the transition starts, ends or
+	// happens in; empty outside of live sessions.
+	SessionID string
+}
+
+// roomStateEntry is the current state of a room and its transition count.
+type roomStateEntry struct {
+	state   RoomState
+	seq     uint64
+	session string // live session ID while state is StateLive
+
+	changedAt time.Time // last live/not-live change
+	changedBy string    // source that reported it
+}
@@ -0,0 +1,84 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	masterInfoURL = "https://api.live.bilibili.com/live_user/v1/Master/info?uid=%d"
+
+	streamerCacheTTL = time.Hour
+)
+
+// GetStreamerInfo fetches the profile of the streamer with the given UID.
+func GetStreamerInfo(ctx context.Context, uid int64) (*StreamerInfo, error) {
+	apiResp, err := doGet(ctx, fmt.Sprintf(masterInfoURL, uid), "")
+	if err != nil {
+		return nil, fmt.Errorf("get streamer info: %w", err)
+	}
+
+	var data struct {
+		Info struct {
+			UID   int64  `json:"uid"`
+			Uname string `json:"uname"`
+			Face  string `json:"face"`
+		} `json:"info"`
+		FollowerNum int64 `json:"follower_num"`
+		RoomID      int64 `json:"room_id"`
+		RoomNews    struct {
+			Content string `json:"content"`
+		} `json:"room_news"`
+	}
+	if err := decodeData(apiResp, &data); err != nil {
+		return nil, fmt.Errorf("parse streamer info: %w", err)
+	}
+	idCache.store(data.Info.UID, data.RoomID)
+
+	return &StreamerInfo{
+		UID:       data.Info.UID,
+		Name:      data.Info.Uname,
+		Face:      data.Info.Face,
+		RoomID:    data.RoomID,
+		RoomNews:  data.RoomNews.Content,
+		Followers: data.FollowerNum,
+	}, nil
+}
+
+// streamerCache caches StreamerInfo by UID for streamerCacheTTL.
+type streamerCache struct {
+	clock   Clock
+	mu      sync.Mutex
+	entries map[int64]streamerCacheEntry
+}
+
+type streamerCacheEntry struct {
+	info    *StreamerInfo
+	fetched time.Time
+}
+
+func newStreamerCache(clock Clock) *streamerCache {
+	return &streamerCache{clock: clock, entries: make(map[int64]streamerCacheEntry)}
+}
+
+// get returns the cached profile for uid, fetching it if missing or stale.
+func (c *streamerCache) get(ctx context.Context, uid int64) (*StreamerInfo, error) {
+	c.mu.Lock()
+	e, ok := c.entries[uid]
+	c.mu.Unlock()
+	if ok && c.clock.Now().Sub(e.fetched) < streamerCacheTTL {
+		return e.info, nil
+	}
+
+	info, err := GetStreamerInfo(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[uid] = streamerCacheEntry{info: info, fetched: c.clock.Now()}
+	c.mu.Unlock()
+	return info, nil
+}
@@ -0,0 +1,84 @@
+package stream
+
+// chatEventBufSize is the per-subscriber queue for EventDanmaku and
+// EventChat. Busy rooms send hundreds of chat commands a minute, so it is
+// larger than the queue for all other events.
+const chatEventBufSize = 256
+
+// subscriber is one Subscribe channel. Chat events are queued apart from
+// all others, so a busy room's chat cannot crowd out lifecycle events such
+// as audio_ready: each queue drops only its own events when full, and
+// forward delivers lifecycle events first.
+type subscriber struct {
+	out    chan StreamEvent // returned by Subscribe
+	events chan StreamEvent // everything but chat
+	chat   chan StreamEvent // EventDanmaku and EventChat
+}
+
+func newSubscriber() *subscriber {
+	s := &subscriber{
+		out:    make(chan StreamEvent),
+		events: make(chan StreamEvent, streamEventBufSize),
+		chat:   make(chan StreamEvent, chatEventBufSize),
+	}
+	go s.forward()
+	return s
+}
+
+// isChatEvent reports whether ev is queued as chat.
+func isChatEvent(ev StreamEvent) bool {
+	return ev.Type == EventDanmaku || ev.Type == EventChat
+}
+
+// offer queues ev without blocking and reports whether it was queued.
+func (s *subscriber) offer(ev StreamEvent) bool {
+	q := s.events
+	if isChatEvent(ev) {
+		q = s.chat
+	}
+	select {
+	case q <- ev:
+		return true
+	default:
+		return false
+	}
+}
+
+// close stops accepting events. Queued events are still delivered before
+// out is closed.
+func (s *subscriber) close() {
+	close(s.events)
+	close(s.chat)
+}
+
+// forward moves queued events to out, lifecycle events before chat, until
+// both queues are closed and drained.
+func (s *subscriber) forward() {
+	defer close(s.out)
+	events, chat := s.events, s.chat
+	for events != nil || chat != nil {
+		var ev StreamEvent
+		var ok bool
+		select {
+		case ev, ok = <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+		default:
+			select {
+			case ev, ok = <-events:
+				if !ok {
+					events = nil
+					continue
+				}
+			case ev, ok = <-chat:
+				if !ok {
+					chat = nil
+					continue
+				}
+			}
+		}
+		s.out <- ev
+	}
+}
@@ -0,0 +1,185 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TranscodeConfig configures Transcode.
+type TranscodeConfig struct {
+	// InputFormat forces the input demuxer (-f), required for raw PCM
+	// segments, e.g. "s16le" together with SampleRate and Channels.
+	// Empty lets ffmpeg probe the input.
+	InputFormat string
+	SampleRate  int // raw PCM input sample rate
+	Channels    int // raw PCM input channel count
+
+	Format    string   // output muxer (-f); empty lets ffmpeg guess from the output path
+	Codec     string   // codec for all streams (-c), e.g. "libopus"; default "copy" (remux)
+	AudioOnly bool     // drop video (-vn)
+	Args      []string // extra output options placed before the output path
+
+	FFmpeg   string       // ffmpeg binary, a path or a name in PATH; default "ffmpeg"
+	LogLevel string       // ffmpeg -loglevel; default "error"
+	Logger   *slog.Logger // logger for transcode messages; default slog.Default()
+
+	// Progress, if set, is called as ffmpeg reports progress (about twice
+	// a second) and once more when it finishes.
+	Progress func(TranscodeProgress)
+}
+
+// TranscodeProgress reports how far a Transcode has got.
+type TranscodeProgress struct {
+	Processed time.Duration // media time written so far
+	Total     time.Duration // input duration; 0 if unknown (only known for raw PCM input)
+	Size      int64         // bytes written so far
+	Speed     float64       // processing speed relative to real time; 0 if unknown
+	Done      bool          // last report; ffmpeg has finished
+}
+
+// Transcode converts a completed segment or recording with ffmpeg, e.g. an
+// flv remuxed to mp4, or raw PCM from a capture encoded to opus:
+//
+//	err := stream.Transcode(ctx, "seg.pcm", "seg.opus", &stream.TranscodeConfig{
+//		InputFormat: "s16le", SampleRate: 16000, Channels: 1, Codec: "libopus",
+//	})
+//
+// It uses the same ffmpeg from PATH as CaptureAudio. out is overwritten if
+// it exists, and removed if the transcode fails or ctx is cancelled, so a
+// partial file is never left behind. A nil cfg remuxes in to out.
+func Transcode(ctx context.Context, in, out string, cfg *TranscodeConfig) error {
+	if cfg == nil {
+		cfg = &TranscodeConfig{}
+	}
+	if in == out {
+		return errors.New("transcode: input and output are the same file")
+	}
+	log := cfg.Logger
+	if log == nil {
+		log = slog.Default()
+	}
+
+	var total time.Duration
+	if cfg.InputFormat != "" && cfg.SampleRate > 0 && cfg.Channels > 0 {
+		if fi, err := os.Stat(in); err == nil {
+			total = pcmDuration(fi.Size(), CaptureConfig{
+				SampleRate: cfg.SampleRate,
+				Channels:   cfg.Channels,
+				Format:     cfg.InputFormat,
+			})
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, ffmpegBinary(cfg.FFmpeg), buildTranscodeArgs(in, out, cfg)...)
+	stderr := &ffmpegStderr{}
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("transcode: stdout pipe: %w", err)
+	}
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("transcode: ffmpeg start: %w", err)
+	}
+	readTranscodeProgress(stdout, total, cfg.Progress)
+
+	if err := cmd.Wait(); err != nil {
+		if rmErr := os.Remove(out); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) {
+			log.Warn("transcode: failed to remove partial output", "path", out, "error", rmErr)
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("transcode: %w", ctx.Err())
+		}
+		if tail := strings.TrimSpace(stderr.String()); tail != "" {
+			return fmt.Errorf("transcode: %w: %s", err, tail)
+		}
+		return fmt.Errorf("transcode: %w", err)
+	}
+	log.Info("transcode: done", "input", in, "output", out, "elapsed", time.Since(start))
+	return nil
+}
+
+// buildTranscodeArgs builds the ffmpeg argv for Transcode. Progress is
+// reported on stdout with -progress.
+func buildTranscodeArgs(in, out string, cfg *TranscodeConfig) []string {
+	loglevel := cfg.LogLevel
+	if loglevel == "" {
+		loglevel = "error"
+	}
+	args := []string{
+		"-hide_banner",
+		"-loglevel", loglevel,
+		"-nostats",
+		"-progress", "pipe:1",
+		"-y",
+	}
+	if cfg.InputFormat != "" {
+		args = append(args, "-f", cfg.InputFormat)
+		if cfg.SampleRate > 0 {
+			args = append(args, "-ar", strconv.Itoa(cfg.SampleRate))
+		}
+		if cfg.Channels > 0 {
+			args = append(args, "-ac", strconv.Itoa(cfg.Channels))
+		}
+	}
+	args = append(args, "-i", in)
+
+	if cfg.AudioOnly {
+		args = append(args, "-vn")
+	}
+	codec := cfg.Codec
+	if codec == "" {
+		codec = "copy"
+	}
+	args = append(args, "-c", codec)
+	if cfg.Format != "" {
+		args = append(args, "-f", cfg.Format)
+	}
+	args = append(args, cfg.Args...)
+	return append(args, out)
+}
+
+// readTranscodeProgress parses ffmpeg's -progress output (blocks of
+// key=value lines, each ending with a "progress" key) until r ends.
+func readTranscodeProgress(r io.Reader, total time.Duration, fn func(TranscodeProgress)) {
+	p := TranscodeProgress{Total: total}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		key, value, ok := strings.Cut(sc.Text(), "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "out_time_us":
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil && us >= 0 {
+				p.Processed = time.Duration(us) * time.Microsecond
+			}
+		case "total_size":
+			if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+				p.Size = n
+			}
+		case "speed":
+			if x, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64); err == nil {
+				p.Speed = x
+			}
+		case "progress":
+			p.Done = value == "end"
+			if fn != nil {
+				fn(p)
+			}
+		}
+	}
+	// Drain so ffmpeg never blocks on a full pipe.
+	io.Copy(io.Discard, r)
+}
@@ -0,0 +1,105 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const defaultUnderrunRatio = 0.5
+
+// ErrCaptureUnderrun is returned by the capture reader when ffmpeg
+// delivered too little audio for the configured format and
+// CaptureConfig.RestartOnUnderrun is set.
+var ErrCaptureUnderrun = errors.New("capture underrun")
+
+// CaptureUnderrun describes a capture delivering less audio than its format
+// requires, e.g. a stream that keeps stalling or a CDN connection that stays
+// open while sending almost nothing.
+type CaptureUnderrun struct {
+	Expected  float64       `json:"expected"`  // bytes per second the format requires
+	Actual    float64       `json:"actual"`    // bytes per second delivered over Window
+	Window    time.Duration `json:"window"`    // CaptureConfig.UnderrunWindow
+	Restarted bool          `json:"restarted"` // the capture was stopped to be restarted
+}
+
+// Err returns the underrun as an error wrapping ErrCaptureUnderrun.
+func (u CaptureUnderrun) Err() error {
+	return fmt.Errorf("%w: %.0f of %.0f bytes/s over %s", ErrCaptureUnderrun, u.Actual, u.Expected, u.Window)
+}
+
+// rateCheckpoint is the byte count of a capture at a point in time.
+type rateCheckpoint struct {
+	at    time.Time
+	total int64
+}
+
+// underrunWatch measures the delivery rate of a capture over a sliding
+// window and compares it with the rate its format requires. It is only
+// touched by Read.
+type underrunWatch struct {
+	expected float64 // bytes per second
+	window   time.Duration
+	ratio    float64
+
+	total       int64
+	checkpoints []rateCheckpoint // oldest first; the first is at least window old once full
+	flagged     bool             // in an underrun episode
+}
+
+// newUnderrunWatch returns the watch for cfg, or nil if the watchdog is
+// disabled or the expected rate is unknown (e.g. ADTS output).
+func newUnderrunWatch(cfg *CaptureConfig) *underrunWatch {
+	if cfg.UnderrunWindow <= 0 {
+		return nil
+	}
+	bps := sampleSize(cfg.Format) * cfg.SampleRate * cfg.Channels
+	if bps <= 0 {
+		return nil
+	}
+	ratio := cfg.UnderrunRatio
+	if ratio <= 0 {
+		ratio = defaultUnderrunRatio
+	}
+	return &underrunWatch{expected: float64(bps), window: cfg.UnderrunWindow, ratio: ratio}
+}
+
+// observe records n bytes read at now. It returns the underrun and true
+// when the rate over the last window first falls below the threshold; the
+// watch then reports nothing until the rate has recovered.
+func (w *underrunWatch) observe(now time.Time, n int) (CaptureUnderrun, bool) {
+	w.total += int64(n)
+	if len(w.checkpoints) == 0 {
+		// The window starts with the first byte, so ffmpeg's startup does
+		// not count as an underrun.
+		if n > 0 {
+			w.checkpoints = append(w.checkpoints, rateCheckpoint{now, w.total})
+		}
+		return CaptureUnderrun{}, false
+	}
+
+	// Keep a checkpoint about every tenth of a window.
+	if last := w.checkpoints[len(w.checkpoints)-1]; now.Sub(last.at) >= w.window/10 {
+		w.checkpoints = append(w.checkpoints, rateCheckpoint{now, w.total})
+	}
+	// Drop checkpoints that are no longer needed as the window's start.
+	for len(w.checkpoints) > 1 && now.Sub(w.checkpoints[1].at) >= w.window {
+		w.checkpoints = w.checkpoints[1:]
+	}
+	base := w.checkpoints[0]
+	elapsed := now.Sub(base.at)
+	if elapsed < w.window {
+		return CaptureUnderrun{}, false
+	}
+
+	actual := float64(w.total-base.total) / elapsed.Seconds()
+	if actual >= w.ratio*w.expected {
+		w.flagged = false
+		return CaptureUnderrun{}, false
+	}
+	if w.flagged {
+		return CaptureUnderrun{}, false
+	}
+	w.flagged = true
+	return CaptureUnderrun{Expected: w.expected, Actual: actual, Window: w.window}, true
+}
@@ -0,0 +1,204 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Containers for VideoConfig.Container.
+const (
+	VideoFMP4     = "mp4"      // fragmented MP4, playable while it is written
+	VideoMPEGTS   = "mpegts"   // MPEG transport stream
+	VideoMatroska = "matroska" // Matroska (MKV)
+	VideoFLV      = "flv"      // FLV, as delivered by the CDN
+)
+
+// VideoNoAudio as VideoConfig.AudioCodec drops the audio track.
+const VideoNoAudio = "none"
+
+// VideoConfig controls ffmpeg video capture (CaptureVideo, WithVideoConfig).
+// The zero value remuxes the stream's video and audio without transcoding
+// into fragmented MP4.
+//
+// A thumbnail extractor can instead decode one JPEG every ten seconds:
+//
+//	stream.VideoConfig{
+//		Container:  "image2pipe",
+//		VideoCodec: "mjpeg",
+//		AudioCodec: stream.VideoNoAudio,
+//		Args:       []string{"-vf", "fps=1/10"},
+//	}
+type VideoConfig struct {
+	Container  string   // ffmpeg muxer (-f); default VideoFMP4
+	VideoCodec string   // default "copy"
+	AudioCodec string   // default "copy"; VideoNoAudio drops audio
+	Args       []string // extra output options, e.g. filters or bitrates
+
+	// CaptureConfig provides the process settings: the ffmpeg binary,
+	// logging, timeouts, the URL probe, StreamPTS piping and Isolation.
+	// Its audio format fields, Outputs and the underrun watchdog do not
+	// apply.
+	CaptureConfig
+}
+
+// VideoStream represents an active video capture from a live stream.
+// Reader delivers the stream in Container as described by the codec
+// fields. Call Cancel to stop the ffmpeg process and release resources.
+type VideoStream struct {
+	RoomID int64
+	Reader io.ReadCloser
+	Cancel context.CancelFunc
+
+	Container  string // ffmpeg muxer name, e.g. VideoFMP4
+	VideoCodec string // ffmpeg codec name, or "copy"
+	AudioCodec string // ffmpeg codec name, "copy" or VideoNoAudio
+}
+
+// SetReadDeadline sets the deadline for Reads of Reader; see
+// AudioStream.SetReadDeadline.
+func (v *VideoStream) SetReadDeadline(t time.Time) error {
+	return setReadDeadline(v.Reader, t)
+}
+
+// ReadContext reads from Reader, returning ctx's error once ctx is done;
+// see AudioStream.ReadContext.
+func (v *VideoStream) ReadContext(ctx context.Context, p []byte) (int, error) {
+	return readContext(ctx, v.Reader, p)
+}
+
+// withDefaults returns cfg with empty fields set to their defaults.
+func (cfg VideoConfig) withDefaults() VideoConfig {
+	if cfg.Container == "" {
+		cfg.Container = VideoFMP4
+	}
+	if cfg.VideoCodec == "" {
+		cfg.VideoCodec = "copy"
+	}
+	if cfg.AudioCodec == "" {
+		cfg.AudioCodec = "copy"
+	}
+	return cfg
+}
+
+// CaptureVideo starts an ffmpeg process that reads from streamURL and
+// writes its video to the returned ReadCloser in cfg.Container, by default
+// remuxed without transcoding to fragmented MP4. A nil cfg uses the zero
+// VideoConfig. The caller must close the reader or cancel the context to
+// stop ffmpeg.
+//
+// The stream is fetched as in CaptureAudio, including RequestOptions
+// attached to ctx, and the reader has the same ReadContext and
+// SetReadDeadline methods.
+//
+// ffmpeg must be installed and available in the system PATH, unless
+// cfg.FFmpeg names another binary, e.g. a build with hardware encoders.
+func CaptureVideo(ctx context.Context, streamURL string, cfg *VideoConfig) (io.ReadCloser, error) {
+	var vc VideoConfig
+	if cfg != nil {
+		vc = *cfg
+	}
+	vc = vc.withDefaults()
+	capCfg := vc.CaptureConfig
+	capCfg.Outputs = nil
+	capCfg.UnderrunWindow = 0
+
+	opts, _ := RequestOptionsFromContext(ctx)
+	args, err := buildVideoArgs(streamURL, &vc, &capCfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	r, err := startFFmpeg(ctx, streamURL, &capCfg, opts, args)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// BuildVideoArgs returns the ffmpeg argument list (excluding the binary
+// name) that CaptureVideo runs for streamURL and cfg.
+func BuildVideoArgs(streamURL string, cfg *VideoConfig) []string {
+	var vc VideoConfig
+	if cfg != nil {
+		vc = *cfg
+	}
+	vc = vc.withDefaults()
+	args, _ := buildVideoArgs(streamURL, &vc, &vc.CaptureConfig, RequestOptions{})
+	return args
+}
+
+// buildVideoArgs builds the video capture argv. vc must have its defaults
+// applied.
+func buildVideoArgs(streamURL string, vc *VideoConfig, capCfg *CaptureConfig, opts RequestOptions) ([]string, error) {
+	args, err := ffmpegInputArgs(streamURL, capCfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, "-map", "0:v:0", "-c:v", vc.VideoCodec)
+	if vc.AudioCodec == VideoNoAudio {
+		args = append(args, "-an")
+	} else {
+		// The trailing '?' keeps video-only streams working.
+		args = append(args, "-map", "0:a:0?", "-c:a", vc.AudioCodec)
+	}
+	args = append(args, vc.Args...)
+	if vc.Container == VideoFMP4 {
+		// A plain MP4 needs a seekable output for its index; fragments
+		// can be written to a pipe and played as they arrive.
+		args = append(args, "-movflags", "frag_keyframe+empty_moov+default_base_moof")
+	}
+	return append(args, "-f", vc.Container, "pipe:1"), nil
+}
+
+// startVideo starts the client's video capture (WithVideoConfig) next to
+// an audio capture of the same stream URL and emits EventVideoReady. It
+// replaces the room's previous video capture and stops with ctx, the audio
+// capture's context, so it follows the audio capture's restarts and
+// resumes.
+func (c *StreamClient) startVideo(ctx context.Context, roomID int64, streamURL, title string) {
+	if c.cfg.videoCfg == nil {
+		return
+	}
+	vc := c.cfg.videoCfg.withDefaults()
+	vc.clock = c.cfg.clock
+	if vc.Logger == nil {
+		vc.Logger = c.monitor.roomLogger(roomID)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	c.capturesMu.Lock()
+	if prev, ok := c.videoCancel[roomID]; ok {
+		prev()
+	}
+	c.videoCancel[roomID] = cancel
+	c.capturesMu.Unlock()
+	reader, err := CaptureVideo(ctx, streamURL, &vc)
+	if err != nil {
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		c.monitor.roomLogger(roomID).Warn("client: failed to start video capture", "error", err)
+		c.publishStreamEvent(StreamEvent{
+			RoomID: roomID,
+			Type:   EventError,
+			Error:  fmt.Errorf("video: %w: %w", ErrCaptureStartFailed, err),
+			Title:  title,
+		})
+		return
+	}
+	c.monitor.roomLogger(roomID).Info("client: video capture started", "container", vc.Container)
+	c.publishStreamEvent(StreamEvent{
+		RoomID: roomID,
+		Type:   EventVideoReady,
+		Title:  title,
+		Video: &VideoStream{
+			RoomID:     roomID,
+			Reader:     reader,
+			Cancel:     cancel,
+			Container:  vc.Container,
+			VideoCodec: vc.VideoCodec,
+			AudioCodec: vc.AudioCodec,
+		},
+	})
+}
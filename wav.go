@@ -0,0 +1,302 @@
+package stream
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// wavHeaderSize is the size of the canonical 44-byte RIFF/WAVE header.
+const wavHeaderSize = 44
+
+// WAV format tags.
+const (
+	wavFormatPCM   = 1
+	wavFormatFloat = 3
+)
+
+// WAVSegment describes a finished file of a WAVRotator.
+type WAVSegment struct {
+	Path     string
+	Index    int           // segment number, starting at 1
+	Frames   int64         // sample frames in the file
+	Duration time.Duration // Frames at the sample rate
+	Start    time.Time     // wall-clock time the first frame was written
+	End      time.Time     // wall-clock time the file was finished
+	PTS      *PTSRange     // stream timeline covered; nil without WithWAVStreamPTS
+}
+
+// wavConfig holds internal configuration for WAVRotator.
+type wavConfig struct {
+	onSegment func(WAVSegment)
+	manifest  *SessionManifest
+	pts       time.Duration
+	hasPTS    bool
+}
+
+// WAVOption configures a WAVRotator.
+type WAVOption func(*wavConfig)
+
+// WithWAVOnSegment calls fn each time a file is finished, on rotation and
+// on Close.
+func WithWAVOnSegment(fn func(WAVSegment)) WAVOption {
+	return func(c *wavConfig) {
+		c.onSegment = fn
+	}
+}
+
+// WithWAVManifest adds every finished file, with its size and SHA-256, to
+// m. The manifest should live in the rotator's directory.
+func WithWAVManifest(m *SessionManifest) WAVOption {
+	return func(c *wavConfig) {
+		c.manifest = m
+	}
+}
+
+// WithWAVStreamPTS places the files on the stream timeline: base is the
+// stream timestamp of the first frame written (AudioStream.StreamPTS).
+// Each WAVSegment then carries its PTS range, and templates can use
+// {pts}.
+func WithWAVStreamPTS(base time.Duration) WAVOption {
+	return func(c *wavConfig) {
+		c.pts, c.hasPTS = base, true
+	}
+}
+
+// WAVRotator writes raw PCM from a capture into a series of WAV files of
+// exactly the same length. Rotation is counted in samples, not wall-clock
+// time: a write spanning a boundary is split, with the remainder starting
+// the next file, so the files concatenate without gaps and each holds
+// exactly the configured duration (except the last).
+//
+// For FLAC or other codecs, convert the finished files with Transcode.
+type WAVRotator struct {
+	dir   string
+	tmpl  *FilenameTemplate
+	vars  FilenameVars
+	cfg   wavConfig
+	every int64 // frames per file
+
+	sampleRate int
+	channels   int
+	frameSize  int
+	format     uint16
+	bits       uint16
+
+	f      *os.File
+	path   string
+	start  time.Time // when the current file was opened
+	frames int64     // frames in the current file
+	total  int64     // frames in finished files
+	carry  []byte    // incomplete frame from the previous write
+	index  int
+}
+
+// NewWAVRotator creates a WAVRotator writing to dir, naming each file with
+// tmpl rendered for vars and the segment number, e.g. a template of
+// "{room_id}_{start_time}_{segment}.wav". An existing file is never
+// overwritten; the new one gets a "_2" suffix instead, as with Recorder. audio is the format of the PCM
+// written to it (e.g. a capture's CaptureConfig); only little-endian
+// formats that WAV can hold are accepted. every must be a whole number of
+// sample frames.
+func NewWAVRotator(dir string, tmpl *FilenameTemplate, vars FilenameVars, audio CaptureConfig, every time.Duration, opts ...WAVOption) (*WAVRotator, error) {
+	w := &WAVRotator{
+		dir:        dir,
+		tmpl:       tmpl,
+		vars:       vars,
+		sampleRate: audio.SampleRate,
+		channels:   audio.Channels,
+	}
+	for _, o := range opts {
+		o(&w.cfg)
+	}
+
+	switch audio.Format {
+	case "u8", "s16le", "s24le", "s32le":
+		w.format = wavFormatPCM
+	case "f32le", "f64le":
+		w.format = wavFormatFloat
+	default:
+		return nil, fmt.Errorf("wav: unsupported sample format %q", audio.Format)
+	}
+	if w.sampleRate <= 0 || w.channels <= 0 {
+		return nil, fmt.Errorf("wav: invalid sample rate %d or channels %d", w.sampleRate, w.channels)
+	}
+	size := sampleSize(audio.Format)
+	w.bits = uint16(size * 8)
+	w.frameSize = size * w.channels
+
+	frames := int64(every) * int64(w.sampleRate)
+	if every <= 0 || frames%int64(time.Second) != 0 {
+		return nil, fmt.Errorf("wav: %s is not a whole number of frames at %d Hz", every, w.sampleRate)
+	}
+	w.every = frames / int64(time.Second)
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("wav: create dir: %w", err)
+	}
+	return w, nil
+}
+
+// Write appends PCM data, rotating files at frame boundaries. Data need
+// not be frame-aligned; an incomplete trailing frame is held for the next
+// write.
+func (w *WAVRotator) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(w.carry) > 0 {
+		need := w.frameSize - len(w.carry)
+		if len(p) < need {
+			w.carry = append(w.carry, p...)
+			return n, nil
+		}
+		w.carry = append(w.carry, p[:need]...)
+		p = p[need:]
+		if err := w.writeFrames(w.carry); err != nil {
+			return 0, err
+		}
+		w.carry = w.carry[:0]
+	}
+
+	whole := len(p) - len(p)%w.frameSize
+	if err := w.writeFrames(p[:whole]); err != nil {
+		return 0, err
+	}
+	w.carry = append(w.carry, p[whole:]...)
+	return n, nil
+}
+
+// writeFrames writes frame-aligned data, splitting it across files.
+func (w *WAVRotator) writeFrames(p []byte) error {
+	for len(p) > 0 {
+		if w.f == nil {
+			if err := w.open(); err != nil {
+				return err
+			}
+		}
+		room := (w.every - w.frames) * int64(w.frameSize)
+		chunk := p
+		if int64(len(chunk)) > room {
+			chunk = chunk[:room]
+		}
+		if _, err := w.f.Write(chunk); err != nil {
+			return fmt.Errorf("wav: write: %w", err)
+		}
+		w.frames += int64(len(chunk) / w.frameSize)
+		p = p[len(chunk):]
+
+		if w.frames == w.every {
+			if err := w.finish(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// open starts the next file with a placeholder header.
+func (w *WAVRotator) open() error {
+	w.index++
+	vars := w.vars
+	vars.Segment = w.index
+	if w.cfg.hasPTS {
+		vars.PTS = w.ptsAt(w.total)
+	}
+	path, f, err := createUnique(filepath.Join(w.dir, w.tmpl.Render(vars)))
+	if err != nil {
+		return fmt.Errorf("wav: create file: %w", err)
+	}
+	if _, err := f.Write(w.header(0)); err != nil {
+		f.Close()
+		return fmt.Errorf("wav: write header: %w", err)
+	}
+	w.f, w.path, w.frames, w.start = f, path, 0, time.Now()
+	return nil
+}
+
+// finish writes the final header of the current file and closes it.
+func (w *WAVRotator) finish() error {
+	f, seg := w.f, WAVSegment{
+		Path:     w.path,
+		Index:    w.index,
+		Frames:   w.frames,
+		Duration: time.Duration(w.frames) * time.Second / time.Duration(w.sampleRate),
+		Start:    w.start,
+	}
+	if w.cfg.hasPTS {
+		seg.PTS = &PTSRange{Start: w.ptsAt(w.total), End: w.ptsAt(w.total + w.frames)}
+	}
+	w.total += w.frames
+	w.f = nil
+
+	_, err := f.WriteAt(w.header(w.frames*int64(w.frameSize)), 0)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("wav: finish %s: %w", seg.Path, err)
+	}
+	seg.End = time.Now()
+	if m := w.cfg.manifest; m != nil {
+		err := m.addSegment(seg.Path, ManifestSegment{
+			Index:    seg.Index,
+			Start:    seg.Start,
+			End:      seg.End,
+			Duration: seg.Duration,
+			PTS:      seg.PTS,
+		})
+		if err != nil {
+			return fmt.Errorf("wav: %w", err)
+		}
+	}
+	if w.cfg.onSegment != nil {
+		w.cfg.onSegment(seg)
+	}
+	return nil
+}
+
+// ptsAt returns the stream timestamp of the frame at position frames.
+func (w *WAVRotator) ptsAt(frames int64) time.Duration {
+	return w.cfg.pts + time.Duration(frames)*time.Second/time.Duration(w.sampleRate)
+}
+
+// header returns the RIFF/WAVE header for dataSize bytes of samples.
+func (w *WAVRotator) header(dataSize int64) []byte {
+	h := make([]byte, 0, wavHeaderSize)
+	h = append(h, "RIFF"...)
+	h = binary.LittleEndian.AppendUint32(h, uint32(36+dataSize))
+	h = append(h, "WAVEfmt "...)
+	h = binary.LittleEndian.AppendUint32(h, 16)
+	h = binary.LittleEndian.AppendUint16(h, w.format)
+	h = binary.LittleEndian.AppendUint16(h, uint16(w.channels))
+	h = binary.LittleEndian.AppendUint32(h, uint32(w.sampleRate))
+	h = binary.LittleEndian.AppendUint32(h, uint32(w.sampleRate*w.frameSize))
+	h = binary.LittleEndian.AppendUint16(h, uint16(w.frameSize))
+	h = binary.LittleEndian.AppendUint16(h, w.bits)
+	h = append(h, "data"...)
+	h = binary.LittleEndian.AppendUint32(h, uint32(dataSize))
+	return h
+}
+
+// Close finishes the current file. An incomplete trailing frame is
+// discarded.
+func (w *WAVRotator) Close() error {
+	w.carry = w.carry[:0]
+	if w.f == nil {
+		return nil
+	}
+	if w.frames == 0 {
+		// The first write to this file failed.
+		path := w.path
+		w.f.Close()
+		w.f = nil
+		w.index--
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("wav: remove empty file: %w", err)
+		}
+		return nil
+	}
+	return w.finish()
+}
@@ -0,0 +1,192 @@
+package stream
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// wbiKeyTTL is how long WBI keys are cached. Bilibili rotates them
+	// daily; a risk control rejection of a signed request refetches them
+	// early.
+	wbiKeyTTL = time.Hour
+
+	// wbiRetryDelay is how long a failed key fetch is not repeated, during
+	// which requests are sent unsigned.
+	wbiRetryDelay = time.Minute
+)
+
+// mixinKeyEncTab is the permutation of img_key+sub_key whose first 32
+// characters form the mixin key.
+var mixinKeyEncTab = [...]int{
+	46, 47, 18, 2, 53, 8, 23, 32, 15, 50, 10, 31, 58, 3, 45, 35,
+	27, 43, 5, 49, 33, 9, 42, 19, 29, 28, 14, 39, 12, 38, 41, 13,
+	37, 48, 7, 16, 24, 55, 40, 61, 26, 17, 0, 1, 60, 51, 30, 4,
+	22, 25, 54, 21, 56, 59, 6, 63, 57, 62, 11, 36, 20, 34, 44, 52,
+}
+
+// wbiEndpoints are the paths that require WBI signing besides those with a
+// /wbi/ segment.
+var wbiEndpoints = map[string]bool{
+	"/xlive/web-room/v1/index/getDanmuInfo": true,
+}
+
+// needsWBI reports whether requests to u must be WBI-signed.
+func needsWBI(u *url.URL) bool {
+	return strings.Contains(u.Path, "/wbi/") || wbiEndpoints[u.Path]
+}
+
+// wbiCache holds an APIClient's mixin key.
+type wbiCache struct {
+	mu       sync.Mutex
+	key      string
+	fetched  time.Time
+	failed   time.Time
+	fetching chan struct{} // closed when the key fetch in flight ends; nil if none
+}
+
+// invalidate makes the next signed request refetch the keys.
+func (w *wbiCache) invalidate() {
+	w.mu.Lock()
+	w.key = ""
+	w.mu.Unlock()
+}
+
+// signWBI returns rawURL WBI-signed if its endpoint requires it, and
+// whether it was signed. If the keys cannot be fetched the request is sent
+// unsigned; Bilibili may then reject it with -352.
+func (c *APIClient) signWBI(ctx context.Context, rawURL string, opts RequestOptions) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || !needsWBI(u) {
+		return rawURL, false
+	}
+	key, err := c.mixinKey(ctx, opts)
+	if err != nil {
+		slog.Warn("api: WBI signing failed, sending unsigned", "url", u.Path, "error", err)
+		return rawURL, false
+	}
+	u.RawQuery = signWBIQuery(u.Query(), key, c.cfg.clock.Now().Unix())
+	return u.String(), true
+}
+
+// mixinKey returns the cached mixin key, fetching the WBI keys if they are
+// missing or stale. Concurrent callers share one fetch, made without
+// holding the cache's lock.
+func (c *APIClient) mixinKey(ctx context.Context, opts RequestOptions) (string, error) {
+	w := &c.wbi
+	for {
+		w.mu.Lock()
+		now := c.cfg.clock.Now()
+		if w.key != "" && now.Sub(w.fetched) < wbiKeyTTL {
+			key := w.key
+			w.mu.Unlock()
+			return key, nil
+		}
+		if now.Sub(w.failed) < wbiRetryDelay {
+			w.mu.Unlock()
+			return "", errors.New("WBI keys unavailable")
+		}
+		if wait := w.fetching; wait != nil {
+			w.mu.Unlock()
+			select {
+			case <-wait:
+				continue
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+		}
+		done := make(chan struct{})
+		w.fetching = done
+		w.mu.Unlock()
+
+		key, err := c.fetchMixinKey(ctx, opts)
+		w.mu.Lock()
+		w.fetching = nil
+		switch {
+		case err == nil:
+			w.key, w.fetched = key, c.cfg.clock.Now()
+		case ctx.Err() == nil:
+			// A cancelled caller leaves the fetch to the next one.
+			w.failed = c.cfg.clock.Now()
+		}
+		w.mu.Unlock()
+		close(done)
+		return key, err
+	}
+}
+
+// fetchMixinKey fetches the WBI keys from nav and derives the mixin key.
+// nav reports them logged out too, so no cookie is sent.
+func (c *APIClient) fetchMixinKey(ctx context.Context, opts RequestOptions) (string, error) {
+	apiResp, err := c.paced(ctx, func() (*apiResponse, error) {
+		return c.getOnce(ctx, navURL, "", opts)
+	})
+	var apiErr *APIError
+	if err != nil && !(errors.As(err, &apiErr) && apiErr.Code == codeNotLoggedIn) {
+		return "", fmt.Errorf("get WBI keys: %w", err)
+	}
+	var data struct {
+		WbiImg struct {
+			ImgURL string `json:"img_url"`
+			SubURL string `json:"sub_url"`
+		} `json:"wbi_img"`
+	}
+	if err := decodeData(apiResp, &data); err != nil {
+		return "", fmt.Errorf("parse WBI keys: %w", err)
+	}
+	imgKey, subKey := wbiKeyFromURL(data.WbiImg.ImgURL), wbiKeyFromURL(data.WbiImg.SubURL)
+	if len(imgKey)+len(subKey) < len(mixinKeyEncTab) {
+		return "", fmt.Errorf("parse WBI keys: unexpected img_url %q, sub_url %q", data.WbiImg.ImgURL, data.WbiImg.SubURL)
+	}
+	return mixinKey(imgKey + subKey), nil
+}
+
+// wbiKeyFromURL returns the file name stem of a wbi_img URL, which is the
+// key.
+func wbiKeyFromURL(u string) string {
+	base := path.Base(u)
+	return strings.TrimSuffix(base, path.Ext(base))
+}
+
+// mixinKey derives the mixin key from img_key+sub_key.
+func mixinKey(raw string) string {
+	var b strings.Builder
+	for _, i := range mixinKeyEncTab[:32] {
+		b.WriteByte(raw[i])
+	}
+	return b.String()
+}
+
+// signWBIQuery returns query with wts set to ts and w_rid, the MD5 of the
+// sorted, filtered query followed by the mixin key, appended.
+func signWBIQuery(query url.Values, mixinKey string, ts int64) string {
+	params := make(url.Values, len(query)+1)
+	for k, vs := range query {
+		if k == "w_rid" {
+			continue
+		}
+		for _, v := range vs {
+			params.Add(k, strings.Map(func(r rune) rune {
+				if strings.ContainsRune("!'()*", r) {
+					return -1
+				}
+				return r
+			}, v))
+		}
+	}
+	params.Set("wts", strconv.FormatInt(ts, 10))
+	// Encode sorts by key; Bilibili expects spaces as %20.
+	encoded := strings.ReplaceAll(params.Encode(), "+", "%20")
+	sum := md5.Sum([]byte(encoded + mixinKey))
+	return encoded + "&w_rid=" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,154 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	workDirLockFile      = ".lock"
+	workDirSessionPrefix = "session-"
+)
+
+// ErrWorkDirLocked is returned by OpenWorkDir when another process (or
+// another WorkDir in this process) already uses the directory.
+var ErrWorkDirLocked = errors.New("workdir: directory in use by another process")
+
+// WorkDir manages a root directory for file-backed features (DVR segments,
+// ring files, per-session scratch files). It holds an exclusive lock on the
+// root for its lifetime, so two processes never share one directory, and
+// gives every live session its own directory that is removed when the
+// session ends.
+//
+// Session directories left behind by a crashed process are removed when
+// the root is next opened: holding the lock proves their owner is gone.
+type WorkDir struct {
+	root   string
+	unlock func() error
+
+	mu       sync.Mutex
+	sessions map[string]bool // open session directories
+	closed   bool
+}
+
+// OpenWorkDir creates root if needed, locks it and removes stale session
+// directories from a previous run. Call Close to release it.
+func OpenWorkDir(root string) (*WorkDir, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("workdir: create root: %w", err)
+	}
+	unlock, err := lockDir(filepath.Join(root, workDirLockFile))
+	if err != nil {
+		return nil, err
+	}
+
+	w := &WorkDir{root: root, unlock: unlock, sessions: make(map[string]bool)}
+	if err := w.recover(); err != nil {
+		unlock()
+		return nil, err
+	}
+	return w, nil
+}
+
+// recover removes session directories left by a previous owner.
+func (w *WorkDir) recover() error {
+	entries, err := os.ReadDir(w.root)
+	if err != nil {
+		return fmt.Errorf("workdir: read root: %w", err)
+	}
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), workDirSessionPrefix) {
+			continue
+		}
+		path := filepath.Join(w.root, e.Name())
+		if err := os.RemoveAll(path); err != nil {
+			slog.Warn("workdir: failed to remove stale session", "path", path, "error", err)
+			continue
+		}
+		slog.Info("workdir: removed stale session", "path", path)
+	}
+	return nil
+}
+
+// Root returns the root directory.
+func (w *WorkDir) Root() string {
+	return w.root
+}
+
+// Dir returns the persistent subdirectory name of the root, creating it if
+// needed, e.g. for NewDVR(w.Dir("dvr")). Unlike session directories it is
+// kept across sessions and restarts.
+func (w *WorkDir) Dir(name string) (string, error) {
+	if name == "" || name == workDirLockFile || strings.HasPrefix(name, workDirSessionPrefix) ||
+		filepath.Base(name) != name {
+		return "", fmt.Errorf("workdir: invalid directory name %q", name)
+	}
+	path := filepath.Join(w.root, name)
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return "", fmt.Errorf("workdir: create dir: %w", err)
+	}
+	return path, nil
+}
+
+// NewSession creates an empty directory for one live session of a room.
+// Remove it with EndSession; Close removes all remaining ones.
+func (w *WorkDir) NewSession(roomID int64) (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return "", errors.New("workdir: closed")
+	}
+
+	name := workDirSessionPrefix + strconv.FormatInt(roomID, 10) + "-" +
+		strconv.FormatInt(time.Now().UnixNano(), 10)
+	path := filepath.Join(w.root, name)
+	if err := os.Mkdir(path, 0o755); err != nil {
+		return "", fmt.Errorf("workdir: create session: %w", err)
+	}
+	w.sessions[path] = true
+	return path, nil
+}
+
+// EndSession removes a directory created by NewSession and everything in it.
+func (w *WorkDir) EndSession(path string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.sessions[path] {
+		return fmt.Errorf("workdir: unknown session %q", path)
+	}
+	delete(w.sessions, path)
+	if err := os.RemoveAll(path); err != nil {
+		return fmt.Errorf("workdir: remove session: %w", err)
+	}
+	return nil
+}
+
+// Close removes all open session directories and releases the lock.
+// Persistent directories are kept.
+func (w *WorkDir) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	var errs []error
+	for path := range w.sessions {
+		if err := os.RemoveAll(path); err != nil {
+			errs = append(errs, fmt.Errorf("workdir: remove session: %w", err))
+		}
+	}
+	w.sessions = nil
+	if err := w.unlock(); err != nil {
+		errs = append(errs, fmt.Errorf("workdir: unlock: %w", err))
+	}
+	return errors.Join(errs...)
+}
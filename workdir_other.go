@@ -0,0 +1,26 @@
+//go:build !unix
+
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// lockDir creates the file at path exclusively. Unlike the unix lock it
+// survives a crash: remove the file by hand if its owner is gone.
+func lockDir(path string) (func() error, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return nil, ErrWorkDirLocked
+		}
+		return nil, fmt.Errorf("workdir: create lock: %w", err)
+	}
+	fmt.Fprintf(f, "%d\n", os.Getpid())
+	f.Close()
+	return func() error {
+		return os.Remove(path)
+	}, nil
+}